@@ -0,0 +1,83 @@
+package confer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+const (
+	// Prefix for base64 encoded strings, for formats such as JSON that lack
+	// a native binary type.
+	base64Prefix = "base64:"
+
+	// Prefix for references to files whose contents should be returned,
+	// e.g. `tls.key: "@file:certs/server.key"`. Relative paths are resolved
+	// against the directory of the file that contained the reference.
+	fileRefPrefix = "@file:"
+)
+
+// Returns the raw bytes at key, or nil if the key is unset or can't be
+// decoded. See GetBytesE.
+func (manager *Config) GetBytes(key string) []byte {
+	b, _ := manager.GetBytesE(key)
+	return b
+}
+
+// Returns the raw bytes at key. Supports:
+//
+//	key: !!binary aGVsbG8=          # YAML binary values
+//	"key": "base64:aGVsbG8="        # base64 tagged strings
+//	key: "@file:certs/server.pem"   # the contents of a file
+//
+// Any other string is returned as is.
+func (manager *Config) GetBytesE(key string) ([]byte, error) {
+	val := manager.Get(key)
+
+	switch v := val.(type) {
+	case nil:
+		return nil, fmt.Errorf("%q is not set", key)
+	case []byte:
+		return v, nil
+	case string:
+		switch {
+		case strings.HasPrefix(v, base64Prefix):
+			b, err := base64.StdEncoding.DecodeString(v[len(base64Prefix):])
+			if err != nil {
+				return nil, fmt.Errorf("Unable to decode %q as base64: %v", key, err)
+			}
+			return b, nil
+		case strings.HasPrefix(v, fileRefPrefix):
+			b, err := manager.fs.ReadFile(manager.fileRefPath(key, v[len(fileRefPrefix):]))
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read file referenced by %q: %v", key, err)
+			}
+			return b, nil
+		}
+		// YAML decodes !!binary into a string of the raw bytes.
+		return []byte(v), nil
+	}
+
+	str, err := cast.ToStringE(val)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to convert %q to bytes: %v", key, err)
+	}
+	return []byte(str), nil
+}
+
+// Resolves the path of a file reference found at key. Relative paths are
+// resolved against the directory of the file that supplied key, leaving the
+// stored value as written.
+func (manager *Config) fileRefPath(key string, ref string) string {
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	if origin, exists := manager.Origin(key); exists {
+		return path.Join(path.Dir(origin), ref)
+	}
+	return ref
+}
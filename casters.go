@@ -0,0 +1,111 @@
+package confer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Converts a raw configuration value into a user-defined type. The returned
+// value must be assignable to the type the caster was registered for.
+type CasterFunc func(val interface{}) (interface{}, error)
+
+// Registers a conversion function for a custom type, e.g:
+//
+//	config.RegisterCaster(reflect.TypeOf(LogLevel(0)), func(v interface{}) (interface{}, error) {
+//		return ParseLogLevel(cast.ToString(v))
+//	})
+//
+// Registered casters are consulted by GetAs, Unmarshal, and Get for keys
+// declared with CastTo.
+func (manager *Config) RegisterCaster(t reflect.Type, fn CasterFunc) {
+	manager.casters[t] = fn
+}
+
+// Retrieves the value at key and stores it in the value pointed to by target,
+// using a registered caster for the target's type when one exists.
+//
+//	var level LogLevel
+//	err := config.GetAs("logging.level", &level)
+func (manager *Config) GetAs(key string, target interface{}) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return fmt.Errorf("GetAs target for %q must be a non-nil pointer", key)
+	}
+
+	val := manager.Get(key)
+	if val == nil {
+		return fmt.Errorf("%q is not set", key)
+	}
+
+	converted, err := manager.castTo(val, ptr.Elem().Type())
+	if err != nil {
+		return fmt.Errorf("Unable to cast %q: %v", key, err)
+	}
+
+	ptr.Elem().Set(converted)
+	return nil
+}
+
+// Converts val to type t, preferring a registered caster and falling back to
+// plain assignment or, between numeric types, conversion.
+func (manager *Config) castTo(val interface{}, t reflect.Type) (reflect.Value, error) {
+	if fn, exists := manager.casters[t]; exists && reflect.TypeOf(val) != t {
+		out, err := fn(val)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if out == nil {
+			return reflect.Value{}, fmt.Errorf("the caster for %v returned nil", t)
+		}
+		val = out
+	}
+
+	v := reflect.ValueOf(val)
+	switch {
+	case v.Type().AssignableTo(t):
+		return v, nil
+	case numeric(v.Kind()) && numeric(t.Kind()):
+		return v.Convert(t), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("%v is not assignable to %v", v.Type(), t)
+}
+
+// Reports whether values of kind are numbers, which convert to one another
+// without changing their meaning, unlike, say, an int converted to a string.
+func numeric(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// Casts values at keys declared with CastTo using the caster registered for
+// their type. Values already of that type, or without a caster, are returned
+// as is.
+func (manager *Config) castKey(key string, val interface{}) (interface{}, error) {
+	if len(manager.schema) == 0 {
+		return val, nil
+	}
+	spec, exists := manager.schema[strings.ToLower(key)]
+	if !exists || spec.GoType == nil || reflect.TypeOf(val) == spec.GoType {
+		return val, nil
+	}
+	fn, exists := manager.casters[spec.GoType]
+	if !exists {
+		return val, nil
+	}
+
+	out, err := fn(val)
+	if err == nil && out == nil {
+		err = fmt.Errorf("the caster for %v returned nil", spec.GoType)
+	}
+	if err != nil {
+		return val, fmt.Errorf("Unable to cast %q: %v", key, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,66 @@
+// Command confer-gen merges configuration files and writes them out as Go
+// source with typed structs and constants, for values known at build time.
+// Keys overridden at runtime are excluded with --exclude and left to the
+// runtime manager:
+//
+//	confer-gen -p config -o config/compiled.go --exclude 'server.*' application.yaml
+//
+// Typically invoked with go:generate:
+//
+//	//go:generate confer-gen -p config -o compiled.go ../application.yaml
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/jacobstr/confer"
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	output := pflag.StringP("output", "o", "", "Path to write the generated source to. Defaults to stdout.")
+	root := pflag.StringP("root", "r", "", "Root path used to resolve relative configuration paths.")
+	pkg := pflag.StringP("package", "p", "config", "Package name of the generated source.")
+	typeName := pflag.String("type", "Settings", "Name of the root struct type.")
+	varName := pflag.String("var", "Compiled", "Name of the variable holding the values.")
+	exclude := pflag.StringSlice("exclude", nil, "Key patterns to leave out, e.g. those overridden at runtime.")
+	pflag.Parse()
+
+	if pflag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: confer-gen [-o output] [-r root] [-p package] [--exclude pattern] path...")
+		os.Exit(2)
+	}
+
+	config := confer.NewConfig()
+	config.SetRootPath(*root)
+
+	if err := config.ReadPaths(pflag.Args()...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var src bytes.Buffer
+	err := config.GenerateGo(&src, confer.GenerateOptions{
+		Package: *pkg,
+		Type:    *typeName,
+		Var:     *varName,
+		Exclude: *exclude,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(src.Bytes())
+		return
+	}
+
+	if err := ioutil.WriteFile(*output, src.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,38 @@
+// Command confer-snapshot merges configuration files and writes the result as
+// a snapshot that can be loaded at runtime with Config.UseSnapshot or
+// Config.ReadSnapshotFile, skipping file parsing entirely.
+//
+//	confer-snapshot -o config.snapshot application.yaml environments/production.yaml
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jacobstr/confer"
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	output := pflag.StringP("output", "o", "config.snapshot", "Path to write the snapshot to.")
+	root := pflag.StringP("root", "r", "", "Root path used to resolve relative configuration paths.")
+	pflag.Parse()
+
+	if pflag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: confer-snapshot [-o output] [-r root] path...")
+		os.Exit(2)
+	}
+
+	config := confer.NewConfig()
+	config.SetRootPath(*root)
+
+	if err := config.ReadPaths(pflag.Args()...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := config.WriteSnapshotFile(*output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
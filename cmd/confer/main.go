@@ -0,0 +1,101 @@
+// Command confer provides tooling for projects using confer.
+//
+//	confer get [-f format] [-r root] key path...
+//	confer migrate-viper [-p package] [-o output] [dir]
+//
+// get merges configuration files as ReadPaths would and writes the value at
+// key, a setting or a whole section, as yaml, json, toml or plain text.
+//
+// migrate-viper scans the Go files beneath dir, the working directory by
+// default, for spf13/viper usage and writes an equivalent confer setup as Go
+// source, reporting any calls that can't be carried over on stderr.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/jacobstr/confer"
+	"github.com/jacobstr/confer/migrate"
+	"github.com/spf13/pflag"
+)
+
+const usage = `usage: confer get [-f format] [-r root] key path...
+       confer migrate-viper [-p package] [-o output] [dir]`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "get":
+		get(os.Args[2:])
+	case "migrate-viper":
+		migrateViper(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func get(args []string) {
+	flags := pflag.NewFlagSet("get", pflag.ExitOnError)
+	format := flags.StringP("format", "f", "yaml", "Output format: yaml, json, toml or plain.")
+	root := flags.StringP("root", "r", "", "Root path used to resolve relative configuration paths.")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	config := confer.NewConfig()
+	config.SetRootPath(*root)
+
+	if err := config.ReadPaths(flags.Args()[1:]...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := config.Render(flags.Arg(0), *format, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func migrateViper(args []string) {
+	flags := pflag.NewFlagSet("migrate-viper", pflag.ExitOnError)
+	output := flags.StringP("output", "o", "", "Path to write the generated setup to. Defaults to stdout.")
+	pkg := flags.StringP("package", "p", "config", "Package name of the generated source.")
+	flags.Parse(args)
+
+	root := "."
+	if flags.NArg() > 0 {
+		root = flags.Arg(0)
+	}
+
+	report, err := migrate.Scan(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var src bytes.Buffer
+	if err := report.WriteGo(&src, *pkg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(src.Bytes())
+	} else if err := ioutil.WriteFile(*output, src.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	report.WriteSummary(os.Stderr)
+}
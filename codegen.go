@@ -0,0 +1,299 @@
+package confer
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// Controls the Go source written by GenerateGo.
+type GenerateOptions struct {
+	// The package name of the generated file. Defaults to "config".
+	Package string
+	// The name of the root struct type. Defaults to "Settings".
+	Type string
+	// The name of the variable holding the values. Defaults to "Compiled".
+	Var string
+	// Patterns matching keys to leave out, typically those overridden at
+	// runtime. Patterns match as in Pin. Secrets are always left out.
+	Exclude []string
+}
+
+// Writes a Go source file embedding the configuration loaded from files and
+// defaults, for values known at build time. The file declares a struct type
+// per map, a variable holding the values, a constant per scalar and a flat
+// Values map that can seed a manager without parsing any files:
+//
+//	for key, val := range config.Values {
+//		manager.SetDefault(key, val)
+//	}
+//
+// Flags and environment variables are ignored, as are excluded and secret
+// keys, so they remain the business of the runtime manager. See the
+// confer-gen command.
+func (manager *Config) GenerateGo(w io.Writer, opts GenerateOptions) error {
+	if opts.Package == "" {
+		opts.Package = "config"
+	}
+	if opts.Type == "" {
+		opts.Type = "Settings"
+	}
+	if opts.Var == "" {
+		opts.Var = "Compiled"
+	}
+
+	flat := map[string]interface{}{}
+	for key, val := range maps.Flatten(manager.storedSettings()) {
+		if val == nil || anyKeyMatches(opts.Exclude, key) || manager.IsSecret(key) {
+			continue
+		}
+		flat[strings.ToLower(key)] = val
+	}
+
+	gen := &generator{types: map[string]string{}}
+	var body bytes.Buffer
+
+	fmt.Fprintf(&body, "// Code generated by confer-gen. DO NOT EDIT.\n\npackage %s\n\n", opts.Package)
+
+	tree := maps.Expand(flat)
+	if err := gen.structType(opts.Type, tree); err != nil {
+		return err
+	}
+	for _, name := range gen.order {
+		body.WriteString(gen.types[name])
+	}
+
+	fmt.Fprintf(&body, "var %s = %s\n\n", opts.Var, gen.structLiteral(opts.Type, tree))
+
+	keys := []string{}
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	body.WriteString("const (\n")
+	consts := map[string]string{}
+	for _, key := range keys {
+		lit, ok := constLiteral(flat[key])
+		if !ok {
+			continue
+		}
+		name := identifier(key)
+		if other, exists := consts[name]; exists {
+			return fmt.Errorf("Keys %q and %q both map to the constant %s", other, key, name)
+		}
+		consts[name] = key
+		fmt.Fprintf(&body, "%s = %s\n", name, lit)
+	}
+	body.WriteString(")\n\n")
+
+	body.WriteString("// Every value by key, e.g. for seeding a manager with SetDefault.\n")
+	body.WriteString("var Values = map[string]interface{}{\n")
+	for _, key := range keys {
+		fmt.Fprintf(&body, "%q: %s,\n", key, literal(flat[key]))
+	}
+	body.WriteString("}\n")
+
+	src, err := format.Source(body.Bytes())
+	if err != nil {
+		return fmt.Errorf("Unable to format generated code: %v", err)
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+// Accumulates struct type declarations.
+type generator struct {
+	types map[string]string
+	order []string
+}
+
+// Declares a struct type named name for m, along with types for nested maps.
+func (g *generator) structType(name string, m map[string]interface{}) error {
+	g.order = append(g.order, name)
+
+	var decl bytes.Buffer
+	fmt.Fprintf(&decl, "type %s struct {\n", name)
+
+	fields := map[string]string{}
+	for _, key := range sortedKeys(m) {
+		field := identifier(key)
+		if other, exists := fields[field]; exists {
+			return fmt.Errorf("Keys %q and %q both map to the field %s.%s", other, key, name, field)
+		}
+		fields[field] = key
+
+		fieldType := goType(m[key])
+		if child, ok := m[key].(map[string]interface{}); ok {
+			fieldType = name + field
+			if err := g.structType(fieldType, child); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(&decl, "%s %s `mapstructure:%q`\n", field, fieldType, key)
+	}
+	decl.WriteString("}\n\n")
+
+	g.types[name] = decl.String()
+	return nil
+}
+
+func (g *generator) structLiteral(name string, m map[string]interface{}) string {
+	var lit bytes.Buffer
+	fmt.Fprintf(&lit, "%s{\n", name)
+	for _, key := range sortedKeys(m) {
+		field := identifier(key)
+		if child, ok := m[key].(map[string]interface{}); ok {
+			fmt.Fprintf(&lit, "%s: %s,\n", field, g.structLiteral(name+field, child))
+		} else {
+			fmt.Fprintf(&lit, "%s: %s,\n", field, typedLiteral(m[key]))
+		}
+	}
+	lit.WriteString("}")
+	return lit.String()
+}
+
+// The Go type used for a value in generated structs.
+func goType(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int64:
+		return "int"
+	case float64:
+		return "float64"
+	case []interface{}:
+		if elem := sliceElemType(v); elem != "" {
+			return "[]" + elem
+		}
+		return "[]interface{}"
+	}
+	return "interface{}"
+}
+
+// Returns the shared scalar type of a slice's elements, if any.
+func sliceElemType(s []interface{}) string {
+	elem := ""
+	for _, item := range s {
+		t := goType(item)
+		if strings.HasPrefix(t, "[]") || t == "interface{}" || (elem != "" && t != elem) {
+			return ""
+		}
+		elem = t
+	}
+	return elem
+}
+
+// A literal matching goType.
+func typedLiteral(val interface{}) string {
+	if s, ok := val.([]interface{}); ok {
+		if elem := sliceElemType(s); elem != "" {
+			items := []string{}
+			for _, item := range s {
+				items = append(items, literal(item))
+			}
+			return "[]" + elem + "{" + strings.Join(items, ", ") + "}"
+		}
+	}
+	return literal(val)
+}
+
+// A literal preserving val's dynamic type when assigned to interface{}.
+func literal(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return fmt.Sprintf("int(%d)", v)
+	case float64:
+		return floatLiteral(v)
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			items = append(items, literal(item))
+		}
+		return "[]interface{}{" + strings.Join(items, ", ") + "}"
+	case map[string]interface{}:
+		items := []string{}
+		for _, key := range sortedKeys(v) {
+			items = append(items, fmt.Sprintf("%q: %s", key, literal(v[key])))
+		}
+		return "map[string]interface{}{" + strings.Join(items, ", ") + "}"
+	}
+
+	if reflect.TypeOf(val).Kind() == reflect.Slice {
+		return literal(toSlice(val))
+	}
+	return strconv.Quote(fmt.Sprint(val))
+}
+
+func constLiteral(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string, bool, int:
+		return literal(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return floatLiteral(v), true
+	}
+	return "", false
+}
+
+// Formats a float so it remains a float constant, e.g. 1.0 rather than 1.
+func floatLiteral(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEnI") {
+		s += ".0"
+	}
+	return s
+}
+
+// Converts a materialized path such as "app.log_level" into an exported Go
+// identifier such as "AppLogLevel".
+func identifier(key string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+
+	id := b.String()
+	if id == "" || unicode.IsDigit([]rune(id)[0]) {
+		id = "X" + id
+	}
+	return id
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,143 @@
+package confer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// Parses a raw configuration value into a boolean. Used by GetBool and friends
+// so booleans can be interpreted consistently regardless of where they came
+// from.
+type BoolParser func(val interface{}) (bool, error)
+
+// The default boolean parser. Strings are interpreted with strconv.ParseBool
+// semantics, so "yes" and "on" are not considered true.
+func StrictBool(val interface{}) (bool, error) {
+	return cast.ToBoolE(val)
+}
+
+// A forgiving boolean parser accepting YAML 1.1 style scalars. Environment
+// variables and flags always arrive as strings, so this brings them in line
+// with YAML documents where `enabled: yes` is already a boolean.
+//
+//	true:  1, t, true, y, yes, on
+//	false: 0, f, false, n, no, off, ""
+//
+// Matching is case-insensitive and ignores surrounding whitespace. Numbers
+// are true when non-zero.
+func LenientBool(val interface{}) (bool, error) {
+	switch v := val.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case int, int8, int16, int32, int64, float32, float64:
+		return cast.ToFloat64(v) != 0, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "1", "t", "true", "y", "yes", "on":
+			return true, nil
+		case "0", "f", "false", "n", "no", "off", "":
+			return false, nil
+		}
+	}
+
+	return false, fmt.Errorf("Unable to parse %#v as a boolean", val)
+}
+
+// Replaces the parser used to coerce values into booleans, e.g:
+//
+//	config.SetBoolParser(confer.LenientBool)
+func (manager *Config) SetBoolParser(parser BoolParser) {
+	manager.boolParser = parser
+}
+
+// Parses a value as a boolean using the configured parser.
+func (manager *Config) parseBool(val interface{}) (bool, error) {
+	if manager.boolParser == nil {
+		return StrictBool(val)
+	}
+	return manager.boolParser(val)
+}
+
+// Coerces a value to a boolean using the configured parser. Values that
+// can't be parsed are treated as false.
+func (manager *Config) toBool(val interface{}) bool {
+	b, _ := manager.parseBool(val)
+	return b
+}
+
+// Normalizes a raw value before Get returns it. Parsers produce an assortment
+// of scalar types, e.g. YAML yields int while TOML yields int64, and the
+// coercer decides how much of that variety callers see.
+type Coercer func(val interface{}) interface{}
+
+// The default coercer. Integers become int and floats become float64, so
+// values compare equal regardless of which parser produced them. Note that
+// int64 values beyond the range of int are truncated on 32 bit platforms,
+// and float32 values pick up representation error.
+func NormalizeTypes(val interface{}) interface{} {
+	switch val.(type) {
+	case bool:
+		return cast.ToBool(val)
+	case string:
+		return cast.ToString(val)
+	case int64, int32, int16, int8, int:
+		return cast.ToInt(val)
+	case float64, float32:
+		return cast.ToFloat64(val)
+	case time.Time:
+		return cast.ToTime(val)
+	}
+	return val
+}
+
+// Returns values exactly as the parser or caller provided them, e.g. for
+// large int64 identifiers that must survive untouched.
+func PreserveTypes(val interface{}) interface{} {
+	return val
+}
+
+// Like NormalizeTypes, but also parses strings that look like integers,
+// floats or booleans, so "8080" from an environment variable is returned as
+// the int 8080. Only "true" and "false" are treated as booleans.
+func AggressiveTypes(val interface{}) interface{} {
+	s, ok := val.(string)
+	if !ok {
+		return NormalizeTypes(val)
+	}
+
+	trimmed := strings.TrimSpace(s)
+	if i, err := strconv.ParseInt(trimmed, 10, 0); err == nil {
+		return int(i)
+	}
+	if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+		return f
+	}
+	switch strings.ToLower(trimmed) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return s
+}
+
+// Replaces the coercer applied to values returned by Get, e.g:
+//
+//	config.SetCoercer(confer.PreserveTypes)
+func (manager *Config) SetCoercer(coercer Coercer) {
+	manager.coercer = coercer
+}
+
+// Coerces a value using the configured coercer.
+func (manager *Config) coerce(val interface{}) interface{} {
+	if manager.coercer == nil {
+		return NormalizeTypes(val)
+	}
+	return manager.coercer(val)
+}
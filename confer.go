@@ -9,22 +9,31 @@
 // via flags, ENVIRONMENT variables, configuration files retrieved
 // from the file system.
 //
-// There are 3 precedence tiers:
+// There are 5 precedence tiers, highest first:
 //
 // 1. Command line flags.
-// 2. Environment variables.
-// 3. Attributes - (e.g. Set, SetDefault, ReadPaths)
+// 2. Overrides - (e.g. Set)
+// 3. Environment variables.
+// 4. Attributes - (e.g. ReadPaths)
+// 5. Defaults - (e.g. SetDefault, and the defaults of bound flags)
+//
+// A value in a higher tier wins over the same key in any tier beneath it.
+// SetPrecedence reorders the tiers, and AddSource adds custom ones.
 
 package confer
 
 import (
 	"fmt"
+	"os"
 	"path"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/kr/pretty"
 	"github.com/spf13/cast"
 	jww "github.com/spf13/jwalterweatherman"
@@ -41,51 +50,275 @@ import (
 type Config struct {
 	pflags     *PFlagSource
 	env        *EnvSource
+	overrides  *ConfigSource
 	attributes *ConfigSource
+	defaults   *ConfigSource
+
+	// Guards the tiers, and what is recorded about them, against writes made
+	// while they're read, e.g. by WatchConfig and polled sources. Reloads,
+	// and the fetches that update the sources they merge, are serialized by
+	// reloadMu.
+	mu       sync.RWMutex
+	reloadMu sync.Mutex
+
+	// Layer names, highest precedence first, and sources added with
+	// AddSource by name.
+	precedence []string
+	sources    map[string]*customSource
 
 	// The root path for configuration files.
 	rootPath string
+
+	// Files successfully loaded by ReadPaths, in merge order, and every
+	// write to the attributes tier, those files included, replayed in order
+	// when the tier is rebuilt.
+	paths     []string
+	documents []attributeDocument
+
+	// An optional precompiled snapshot used in lieu of reading files.
+	snapshotPath string
+
+	// User-defined conversion functions, keyed by target type.
+	casters map[reflect.Type]CasterFunc
+
+	// Interprets values as booleans. Defaults to StrictBool.
+	boolParser BoolParser
+
+	// Normalizes values returned by Get. Defaults to NormalizeTypes.
+	coercer Coercer
+
+	// Where configuration files are read from.
+	fs reader.FileSystem
+
+	// The format of files without an extension. Sniffed when empty.
+	configType string
+
+	// Options for paths read with ReadPathsWithOptions, by resolved path.
+	pathSpecs map[string]PathSpec
+
+	// The file that supplied each leaf, by lower cased key, and the contents
+	// of each file by resolved path.
+	origins  map[string]string
+	fileData map[string]map[string]interface{}
+
+	// How each file read took to load, by resolved path, and the order
+	// they were first read in.
+	fileStats  map[string]*FileStats
+	statsOrder []string
+
+	// Whether Get and the accessors built on it hand out deep copies.
+	copyOnRead bool
+
+	// Resolves relative paths for GetPath, if set.
+	pathResolver PathResolver
+
+	// Decrypters for values stored encrypted inline.
+	valueDecrypters []ValueDecrypter
+
+	// Secrets removed by ScrubSecrets, kept for TakeSecret.
+	scrubbed map[string][]byte
+
+	// When files were last read, and the outcome of the last reload, for
+	// Health.
+	loadedAt   time.Time
+	reloadedAt time.Time
+	reloadErr  error
+
+	// Separators splitting list values read from the environment, for every
+	// list and by lower cased key.
+	envListSeparator  string
+	envListSeparators map[string]string
+
+	// Whether Unset removes sections it leaves empty.
+	pruneOnUnset bool
+
+	// Whether ReadPaths updates the defaults of bound flags.
+	flagDefaultSync bool
+
+	// Lower cased keys whose default was copied from a flag by BindPFlag
+	// rather than given to SetDefault.
+	flagDefaulted map[string]bool
+
+	// Subtrees locked with LockPrefix.
+	locks prefixLocks
+
+	// Whether reading keys before loading is an error, and whether
+	// ReadPaths or Finalize has been called. Atomic as every read checks
+	// them.
+	strictLifecycle atomic.Bool
+	loaded          atomic.Bool
+
+	// Debug mode detecting changes made to the tiers outside of the API.
+	mutationChecks bool
+	pristine       []interface{}
+
+	// Debug mode logging reads of unset keys, holding those already logged.
+	missingKeys *sync.Map
+
+	// The published snapshot, if View has been called, the depth of batched
+	// writes deferring publication, and a lock ordering publications.
+	view      atomic.Pointer[View]
+	viewsHeld atomic.Int32
+	publishMu sync.Mutex
+
+	// Bumped on every write, invalidating values cached by Memo.
+	generation atomic.Uint64
+
+	// Notified of changes after a Reload, and of reloads that failed.
+	changeHandlers      []*ChangeHandler
+	reloadErrorHandlers []func(error)
+
+	// Whether invalid settings are withheld rather than failing a reload,
+	// and those withheld by the last one.
+	quarantineEnabled bool
+	quarantined       []QuarantinedKey
+
+	// Watches files for WatchConfig, notifying handlers after each reload.
+	watcher              *fsnotify.Watcher
+	configChangeHandlers []func(Event)
+
+	// Whether values with activation windows are resolved, and the handlers
+	// WatchSchedules notifies as windows open and close.
+	schedulesEnabled        bool
+	schedulesStop           chan struct{}
+	schedulesDone           chan struct{}
+	scheduledChangeHandlers []ChangeHandler
+
+	// Keys being retired.
+	deprecations         []Deprecation
+	deprecationsEnforced bool
+
+	// Patterns matching keys that may not change on reload.
+	pinned []string
+
+	// Patterns matching keys that require a restart to take effect, and
+	// the changes to them made since the process started.
+	restartRequired []string
+	pendingRestart  map[string]Change
+
+	// Patterns matching keys that hold sensitive values.
+	secrets []string
+
+	// Keys declared with Define, by lower cased key.
+	schema map[string]*KeySpec
+
+	// Custom checks run alongside the schema.
+	validators []Validator
+
+	// Objects added with AddObjectSource, in merge order.
+	objectSources []*objectSource
+
+	// Znodes added with AddZooKeeperSource, merged after object sources.
+	zooKeeperSources []*zooKeeperSource
+
+	// Repositories added with AddGitSource, merged after znodes, and handlers
+	// notified when they pull a new commit.
+	gitSources        []*gitSource
+	gitUpdateHandlers []func(GitUpdate)
+
+	// Documents read with ReadRemote or WatchRemote, merged after git
+	// sources.
+	remoteSources  []*remoteSource
+	remoteCacheDir string
+	remoteEventsMu sync.Mutex
+	remoteEvents   []chan RemoteEvent
+
+	// Limits on values from every remote source, and handlers notified of
+	// settings withheld by them or by quarantine.
+	remoteQuota        RemoteQuota
+	quarantineHandlers []func(QuarantinedKey)
+
+	// Secrets bound with BindSecret, the layer holding their values, and
+	// handlers notified when they rotate.
+	secretBindings         []*secretBinding
+	secretValues           *ConfigSource
+	secretRotationHandlers []func(SecretRotation)
+
+	// Additional conversions used by Unmarshal.
+	decodeHooks []DecodeHook
+
+	// Resource limits for EvalKey.
+	exprLimits ExpressionLimits
 }
 
 func NewConfig() *Config {
 	manager := &Config{}
 	manager.pflags = NewPFlagSource()
+	manager.overrides = NewConfigSource()
 	manager.attributes = NewConfigSource()
+	manager.defaults = NewConfigSource()
+	manager.flagDefaulted = make(map[string]bool)
+	manager.precedence = defaultPrecedence
+	manager.sources = make(map[string]*customSource)
 	manager.env = NewEnvSource()
 	manager.rootPath = ""
+	manager.casters = make(map[reflect.Type]CasterFunc)
+	manager.boolParser = StrictBool
+	manager.coercer = NormalizeTypes
+	manager.fs = reader.ArchiveFileSystem{Base: reader.OSFileSystem{}}
+	manager.copyOnRead = true
+	manager.deprecationsEnforced = true
+	manager.pendingRestart = make(map[string]Change)
+	manager.schema = make(map[string]*KeySpec)
+	manager.pathSpecs = make(map[string]PathSpec)
+	manager.origins = make(map[string]string)
+	manager.fileData = make(map[string]map[string]interface{})
+	manager.fileStats = make(map[string]*FileStats)
+	manager.exprLimits = DefaultExpressionLimits
 
 	return manager
 }
 
 // Finds a value at a provided key, returning nil if the key does not exist.
-// The order of precedence for configuration data is:
+// The order of precedence for configuration data, unless changed with
+// SetPrecedence, is:
 // 1. Program arguments.
-// 2. Environment variables.
-// 3. Config file data, overrides, and defaults.
+// 2. Overrides.
+// 3. Environment variables.
+// 4. Config file data.
+// 5. Defaults.
 func (self *Config) Find(key string) interface{} {
-	var val interface{}
-	var exists bool
+	self.mu.RLock()
+	defer self.mu.RUnlock()
 
-	// PFlag Override first
-	val, exists = self.pflags.Get(key)
-	if exists {
-		jww.TRACE.Println(key, "found in override (via pflag):", val)
-		return val
-	}
+	self.checkMutations()
+	return self.find(key)
+}
 
-	// Periods are not supported. Allow the usage of underscores to specify nested
-	// configuration options.
-	val, exists = self.env.Get(key)
-	if exists {
-		jww.TRACE.Println(key, "Found in environment with value:", val)
+// Find without the lock or the mutation check, for callers resolving several
+// keys.
+func (self *Config) find(key string) interface{} {
+	return self.findIn(self.env, key)
+}
+
+// Like find, but reads environment variables from env.
+func (self *Config) findIn(env *EnvSource, key string) interface{} {
+	if val := self.findKey(env, key); val != nil {
 		return val
 	}
+	if deprecated, ok := self.aliasOf(key); ok {
+		return self.findKey(env, deprecated)
+	}
+	return nil
+}
 
-	// Attributes entail pretty much everything else.
-	val, exists = self.attributes.Get(key)
-	if exists {
-		jww.TRACE.Println(key, "Found in config:", val)
-		return val
+// Searches the layers for key itself, ignoring deprecated aliases.
+func (self *Config) findKey(env *EnvSource, key string) interface{} {
+	for i, layer := range self.precedence {
+		val, exists := self.lookupIn(env, layer, key)
+		if exists && self.schedulesEnabled {
+			val, exists = resolveSchedule(val, timeNow())
+		}
+		if exists {
+			jww.TRACE.Println(key, "Found in", layer, "with value:", val)
+
+			// Sections are filled in by the stored tiers beneath, e.g. defaults
+			// apply to parts of a section a file didn't configure.
+			if self.store(layer) != nil || layer == LayerEnv {
+				return self.layerSections(key, val, self.stores(self.precedence[i+1:])...)
+			}
+			return val
+		}
 	}
 
 	return nil
@@ -96,7 +329,7 @@ func (manager *Config) GetString(key string) string {
 }
 
 func (manager *Config) GetBool(key string) bool {
-	return cast.ToBool(manager.Get(key))
+	return manager.toBool(manager.Get(key))
 }
 
 func (manager *Config) GetInt(key string) int {
@@ -111,10 +344,16 @@ func (manager *Config) GetTime(key string) time.Time {
 	return cast.ToTime(manager.Get(key))
 }
 
+func (manager *Config) GetDuration(key string) time.Duration {
+	return cast.ToDuration(manager.Get(key))
+}
+
 func (manager *Config) GetStringSlice(key string) []string {
 	return cast.ToStringSlice(manager.Get(key))
 }
 
+// Returns the map at key. Unless disabled with SetCopyOnRead, the result is a
+// deep copy that may be freely modified, as with Get.
 func (manager *Config) GetStringMap(key string) map[string]interface{} {
 	return cast.ToStringMap(manager.Get(key))
 }
@@ -123,59 +362,212 @@ func (manager *Config) GetStringMapString(key string) map[string]string {
 	return cast.ToStringMapString(manager.Get(key))
 }
 
+// Returns a pointer to the boolean at key, or nil if the key is not set. Allows
+// callers to distinguish an explicit false from an absent value.
+func (manager *Config) GetBoolPtr(key string) *bool {
+	v := manager.Get(key)
+	if v == nil {
+		return nil
+	}
+	b := manager.toBool(v)
+	return &b
+}
+
+// Returns a pointer to the integer at key, or nil if the key is not set.
+func (manager *Config) GetIntPtr(key string) *int {
+	v := manager.Get(key)
+	if v == nil {
+		return nil
+	}
+	i := cast.ToInt(v)
+	return &i
+}
+
+// Returns a pointer to the string at key, or nil if the key is not set.
+func (manager *Config) GetStringPtr(key string) *string {
+	v := manager.Get(key)
+	if v == nil {
+		return nil
+	}
+	str := cast.ToString(v)
+	return &str
+}
+
 // Binds a configuration key to a command line flag:
 //	 pflag.Int("port", 8080, "The best alternative port")
 //	 confer.BindPFlag("port", pflag.Lookup("port"))
+//
+// The flag's default also becomes the key's default, unless LayerFlagDefaults
+// is named in the precedence, in which case the flag defaults tier provides it
+// instead.
 func (manager *Config) BindPFlag(key string, flag *pflag.Flag) (err error) {
 	if flag == nil {
 		return fmt.Errorf("flag for %q is nil", key)
 	}
 
-	manager.pflags.Set(key, flag)
+	manager.write(func() {
+		manager.pflags.Set(key, flag)
+		manager.flagDefaulted[strings.ToLower(key)] = true
+		manager.copyFlagDefaults()
+	})
+	return nil
+}
 
-	switch flag.Value.Type() {
-	case "int", "int8", "int16", "int32", "int64":
-		manager.SetDefault(key, cast.ToInt(flag.Value.String()))
-	case "bool":
-		manager.SetDefault(key, cast.ToBool(flag.Value.String()))
-	default:
-		manager.SetDefault(key, flag.Value.String())
+// Copies the defaults of bound flags into the defaults tier, or removes them
+// once LayerFlagDefaults is named. Defaults given to SetDefault are left
+// alone. Requires the lock.
+func (manager *Config) copyFlagDefaults() {
+	named := false
+	for _, layer := range manager.precedence {
+		named = named || layer == LayerFlagDefaults
+	}
+
+	for key := range manager.flagDefaulted {
+		if named {
+			manager.defaults.Unset(key)
+			continue
+		}
+		flag, exists := manager.pflags.Flag(key)
+		if !exists {
+			continue
+		}
+		switch flag.Value.Type() {
+		case "int", "int8", "int16", "int32", "int64":
+			manager.defaults.Set(key, cast.ToInt(flag.Value.String()))
+		case "bool":
+			manager.defaults.Set(key, cast.ToBool(flag.Value.String()))
+		default:
+			manager.defaults.Set(key, flag.Value.String())
+		}
 	}
-	return nil
 }
 
 // Binds a confer key to a ENV variable. ENV variables are case sensitive If only
 func (manager *Config) BindEnv(input ...string) (err error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
 	return manager.env.Bind(input...)
 }
 
 // Get returns an interface..
 // Must be typecast or used by something that will typecast
+//
+// Values that fail to decrypt are logged and returned as nil, and values that
+// a caster registered for their CastTo type rejects are logged and returned
+// as stored; GetE returns these failures instead. Get only panics in strict
+// lifecycle mode, when called before the configuration is loaded.
+//
+// Maps and slices are deep copies unless disabled with SetCopyOnRead, so
+// modifying them doesn't affect the configuration.
 func (manager *Config) Get(key string) interface{} {
 	jww.TRACE.Println("Looking for", key)
 
-	v := manager.Find(key)
+	if err := manager.checkLifecycle(key); err != nil {
+		panic("confer: " + err.Error())
+	}
+
+	return manager.copied(manager.resolve(key, manager.Find(key)))
+}
+
+// Returns a deep copy of val when reads are copied, see SetCopyOnRead.
+func (manager *Config) copied(val interface{}) interface{} {
+	if manager.copyOnRead {
+		return maps.DeepCopy(val)
+	}
+	return val
+}
+
+// Decrypts, coerces and converts the value found at key, as returned by Get.
+// Runs without the lock, so values are resolved after the tiers are read.
+// Failures are logged: values that can't be decrypted are left out and those
+// that can't be cast are returned as stored.
+func (manager *Config) resolve(key string, v interface{}) interface{} {
+	val, err := manager.resolveE(key, v)
+	if err != nil {
+		jww.ERROR.Println(err)
+	}
+	return val
+}
 
+// Like resolve, but returns decryption and cast failures.
+func (manager *Config) resolveE(key string, v interface{}) (interface{}, error) {
 	if v == nil {
-		return nil
+		manager.logMissingKey(key)
+		return nil, nil
 	}
 
 	jww.TRACE.Println("Found value", v)
-	switch v.(type) {
-	case bool:
-		return cast.ToBool(v)
-	case string:
-		return cast.ToString(v)
-	case int64, int32, int16, int8, int:
-		return cast.ToInt(v)
-	case float64, float32:
-		return cast.ToFloat64(v)
-	case time.Time:
-		return cast.ToTime(v)
-	case []string:
-		return v
-	}
-	return v
+	decrypted, err := manager.decryptValues(key, v)
+	if decrypted == nil {
+		return nil, err
+	}
+	val, castErr := manager.castKey(key, manager.convertUnits(key, manager.coerce(decrypted)))
+	if err == nil {
+		err = castErr
+	}
+	return val, err
+}
+
+// Like Get, but distinguishes a key that is simply unset, returning nil and no
+// error, from one that can't be reached because an ancestor holds a scalar,
+// returning a WrongShapeError. The latter usually means an overlay replaced a
+// whole section, e.g. logging: debug rather than logging.level: debug.
+func (manager *Config) GetE(key string) (interface{}, error) {
+	if err := manager.checkLifecycle(key); err != nil {
+		return nil, err
+	}
+	val, err := manager.resolveE(key, manager.Find(key))
+	if err != nil {
+		return nil, err
+	}
+	if val != nil {
+		return manager.copied(val), nil
+	}
+	if err := manager.overrides.Shape(key); err != nil {
+		return nil, err
+	}
+	return nil, manager.attributes.Shape(key)
+}
+
+// Lays a section found in one tier over the sections at the same key in the
+// tiers beneath it, highest precedence first, so they still apply to the parts
+// that weren't configured. Values other than maps are returned as is.
+func (manager *Config) layerSections(key string, val interface{}, beneath ...Configger) interface{} {
+	section, ok := maps.Normalize(val).(map[string]interface{})
+	if !ok {
+		return val
+	}
+
+	layered := false
+	for _, tier := range beneath {
+		fallback, exists := tier.Get(key)
+		if !exists {
+			continue
+		}
+		if base, ok := maps.Normalize(fallback).(map[string]interface{}); ok {
+			section = maps.Merge(base, section)
+			layered = true
+		}
+	}
+
+	if !layered {
+		return val
+	}
+	return section
+}
+
+// Merges the overrides, attributes and defaults into a single nested map in
+// order of precedence. The result is a copy.
+func (manager *Config) storedSettings() map[string]interface{} {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	settings := map[string]interface{}{}
+	tiers := manager.stores(manager.precedence)
+	for i := len(tiers) - 1; i >= 0; i-- {
+		settings = maps.Merge(settings, maps.Normalize(tiers[i].ToStringMap()).(map[string]interface{}))
+	}
+	return settings
 }
 
 // Returns true if the config key exists and is non-nil.
@@ -194,22 +586,61 @@ func (manager *Config) AutomaticEnv() {
 
 // Returns true if the key provided exists in our configuration.
 func (manager *Config) InConfig(key string) bool {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
 	_, exists := manager.attributes.Get(key)
 	return exists
 }
 
 // Set the default value for this key.
 // Default only used when no value is provided by the user via flag, config or ENV.
+// Defaults live in their own tier, so they may be set before or after files are
+// read; setting one again replaces it.
 func (manager *Config) SetDefault(key string, value interface{}) {
-	if !manager.IsSet(key) {
-		manager.attributes.Set(key, value)
-	}
+	manager.write(func() {
+		manager.defaults.Set(key, value)
+		delete(manager.flagDefaulted, strings.ToLower(key))
+	})
 }
 
-// Explicitly sets a value. Will not override command line arguments or
-// environment variables, as those sources have higher precedence.
+// Explicitly sets a value. Overrides live in their own tier, so they take
+// precedence over environment variables and files, including those read
+// afterwards. Only command line arguments have higher precedence.
 func (manager *Config) Set(key string, value interface{}) {
-	manager.attributes.Set(key, value)
+	manager.write(func() {
+		manager.overrides.Set(key, value)
+	})
+}
+
+// Removes a value set in files or with Set, along with anything nested beneath
+// it. Flags, environment variables and defaults are unaffected, so a default
+// for the key applies again. Sections left empty are kept unless
+// SetPruneOnUnset is enabled.
+func (manager *Config) Unset(key string) {
+	manager.write(func() {
+		manager.overrides.Unset(key)
+		manager.attributes.Unset(key)
+		manager.recordDocument(attributeDocument{unset: key})
+		if manager.pruneOnUnset {
+			manager.overrides.PruneEmptyParents(key)
+			manager.attributes.PruneEmptyParents(key)
+		}
+
+		lowered := strings.ToLower(key)
+		for leaf := range manager.origins {
+			if leaf == lowered || strings.HasPrefix(leaf, lowered+".") {
+				delete(manager.origins, leaf)
+			}
+		}
+	})
+}
+
+// Makes Unset remove sections left empty by removing their last key, so
+// managers that add and remove dynamic keys over a long life don't accumulate
+// empty sections in AllKeys and exports.
+func (manager *Config) SetPruneOnUnset(enabled bool) {
+	manager.pruneOnUnset = enabled
 }
 
 // Sets an optional root path. This frees you from having to specify a
@@ -218,98 +649,228 @@ func (manager *Config) SetRootPath(path string) {
 	manager.rootPath = path
 }
 
+// Replaces the file system configuration files are read from. Defaults to
+// the local file system, with archive entries addressable as
+// `configs.tar.gz//app/application.yaml`. Wrap fs in a
+// reader.ArchiveFileSystem to keep that behaviour.
+func (manager *Config) SetFileSystem(fs reader.FileSystem) {
+	manager.fs = fs
+}
+
+// Replaces the environment that bound environment variables are read from.
+// Defaults to the process environment.
+func (manager *Config) SetEnvironment(env Environment) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.env.SetEnvironment(env)
+}
+
 // Loads and sequentially + recursively merges the provided config arguments. Returns
 // an error if any of the files fail to load, though this may be expecte
 // in the case of search paths.
 func (manager *Config) ReadPaths(paths ...string) error {
-	var err error
-	var loaded interface{}
-
-	merged_config := manager.attributes.ToStringMap()
-	errs := []error{}
+	manager.loaded.Store(true)
+	if manager.readPathsFromSnapshot() {
+		return nil
+	}
 
+	final_paths := []string{}
 	for _, base_path := range paths {
-		var final_path string
+		final_paths = append(final_paths, manager.resolvePath(base_path))
+	}
 
-		if !filepath.IsAbs(base_path) {
-			final_path = path.Join(manager.rootPath, base_path)
-		} else {
-			final_path = base_path
-		}
+	manager.reloadMu.Lock()
+	loaded, errs := manager.readFiles(final_paths)
+	manager.mu.Lock()
+	manager.recordPaths(loaded)
+	if len(loaded) > 0 {
+		manager.loadedAt = time.Now()
+	}
+	manager.mu.Unlock()
+	manager.reloadMu.Unlock()
 
-		loaded, err = reader.ReadFile(final_path)
+	if manager.flagDefaultSync {
+		manager.SyncFlagDefaults()
+	}
+	errs = append(errs, manager.checkDeprecations()...)
+	errs = append(errs, manager.validate(false)...)
 
-		if err != nil {
+	if len(errs) > 0 {
+		return &errors.LoadError{Errors: errs}
+	} else {
+		return nil
+	}
+}
+
+// Resolves a path relative to the root path, unless it is absolute.
+func (manager *Config) resolvePath(base_path string) string {
+	if filepath.IsAbs(base_path) {
+		return base_path
+	}
+	return path.Join(manager.rootPath, base_path)
+}
+
+// Sequentially merges already resolved paths into the attributes tier.
+// Returns the paths that were loaded successfully along with any errors.
+func (manager *Config) readFiles(paths []string) ([]string, []error) {
+	state := manager.saveAttributes()
+	loaded, errs := manager.mergeFiles(state, paths)
+	if len(loaded) > 0 {
+		errs = append(errs, resolveRefs(state.data)...)
+		manager.restoreAttributes(state)
+	}
+	return loaded, errs
+}
+
+// Sequentially merges already resolved paths into state, recording where
+// their values came from. Files are read without holding the lock; the result
+// takes effect once references are resolved and it's restored with
+// restoreAttributes.
+func (manager *Config) mergeFiles(state *attributeState, paths []string) ([]string, []error) {
+	loaded_paths := []string{}
+	errs := []error{}
+
+	for _, final_path := range paths {
+		fs := &timedFileSystem{fs: manager.fs}
+		started := time.Now()
+		loaded, err := manager.readFileFrom(fs, final_path)
+		elapsed := time.Since(started)
+
+		if err != nil && os.IsNotExist(err) && manager.isOptional(final_path) {
+			jww.INFO.Println("Skipping missing optional config file", final_path)
+			continue
+		} else if err != nil {
 			errs = append(errs, err)
 			continue
 		}
 
+		if mount := manager.pathSpecs[final_path].Key; mount != "" {
+			loaded = maps.Expand(map[string]interface{}{mount: maps.Normalize(loaded)})
+		} else if _, ok := loaded.([]interface{}); ok {
+			errs = append(errs, fmt.Errorf("%s holds a list rather than a map, read it with ReadPathsInto", final_path))
+			continue
+		}
+
 		// In-place recursive coercion to stringmap.
 		coerced := cast.ToStringMap(loaded)
 		maps.ToStringMapRecursive(coerced)
+		state.recordOrigins(coerced, final_path)
+		manager.recordFileStats(final_path, fs.size, fs.elapsed, elapsed-fs.elapsed, len(maps.Flatten(coerced)))
 
-		if merged_config == nil {
-			merged_config = coerced
-		} else {
-			merged_config = maps.Merge(
-				merged_config,
-				coerced,
-			)
-		}
-
-		manager.attributes.FromStringMap(merged_config)
+		state.data = maps.Merge(state.data, coerced)
+		loaded_paths = append(loaded_paths, final_path)
 	}
 
-	if len(errs) > 0 {
-		return &errors.LoadError{Errors: errs}
-	} else {
-		return nil
+	return loaded_paths, errs
+}
+
+// Reads a single file, honouring SetConfigType for files without an extension
+// and any options given to ReadPathsWithOptions.
+func (manager *Config) readFile(final_path string) (interface{}, error) {
+	return manager.readFileFrom(manager.fs, final_path)
+}
+
+func (manager *Config) readFileFrom(fs reader.FileSystem, final_path string) (interface{}, error) {
+	opts := reader.ReadOptions{}
+	if spec, exists := manager.pathSpecs[final_path]; exists {
+		opts.Format, opts.Strict = spec.Format, spec.Strict
+	}
+	if opts.Format == "" && reader.FormatOf(final_path) == "" {
+		opts.Format = manager.configType
 	}
+	return reader.ReadFileWith(fs, final_path, opts)
+}
+
+// Sets the format of configuration files without an extension, e.g. "json",
+// rather than detecting it from their contents.
+func (manager *Config) SetConfigType(format string) {
+	manager.configType = format
 }
 
 // Merges data into the our attributes configuration tier from a struct.
 func (manager *Config) MergeAttributes(val interface{}) error {
-	merged_config := maps.Merge(
-		manager.attributes.ToStringMap(),
-		cast.ToStringMap(val),
-	)
-
-	manager.attributes.FromStringMap(merged_config)
+	doc := maps.DeepCopy(cast.ToStringMap(val)).(map[string]interface{})
+	manager.write(func() {
+		manager.recordDocument(attributeDocument{data: doc})
+		manager.attributes.FromStringMap(maps.Merge(
+			maps.DeepCopy(manager.attributes.ToStringMap()).(map[string]interface{}),
+			maps.DeepCopy(doc).(map[string]interface{}),
+		))
+	})
 	return nil
 }
 
 // Returns all currently set keys, pruning ancestors and only
-// showing the leaves.
+// showing the leaves. Keys bound to flags and environment variables are
+// included while they provide a value.
 func (manager *Config) AllKeys() []string {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return manager.allKeys()
+}
+
+// AllKeys without the lock.
+func (manager *Config) allKeys() []string {
 	keys := manager.attributes.AllKeys()
-	keys = append(keys, manager.env.AllKeys()...)
-	keys = append(keys, manager.attributes.AllKeys()...)
+	keys = append(keys, manager.overrides.AllKeys()...)
+	keys = append(keys, manager.defaults.AllKeys()...)
+	keys = append(keys, manager.customKeys()...)
+
+	for _, key := range manager.env.AllKeys() {
+		if _, exists := manager.env.Get(key); exists {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range manager.pflags.AllKeys() {
+		if _, exists := manager.pflags.Get(key); exists {
+			keys = append(keys, key)
+		}
+	}
+
+	keys = append(keys, manager.aliasKeys(keys)...)
 
+	// LowerCase the keys for backwards-compatibility, which also merges the
+	// same key found in several sources.
 	leaves := map[string]struct{}{}
 	for _, key := range keys {
+		if manager.schedulesEnabled && manager.withinSchedule(key) {
+			continue
+		}
 
 		// Filter out leaves. This is really ineffecient.
-		val := manager.Get(key)
+		val := manager.find(key)
 		if val == nil {
-			leaves[key] = struct{}{}
+			leaves[strings.ToLower(key)] = struct{}{}
 		} else if reflect.TypeOf(val).Kind() != reflect.Map {
-			leaves[key] = struct{}{}
+			leaves[strings.ToLower(key)] = struct{}{}
 		}
 	}
 
 	unique_keys := []string{}
 	for x, _ := range leaves {
-		// LowerCase the key for backwards-compatibility.
-		unique_keys = append(unique_keys, strings.ToLower(x))
+		unique_keys = append(unique_keys, x)
 	}
 
 	return unique_keys
 }
 
+// Returns every setting, keyed as in AllKeys. The tiers are read under a
+// single lock, so the result is consistent even while a reload is underway.
 func (manager *Config) AllSettings() map[string]interface{} {
+	manager.mu.RLock()
+	manager.checkMutations()
+	found := map[string]interface{}{}
+	for _, x := range manager.allKeys() {
+		found[x] = manager.find(x)
+	}
+	manager.mu.RUnlock()
+
 	m := map[string]interface{}{}
-	for _, x := range manager.AllKeys() {
-		m[x] = manager.Get(x)
+	for x, val := range found {
+		if err := manager.checkLifecycle(x); err != nil {
+			panic("confer: " + err.Error())
+		}
+		m[x] = manager.resolve(x, val)
 	}
 
 	return m
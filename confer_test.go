@@ -6,15 +6,46 @@
 package confer
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	errors "github.com/jacobstr/confer/errors"
+	"github.com/jacobstr/confer/migrate"
 	"github.com/jacobstr/confer/reader"
+	"github.com/jacobstr/confer/remote/age"
+	"github.com/jacobstr/confer/remote/azblob"
+	"github.com/jacobstr/confer/remote/gcs"
+	"github.com/jacobstr/confer/remote/pgp"
+	"github.com/jacobstr/confer/remote/s3"
+	"github.com/jacobstr/confer/remote/sftpfs"
+	"github.com/jacobstr/confer/source"
+	"github.com/spf13/cast"
 	"github.com/spf13/pflag"
+	filippoage "filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/yaml.v2"
 )
 
 var yamlExample = []byte(`Hacker: true
@@ -96,6 +127,9 @@ var app_dev_yaml = map[string]interface{}{
 	},
 }
 
+// A user-defined type exercised by the caster registry.
+type testLevel int
+
 //stubs for PFlag Values
 type stringValue string
 
@@ -117,6 +151,271 @@ func (s *stringValue) String() string {
 	return fmt.Sprintf("%s", *s)
 }
 
+// A codec for "key = value" lines, registered as a third party would.
+type kvCodec struct{}
+
+func (kvCodec) Decode(data []byte) (interface{}, error) {
+	m := map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+		m[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return m, nil
+}
+
+func (kvCodec) Encode(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for key, val := range cast.ToStringMap(data) {
+		fmt.Fprintf(&buf, "%s = %v\n", key, val)
+	}
+	return buf.Bytes(), nil
+}
+
+func init() {
+	reader.RegisterCodec("kv", kvCodec{})
+}
+
+// A secret manager whose secret can be rotated by the test.
+type fakeSecretStore struct {
+	mu      sync.Mutex
+	value   string
+	version SecretVersion
+}
+
+func (s *fakeSecretStore) FetchSecret(name string) (string, SecretVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value, s.version, nil
+}
+
+func (s *fakeSecretStore) rotate(value string, version SecretVersion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value, s.version = value, version
+}
+
+// An in memory ZooKeeper tree, keyed by znode path.
+type fakeZooKeeper struct {
+	mu      sync.Mutex
+	nodes   map[string]string
+	watches []chan struct{}
+}
+
+func (zk *fakeZooKeeper) GetW(path string) ([]byte, <-chan struct{}, error) {
+	zk.mu.Lock()
+	defer zk.mu.Unlock()
+	data, exists := zk.nodes[path]
+	if !exists {
+		return nil, nil, fmt.Errorf("zk: node does not exist")
+	}
+	return []byte(data), zk.watch(), nil
+}
+
+func (zk *fakeZooKeeper) ChildrenW(path string) ([]string, <-chan struct{}, error) {
+	zk.mu.Lock()
+	defer zk.mu.Unlock()
+	children := []string{}
+	for node := range zk.nodes {
+		if strings.HasPrefix(node, path+"/") && !strings.Contains(node[len(path)+1:], "/") {
+			children = append(children, node[len(path)+1:])
+		}
+	}
+	sort.Strings(children)
+	return children, zk.watch(), nil
+}
+
+func (zk *fakeZooKeeper) set(path, data string) {
+	zk.mu.Lock()
+	defer zk.mu.Unlock()
+	zk.nodes[path] = data
+	for _, watch := range zk.watches {
+		close(watch)
+	}
+	zk.watches = nil
+}
+
+func (zk *fakeZooKeeper) watch() chan struct{} {
+	watch := make(chan struct{})
+	zk.watches = append(zk.watches, watch)
+	return watch
+}
+
+// A remote provider serving a document that changes when set is called.
+type fakeRemote struct {
+	mu      sync.Mutex
+	doc     string
+	err     error
+	changed chan struct{}
+}
+
+func (r *fakeRemote) Fetch() ([]byte, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, "", r.err
+	}
+	return []byte(r.doc), "yaml", nil
+}
+
+func (r *fakeRemote) Wait(stop <-chan struct{}) error {
+	select {
+	case <-r.changed:
+	case <-stop:
+	}
+	return nil
+}
+
+func (r *fakeRemote) set(doc string) {
+	r.mu.Lock()
+	r.doc = doc
+	r.mu.Unlock()
+	r.changed <- struct{}{}
+}
+
+// A Logger recording each line as its message followed by its attributes.
+type recordingLogger struct {
+	lines [][]interface{}
+}
+
+func (l *recordingLogger) Info(msg string, args ...interface{}) {
+	l.lines = append(l.lines, append([]interface{}{msg}, args...))
+}
+
+// Counts how the environment is read.
+type countingEnvironment struct {
+	source.MapEnvironment
+	getenvs, environs int
+}
+
+func (env *countingEnvironment) Getenv(key string) string {
+	env.getenvs++
+	return env.MapEnvironment.Getenv(key)
+}
+
+func (env *countingEnvironment) Environ() []string {
+	env.environs++
+	return env.MapEnvironment.Environ()
+}
+
+// An SSH server on a loopback port serving the local file system over SFTP to
+// a user authenticating with a password.
+type sftpServer struct {
+	listener net.Listener
+	hostKey  ssh.PublicKey
+
+	mu      sync.Mutex
+	conns   []net.Conn
+	accepts int
+}
+
+func newSFTPServer(password string) *sftpServer {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		panic(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		panic(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, given []byte) (*ssh.Permissions, error) {
+			if string(given) != password {
+				return nil, fmt.Errorf("wrong password for %s", conn.User())
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	server := &sftpServer{listener: listener, hostKey: signer.PublicKey()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.conns = append(server.conns, conn)
+			server.accepts++
+			server.mu.Unlock()
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+func (server *sftpServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					if sftpServer, err := sftp.NewServer(channel); err == nil {
+						sftpServer.Serve()
+						sftpServer.Close()
+					}
+				}
+			}
+		}()
+	}
+}
+
+func (server *sftpServer) addr() string {
+	return server.listener.Addr().String()
+}
+
+// Drops every open connection, as a restarted host would.
+func (server *sftpServer) drop() {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for _, conn := range server.conns {
+		conn.Close()
+	}
+	server.conns = nil
+}
+
+func (server *sftpServer) close() {
+	server.listener.Close()
+	server.drop()
+}
+
+// Counts the connections accepted so far.
+func (server *sftpServer) accepted() int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.accepts
+}
+
+// Returns a new age identity and its recipient.
+func ageIdentity() (string, string) {
+	identity, err := filippoage.GenerateX25519Identity()
+	if err != nil {
+		panic(err)
+	}
+	return identity.String(), identity.Recipient().String()
+}
+
 func TestSpec(t *testing.T) {
 	Convey("Confer", t, func() {
 		config := NewConfig()
@@ -425,6 +724,2901 @@ func TestSpec(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("Snapshots", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+
+			var buf bytes.Buffer
+			So(config.WriteSnapshot(&buf), ShouldBeNil)
+
+			restored := NewConfig()
+			So(restored.ReadSnapshot(&buf), ShouldBeNil)
+			So(restored.GetStringMap("app"), ShouldResemble, application_yaml)
+
+			Convey("Reload from the snapshot when its files are missing", func() {
+				restored.SetFileSystem(reader.MapFileSystem{})
+				report, err := restored.Reload()
+				So(err, ShouldNotBeNil)
+				So(report.Applied, ShouldBeEmpty)
+				So(restored.GetStringMap("app"), ShouldResemble, application_yaml)
+			})
+
+			Convey("Reload the files when they are present", func() {
+				restored.SetFileSystem(reader.MapFileSystem{
+					config.paths[0]: []byte("app:\n  name: reread\n"),
+				})
+				_, err := restored.Reload()
+				So(err, ShouldBeNil)
+				So(restored.GetString("app.name"), ShouldEqual, "reread")
+				So(restored.IsSet("app.database.host"), ShouldBeFalse)
+			})
+		})
+
+		Convey("Casters", func() {
+			config.Set("logging.level", "warn")
+			config.RegisterCaster(reflect.TypeOf(testLevel(0)), func(v interface{}) (interface{}, error) {
+				switch v {
+				case "info":
+					return testLevel(1), nil
+				case "warn":
+					return testLevel(2), nil
+				}
+				return nil, fmt.Errorf("unknown level %v", v)
+			})
+
+			var level testLevel
+			So(config.GetAs("logging.level", &level), ShouldBeNil)
+			So(level, ShouldEqual, testLevel(2))
+
+			config.Set("logging.level", "loud")
+			So(config.GetAs("logging.level", &level), ShouldNotBeNil)
+
+			Convey("Cast declared keys on Get", func() {
+				config.Define("logging.level").CastTo(reflect.TypeOf(testLevel(0)))
+				config.Set("logging.level", "info")
+				So(config.Get("logging.level"), ShouldEqual, testLevel(1))
+				So(config.GetAs("logging.level", &level), ShouldBeNil)
+				So(level, ShouldEqual, testLevel(1))
+
+				config.Set("logging.level", "loud")
+				_, err := config.GetE("logging.level")
+				So(err, ShouldNotBeNil)
+				So(config.Get("logging.level"), ShouldEqual, "loud")
+				So(config.Validate(), ShouldNotBeNil)
+				So(config.Validate().Error(), ShouldContainSubstring, "unknown level loud")
+			})
+
+			Convey("Convert only between numbers", func() {
+				config.Set("port", 65)
+				var port int64
+				So(config.GetAs("port", &port), ShouldBeNil)
+				So(port, ShouldEqual, 65)
+
+				var name string
+				So(config.GetAs("port", &name), ShouldNotBeNil)
+				So(name, ShouldEqual, "")
+			})
+
+			Convey("Reject casters returning nil", func() {
+				type region string
+				config.RegisterCaster(reflect.TypeOf(region("")), func(v interface{}) (interface{}, error) {
+					return nil, nil
+				})
+				config.Set("region", "eu-west")
+				var r region
+				So(func() { config.GetAs("region", &r) }, ShouldNotPanic)
+				So(config.GetAs("region", &r), ShouldNotBeNil)
+
+				config.Define("region").CastTo(reflect.TypeOf(region("")))
+				_, err := config.GetE("region")
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Cast fields on Unmarshal", func() {
+				config.Set("logging.level", "info")
+				config.Set("logging.levels", map[string]interface{}{"http": "warn", "db": "info"})
+				config.Set("logging.history", []interface{}{"info", "warn"})
+
+				var settings struct {
+					Logging struct {
+						Level   testLevel
+						Levels  map[string]testLevel
+						History []testLevel
+					}
+				}
+				So(config.Unmarshal(&settings), ShouldBeNil)
+				So(settings.Logging.Level, ShouldEqual, testLevel(1))
+				So(settings.Logging.Levels, ShouldResemble, map[string]testLevel{"http": 2, "db": 1})
+				So(settings.Logging.History, ShouldResemble, []testLevel{1, 2})
+
+				config.Set("logging.history", []interface{}{"info", "loud"})
+				So(config.Unmarshal(&settings), ShouldNotBeNil)
+
+				Convey("Including keys cast on Get", func() {
+					config.Define("logging.level").CastTo(reflect.TypeOf(testLevel(0)))
+					config.Set("logging.history", []interface{}{"warn"})
+					So(config.Unmarshal(&settings), ShouldBeNil)
+					So(settings.Logging.Level, ShouldEqual, testLevel(1))
+				})
+			})
+		})
+
+		Convey("Pointer accessors", func() {
+			So(config.GetBoolPtr("verbose"), ShouldBeNil)
+			So(config.GetIntPtr("retries"), ShouldBeNil)
+			So(config.GetStringPtr("name"), ShouldBeNil)
+
+			config.Set("verbose", false)
+			config.Set("retries", 0)
+			config.Set("name", "")
+
+			So(*config.GetBoolPtr("verbose"), ShouldEqual, false)
+			So(*config.GetIntPtr("retries"), ShouldEqual, 0)
+			So(*config.GetStringPtr("name"), ShouldEqual, "")
+		})
+
+		Convey("Lenient booleans", func() {
+			config.Set("a", "yes")
+			config.Set("b", "Off")
+			So(config.GetBool("a"), ShouldEqual, false)
+
+			config.SetBoolParser(LenientBool)
+			So(config.GetBool("a"), ShouldEqual, true)
+			So(config.GetBool("b"), ShouldEqual, false)
+			So(*config.GetBoolPtr("a"), ShouldEqual, true)
+		})
+
+		Convey("Per-layer settings", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			os.Setenv("APP_LOGGING_LEVEL", "trace")
+			config.BindEnv("app.logging.level")
+
+			So(config.SettingsFrom(LayerEnv), ShouldResemble, map[string]interface{}{
+				"app.logging.level": "trace",
+			})
+			So(config.SettingsFrom(LayerAttributes)["app.logging.level"], ShouldEqual, "info")
+			So(config.SettingsFrom(LayerFlags), ShouldResemble, map[string]interface{}{})
+			So(config.SettingsFrom("bogus"), ShouldBeNil)
+		})
+
+		Convey("Pluggable file systems and environments", func() {
+			config.SetFileSystem(reader.MapFileSystem{
+				"app.json": []byte(`{"app": {"name": "inline"}}`),
+			})
+			config.SetEnvironment(source.MapEnvironment{"APP_PORT": "8080"})
+			config.BindEnv("app.port")
+
+			So(config.ReadPaths("app.json"), ShouldBeNil)
+			So(config.GetString("app.name"), ShouldEqual, "inline")
+			So(config.GetInt("app.port"), ShouldEqual, 8080)
+
+			Convey("Reading raw bytes", func() {
+				So(config.ReadBytes([]byte(`{"app": {"debug": true}}`), "json"), ShouldBeNil)
+				So(config.GetBool("app.debug"), ShouldEqual, true)
+				So(config.GetString("app.name"), ShouldEqual, "inline")
+			})
+		})
+
+		Convey("Defensive copies", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+
+			db := config.GetStringMap("app.database")
+			db["host"] = "mutated"
+			So(config.GetString("app.database.host"), ShouldEqual, "localhost")
+
+			config.Get("app.database").(map[string]interface{})["host"] = "mutated"
+			So(config.GetString("app.database.host"), ShouldEqual, "localhost")
+
+			config.Set("app.tags", []interface{}{"a", "b"})
+			config.Get("app.tags").([]interface{})[0] = "mutated"
+			So(config.GetStringSlice("app.tags"), ShouldResemble, []string{"a", "b"})
+
+			Convey("Mutation checks panic on out-of-band changes", func() {
+				config.SetMutationChecks(true)
+				config.Set("app.name", "mutated")
+				So(func() { config.Get("app.database.port") }, ShouldNotPanic)
+
+				config.SetCopyOnRead(false)
+				config.Get("app.database").(map[string]interface{})["host"] = "mutated"
+				So(func() { config.Get("app.database.host") }, ShouldPanic)
+			})
+
+			Convey("Mutation checks cover overrides and defaults", func() {
+				config.SetMutationChecks(true)
+				replica := map[string]interface{}{"host": "replica.internal"}
+				config.Set("app.replica", replica)
+				So(func() { config.Get("app.replica.host") }, ShouldNotPanic)
+
+				replica["host"] = "mutated"
+				So(func() { config.Get("app.replica.host") }, ShouldPanic)
+
+				config.Set("app.replica", map[string]interface{}{"host": "replica.internal"})
+				So(func() { config.Get("app.replica.host") }, ShouldNotPanic)
+
+				pool := map[string]interface{}{"size": 4}
+				config.SetDefault("app.pool", pool)
+				pool["size"] = 64
+				So(func() { config.Get("app.name") }, ShouldPanic)
+			})
+		})
+
+		Convey("Bytes", func() {
+			config.ReadPaths("test/fixtures/binary.yaml")
+			So(config.GetBytes("tls.key"), ShouldResemble, []byte("hello"))
+			So(config.GetBytes("tls.ca"), ShouldResemble, []byte("hello"))
+			So(config.GetBytes("tls.cert"), ShouldResemble, []byte("not-really-a-certificate\n"))
+			So(config.GetString("tls.cert"), ShouldEqual, "@file:certs/server.pem")
+
+			var buf bytes.Buffer
+			So(config.WriteConfigFor(&buf, "test/fixtures/binary.yaml", ""), ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, "cert: '@file:certs/server.pem'")
+
+			_, err := config.GetBytesE("tls.missing")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Reloading", func() {
+			files := reader.MapFileSystem{
+				"app.yaml": []byte("logging:\n  level: info\nport: 80\n"),
+			}
+			config.SetFileSystem(files)
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+
+			var notified []Change
+			config.OnChange(func(changes []Change) {
+				notified = changes
+			})
+
+			files["app.yaml"] = []byte("logging:\n  level: debug\nport: 80\n")
+			report, err := config.Reload()
+
+			So(err, ShouldBeNil)
+			So(report.Applied, ShouldResemble, []Change{
+				{Key: "logging.level", Old: "info", New: "debug"},
+			})
+			So(notified, ShouldResemble, report.Applied)
+			So(config.GetString("logging.level"), ShouldEqual, "debug")
+		})
+
+		Convey("Deprecations", func() {
+			defer func(fn func() time.Time) { timeNow = fn }(timeNow)
+			timeNow = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+			config.Deprecate(Deprecation{
+				Key:          "app.logging",
+				Replacement:  "app.log",
+				EndOfSupport: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			})
+
+			Convey("Are aliased before their end of support", func() {
+				So(config.ReadPaths("test/fixtures/application.yaml"), ShouldBeNil)
+				So(config.GetString("app.log.level"), ShouldEqual, "info")
+			})
+
+			Convey("Are aliased at read time, beneath the replacement's own layers", func() {
+				files := reader.MapFileSystem{"app.yaml": []byte("app:\n  logging:\n    level: info\n    format: json\n")}
+				config.SetFileSystem(files)
+				So(config.ReadPaths("app.yaml"), ShouldBeNil)
+				So(config.SettingsFrom(LayerOverrides), ShouldBeEmpty)
+				So(config.AllKeys(), ShouldContain, "app.log.format")
+
+				config.SetEnvironment(source.MapEnvironment{"APP_LOG_LEVEL": "debug"})
+				config.BindEnv("app.log.level")
+				So(config.GetString("app.log.level"), ShouldEqual, "debug")
+				So(config.GetString("app.log.format"), ShouldEqual, "json")
+
+				files["app.yaml"] = []byte("app:\n  logging:\n    format: text\n")
+				_, err := config.Reload()
+				So(err, ShouldBeNil)
+				So(config.GetString("app.log.format"), ShouldEqual, "text")
+			})
+
+			Convey("Are errors after their end of support", func() {
+				timeNow = func() time.Time { return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) }
+				So(config.ReadPaths("test/fixtures/application.yaml"), ShouldNotBeNil)
+
+				config.SetDeprecationEnforcement(false)
+				So(config.CheckDeprecations(), ShouldBeNil)
+			})
+		})
+
+		Convey("Pinned keys", func() {
+			files := reader.MapFileSystem{
+				"app.yaml": []byte("server:\n  port: 80\n  workers: 1\n"),
+			}
+			config.SetFileSystem(files)
+			config.Pin("server.port")
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+
+			files["app.yaml"] = []byte("server:\n  port: 8080\n  workers: 4\n")
+			report, err := config.Reload()
+
+			So(err, ShouldBeNil)
+			So(report.Rejected, ShouldResemble, []Change{{Key: "server.port", Old: 80, New: 8080}})
+			So(report.Applied, ShouldResemble, []Change{{Key: "server.workers", Old: 1, New: 4}})
+			So(config.GetInt("server.port"), ShouldEqual, 80)
+		})
+
+		Convey("Pinned prefixes", func() {
+			files := reader.MapFileSystem{
+				"app.yaml": []byte("server:\n  port: 80\n"),
+			}
+			config.SetFileSystem(files)
+			config.SetDefault("server.workers", 2)
+			config.Pin("server")
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+
+			files["app.yaml"] = []byte("server:\n  port: 80\n  host: 0.0.0.0\n  workers: 8\n")
+			report, err := config.Reload()
+
+			So(err, ShouldBeNil)
+			So(report.Rejected, ShouldResemble, []Change{
+				{Key: "server.host", Old: nil, New: "0.0.0.0"},
+				{Key: "server.workers", Old: 2, New: 8},
+			})
+			So(config.IsSet("server.host"), ShouldBeFalse)
+			So(config.AllKeys(), ShouldNotContain, "server.host")
+			So(config.GetInt("server.workers"), ShouldEqual, 2)
+			So(config.InConfig("server.workers"), ShouldBeFalse)
+			So(config.SettingsFrom(LayerAttributes), ShouldResemble, map[string]interface{}{"server.port": 80})
+		})
+
+		Convey("Restart-required keys", func() {
+			files := reader.MapFileSystem{
+				"app.yaml": []byte("server:\n  port: 80\n  workers: 1\n"),
+			}
+			config.SetFileSystem(files)
+			config.RequireRestart("server.port")
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+
+			files["app.yaml"] = []byte("server:\n  port: 8080\n  workers: 4\n")
+			report, _ := config.Reload()
+
+			So(report.PendingRestart, ShouldResemble, []Change{{Key: "server.port", Old: 80, New: 8080}})
+			So(report.Applied, ShouldResemble, []Change{{Key: "server.workers", Old: 1, New: 4}})
+			So(config.RestartRequired(), ShouldBeTrue)
+
+			Convey("Until they are reverted", func() {
+				files["app.yaml"] = []byte("server:\n  port: 80\n  workers: 4\n")
+				config.Reload()
+				So(config.RestartRequired(), ShouldBeFalse)
+			})
+		})
+
+		Convey("Drift", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			changes, err := config.CompareToFile("test/fixtures/application.yaml")
+			So(err, ShouldBeNil)
+			So(changes, ShouldBeEmpty)
+
+			sum := config.Checksum()
+			So(config.CompareToChecksum(sum), ShouldBeTrue)
+
+			config.Set("app.logging.level", "debug")
+			changes, err = config.CompareToFile("test/fixtures/application.yaml")
+			So(err, ShouldBeNil)
+			So(changes, ShouldResemble, []Change{{Key: "app.logging.level", Old: "info", New: "debug"}})
+			So(config.CompareToChecksum(sum), ShouldBeFalse)
+		})
+
+		Convey("Checksums don't depend on the source format or helper functions", func() {
+			So(config.ReadBytes([]byte("app:\n  workers: 8\n  tags: [a, b]\n  db:\n    host: x\n    port: 5432\n"), "yaml"), ShouldBeNil)
+			config.SetDefault("app.hook", func() {})
+
+			other := NewConfig()
+			So(other.ReadBytes([]byte(`{"app": {"db": {"port": 5432, "host": "x"}, "tags": ["a", "b"], "workers": 8}}`), "json"), ShouldBeNil)
+			other.SetDefault("app.hook", func() {})
+
+			So(config.Checksum(), ShouldEqual, other.Checksum())
+			So(config.CompareToChecksum(other.Checksum()), ShouldBeTrue)
+
+			other.Set("app.db.port", 5433)
+			So(config.Checksum(), ShouldNotEqual, other.Checksum())
+		})
+
+		Convey("Dumping and loading state", func() {
+			config.SetEnvironment(source.MapEnvironment{
+				"APP_DATABASE_PASSWORD": "hunter2",
+				"APP_LOGGING_LEVEL":     "trace",
+			})
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.BindEnv("app.database.password")
+			config.BindEnv("app.logging.level")
+			config.Set("app.server.workers", 4)
+
+			var buf bytes.Buffer
+			So(config.DumpState(&buf), ShouldBeNil)
+			So(buf.String(), ShouldNotContainSubstring, "hunter2")
+
+			restored, err := LoadState(&buf)
+			So(err, ShouldBeNil)
+			So(restored.GetString("app.logging.level"), ShouldEqual, "trace")
+			So(restored.GetInt("app.server.workers"), ShouldEqual, 4)
+			So(restored.GetString("app.database.host"), ShouldEqual, "localhost")
+			So(restored.GetString("app.database.password"), ShouldEqual, Redacted)
+		})
+
+		Convey("Dumping state captures the files as loaded", func() {
+			files := reader.MapFileSystem{"app.yaml": []byte("app:\n  name: loaded\n")}
+			config.SetFileSystem(files)
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+			files["app.yaml"] = []byte("app:\n  name: edited\n")
+
+			var buf bytes.Buffer
+			So(config.DumpState(&buf), ShouldBeNil)
+			So(buf.String(), ShouldNotContainSubstring, "edited")
+
+			restored, err := LoadState(&buf)
+			So(err, ShouldBeNil)
+			So(restored.GetString("app.name"), ShouldEqual, "loaded")
+		})
+
+		Convey("Dumping and loading state with custom variable names", func() {
+			config.SetEnvironment(source.MapEnvironment{
+				"CUSTOM_NAME":             "custom",
+				"MYAPP_APP_DATABASE_HOST": "db.internal",
+			})
+			config.ReadPaths("test/fixtures/application.yaml")
+			So(config.BindEnv("app.name", "CUSTOM_NAME"), ShouldBeNil)
+			So(config.OverlayEnv("MYAPP_").Bound, ShouldResemble, map[string]string{"MYAPP_APP_DATABASE_HOST": "app.database.host"})
+			So(config.GetString("app.name"), ShouldEqual, "custom")
+
+			var buf bytes.Buffer
+			So(config.DumpState(&buf), ShouldBeNil)
+
+			restored, err := LoadState(&buf)
+			So(err, ShouldBeNil)
+			So(restored.GetString("app.name"), ShouldEqual, "custom")
+			So(restored.GetString("app.database.host"), ShouldEqual, "db.internal")
+		})
+
+		Convey("Schedules", func() {
+			config.ReadPaths("test/fixtures/schedules.yaml")
+
+			cron := config.GetCron("jobs.cleanup.schedule")
+			So(cron, ShouldNotBeNil)
+
+			// A Saturday.
+			saturday := time.Date(2015, 6, 6, 12, 0, 0, 0, time.UTC)
+			So(cron.Next(saturday), ShouldResemble, time.Date(2015, 6, 8, 9, 0, 0, 0, time.UTC))
+
+			So(config.GetClockTime("jobs.cleanup.quiet_hours_start"), ShouldResemble, ClockTime{Hour: 22, Minute: 30})
+
+			_, err := config.GetCronE("jobs.broken.schedule")
+			So(err, ShouldNotBeNil)
+			_, err = config.GetClockTimeE("jobs.broken.quiet_hours_start")
+			So(err, ShouldNotBeNil)
+
+			Convey("Are validated by the schema", func() {
+				config.Define("jobs.cleanup.schedule").As(TypeCron)
+				So(config.Validate(), ShouldBeNil)
+
+				config.Define("jobs.broken.schedule").As(TypeCron)
+				config.Define("jobs.broken.quiet_hours_start").As(TypeClockTime)
+				So(config.Validate(), ShouldNotBeNil)
+				So(config.ReadPaths("test/fixtures/schedules.yaml"), ShouldNotBeNil)
+			})
+		})
+
+		Convey("Weighted maps", func() {
+			config.RequirePercentages("traffic.split")
+			So(config.ReadBytes([]byte(`{"traffic": {"split": {"stable": 90, "canary": 10}}}`), "json"), ShouldBeNil)
+			So(config.Validate(), ShouldBeNil)
+
+			config.Set("traffic.split.canary", 20)
+			err := config.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `weights in "traffic.split" sum to 110, expected 100`)
+		})
+
+		Convey("Documenting environment variables", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.Define("app.logging.level").Describe("Minimum log level")
+			config.AutomaticEnv()
+
+			docs := config.DocumentEnv()
+			So(docs[0], ShouldResemble, EnvVarDoc{
+				Name:    "APP_DATABASE_HOST",
+				Key:     "app.database.host",
+				Type:    "string",
+				Default: "localhost",
+			})
+			So(docs[1].Default, ShouldEqual, Redacted)
+			So(docs[3].Description, ShouldEqual, "Minimum log level")
+		})
+
+		Convey("Exporting ConfigMaps", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			out, err := config.ExportK8sConfigMap("api", "prod", "app.database")
+			So(err, ShouldBeNil)
+
+			exported := NewConfig()
+			So(exported.ReadBytes(out, "yaml"), ShouldBeNil)
+			So(exported.GetString("metadata.namespace"), ShouldEqual, "prod")
+
+			data := exported.GetStringMapString("data")
+			So(exported.ReadBytes([]byte(data[ConfigMapKey]), "yaml"), ShouldBeNil)
+			So(exported.GetString("app.database.host"), ShouldEqual, "localhost")
+			So(exported.GetString("app.database.password"), ShouldEqual, Redacted)
+			So(exported.IsSet("app.logging.level"), ShouldBeFalse)
+		})
+
+		Convey("Helm values", func() {
+			So(config.ReadHelmValues("test/fixtures/helm/values.yaml", "test/fixtures/helm/production.yaml"), ShouldBeNil)
+			So(config.GetInt("replicas"), ShouldEqual, 3)
+			So(config.IsSet("resources.limits.cpu"), ShouldBeFalse)
+			So(config.GetString("resources.limits.memory"), ShouldEqual, "256Mi")
+
+			So(config.HelmSet(`image.tag=1.4.2,hosts={a.example.com,b.example.com},servers[1].port=8080,annotations.example\.com/team=core`), ShouldBeNil)
+			So(config.GetString("image.tag"), ShouldEqual, "1.4.2")
+			So(config.GetStringSlice("hosts"), ShouldResemble, []string{"a.example.com", "b.example.com"})
+			So(config.Get("servers"), ShouldResemble, []interface{}{nil, map[string]interface{}{"port": int64(8080)}})
+			So(config.GetStringMapString("annotations"), ShouldResemble, map[string]string{"example.com/team": "core"})
+
+			So(config.HelmSetString("replicas=007"), ShouldBeNil)
+			So(config.Get("replicas"), ShouldEqual, "007")
+
+			So(config.HelmSet("image.repository=null"), ShouldBeNil)
+			So(config.IsSet("image.repository"), ShouldBeFalse)
+
+			_, err := ParseHelmSet("image.tag")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Unmarshal", func() {
+			type database struct {
+				Host     string
+				Port     int
+				Timeout  time.Duration
+				Password string
+			}
+			type app struct {
+				Logging struct {
+					Level testLevel
+				}
+				Database database
+				Debug    bool `mapstructure:"debug_mode"`
+			}
+
+			config.RegisterCaster(reflect.TypeOf(testLevel(0)), func(v interface{}) (interface{}, error) {
+				return testLevel(len(fmt.Sprint(v))), nil
+			})
+			config.SetBoolParser(LenientBool)
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.SetDefault("app.database.port", 5432)
+			config.SetDefault("app.database.timeout", "5s")
+			config.Set("app.debug_mode", "yes")
+
+			config.SetEnvironment(source.MapEnvironment{"APP_DATABASE_HOST": "db.internal"})
+			config.BindEnv("app.database.host")
+
+			port := "6432"
+			config.BindPFlag("app.database.port", &pflag.Flag{Name: "port", Value: newStringValue(port, &port), Changed: true})
+
+			var settings struct{ App app }
+			So(config.Unmarshal(&settings), ShouldBeNil)
+			So(settings.App.Database, ShouldResemble, database{
+				Host:     "db.internal",
+				Port:     6432,
+				Timeout:  5 * time.Second,
+				Password: "spend_an_hour_tweaking_your_pg_hba_for_this",
+			})
+			So(settings.App.Logging.Level, ShouldEqual, testLevel(4))
+			So(settings.App.Debug, ShouldBeTrue)
+		})
+
+		Convey("Expressions", func() {
+			config.Set("env", "production")
+			config.Set("server.cpus", 4)
+			config.Set("server.workers", "expr: server.cpus * 2")
+			config.Set("server.log_level", "expr: env == 'production' ? 'warn' : 'debug'")
+			config.Set("server.hosts", "expr: ['a', 'b'].map(h, h + '.' + config['env'])")
+
+			So(config.IsExpression("server.workers"), ShouldBeTrue)
+			So(config.IsExpression("server.cpus"), ShouldBeFalse)
+
+			workers, err := config.EvalKey("server.workers")
+			So(err, ShouldBeNil)
+			So(workers, ShouldEqual, 8)
+
+			level, _ := config.EvalKey("server.log_level")
+			So(level, ShouldEqual, "warn")
+
+			hosts, _ := config.EvalKey("server.hosts")
+			So(hosts, ShouldResemble, []interface{}{"a.production", "b.production"})
+
+			_, err = config.EvalKey("server.cpus")
+			So(err, ShouldNotBeNil)
+
+			config.SetExpressionLimits(ExpressionLimits{Cost: 100})
+			config.Set("server.busy", "expr: [1,2,3,4,5,6,7,8,9,10].all(x, [1,2,3,4,5,6,7,8,9,10].all(y, x + y > 0))")
+			_, err = config.EvalKey("server.busy")
+			So(err.Error(), ShouldContainSubstring, "cost limit")
+		})
+
+		Convey("Unmarshaling a key", func() {
+			type database struct {
+				Host string
+				User string
+			}
+
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.SetEnvironment(source.MapEnvironment{"APP_DATABASE_USER": "admin"})
+			config.BindEnv("app.database.user")
+
+			var db database
+			So(config.UnmarshalKey("App.Database", &db), ShouldBeNil)
+			So(db, ShouldResemble, database{Host: "localhost", User: "admin"})
+
+			var level string
+			So(config.UnmarshalKey("app.logging.level", &level), ShouldBeNil)
+			So(level, ShouldEqual, "info")
+
+			So(config.UnmarshalKey("app.cache", &db), ShouldNotBeNil)
+		})
+
+		Convey("Policies", func() {
+			So(config.AddPolicy("production needs redundancy", "env != 'production' || replicas >= 2"), ShouldBeNil)
+			So(config.AddPolicy("broken", "replicas >="), ShouldNotBeNil)
+
+			config.Set("env", "staging")
+			config.Set("replicas", 1)
+			So(config.Validate(), ShouldBeNil)
+
+			config.Set("env", "production")
+			err := config.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `policy "production needs redundancy" violated`)
+
+			So(config.AddPolicy("size", "size"), ShouldBeNil)
+			So(config.Validate().Error(), ShouldContainSubstring, `policy "size" could not be evaluated`)
+		})
+
+		Convey("Decode hooks", func() {
+			type upstream struct {
+				Addr     net.IP
+				Endpoint url.URL
+				Proxy    *url.URL
+				Timeout  time.Duration
+				Level    testLevel
+			}
+
+			config.Set("upstream.addr", "10.0.0.1")
+			config.Set("upstream.endpoint", "https://api.example.com/v1")
+			config.Set("upstream.proxy", "http://proxy:3128")
+			config.Set("upstream.timeout", "30s")
+			config.Set("upstream.level", "warn")
+
+			config.RegisterDecodeHook(func(from, to reflect.Type, data interface{}) (interface{}, error) {
+				if to != reflect.TypeOf(testLevel(0)) || from.Kind() != reflect.String {
+					return data, nil
+				}
+				return testLevel(2), nil
+			})
+
+			var u upstream
+			So(config.UnmarshalKey("upstream", &u), ShouldBeNil)
+			So(u.Addr.String(), ShouldEqual, "10.0.0.1")
+			So(u.Endpoint.Host, ShouldEqual, "api.example.com")
+			So(u.Proxy.Host, ShouldEqual, "proxy:3128")
+			So(u.Timeout, ShouldEqual, 30*time.Second)
+			So(u.Level, ShouldEqual, testLevel(2))
+		})
+
+		Convey("Files without an extension", func() {
+			So(config.ReadPaths("test/fixtures/extensionless/database"), ShouldBeNil)
+			So(config.GetString("database.host"), ShouldEqual, "db.internal")
+
+			So(config.ReadPaths("test/fixtures/extensionless/database-json"), ShouldBeNil)
+			So(config.GetString("database.host"), ShouldEqual, "json.internal")
+
+			So(config.ReadPaths("test/fixtures/extensionless/database-yaml"), ShouldBeNil)
+			So(config.GetString("database.host"), ShouldEqual, "yaml.internal")
+
+			config.SetConfigType("json")
+			So(config.ReadPaths("test/fixtures/extensionless/database-yaml"), ShouldNotBeNil)
+		})
+
+		Convey("Strict unmarshaling", func() {
+			var settings struct {
+				App struct {
+					Database struct {
+						Host string
+						User string
+					}
+				}
+			}
+
+			config.Set("app.database.host", "localhost")
+			config.Set("app.database.user", "postgres")
+			So(config.UnmarshalExact(&settings), ShouldBeNil)
+
+			config.Set("app.databse.host", "typo")
+			config.Set("app.database.pasword", "typo")
+			err := config.UnmarshalExact(&settings)
+			So(err, ShouldResemble, &errors.UnknownKeysError{Keys: []string{"app.database.pasword", "app.databse"}})
+		})
+
+		Convey("Archives", func() {
+			So(config.ReadPaths("test/fixtures/configs.tar.gz//app/application.yaml"), ShouldBeNil)
+			So(config.GetString("app.database.host"), ShouldEqual, "localhost")
+
+			config.Unset("app.database.host")
+			So(config.ReadPaths("test/fixtures/configs.zip//app/application.yaml"), ShouldBeNil)
+			So(config.GetString("app.database.host"), ShouldEqual, "localhost")
+
+			So(config.ReadPaths("test/fixtures/configs.zip//app/missing.yaml"), ShouldNotBeNil)
+
+			files, err := reader.OpenArchive(reader.OSFileSystem{}, "test/fixtures/configs.tar.gz")
+			So(err, ShouldBeNil)
+			So(files, ShouldContainKey, "app/application.yaml")
+		})
+
+		Convey("Slice getters", func() {
+			config.Set("ports", []interface{}{80, "443"})
+			config.Set("toggles", "yes no on")
+			config.Set("weights", []interface{}{0.5, 1, "2.5"})
+			config.Set("routes", map[string]interface{}{
+				"api": []interface{}{"api-1", "api-2"},
+				"web": "web-1",
+			})
+			config.SetBoolParser(LenientBool)
+
+			So(config.GetIntSlice("ports"), ShouldResemble, []int{80, 443})
+			So(config.GetBoolSlice("toggles"), ShouldResemble, []bool{true, false, true})
+			So(config.GetFloat64Slice("weights"), ShouldResemble, []float64{0.5, 1, 2.5})
+			So(config.GetStringMapStringSlice("routes"), ShouldResemble, map[string][]string{
+				"api": {"api-1", "api-2"},
+				"web": {"web-1"},
+			})
+			So(config.GetIntSlice("missing"), ShouldBeNil)
+		})
+
+		Convey("Object sources", func() {
+			body := "app:\n  replicas: 2\n"
+			etag := `"v1"`
+			var mu sync.Mutex
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if r.URL.Path != "/configs/app.yaml" || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				if r.Header.Get("If-None-Match") == etag {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", etag)
+				fmt.Fprint(w, body)
+			}))
+			defer srv.Close()
+
+			RegisterObjectStore("s3test", s3.New(s3.Options{
+				Endpoint:        srv.URL,
+				PathStyle:       true,
+				AccessKeyID:     "AKID",
+				SecretAccessKey: "secret",
+			}))
+
+			changed := make(chan []Change, 1)
+			config.OnChange(func(changes []Change) { changed <- changes })
+
+			So(config.AddObjectSource("s3test://configs/app.yaml", 10*time.Millisecond), ShouldBeNil)
+			defer config.StopObjectSources()
+			So(config.GetInt("app.replicas"), ShouldEqual, 2)
+
+			mu.Lock()
+			body, etag = "app:\n  replicas: 3\n", `"v2"`
+			mu.Unlock()
+
+			select {
+			case changes := <-changed:
+				So(changes, ShouldResemble, []Change{{Key: "app.replicas", Old: 2, New: 3}})
+			case <-time.After(time.Second):
+				So("no change detected", ShouldBeNil)
+			}
+
+			So(config.AddObjectSource("s3test://configs/missing.yaml", 0), ShouldNotBeNil)
+			So(config.AddObjectSource("gopher://configs/app.yaml", 0), ShouldNotBeNil)
+		})
+
+		Convey("Generating Go source", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.Set("app.ratio", 1.0)
+			config.Set("app.hosts", []interface{}{"a", "b"})
+
+			var src bytes.Buffer
+			So(config.GenerateGo(&src, GenerateOptions{Package: "settings", Exclude: []string{"app.logging"}}), ShouldBeNil)
+
+			generated := src.String()
+			So(generated, ShouldStartWith, "// Code generated by confer-gen. DO NOT EDIT.")
+			So(generated, ShouldContainSubstring, "package settings")
+			So(generated, ShouldContainSubstring, "type SettingsAppDatabase struct {")
+			So(generated, ShouldContainSubstring, `Host: "localhost",`)
+			So(generated, ShouldContainSubstring, `[]string{"a", "b"}`)
+			So(generated, ShouldContainSubstring, "= 1.0\n")
+			So(generated, ShouldNotContainSubstring, "Logging")
+			So(generated, ShouldNotContainSubstring, "spend_an_hour")
+		})
+
+		Convey("Must getters", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.BindEnv("app.database.url")
+			config.Set("app.database.port", "not a port")
+
+			So(config.MustGetString("app.database.host"), ShouldEqual, "localhost")
+			So(func() { config.MustGetString("app.database.url") }, ShouldPanicWith,
+				`confer: required key "app.database.url" is not set (searched environment variable APP_DATABASE_URL; files test/fixtures/application.yaml; defaults)`)
+			So(func() { config.MustGetInt("app.database.port") }, ShouldPanic)
+		})
+
+		Convey("Environment overlays", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.SetEnvironment(source.MapEnvironment{
+				"APP_APP_DATABASE_HOST": "db.internal",
+				"APP_NAP_TIME":          "20m",
+				"APP_APP_DATABASE":      "oops",
+				"HOME":                  "/root",
+			})
+
+			overlay := config.OverlayEnv("APP_")
+			So(overlay.Bound, ShouldResemble, map[string]string{"APP_APP_DATABASE_HOST": "app.database.host"})
+			So(overlay.Ignored, ShouldResemble, []string{"APP_APP_DATABASE", "APP_NAP_TIME"})
+
+			So(config.GetString("app.database.host"), ShouldEqual, "db.internal")
+			So(config.IsSet("nap.time"), ShouldBeFalse)
+		})
+
+		Convey("Generic accessors", func() {
+			config.Set("server.port", "8080")
+			config.Set("server.timeout", "5s")
+			config.Set("server.hosts", []interface{}{"a", "b"})
+			config.Set("server.tls.enabled", true)
+
+			So(Get[int](config, "server.port"), ShouldEqual, 8080)
+			So(Get[time.Duration](config, "server.timeout"), ShouldEqual, 5*time.Second)
+			So(Get[[]string](config, "server.hosts"), ShouldResemble, []string{"a", "b"})
+			So(Get[struct{ Enabled bool }](config, "server.tls").Enabled, ShouldBeTrue)
+
+			_, ok := Lookup[int](config, "server.missing")
+			So(ok, ShouldBeFalse)
+
+			port, ok := Lookup[int](config, "server.timeout")
+			So(ok, ShouldBeFalse)
+			So(port, ShouldEqual, 0)
+		})
+
+		Convey("Ambiguous environment variables", func() {
+			config.SetDefault("app.database.host", "localhost")
+			config.SetDefault("app.database_host", "legacy")
+			config.SetEnvironment(source.MapEnvironment{
+				"APP_DATABASE_HOST":  "db.internal",
+				"APP__DATABASE_HOST": "db.explicit",
+			})
+
+			overlay := config.OverlayEnv("")
+			So(overlay.Bound, ShouldResemble, map[string]string{"APP__DATABASE_HOST": "app.database_host"})
+			So(overlay.Ambiguous, ShouldResemble, []EnvAmbiguity{
+				{Variable: "APP_DATABASE_HOST", Keys: []string{"app.database.host", "app.database_host"}},
+			})
+			So(config.GetString("app.database_host"), ShouldEqual, "db.explicit")
+			So(config.GetString("app.database.host"), ShouldEqual, "localhost")
+
+			config.AutomaticEnv()
+			So(config.EnvAmbiguities(), ShouldResemble, []EnvAmbiguity{
+				{Variable: "APP_DATABASE_HOST", Keys: []string{"app.database.host", "app.database_host"}},
+			})
+			So(config.GetString("app.database_host"), ShouldEqual, "db.explicit")
+			So(config.GetString("app.database.host"), ShouldEqual, "db.internal")
+		})
+
+		Convey("Inline fallbacks", func() {
+			config.Set("queue.workers", 8)
+			config.Set("queue.name", "jobs")
+			config.Set("queue.timeout", "bogus")
+
+			So(config.GetIntDefault("queue.workers", 4), ShouldEqual, 8)
+			So(config.GetStringDefault("queue.name", "default"), ShouldEqual, "jobs")
+			So(config.GetStringDefault("queue.missing", "default"), ShouldEqual, "default")
+			So(config.GetBoolDefault("queue.enabled", true), ShouldBeTrue)
+			So(config.GetDurationDefault("queue.timeout", time.Second), ShouldEqual, time.Second)
+
+			So(GetOr(config, "queue.workers", 4), ShouldEqual, 8)
+			So(GetOr(config, "queue.retries", 3), ShouldEqual, 3)
+			So(GetOr(config, "queue.timeout", 5*time.Second), ShouldEqual, 5*time.Second)
+		})
+
+		Convey("Deep access through scalars", func() {
+			config.MergeAttributes(map[string]interface{}{
+				"app": map[string]interface{}{"logging": map[string]interface{}{"level": "info"}},
+			})
+			config.MergeAttributes(map[string]interface{}{
+				"app": map[string]interface{}{"logging": "debug"},
+			})
+
+			So(config.Get("app.logging.level"), ShouldBeNil)
+			So(config.IsSet("app.logging.level"), ShouldBeFalse)
+
+			val, err := config.GetE("app.logging.level")
+			So(val, ShouldBeNil)
+			So(err, ShouldHaveSameTypeAs, &errors.WrongShapeError{})
+			So(err.(*errors.WrongShapeError).Ancestor, ShouldEqual, "app.logging")
+
+			val, err = config.GetE("app.missing.level")
+			So(val, ShouldBeNil)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Scoped managers", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.SetEnvironment(source.MapEnvironment{"APP_DATABASE_PORT": "6543"})
+			config.BindEnv("app.database.port")
+			config.MarkSecret("app.database.host")
+
+			db := config.Sub("app.database")
+			So(db.GetString("host"), ShouldEqual, "localhost")
+			So(db.GetInt("port"), ShouldEqual, 6543)
+			So(db.IsSecret("host"), ShouldBeTrue)
+			So(db.IsSet("app"), ShouldBeFalse)
+
+			db.Set("host", "db.internal")
+			So(config.GetString("app.database.host"), ShouldEqual, "localhost")
+
+			So(config.Sub("app.database.host"), ShouldBeNil)
+			So(config.Sub("app.cache").AllKeys(), ShouldBeEmpty)
+		})
+
+		Convey("Coercion policies", func() {
+			config.Set("ids.account", int64(9007199254740993))
+			config.Set("ratio", float32(0.5))
+			config.Set("port", "8080")
+
+			So(config.Get("ids.account"), ShouldHaveSameTypeAs, 0)
+			So(config.Get("port"), ShouldEqual, "8080")
+
+			config.SetCoercer(PreserveTypes)
+			So(config.Get("ids.account"), ShouldEqual, int64(9007199254740993))
+			So(config.Get("ratio"), ShouldEqual, float32(0.5))
+
+			config.SetCoercer(AggressiveTypes)
+			So(config.Get("port"), ShouldEqual, 8080)
+			So(config.Get("ids.account"), ShouldHaveSameTypeAs, 0)
+		})
+
+		Convey("Per path options", func() {
+			So(config.ReadPaths("test/fixtures/strict/duplicate.json"), ShouldBeNil)
+			So(config.GetString("app.name"), ShouldEqual, "second")
+
+			err := config.ReadPathsWithOptions(PathSpec{Path: "test/fixtures/strict/duplicate.yaml", Strict: true})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "already set")
+
+			err = config.ReadPathsWithOptions(PathSpec{Path: "test/fixtures/strict/duplicate.json", Strict: true})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `duplicate key "app.name"`)
+
+			err = config.ReadPathsWithOptions(
+				PathSpec{Path: "test/fixtures/strict/settings.conf", Format: "yaml", Required: true},
+				PathSpec{Path: "test/fixtures/strict/local.yaml"},
+			)
+			So(err, ShouldBeNil)
+			So(config.GetInt("app.port"), ShouldEqual, 8080)
+
+			err = config.ReadPathsWithOptions(PathSpec{Path: "test/fixtures/strict/local.yaml", Required: true})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Unsetting keys", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+
+			config.Unset("App.Database.Host")
+			So(config.IsSet("app.database.host"), ShouldBeFalse)
+			So(config.GetString("app.database.user"), ShouldEqual, "postgres")
+
+			config.Unset("app.logging")
+			So(config.IsSet("app.logging"), ShouldBeFalse)
+			So(config.IsSet("app.logging.level"), ShouldBeFalse)
+			So(config.AllKeys(), ShouldNotContain, "app.logging.level")
+
+			config.Unset("app.missing.key")
+			config.Set("app.logging.level", "debug")
+			So(config.GetString("app.logging.level"), ShouldEqual, "debug")
+		})
+
+		Convey("Missing key logging", func() {
+			config.SetMissingKeyLogging(true)
+			config.Set("app.name", "confer")
+
+			So(config.GetString("App.Databse.Host"), ShouldEqual, "")
+			So(config.GetString("app.name"), ShouldEqual, "confer")
+
+			logged := []string{}
+			config.missingKeys.Range(func(key, _ interface{}) bool {
+				logged = append(logged, key.(string))
+				return true
+			})
+			So(logged, ShouldResemble, []string{"app.databse.host"})
+
+			config.SetMissingKeyLogging(false)
+			So(config.GetString("app.other"), ShouldEqual, "")
+		})
+
+		Convey("Documents with a list at the root", func() {
+			err := config.ReadPaths("test/fixtures/lists/rules.yaml")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "ReadPathsInto")
+
+			So(config.ReadPathsInto("acl.rules", "test/fixtures/lists/rules.yaml"), ShouldBeNil)
+			rules := config.Get("acl.rules").([]interface{})
+			So(rules, ShouldHaveLength, 2)
+			So(rules[0], ShouldResemble, map[string]interface{}{
+				"match": "/admin",
+				"allow": []interface{}{"ops"},
+			})
+
+			So(config.ReadPathsInto("acl.rules", "test/fixtures/lists/rules.json"), ShouldBeNil)
+			So(config.Get("acl.rules"), ShouldHaveLength, 1)
+			_, err = config.Reload()
+			So(err, ShouldBeNil)
+			So(config.Get("acl.rules"), ShouldHaveLength, 1)
+		})
+
+		Convey("Published views", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.Set("features.beta", true)
+
+			view := config.View()
+			So(view.GetString("app.database.host"), ShouldEqual, "localhost")
+			So(view.GetBool("features.beta"), ShouldBeTrue)
+			So(view.GetStringMap("app.logging"), ShouldResemble, map[string]interface{}{"level": "info"})
+			So(config.View(), ShouldEqual, view)
+
+			allocs := testing.AllocsPerRun(100, func() {
+				view.GetString("app.database.host")
+				view.GetBool("features.beta")
+			})
+			So(allocs, ShouldEqual, 0)
+
+			config.MergeAttributes(map[string]interface{}{
+				"app": map[string]interface{}{"database": map[string]interface{}{"host": "db.internal"}},
+			})
+			So(view.GetString("app.database.host"), ShouldEqual, "localhost")
+			So(config.View().GetString("app.database.host"), ShouldEqual, "db.internal")
+
+			reloaded := config.View()
+			config.Set("app.database.host", "override.internal")
+			So(reloaded.GetString("app.database.host"), ShouldEqual, "db.internal")
+			So(config.View().GetString("app.database.host"), ShouldEqual, "override.internal")
+
+			config.SetEnvironment(source.MapEnvironment{"APP_LOGGING_LEVEL": "debug"})
+			config.BindEnv("app.logging.level")
+			So(config.View().GetString("app.logging.level"), ShouldEqual, "info")
+			config.Publish()
+			So(config.View().GetString("app.logging.level"), ShouldEqual, "debug")
+		})
+
+		Convey("Watching files", func() {
+			dir, _ := os.MkdirTemp("", "confer")
+			defer os.RemoveAll(dir)
+			file := dir + "/application.yaml"
+			os.WriteFile(file, []byte("app:\n  name: before\n"), 0644)
+
+			So(config.ReadPaths(file), ShouldBeNil)
+			So(config.WatchConfig(), ShouldBeNil)
+			defer config.StopWatching()
+
+			events := make(chan Event, 1)
+			config.OnConfigChange(func(e Event) { events <- e })
+
+			os.WriteFile(file, []byte("app:\n  name: after\n"), 0644)
+
+			select {
+			case e := <-events:
+				So(e.Path, ShouldEqual, file)
+				So(e.Err, ShouldBeNil)
+				So(e.Report.Applied, ShouldResemble, []Change{{Key: "app.name", Old: "before", New: "after"}})
+			case <-time.After(5 * time.Second):
+				So("no event", ShouldBeEmpty)
+			}
+
+			config.SetFileSystem(reader.MapFileSystem{})
+			config.StopWatching()
+			So(config.WatchConfig(), ShouldNotBeNil)
+		})
+
+		Convey("Writing settings back to their origin", func() {
+			dir, _ := os.MkdirTemp("", "confer")
+			defer os.RemoveAll(dir)
+			os.WriteFile(dir+"/base.yaml", []byte("app:\n  name: confer\n  port: 80\n"), 0644)
+			os.WriteFile(dir+"/local.json", []byte(`{"app": {"port": 8080}}`), 0644)
+
+			config.SetRootPath(dir)
+			So(config.ReadPaths("base.yaml", "local.json"), ShouldBeNil)
+			config.Set("app.port", 9090)
+			config.Set("app.debug", true)
+
+			origin, _ := config.Origin("app.name")
+			So(origin, ShouldEqual, dir+"/base.yaml")
+			origin, _ = config.Origin("app.port")
+			So(origin, ShouldEqual, dir+"/local.json")
+			_, exists := config.Origin("app.debug")
+			So(exists, ShouldBeFalse)
+
+			var buf bytes.Buffer
+			So(config.WriteConfigFor(&buf, "local.json", ""), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "{\n  \"app\": {\n    \"port\": 9090\n  }\n}\n")
+
+			config.Unset("app.name")
+			So(config.WriteConfigFiles(), ShouldBeNil)
+			base, _ := os.ReadFile(dir + "/base.yaml")
+			So(string(base), ShouldEqual, "app:\n  port: 80\n")
+		})
+
+		Convey("Batch reads", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.SetEnvironment(source.MapEnvironment{"APP_LOGGING_LEVEL": "debug"})
+			config.BindEnv("app.logging.level")
+
+			So(config.GetMany("app.database.host", "App.Logging.Level", "app.missing"), ShouldResemble, map[string]interface{}{
+				"app.database.host": "localhost",
+				"App.Logging.Level": "debug",
+			})
+
+			env := &countingEnvironment{MapEnvironment: source.MapEnvironment{"APP_DATABASE_HOST": "db.internal", "APP_DATABASE_PORT": "5433"}}
+			config.SetEnvironment(env)
+			config.BindEnv("app.database.host")
+			config.BindEnv("app.database.port")
+			So(config.GetMany("app.database.host", "app.database.port", "app.logging.level"), ShouldResemble, map[string]interface{}{
+				"app.database.host": "db.internal",
+				"app.database.port": "5433",
+				"app.logging.level": "info",
+			})
+			So(env.environs, ShouldEqual, 1)
+			So(env.getenvs, ShouldEqual, 0)
+		})
+
+		Convey("Watching keys", func() {
+			files := reader.MapFileSystem{
+				"app.yaml": []byte("app:\n  logging:\n    level: info\n  name: confer\n"),
+			}
+			config.SetFileSystem(files)
+			config.ReadPaths("app.yaml")
+
+			seen := []Change{}
+			config.Watch("app.logging", func(key string, old, new interface{}) {
+				seen = append(seen, Change{Key: key, Old: old, New: new})
+			})
+
+			files["app.yaml"] = []byte("app:\n  logging:\n    level: debug\n  name: renamed\n")
+			config.Reload()
+			So(seen, ShouldResemble, []Change{{Key: "app.logging.level", Old: "info", New: "debug"}})
+		})
+
+		Convey("Memoized values", func() {
+			config.Set("http.origin", "^https://.*\\.example\\.com$")
+
+			parses := 0
+			origin := Memo(config, "http.origin", func(val interface{}) (*regexp.Regexp, error) {
+				parses++
+				return regexp.Compile(cast.ToString(val))
+			})
+
+			re, err := origin()
+			So(err, ShouldBeNil)
+			So(re.MatchString("https://api.example.com"), ShouldBeTrue)
+			origin()
+			So(parses, ShouldEqual, 1)
+
+			config.Set("http.origin", "(")
+			_, err = origin()
+			So(err, ShouldNotBeNil)
+			So(parses, ShouldEqual, 2)
+		})
+
+		Convey("Overlays across formats", func() {
+			for _, base := range []string{"yaml", "toml", "json"} {
+				for _, overlay := range []string{"yaml", "toml", "json"} {
+					config := NewConfig()
+					So(config.ReadPaths(
+						"test/fixtures/application."+base,
+						"test/fixtures/environments/development."+overlay,
+					), ShouldBeNil)
+					So(config.GetStringMap("app"), ShouldResemble, app_dev_yaml)
+				}
+			}
+
+			So(config.ReadBytes([]byte(`{"ids": {"account": 9007199254740993, "ratio": 0.5}}`), "json"), ShouldBeNil)
+			So(config.GetInt("ids.account"), ShouldEqual, 9007199254740993)
+			So(config.GetFloat64("ids.ratio"), ShouldEqual, 0.5)
+
+			So(config.ReadBytes([]byte(`{"ids": {"account": 1}} garbage`), "json"), ShouldNotBeNil)
+			So(config.ReadBytes([]byte(`{"ids": {"account": 1}} {"ids": {"account": 2}}`), "json"), ShouldNotBeNil)
+			So(config.ReadBytes([]byte("{\"ids\": {\"account\": 1}}\n\n"), "json"), ShouldBeNil)
+			So(config.GetInt("ids.account"), ShouldEqual, 1)
+		})
+
+		Convey("Rolling back invalid reloads", func() {
+			files := reader.MapFileSystem{"app.yaml": []byte("server:\n  port: 80\n  host: a\n")}
+			config.SetFileSystem(files)
+			config.Define("server.port").As(TypeInt)
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+			view := config.View()
+
+			failures := []error{}
+			config.OnReloadError(func(err error) { failures = append(failures, err) })
+
+			files["app.yaml"] = []byte("server:\n  port: eighty\n  host: b\n  extra: 1\n")
+			report, err := config.Reload()
+			So(err, ShouldNotBeNil)
+			So(report.Applied, ShouldBeEmpty)
+			So(failures, ShouldHaveLength, 1)
+			So(config.GetInt("server.port"), ShouldEqual, 80)
+			So(config.GetString("server.host"), ShouldEqual, "a")
+			So(config.IsSet("server.extra"), ShouldBeFalse)
+			So(config.View(), ShouldEqual, view)
+
+			files["app.yaml"] = []byte("server:\n  port: 8080\n  host: b\n")
+			_, err = config.Reload()
+			So(err, ShouldBeNil)
+			So(config.View().GetInt("server.port"), ShouldEqual, 8080)
+		})
+
+		Convey("Quarantining invalid settings", func() {
+			files := reader.MapFileSystem{"app.yaml": []byte("server:\n  port: 80\n  host: a\n")}
+			config.SetFileSystem(files)
+			config.Define("server.port").As(TypeInt)
+			config.Define("server.timeout").As(TypeDuration)
+			config.SetQuarantine(true)
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+
+			files["app.yaml"] = []byte("server:\n  port: eighty\n  host: b\n  timeout: soon\n")
+			report, err := config.Reload()
+			So(err, ShouldBeNil)
+			So(report.Applied, ShouldResemble, []Change{{Key: "server.host", Old: "a", New: "b"}})
+			So(report.Quarantined, ShouldHaveLength, 2)
+			So(report.Quarantined[0].Key, ShouldEqual, "server.port")
+			So(report.Quarantined[1].Key, ShouldEqual, "server.timeout")
+			So(config.Quarantined(), ShouldResemble, report.Quarantined)
+
+			So(config.GetInt("server.port"), ShouldEqual, 80)
+			So(config.IsSet("server.timeout"), ShouldBeFalse)
+
+			files["app.yaml"] = []byte("server:\n  port: 8080\n  host: b\n")
+			config.Reload()
+			So(config.Quarantined(), ShouldBeEmpty)
+			So(config.GetInt("server.port"), ShouldEqual, 8080)
+		})
+		Convey("Defaults tier", func() {
+			config.SetDefault("app.database.host", "localhost")
+			config.SetDefault("app.database.port", 5432)
+			config.Set("app.database.host", "db.internal")
+
+			Convey("Apply regardless of the order they're set in", func() {
+				config.SetDefault("app.name", "default")
+				So(config.GetString("app.database.host"), ShouldEqual, "db.internal")
+				So(config.GetInt("app.database.port"), ShouldEqual, 5432)
+				So(config.GetString("app.name"), ShouldEqual, "default")
+			})
+
+			Convey("Fill in partially configured sections", func() {
+				db := config.GetStringMap("app.database")
+				So(db["host"], ShouldEqual, "db.internal")
+				So(db["port"], ShouldEqual, 5432)
+			})
+
+			Convey("Are replaced by a later SetDefault", func() {
+				config.SetDefault("app.database.port", 6543)
+				So(config.GetInt("app.database.port"), ShouldEqual, 6543)
+			})
+
+			Convey("Apply again once a value is unset", func() {
+				config.Unset("app.database.host")
+				So(config.GetString("app.database.host"), ShouldEqual, "localhost")
+			})
+
+			Convey("Are reported as their own layer", func() {
+				So(config.Layers(), ShouldContain, LayerDefaults)
+				So(config.SettingsFrom(LayerDefaults)["app.database.port"], ShouldEqual, 5432)
+				So(config.SettingsFrom(LayerAttributes)["app.database.port"], ShouldBeNil)
+			})
+		})
+		Convey("Override tier", func() {
+			config.Set("app.database.host", "db.override")
+			config.SetEnvironment(source.MapEnvironment{"APP_DATABASE_HOST": "db.env"})
+			config.BindEnv("app.database.host")
+			So(config.ReadPaths("test/fixtures/application.yaml"), ShouldBeNil)
+
+			Convey("Wins over files read afterwards and the environment", func() {
+				So(config.GetString("app.database.host"), ShouldEqual, "db.override")
+				So(config.GetString("app.database.user"), ShouldEqual, "postgres")
+				So(config.GetStringMap("app.database")["host"], ShouldEqual, "db.override")
+				So(config.GetStringMap("app.database")["user"], ShouldEqual, "postgres")
+			})
+
+			Convey("Loses to flags", func() {
+				flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+				flags.String("host", "", "")
+				flags.Parse([]string{"--host=db.flag"})
+				config.BindPFlag("app.database.host", flags.Lookup("host"))
+				So(config.GetString("app.database.host"), ShouldEqual, "db.flag")
+			})
+
+			Convey("Is reported as its own layer", func() {
+				So(config.Layers()[1], ShouldEqual, LayerOverrides)
+				So(config.SettingsFrom(LayerOverrides), ShouldResemble, map[string]interface{}{"app.database.host": "db.override"})
+				So(config.SettingsFrom(LayerAttributes)["app.database.host"], ShouldEqual, "localhost")
+			})
+
+			Convey("Is cleared by Unset", func() {
+				config.Unset("app.database.host")
+				So(config.GetString("app.database.host"), ShouldEqual, "db.env")
+			})
+		})
+		Convey("Configurable precedence", func() {
+			So(config.ReadPaths("test/fixtures/application.yaml"), ShouldBeNil)
+			config.SetEnvironment(source.MapEnvironment{"APP_DATABASE_HOST": "db.env"})
+			config.BindEnv("app.database.host")
+			So(config.GetString("app.database.host"), ShouldEqual, "db.env")
+
+			Convey("Files can beat the environment", func() {
+				So(config.SetPrecedence(LayerFlags, LayerOverrides, LayerAttributes, LayerEnv, LayerDefaults), ShouldBeNil)
+				So(config.GetString("app.database.host"), ShouldEqual, "localhost")
+				So(config.Layers(), ShouldResemble, []string{LayerFlags, LayerOverrides, LayerAttributes, LayerEnv, LayerDefaults})
+
+				config.SetDefault("app.database.pool", 10)
+				So(config.GetStringMap("app.database")["pool"], ShouldEqual, 10)
+			})
+
+			Convey("Every layer must be named once", func() {
+				So(config.SetPrecedence(LayerFlags, LayerAttributes, LayerEnv, LayerDefaults), ShouldNotBeNil)
+				So(config.SetPrecedence(LayerFlags, LayerOverrides, LayerEnv, LayerEnv, LayerAttributes, LayerDefaults), ShouldNotBeNil)
+				So(config.SetPrecedence(LayerFlags, LayerOverrides, LayerEnv, "files", LayerDefaults), ShouldNotBeNil)
+				So(config.GetString("app.database.host"), ShouldEqual, "db.env")
+			})
+		})
+		Convey("Flags and environment variables in AllKeys", func() {
+			config.Set("App.Name", "confer")
+			config.SetEnvironment(source.MapEnvironment{"APP_NAME": "env", "APP_REGION": "eu-west-1"})
+			config.BindEnv("app.name")
+			config.BindEnv("app.region")
+			config.BindEnv("app.unset")
+
+			port := "8080"
+			config.BindPFlag("app.port", &pflag.Flag{Name: "port", Value: newStringValue(port, &port), Changed: true})
+
+			keys := config.AllKeys()
+			sort.Strings(keys)
+			So(keys, ShouldResemble, []string{"app.name", "app.port", "app.region"})
+			So(config.AllSettings(), ShouldResemble, map[string]interface{}{
+				"app.name":   "confer",
+				"app.port":   "8080",
+				"app.region": "eu-west-1",
+			})
+		})
+		Convey("Custom sources", func() {
+			So(config.ReadPaths("test/fixtures/application.yaml"), ShouldBeNil)
+			config.SetEnvironment(source.MapEnvironment{"APP_DATABASE_HOST": "db.env"})
+			config.BindEnv("app.database.host")
+
+			flags := source.NewConfigSource()
+			flags.Set("app.database.host", "db.flags")
+			flags.Set("app.database.pool", 20)
+			So(config.AddSource("feature-flags", PriorityAttributes+50, flags), ShouldBeNil)
+
+			So(config.Layers(), ShouldResemble, []string{
+				LayerFlags, LayerOverrides, LayerEnv, "feature-flags", LayerAttributes, LayerDefaults,
+			})
+			So(config.GetString("app.database.host"), ShouldEqual, "db.env")
+			So(config.GetInt("app.database.pool"), ShouldEqual, 20)
+			So(config.GetStringMap("app.database")["user"], ShouldEqual, "postgres")
+			So(config.AllKeys(), ShouldContain, "app.database.pool")
+			So(config.SettingsFrom("feature-flags"), ShouldResemble, map[string]interface{}{
+				"app.database.host": "db.flags",
+				"app.database.pool": 20,
+			})
+
+			Convey("Sources of higher priority win", func() {
+				tests := source.NewConfigSource()
+				tests.Set("app.database.pool", 1)
+				So(config.AddSource("tests", PriorityFlags, tests), ShouldBeNil)
+				So(config.Layers()[0], ShouldEqual, "tests")
+				So(config.GetInt("app.database.pool"), ShouldEqual, 1)
+			})
+
+			Convey("Names must be unique", func() {
+				So(config.AddSource("feature-flags", 0, flags), ShouldNotBeNil)
+				So(config.AddSource(LayerEnv, 0, flags), ShouldNotBeNil)
+			})
+
+			Convey("Take part in SetPrecedence", func() {
+				So(config.SetPrecedence(LayerFlags, LayerOverrides, LayerEnv, LayerAttributes, LayerDefaults), ShouldNotBeNil)
+				So(config.SetPrecedence("feature-flags", LayerFlags, LayerOverrides, LayerEnv, LayerAttributes, LayerDefaults), ShouldBeNil)
+				So(config.GetString("app.database.host"), ShouldEqual, "db.flags")
+			})
+		})
+		Convey("Registered codecs and providers", func() {
+			So(reader.Formats(), ShouldResemble, []string{"json", "kv", "toml", "yaml"})
+			So(config.ReadBytes([]byte("name = confer\n"), "kv"), ShouldBeNil)
+			So(config.GetString("name"), ShouldEqual, "confer")
+
+			out, err := reader.Marshal(map[string]interface{}{"name": "confer"}, "kv")
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, "name = confer\n")
+
+			_, err = reader.ReadBytes([]byte("malformed"), "kv")
+			So(err, ShouldHaveSameTypeAs, &errors.ParseError{})
+
+			So(func() { reader.RegisterCodec("kv", kvCodec{}) }, ShouldPanic)
+			So(func() { reader.RegisterCodec("yaml", kvCodec{}) }, ShouldPanic)
+			So(SupportedRemoteProviders(), ShouldContain, "s3")
+		})
+		Convey("Provenance", func() {
+			So(config.ReadPaths("test/fixtures/application.yaml"), ShouldBeNil)
+			config.SetDefault("app.database.pool", 10)
+			config.Set("app.name", "confer")
+			config.SetEnvironment(source.MapEnvironment{"APP__DATABASE__USER": "admin"})
+			config.BindEnv("app.database.user")
+
+			port := "6543"
+			config.BindPFlag("app.database.port", &pflag.Flag{Name: "db-port", Value: newStringValue(port, &port), Changed: true})
+
+			info, ok := config.Provenance("app.database.host")
+			So(ok, ShouldBeTrue)
+			So(info, ShouldResemble, SourceInfo{Layer: LayerAttributes, Path: "test/fixtures/application.yaml"})
+
+			info, _ = config.Provenance("app.database.user")
+			So(info, ShouldResemble, SourceInfo{Layer: LayerEnv, Name: "APP__DATABASE__USER"})
+
+			info, _ = config.Provenance("app.database.port")
+			So(info, ShouldResemble, SourceInfo{Layer: LayerFlags, Name: "db-port"})
+
+			info, _ = config.Provenance("app.name")
+			So(info, ShouldResemble, SourceInfo{Layer: LayerOverrides})
+
+			info, _ = config.Provenance("app.database.pool")
+			So(info, ShouldResemble, SourceInfo{Layer: LayerDefaults})
+
+			_, ok = config.Provenance("app.missing")
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Duration units", func() {
+			config.Define("http.timeout").DurationUnit(time.Millisecond)
+			config.Define("http.idle").DurationUnit(time.Second)
+			config.Set("http.timeout", 1500)
+			config.Set("http.idle", "90")
+			config.Set("http.retry", 250)
+
+			So(config.Get("http.timeout"), ShouldEqual, 1500*time.Millisecond)
+			So(config.GetDuration("http.timeout"), ShouldEqual, 1500*time.Millisecond)
+			So(config.GetDuration("http.idle"), ShouldEqual, 90*time.Second)
+			So(config.Get("http.retry"), ShouldEqual, 250)
+			So(config.Validate(), ShouldBeNil)
+
+			config.Set("http.idle", "2m")
+			So(config.GetDuration("http.idle"), ShouldEqual, 2*time.Minute)
+
+			var settings struct {
+				HTTP struct {
+					Timeout time.Duration
+				} `mapstructure:"http"`
+			}
+			So(config.Unmarshal(&settings), ShouldBeNil)
+			So(settings.HTTP.Timeout, ShouldEqual, 1500*time.Millisecond)
+		})
+		Convey("Typed accessors with errors", func() {
+			So(config.ReadPaths("test/fixtures/application.yaml"), ShouldBeNil)
+			config.SetEnvironment(source.MapEnvironment{"APP_PORT": "eighty"})
+			config.BindEnv("app.port")
+
+			_, err := config.GetIntE("app.port")
+			So(err, ShouldHaveSameTypeAs, &errors.ConversionError{})
+			So(err.Error(), ShouldEqual, "env APP_PORT='eighty' is not an int")
+			So(err.(*errors.ConversionError).Layer, ShouldEqual, LayerEnv)
+
+			_, err = config.GetDurationE("app.database.host")
+			So(err.Error(), ShouldEqual, "test/fixtures/application.yaml: app.database.host='localhost' is not a duration")
+
+			config.SetDefault("app.workers", "many")
+			_, err = config.GetIntE("app.workers")
+			So(err.Error(), ShouldEqual, "defaults app.workers='many' is not an int")
+
+			config.Set("app.database.port", "5432")
+			port, err := config.GetIntE("app.database.port")
+			So(err, ShouldBeNil)
+			So(port, ShouldEqual, 5432)
+
+			host, err := config.GetStringE("app.database.host")
+			So(err, ShouldBeNil)
+			So(host, ShouldEqual, "localhost")
+
+			_, err = config.GetBoolE("app.missing")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Explaining a key", func() {
+			So(config.ReadBytes([]byte("app:\n  workers: 4\n"), "yaml"), ShouldBeNil)
+			config.SetDefault("app.workers", 1)
+			config.SetEnvironment(source.MapEnvironment{"APP_WORKERS": "16"})
+			config.BindEnv("app.workers")
+
+			explanation := config.Explain("app.workers")
+			So(explanation.Value, ShouldEqual, "16")
+			So(explanation.Winner, ShouldEqual, LayerEnv)
+			So(explanation.Layers, ShouldHaveLength, 5)
+			So(explanation.Layers[2], ShouldResemble, LayerValue{
+				Layer: LayerEnv, Source: SourceInfo{Layer: LayerEnv, Name: "APP_WORKERS"}, Value: "16", Set: true,
+			})
+			So(explanation.Layers[3].Value, ShouldEqual, 4)
+			So(explanation.Layers[4].Value, ShouldEqual, 1)
+			So(explanation.String(), ShouldEqual, strings.Join([]string{
+				"app.workers = 16 (from env)",
+				"  flags: unset",
+				"  overrides: unset",
+				"* env (APP_WORKERS): 16",
+				"  attributes: 4",
+				"  defaults: 1",
+				"",
+			}, "\n"))
+
+			So(config.Explain("app.missing").String(), ShouldStartWith, "app.missing is unset\n")
+		})
+		Convey("OpenAPI schema", func() {
+			config.Define("app.database.host").As(TypeString).Describe("The database host").WithDefault("localhost").Require()
+			config.Define("app.database.password").As(TypeString)
+			config.Define("app.database.timeout").DurationUnit(time.Millisecond)
+			config.Define("app.workers").As(TypeInt).WithDefault(4)
+			config.Define("app.tags").As(TypeStringSlice)
+
+			schema := config.OpenAPISchema()
+			app := schema["properties"].(map[string]interface{})["app"].(map[string]interface{})
+			So(app["type"], ShouldEqual, "object")
+			So(app["properties"].(map[string]interface{})["workers"], ShouldResemble, map[string]interface{}{
+				"type": "integer", "default": 4,
+			})
+			So(app["properties"].(map[string]interface{})["tags"], ShouldResemble, map[string]interface{}{
+				"type": "array", "items": map[string]interface{}{"type": "string"},
+			})
+
+			db := app["properties"].(map[string]interface{})["database"].(map[string]interface{})
+			So(db["required"], ShouldResemble, []string{"host"})
+			So(db["properties"].(map[string]interface{})["host"], ShouldResemble, map[string]interface{}{
+				"type": "string", "description": "The database host", "default": "localhost",
+			})
+			So(db["properties"].(map[string]interface{})["password"], ShouldResemble, map[string]interface{}{
+				"type": "string", "writeOnly": true,
+			})
+
+			var buf bytes.Buffer
+			So(config.WriteOpenAPI(&buf, "AppConfig", "yaml"), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, "components:\n  schemas:\n    AppConfig:\n")
+		})
+		Convey("Secret rotation", func() {
+			store := &fakeSecretStore{value: "hunter2", version: SecretVersion{Version: "v1"}}
+			So(config.BindSecret("app.database.password", store, "db/creds", 5*time.Millisecond), ShouldBeNil)
+			defer config.StopSecretRotation()
+
+			So(config.GetString("app.database.password"), ShouldEqual, "hunter2")
+			So(config.IsSecret("app.database.password"), ShouldBeTrue)
+			So(config.Layers(), ShouldContain, LayerSecrets)
+
+			version, ok := config.SecretVersion("app.database.password")
+			So(ok, ShouldBeTrue)
+			So(version.Version, ShouldEqual, "v1")
+
+			rotations := make(chan SecretRotation, 1)
+			config.OnSecretRotation(func(r SecretRotation) { rotations <- r })
+			store.rotate("correct-horse", SecretVersion{Version: "v2"})
+
+			select {
+			case r := <-rotations:
+				So(r.Key, ShouldEqual, "app.database.password")
+				So(r.Previous.Version, ShouldEqual, "v1")
+				So(r.Current.Version, ShouldEqual, "v2")
+				So(config.GetString("app.database.password"), ShouldEqual, "correct-horse")
+			case <-time.After(time.Second):
+				So("rotation", ShouldEqual, "notified")
+			}
+		})
+		Convey("Scheduled values", func() {
+			defer func(fn func() time.Time) { timeNow = fn }(timeNow)
+			timeNow = func() time.Time { return time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC) }
+
+			config.SetScheduledValues(true)
+			config.SetDefault("maintenance", false)
+			So(config.ReadBytes([]byte(strings.Join([]string{
+				"maintenance:",
+				"  value: true",
+				"  effective_at: 2025-01-01T00:00Z",
+				"  expires_at: 2025-01-01T04:00Z",
+				"banner:",
+				"  - value: Upgrade soon",
+				"    effective_at: 2024-12-01T00:00Z",
+				"  - value: Upgrading",
+				"    effective_at: 2025-01-01T00:00Z",
+			}, "\n")), "yaml"), ShouldBeNil)
+
+			So(config.GetBool("maintenance"), ShouldBeFalse)
+			So(config.GetString("banner"), ShouldEqual, "Upgrade soon")
+			keys := config.AllKeys()
+			sort.Strings(keys)
+			So(keys, ShouldResemble, []string{"banner", "maintenance"})
+
+			timeNow = func() time.Time { return time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC) }
+			So(config.GetBool("maintenance"), ShouldBeTrue)
+			So(config.GetString("banner"), ShouldEqual, "Upgrading")
+
+			timeNow = func() time.Time { return time.Date(2025, 1, 1, 4, 0, 0, 0, time.UTC) }
+			So(config.GetBool("maintenance"), ShouldBeFalse)
+
+			Convey("Fire events as windows open", func() {
+				timeNow = time.Now
+				opens := time.Now().Add(30 * time.Millisecond).UTC().Format(time.RFC3339Nano)
+				config.Set("feature", map[string]interface{}{"value": "on", "effective_at": opens})
+				So(config.Get("feature"), ShouldBeNil)
+
+				changes := make(chan []Change, 1)
+				config.OnScheduledChange(func(c []Change) { changes <- c })
+				config.WatchSchedules()
+				defer config.StopSchedules()
+
+				select {
+				case c := <-changes:
+					So(c, ShouldResemble, []Change{{Key: "feature", Old: nil, New: "on"}})
+					So(config.GetString("feature"), ShouldEqual, "on")
+				case <-time.After(time.Second):
+					So("window", ShouldEqual, "opened")
+				}
+			})
+		})
+		Convey("ZooKeeper sources", func() {
+			zk := &fakeZooKeeper{nodes: map[string]string{
+				"/billing":                   "app:\n  name: billing\n",
+				"/billing/app":               "",
+				"/billing/app/replicas":      "2",
+				"/billing/app/database":      `{"host": "zk-db"}`,
+				"/billing/app/database/port": "5432",
+			}}
+
+			changed := make(chan []Change, 1)
+			config.OnChange(func(changes []Change) { changed <- changes })
+
+			So(config.AddZooKeeperSource(zk, "/billing"), ShouldBeNil)
+			defer config.StopZooKeeperSources()
+			So(config.GetString("app.name"), ShouldEqual, "billing")
+			So(config.GetInt("app.replicas"), ShouldEqual, 2)
+			So(config.GetString("app.database.host"), ShouldEqual, "zk-db")
+			So(config.GetInt("app.database.port"), ShouldEqual, 5432)
+
+			zk.set("/billing/app/replicas", "3")
+
+			select {
+			case changes := <-changed:
+				So(changes, ShouldResemble, []Change{{Key: "app.replicas", Old: "2", New: "3"}})
+			case <-time.After(time.Second):
+				So("no change detected", ShouldBeNil)
+			}
+
+			So(config.AddZooKeeperSource(zk, "/missing"), ShouldNotBeNil)
+		})
+		Convey("Stats", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.SetDefault("app.replicas", 1)
+			config.Set("app.replicas", 3)
+
+			stats := config.Stats()
+			So(stats.Keys, ShouldEqual, len(config.AllKeys()))
+			So(stats.KeysByLayer[LayerOverrides], ShouldEqual, 1)
+			So(stats.KeysByLayer[LayerDefaults], ShouldEqual, 1)
+			So(stats.KeysByLayer[LayerAttributes], ShouldEqual, len(config.SettingsFrom(LayerAttributes)))
+			So(stats.Depth, ShouldEqual, 3)
+			So(stats.MemoryBytes, ShouldBeGreaterThan, 0)
+			So(stats.LargestSubtrees[0], ShouldResemble, SubtreeStats{Key: "app", Keys: stats.Keys})
+
+			So(len(stats.Files), ShouldEqual, 1)
+			So(stats.Files[0].Path, ShouldEqual, "test/fixtures/application.yaml")
+			So(stats.Files[0].Bytes, ShouldBeGreaterThan, 0)
+			So(stats.Files[0].Keys, ShouldEqual, 5)
+			So(stats.Files[0].LoadDuration+stats.Files[0].ParseDuration, ShouldBeGreaterThan, 0)
+		})
+		Convey("Migrating from viper", func() {
+			report := &migrate.Report{}
+			So(report.ScanFile("main.go", []byte(strings.Join([]string{
+				"package main",
+				"",
+				`import "github.com/spf13/viper"`,
+				"",
+				"func setup() {",
+				"	v := viper.New()",
+				`	v.SetConfigName("application")`,
+				`	v.AddConfigPath("/etc/app")`,
+				`	v.SetDefault("server.port", 8080)`,
+				`	v.SetEnvPrefix("app")`,
+				`	v.BindEnv("database.url", "DATABASE_URL")`,
+				`	v.BindEnv("server.port")`,
+				`	v.BindPFlag("server.port", cmd.Flags().Lookup("port"))`,
+				"	v.AutomaticEnv()",
+				"	v.ReadInConfig()",
+				`	viper.AddRemoteProvider("etcd", "http://127.0.0.1:4001", "/config/app.json")`,
+				"}",
+			}, "\n"))), ShouldBeNil)
+
+			So(report.Paths, ShouldResemble, []string{"/etc/app/application.yaml"})
+			So(report.Defaults, ShouldResemble, []migrate.Default{{Key: "server.port", Value: "8080", Pos: "main.go:9:2"}})
+			So(len(report.EnvBindings), ShouldEqual, 2)
+			So(report.FlagBindings[0].Name, ShouldEqual, "port")
+			So(len(report.Issues), ShouldEqual, 1)
+			So(report.Issues[0].Call, ShouldEqual, "AddRemoteProvider")
+
+			var src bytes.Buffer
+			So(report.WriteGo(&src, "config"), ShouldBeNil)
+			generated := src.String()
+			So(generated, ShouldContainSubstring, "func NewConfig(flags *pflag.FlagSet) (*confer.Config, error) {")
+			So(generated, ShouldContainSubstring, `config.SetDefault("server.port", 8080)`)
+			So(generated, ShouldContainSubstring, `confer.PathSpec{Path: "/etc/app/application.yaml"},`)
+			So(generated, ShouldContainSubstring, `config.BindEnv("database.url", "DATABASE_URL")`)
+			So(generated, ShouldContainSubstring, `config.BindEnv("server.port", "APP_SERVER.PORT")`)
+			So(generated, ShouldContainSubstring, `config.OverlayEnv("APP_")`)
+			So(generated, ShouldContainSubstring, `config.BindPFlag("server.port", flags.Lookup("port"))`)
+
+			var summary bytes.Buffer
+			report.WriteSummary(&summary)
+			So(summary.String(), ShouldContainSubstring, "main.go:16:2: AddRemoteProvider: remote key/value stores aren't supported")
+		})
+		Convey("Rendering a key", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+
+			var out bytes.Buffer
+			So(config.Render("app.database.host", "plain", &out), ShouldBeNil)
+			So(out.String(), ShouldEqual, "localhost\n")
+
+			out.Reset()
+			So(config.Render("app.database.host", "toml", &out), ShouldBeNil)
+			So(out.String(), ShouldEqual, "host = \"localhost\"\n")
+
+			out.Reset()
+			So(config.Render("app.database", "json", &out), ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, `"host": "localhost"`)
+			So(out.String(), ShouldContainSubstring, `"password": "[REDACTED]"`)
+
+			out.Reset()
+			So(config.Render("app.database", "plain", &out), ShouldBeNil)
+			So(out.String(), ShouldEqual, strings.Join([]string{
+				"app.database.host=localhost",
+				"app.database.password=[REDACTED]",
+				"app.database.user=postgres",
+				"",
+			}, "\n"))
+
+			out.Reset()
+			So(config.Render("app.logging", "yaml", &out), ShouldBeNil)
+			So(out.String(), ShouldEqual, "level: info\n")
+
+			So(config.Render("app.missing", "yaml", &out), ShouldNotBeNil)
+		})
+		Convey("Pruning empty sections on Unset", func() {
+			config.Set("jobs.nightly.backup.schedule", "0 2 * * *")
+			config.Set("jobs.weekly", "sunday")
+
+			config.Unset("jobs.nightly.backup.schedule")
+			So(config.IsSet("jobs.nightly.backup"), ShouldBeTrue)
+
+			config.SetPruneOnUnset(true)
+			config.Set("jobs.nightly.backup.schedule", "0 2 * * *")
+			config.Unset("Jobs.Nightly.Backup.Schedule")
+			So(config.IsSet("jobs.nightly"), ShouldBeFalse)
+			So(config.AllKeys(), ShouldResemble, []string{"jobs.weekly"})
+			So(config.overrides.ToStringMap(), ShouldResemble, map[string]interface{}{
+				"jobs": map[string]interface{}{"weekly": "sunday"},
+			})
+
+			config.Unset("jobs.weekly")
+			So(config.overrides.ToStringMap(), ShouldBeEmpty)
+			So(config.IsSet("jobs"), ShouldBeFalse)
+		})
+		Convey("Synchronizing flag defaults", func() {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			host := flags.String("host", "127.0.0.1", "Database host")
+			workers := flags.Int("workers", 1, "Worker count")
+			peers := flags.StringSlice("peers", nil, "Peers")
+			So(flags.Parse([]string{"--workers", "4"}), ShouldBeNil)
+
+			config.BindPFlag("app.database.host", flags.Lookup("host"))
+			config.BindPFlag("app.server.workers", flags.Lookup("workers"))
+			config.BindPFlag("app.peers", flags.Lookup("peers"))
+			config.SetFileSystem(reader.MapFileSystem{
+				"app.yaml": []byte("app:\n  database:\n    host: db.internal\n  server:\n    workers: 8\n  peers: [a, b]\n"),
+			})
+			config.SetFlagDefaultSync(true)
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+
+			So(flags.Lookup("host").DefValue, ShouldEqual, "db.internal")
+			So(*host, ShouldEqual, "db.internal")
+			So(flags.Lookup("host").Changed, ShouldBeFalse)
+			So(flags.Lookup("peers").DefValue, ShouldEqual, "[a,b]")
+			So(*peers, ShouldResemble, []string{"a", "b"})
+
+			So(flags.Lookup("workers").DefValue, ShouldEqual, "1")
+			So(*workers, ShouldEqual, 4)
+			So(config.GetInt("app.server.workers"), ShouldEqual, 4)
+		})
+		Convey("Load reports", func() {
+			config.Define("app.database.host").As(TypeString)
+			config.Define("app.database.user").As(TypeString)
+			config.Define("app.database.port").As(TypeInt).WithDefault(5432)
+			config.Define("app.logging").As(TypeMap)
+			config.Define("app.timeout").As(TypeDuration).WithDefault("5s")
+			config.Deprecate(Deprecation{Key: "app.database.password", Replacement: "app.database.secret"})
+			config.Define("app.database.secret")
+			config.Set("app.database.user", "admin")
+
+			report, err := config.ReadPathsWithReport("test/fixtures/application.yaml")
+			So(err, ShouldBeNil)
+			So(report.Files, ShouldResemble, []string{"test/fixtures/application.yaml"})
+			So(report.Unknown, ShouldResemble, []string{"app.server.workers"})
+			So(report.Deprecated, ShouldResemble, []string{"app.database.password"})
+			So(report.Defaulted, ShouldResemble, []string{"app.database.port", "app.timeout"})
+			So(report.Overridden, ShouldResemble, []OverriddenKey{{Key: "app.database.user", Layer: LayerOverrides}})
+			So(report.Clean(), ShouldBeFalse)
+		})
+		Convey("References across files", func() {
+			config.SetFileSystem(reader.MapFileSystem{
+				"base.yaml": []byte("app:\n  database:\n    host: db.internal\n    pool:\n      size: 4\n"),
+				"overlay.yaml": []byte(strings.Join([]string{
+					"app:",
+					"  cache:",
+					"    host:",
+					"      $ref: App.Database.Host",
+					"    pool:",
+					"      $ref: app.database.pool",
+					"  replica:",
+					"    host:",
+					"      $ref: app.cache.host",
+				}, "\n")),
+			})
+
+			So(config.ReadPaths("base.yaml", "overlay.yaml"), ShouldBeNil)
+			So(config.GetString("app.cache.host"), ShouldEqual, "db.internal")
+			So(config.GetInt("app.cache.pool.size"), ShouldEqual, 4)
+			So(config.GetString("app.replica.host"), ShouldEqual, "db.internal")
+			So(config.AllKeys(), ShouldNotContain, "app.cache.host.$ref")
+
+			Convey("Write references back as written", func() {
+				var buf bytes.Buffer
+				So(config.WriteConfigFor(&buf, "overlay.yaml", ""), ShouldBeNil)
+				So(buf.String(), ShouldNotContainSubstring, "null")
+
+				reread := NewConfig()
+				reread.SetFileSystem(reader.MapFileSystem{
+					"base.yaml":    []byte("app:\n  database:\n    host: db.internal\n    pool:\n      size: 4\n"),
+					"overlay.yaml": buf.Bytes(),
+				})
+				So(reread.ReadPaths("base.yaml", "overlay.yaml"), ShouldBeNil)
+				So(reread.AllSettings(), ShouldResemble, config.AllSettings())
+
+				config.Set("app.replica.host", "replica.internal")
+				buf.Reset()
+				So(config.WriteConfigFor(&buf, "overlay.yaml", ""), ShouldBeNil)
+				So(buf.String(), ShouldContainSubstring, "host: replica.internal")
+				So(buf.String(), ShouldContainSubstring, "$ref: App.Database.Host")
+			})
+
+			Convey("Reject dangling and circular references", func() {
+				config := NewConfig()
+				config.SetFileSystem(reader.MapFileSystem{
+					"refs.yaml": []byte("a:\n  $ref: b\nb:\n  $ref: a\nc:\n  $ref: missing\n"),
+				})
+				err := config.ReadPaths("refs.yaml")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "refers to missing, which is not set")
+				So(err.Error(), ShouldContainSubstring, "circular references")
+			})
+		})
+		Convey("Docker secrets", func() {
+			dir, _ := os.MkdirTemp("", "confer")
+			defer os.RemoveAll(dir)
+			os.WriteFile(dir+"/db_password", []byte("hunter2\n"), 0600)
+			os.WriteFile(dir+"/api_token", []byte("abc123\r\n"), 0600)
+			os.WriteFile(dir+"/.hidden", []byte("ignored"), 0600)
+
+			config.Define("api_token")
+			config.SetDefault("db.password", "changeme")
+			config.Set("db.host", "localhost")
+
+			So(config.ReadSecretsDir(dir), ShouldBeNil)
+			So(config.GetString("db.password"), ShouldEqual, "hunter2")
+			So(config.GetString("api_token"), ShouldEqual, "abc123")
+			So(config.GetString("db.host"), ShouldEqual, "localhost")
+			So(config.IsSecret("db.password"), ShouldBeTrue)
+			So(config.Layers(), ShouldContain, LayerSecrets)
+			So(len(config.SettingsFrom(LayerSecrets)), ShouldEqual, 2)
+
+			So(config.ReadSecretsDir(dir+"/missing"), ShouldNotBeNil)
+		})
+		Convey("Locking subtrees", func() {
+			unlock := config.LockPrefix("cache.")
+
+			queued := make(chan bool)
+			go func() {
+				defer config.LockPrefix("queue")()
+				queued <- true
+			}()
+			So(<-queued, ShouldBeTrue)
+
+			acquired := make(chan bool, 1)
+			go func() {
+				defer config.LockPrefix("Cache.Redis")()
+				acquired <- true
+			}()
+
+			select {
+			case <-acquired:
+				So("overlapping lock", ShouldEqual, "blocked")
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			unlock()
+			unlock()
+			select {
+			case <-acquired:
+			case <-time.After(time.Second):
+				So("overlapping lock", ShouldEqual, "acquired")
+			}
+		})
+
+		Convey("Writing disjoint subtrees concurrently", func() {
+			var wg sync.WaitGroup
+			for _, prefix := range []string{"cache", "queue"} {
+				wg.Add(1)
+				go func(prefix string) {
+					defer wg.Done()
+					for i := 0; i < 100; i++ {
+						unlock := config.LockPrefix(prefix)
+						config.Set(prefix+".host", fmt.Sprint(prefix, "-", i))
+						config.Set(prefix+".port", i)
+						unlock()
+					}
+				}(prefix)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 100; i++ {
+					config.AllSettings()
+				}
+			}()
+			wg.Wait()
+			<-done
+
+			So(config.GetString("cache.host"), ShouldEqual, "cache-99")
+			So(config.GetInt("queue.port"), ShouldEqual, 99)
+		})
+		Convey("Filtered exports", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.RequireRestart("app.database.host")
+			config.MarkSecret("app.database.user")
+
+			So(config.Tags("app.database.host"), ShouldResemble, []KeyTag{TagStatic})
+			So(config.Tags("app.database.password"), ShouldResemble, []KeyTag{TagSecret, TagRuntime})
+
+			So(config.Export(ExportOptions{ExcludeTags: []KeyTag{TagSecret}}), ShouldResemble, map[string]interface{}{
+				"app": map[string]interface{}{
+					"logging":  map[string]interface{}{"level": "info"},
+					"database": map[string]interface{}{"host": "localhost"},
+				},
+			})
+
+			So(config.Export(ExportOptions{Include: []string{"app.database"}, Exclude: []string{"app.*.host"}, Redact: true}), ShouldResemble, map[string]interface{}{
+				"app": map[string]interface{}{
+					"database": map[string]interface{}{"user": Redacted, "password": Redacted},
+				},
+			})
+
+			So(config.Export(ExportOptions{Tags: []KeyTag{TagStatic}}), ShouldResemble, map[string]interface{}{
+				"app": map[string]interface{}{
+					"database": map[string]interface{}{"host": "localhost"},
+				},
+			})
+		})
+		Convey("URL sources", func() {
+			var mu sync.Mutex
+			body, etag, notModified := "app:\n  replicas: 2\n", `"v1"`, 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if r.Header.Get("Authorization") != "Bearer s3cret" || r.Header.Get("X-Team") != "billing" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if r.Header.Get("If-None-Match") == etag {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", etag)
+				w.Write([]byte(body))
+			}))
+			defer server.Close()
+
+			changed := make(chan []Change, 1)
+			config.OnChange(func(changes []Change) { changed <- changes })
+
+			So(config.AddURLSource(server.URL+"/app.yaml", URLOptions{
+				Interval:    10 * time.Millisecond,
+				BearerToken: "s3cret",
+				Header:      http.Header{"X-Team": {"billing"}},
+			}), ShouldBeNil)
+			defer config.StopObjectSources()
+			So(config.GetInt("app.replicas"), ShouldEqual, 2)
+
+			time.Sleep(30 * time.Millisecond)
+			mu.Lock()
+			So(notModified, ShouldBeGreaterThan, 0)
+			body, etag = "app:\n  replicas: 3\n", `"v2"`
+			mu.Unlock()
+
+			select {
+			case changes := <-changed:
+				So(changes, ShouldResemble, []Change{{Key: "app.replicas", Old: 2, New: 3}})
+			case <-time.After(time.Second):
+				So("no change detected", ShouldBeNil)
+			}
+
+			So(config.AddURLSource(server.URL+"/app.yaml", URLOptions{}), ShouldNotBeNil)
+			So(config.AddURLSource("ftp://example.com/app.yaml", URLOptions{}), ShouldNotBeNil)
+		})
+		Convey("Strict lifecycle", func() {
+			config.SetStrictLifecycle(true)
+			config.SetDefault("app.port", 8080)
+
+			So(func() { config.GetInt("app.port") }, ShouldPanicWith,
+				`confer: "app.port" was read before configuration was loaded; call ReadPaths or Finalize first`)
+			_, err := config.GetE("app.port")
+			So(err, ShouldHaveSameTypeAs, &errors.NotLoadedError{})
+
+			config.ReadPaths("test/fixtures/application.yaml")
+			So(config.GetInt("app.port"), ShouldEqual, 8080)
+
+			Convey("Finalize without files", func() {
+				config := NewConfig()
+				config.SetStrictLifecycle(true)
+				config.Finalize()
+				So(config.Get("app.port"), ShouldBeNil)
+			})
+		})
+		Convey("Git sources", func() {
+			repo, _ := os.MkdirTemp("", "confer-repo")
+			clone, _ := os.MkdirTemp("", "confer-clone")
+			defer os.RemoveAll(repo)
+			defer os.RemoveAll(clone)
+
+			commit := func(contents string) {
+				os.WriteFile(repo+"/app.yaml", []byte(contents), 0644)
+				for _, args := range [][]string{
+					{"add", "app.yaml"},
+					{"-c", "user.name=confer", "-c", "user.email=confer@example.com", "commit", "--quiet", "-m", "update"},
+				} {
+					cmd := exec.Command("git", args...)
+					cmd.Dir = repo
+					So(cmd.Run(), ShouldBeNil)
+				}
+			}
+			setup := exec.Command("git", "init", "--quiet", "-b", "main")
+			setup.Dir = repo
+			So(setup.Run(), ShouldBeNil)
+			commit("app:\n  replicas: 2\n")
+
+			updates := make(chan GitUpdate, 1)
+			config.OnGitUpdate(func(u GitUpdate) { updates <- u })
+
+			So(config.AddGitSource("file://"+repo, GitOptions{
+				Ref:      "main",
+				Paths:    []string{"app.yaml"},
+				Dir:      clone + "/config",
+				Interval: 10 * time.Millisecond,
+			}), ShouldBeNil)
+			defer config.StopGitSources()
+			So(config.GetInt("app.replicas"), ShouldEqual, 2)
+
+			commit("app:\n  replicas: 3\n")
+
+			select {
+			case u := <-updates:
+				So(u.Ref, ShouldEqual, "main")
+				So(u.Current, ShouldNotEqual, u.Previous)
+				So(config.GetInt("app.replicas"), ShouldEqual, 3)
+			case <-time.After(5 * time.Second):
+				So("no update pulled", ShouldBeNil)
+			}
+
+			So(config.AddGitSource("file://"+repo, GitOptions{Paths: []string{"missing.yaml"}, Dir: clone + "/missing"}), ShouldNotBeNil)
+		})
+		Convey("Marshaling", func() {
+			config.ReadPaths("test/fixtures/application.yaml")
+			config.Set("app.hosts", []interface{}{"a", "b"})
+
+			out, err := json.Marshal(map[string]interface{}{"config": config})
+			So(err, ShouldBeNil)
+			So(string(out), ShouldContainSubstring, `"host":"localhost"`)
+			So(string(out), ShouldContainSubstring, `"hosts":["a","b"]`)
+			So(string(out), ShouldContainSubstring, `"password":"[REDACTED]"`)
+
+			out, err = yaml.Marshal(config)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldContainSubstring, "password: '[REDACTED]'")
+			So(string(out), ShouldContainSubstring, "    host: localhost\n")
+		})
+		Convey("Cloud Storage and Azure object stores", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/configs/env/app.yaml" && r.Header.Get("Authorization") == "Bearer gcs-token":
+					w.Header().Set("ETag", `"g1"`)
+					w.Write([]byte("app:\n  store: gcs\n"))
+				case r.URL.Path == "/configs/app.yaml" && strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey acct:") &&
+					r.Header.Get("x-ms-version") != "" && r.Header.Get("x-ms-date") != "":
+					w.Header().Set("ETag", `"a1"`)
+					w.Write([]byte("app:\n  replicas: 5\n"))
+				default:
+					w.WriteHeader(http.StatusForbidden)
+				}
+			}))
+			defer server.Close()
+
+			RegisterObjectStore("gstest", gcs.New(gcs.Options{Endpoint: server.URL, Token: "gcs-token"}))
+			RegisterObjectStore("aztest", azblob.New(azblob.Options{Account: "acct", Endpoint: server.URL, AccountKey: "c2VjcmV0"}))
+			So(SupportedRemoteProviders(), ShouldContain, "gs")
+			So(SupportedRemoteProviders(), ShouldContain, "azblob")
+
+			So(config.AddObjectSource("gstest://configs/env/app.yaml", 0), ShouldBeNil)
+			So(config.AddObjectSource("aztest://configs/app.yaml", 0), ShouldBeNil)
+			So(config.GetString("app.store"), ShouldEqual, "gcs")
+			So(config.GetInt("app.replicas"), ShouldEqual, 5)
+
+			So(config.AddObjectSource("gstest://configs/missing.yaml", 0), ShouldNotBeNil)
+		})
+		Convey("Remote providers", func() {
+			remote := &fakeRemote{doc: "app:\n  region: us-east\n", changed: make(chan struct{})}
+			RegisterRemoteProvider("fake", func(u *url.URL) (RemoteProvider, error) {
+				if u.Host != "cluster" {
+					return nil, fmt.Errorf("unknown cluster %s", u.Host)
+				}
+				return remote, nil
+			})
+			So(SupportedRemoteProviders(), ShouldContain, "fake")
+
+			Convey("Read a document once", func() {
+				So(config.ReadRemote("fake://cluster/app"), ShouldBeNil)
+				So(config.GetString("app.region"), ShouldEqual, "us-east")
+			})
+
+			Convey("Reject unknown schemes and failing factories", func() {
+				So(config.ReadRemote("nats2://cluster/app"), ShouldNotBeNil)
+				So(config.ReadRemote("fake://elsewhere/app"), ShouldNotBeNil)
+			})
+
+			Convey("Reload when a watched document changes", func() {
+				changed := make(chan []Change, 1)
+				config.OnChange(func(changes []Change) { changed <- changes })
+				So(config.WatchRemote("fake://cluster/app", 0), ShouldBeNil)
+				defer config.StopRemote()
+
+				remote.set("app:\n  region: eu-west\n")
+				select {
+				case changes := <-changed:
+					So(changes, ShouldResemble, []Change{{Key: "app.region", Old: "us-east", New: "eu-west"}})
+				case <-time.After(2 * time.Second):
+					So("no change detected", ShouldBeNil)
+				}
+			})
+		})
+		Convey("Flag defaults in the precedence", func() {
+			flags := pflag.NewFlagSet("tool", pflag.ContinueOnError)
+			flags.String("listen", ":8080", "")
+			flags.String("region", "us-east", "")
+			config.BindPFlag("listen", flags.Lookup("listen"))
+			config.BindPFlag("region", flags.Lookup("region"))
+			config.SetDefault("listen", ":80")
+			config.Set("region", "eu-west")
+			config.SetPrecedence(LayerFlags, LayerEnv, LayerAttributes, LayerFlagDefaults, LayerOverrides, LayerDefaults)
+
+			Convey("Flag defaults are ignored by default", func() {
+				fresh := NewConfig()
+				fresh.BindPFlag("listen", flags.Lookup("listen"))
+				fresh.SetDefault("listen", ":80")
+				So(fresh.GetString("listen"), ShouldEqual, ":80")
+				So(fresh.Layers(), ShouldNotContain, LayerFlagDefaults)
+			})
+
+			Convey("Apply flag defaults where named", func() {
+				So(config.GetString("listen"), ShouldEqual, ":8080")
+				So(config.GetString("region"), ShouldEqual, "us-east")
+				info, _ := config.Provenance("listen")
+				So(info.Layer, ShouldEqual, LayerFlagDefaults)
+			})
+
+			Convey("Let files beat flag defaults but not passed flags", func() {
+				config.SetFileSystem(reader.MapFileSystem{"tool.yaml": []byte("listen: :9090\nregion: ap-south\n")})
+				So(config.ReadPaths("tool.yaml"), ShouldBeNil)
+				So(config.GetString("listen"), ShouldEqual, ":9090")
+
+				flags.Parse([]string{"--region", "sa-east"})
+				So(config.GetString("region"), ShouldEqual, "sa-east")
+			})
+
+			Convey("Allow files above everything", func() {
+				So(config.SetPrecedence(LayerAttributes, LayerFlags, LayerOverrides, LayerEnv, LayerDefaults), ShouldBeNil)
+				config.SetFileSystem(reader.MapFileSystem{"kiosk.yaml": []byte("region: kiosk\n")})
+				So(config.ReadPaths("kiosk.yaml"), ShouldBeNil)
+				flags.Parse([]string{"--region", "sa-east"})
+				So(config.GetString("region"), ShouldEqual, "kiosk")
+			})
+		})
+		Convey("Paths relative to their file", func() {
+			config.SetFileSystem(reader.MapFileSystem{
+				"/etc/myapp/prod.yaml": []byte("tls:\n  cert_file: certs/server.pem\n  ca_file: /etc/ssl/ca.pem\nplugins:\n  - plugins/a.so\n  - /opt/b.so\n"),
+			})
+			So(config.ReadPaths("/etc/myapp/prod.yaml"), ShouldBeNil)
+
+			Convey("Resolve against the file's directory", func() {
+				So(config.GetPath("tls.cert_file"), ShouldEqual, "/etc/myapp/certs/server.pem")
+				So(config.GetPath("tls.ca_file"), ShouldEqual, "/etc/ssl/ca.pem")
+				So(config.GetPathSlice("plugins"), ShouldResemble, []string{"/etc/myapp/plugins/a.so", "/opt/b.so"})
+				So(config.GetPath("tls.key_file"), ShouldEqual, "")
+			})
+
+			Convey("Leave values from other layers as is", func() {
+				config.Set("tls.cert_file", "local.pem")
+				So(config.GetPath("tls.cert_file"), ShouldEqual, "local.pem")
+			})
+
+			Convey("Use a custom resolver", func() {
+				config.SetPathResolver(func(value string, info SourceInfo) string {
+					return "/bundle/" + value
+				})
+				So(config.GetPath("tls.cert_file"), ShouldEqual, "/bundle/certs/server.pem")
+			})
+		})
+		Convey("Remote cache fallback", func() {
+			dir, _ := os.MkdirTemp("", "confer")
+			defer os.RemoveAll(dir)
+
+			remote := &fakeRemote{doc: "region: us-east\n", changed: make(chan struct{})}
+			RegisterRemoteProvider("cached", func(u *url.URL) (RemoteProvider, error) {
+				return remote, nil
+			})
+			config.SetRemoteCacheDir(dir)
+			So(config.ReadRemote("cached://control/app"), ShouldBeNil)
+			status, _ := config.RemoteStatus("cached://control/app")
+			So(status.Stale, ShouldBeFalse)
+			So(status.FetchedAt.IsZero(), ShouldBeFalse)
+
+			Convey("Use the cached payload when the provider is down", func() {
+				remote.err = fmt.Errorf("connection refused")
+				booted := NewConfig()
+				booted.SetRemoteCacheDir(dir)
+				So(booted.ReadRemote("cached://control/app"), ShouldBeNil)
+				So(booted.GetString("region"), ShouldEqual, "us-east")
+
+				status, exists := booted.RemoteStatus("cached://control/app")
+				So(exists, ShouldBeTrue)
+				So(status.Stale, ShouldBeTrue)
+				So(status.Err, ShouldNotBeNil)
+			})
+
+			Convey("Fail without a cached payload", func() {
+				remote.err = fmt.Errorf("connection refused")
+				booted := NewConfig()
+				booted.SetRemoteCacheDir(dir)
+				So(booted.ReadRemote("cached://control/other"), ShouldNotBeNil)
+				So(NewConfig().ReadRemote("cached://control/app"), ShouldNotBeNil)
+			})
+		})
+		Convey("Remote events on a channel", func() {
+			remote := &fakeRemote{doc: "pool:\n  size: 4\n", changed: make(chan struct{})}
+			RegisterRemoteProvider("events", func(u *url.URL) (RemoteProvider, error) {
+				return remote, nil
+			})
+			events := config.WatchRemoteConfigOnChannel()
+			So(config.WatchRemote("events://control/app", 0), ShouldBeNil)
+
+			remote.set("pool:\n  size: 8\n")
+			select {
+			case event := <-events:
+				So(event.Err, ShouldBeNil)
+				So(event.URL, ShouldEqual, "events://control/app")
+				So(event.Settings["pool"], ShouldResemble, map[string]interface{}{"size": 8})
+				So(event.Changes, ShouldResemble, []Change{{Key: "pool.size", Old: 4, New: 8}})
+				So(config.GetInt("pool.size"), ShouldEqual, 8)
+			case <-time.After(2 * time.Second):
+				So("no event", ShouldBeEmpty)
+			}
+
+			config.StopRemote()
+			_, open := <-events
+			So(open, ShouldBeFalse)
+		})
+		Convey("Remote quotas", func() {
+			remote := &fakeRemote{doc: "app:\n  port: 8080\n  name: billing\n", changed: make(chan struct{})}
+			RegisterRemoteProvider("quota", func(u *url.URL) (RemoteProvider, error) {
+				return remote, nil
+			})
+			withheld := []QuarantinedKey{}
+			config.OnQuarantine(func(q QuarantinedKey) { withheld = append(withheld, q) })
+			config.SetRemoteQuota(RemoteQuota{MaxValueBytes: 64, MaxDepth: 3, KeepTypes: true})
+			config.Define("app.tags").As(TypeStringSlice)
+
+			Convey("Withhold values that change kind", func() {
+				config.SetFileSystem(reader.MapFileSystem{"app.yaml": []byte("app:\n  port: 8080\n")})
+				So(config.ReadPaths("app.yaml"), ShouldBeNil)
+
+				remote.doc = "app:\n  port:\n    huge: blob\n  name: billing\n  tags: {a: b}\n"
+				So(config.ReadRemote("quota://control/app"), ShouldBeNil)
+				So(config.GetString("app.name"), ShouldEqual, "billing")
+				So(config.SettingsFrom(LayerAttributes)["app.port"], ShouldEqual, 8080)
+				So(config.IsSet("app.tags"), ShouldBeFalse)
+
+				So(len(withheld), ShouldEqual, 2)
+				keys := []string{withheld[0].Key, withheld[1].Key}
+				sort.Strings(keys)
+				So(keys, ShouldResemble, []string{"app.port", "app.tags"})
+				_, isQuota := withheld[0].Err.(*errors.QuotaError)
+				So(isQuota, ShouldBeTrue)
+			})
+
+			Convey("Withhold oversized and deeply nested values", func() {
+				remote.doc = "app:\n  name: billing\n  blob: " + strings.Repeat("x", 100) + "\n  a:\n    b:\n      c: 1\n"
+				So(config.ReadRemote("quota://control/app"), ShouldBeNil)
+				So(config.GetString("app.name"), ShouldEqual, "billing")
+				So(config.IsSet("app.blob"), ShouldBeFalse)
+				So(config.IsSet("app.a.b"), ShouldBeFalse)
+				So(len(withheld), ShouldEqual, 2)
+			})
+		})
+		Convey("Encrypted remote documents", func() {
+			entity, err := openpgp.NewEntity("ops", "", "ops@example.com", &packet.Config{RSABits: 1024, DefaultHash: crypto.SHA256})
+			So(err, ShouldBeNil)
+			var secring bytes.Buffer
+			So(entity.SerializePrivate(&secring, nil), ShouldBeNil)
+			keyring, err := pgp.NewKeyring(&secring)
+			So(err, ShouldBeNil)
+
+			ciphertext, err := keyring.Encrypt([]byte("database:\n  password: hunter2\n"))
+			So(err, ShouldBeNil)
+			remote := &fakeRemote{doc: string(ciphertext), changed: make(chan struct{})}
+			RegisterRemoteProvider("sealed", func(u *url.URL) (RemoteProvider, error) {
+				return remote, nil
+			})
+
+			Convey("Decrypt before parsing", func() {
+				So(config.ReadSecureRemote("sealed://control/app", keyring), ShouldBeNil)
+				So(config.GetString("database.password"), ShouldEqual, "hunter2")
+			})
+
+			Convey("Fail with the wrong key", func() {
+				other, _ := openpgp.NewEntity("other", "", "other@example.com", &packet.Config{RSABits: 1024, DefaultHash: crypto.SHA256})
+				var otherring bytes.Buffer
+				other.SerializePrivate(&otherring, nil)
+				wrong, _ := pgp.NewKeyring(&otherring)
+				So(config.ReadSecureRemote("sealed://control/app", wrong), ShouldNotBeNil)
+				So(config.IsSet("database.password"), ShouldBeFalse)
+			})
+
+			Convey("Decrypt with age", func() {
+				identity, _ := ageIdentity()
+				keys, err := age.NewKeyring(strings.NewReader("# created: 2024-01-01\n" + identity + "\n"))
+				So(err, ShouldBeNil)
+				sealed, err := keys.Encrypt([]byte("database:\n  password: hunter2\n"))
+				So(err, ShouldBeNil)
+				So(string(sealed), ShouldStartWith, "-----BEGIN AGE ENCRYPTED FILE-----")
+
+				remote.doc = string(sealed)
+				So(config.ReadSecureRemote("sealed://control/app", keys), ShouldBeNil)
+				So(config.GetString("database.password"), ShouldEqual, "hunter2")
+
+				other, _ := ageIdentity()
+				wrong, _ := age.NewKeyring(strings.NewReader(other))
+				_, err = wrong.Decrypt(sealed)
+				So(err, ShouldNotBeNil)
+
+				_, err = age.NewKeyring(strings.NewReader("AGE-SECRET-KEY-1BOGUS\n"))
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("Logging the effective configuration", func() {
+			config.SetDefault("app.port", 8080)
+			config.Set("app.password", "hunter2")
+			config.MarkSecret("app.password")
+			logger := &recordingLogger{}
+			config.LogEffectiveConfig(logger)
+
+			So(logger.lines, ShouldResemble, [][]interface{}{
+				{"effective config", "key", "app.password", "value", Redacted, "layer", LayerOverrides},
+				{"effective config", "key", "app.port", "value", 8080, "layer", LayerDefaults},
+			})
+
+			Convey("Log again after reloads", func() {
+				config.SetFileSystem(reader.MapFileSystem{"app.yaml": []byte("app:\n  port: 9090\n")})
+				config.ReadPaths("app.yaml")
+				logger.lines = nil
+				config.SetFileSystem(reader.MapFileSystem{"app.yaml": []byte("app:\n  port: 9191\n")})
+				_, err := config.Reload()
+				So(err, ShouldBeNil)
+				So(logger.lines, ShouldContain, []interface{}{"effective config", "key", "app.port", "value", 9191, "layer", LayerAttributes})
+			})
+		})
+		Convey("Inline encrypted values", func() {
+			key := AESKey(bytes.Repeat([]byte{7}, 32))
+			ciphertext, err := key.EncryptValue("hunter2")
+			So(err, ShouldBeNil)
+			So(ciphertext, ShouldStartWith, "ENC[AES256_GCM,data:")
+
+			config.SetFileSystem(reader.MapFileSystem{"app.json": []byte(`{"db": {"host": "db.internal", "pass": "` + ciphertext + `"}}`)})
+			So(config.ReadPaths("app.json"), ShouldBeNil)
+
+			Convey("Return ciphertext without a key", func() {
+				So(config.GetString("db.pass"), ShouldEqual, ciphertext)
+			})
+
+			Convey("Return plaintext with a key", func() {
+				config.AddValueDecrypter(key)
+				So(config.GetString("db.pass"), ShouldEqual, "hunter2")
+				So(config.GetStringMap("db")["pass"], ShouldEqual, "hunter2")
+				So(config.GetString("db.host"), ShouldEqual, "db.internal")
+				So(config.IsSecret("db.pass"), ShouldBeTrue)
+				So(config.IsSecret("db.host"), ShouldBeFalse)
+				So(config.Export(ExportOptions{Redact: true})["db"].(map[string]interface{})["pass"], ShouldEqual, Redacted)
+			})
+
+			Convey("Report values encrypted for another key rather than return ciphertext", func() {
+				config.AddValueDecrypter(AESKey(bytes.Repeat([]byte{8}, 32)))
+				So(config.GetString("db.pass"), ShouldEqual, "")
+				So(config.IsSet("db.pass"), ShouldBeFalse)
+				So(config.GetStringMap("db"), ShouldResemble, map[string]interface{}{"host": "db.internal", "pass": nil})
+
+				_, err := config.GetStringE("db.pass")
+				So(err, ShouldHaveSameTypeAs, &errors.DecryptionError{})
+				So(err.(*errors.DecryptionError).Key, ShouldEqual, "db.pass")
+				_, err = config.GetE("db")
+				So(err, ShouldNotBeNil)
+
+				config.SetStrictLifecycle(true)
+				config.Finalize()
+				So(func() { config.Get("db.pass") }, ShouldNotPanic)
+				So(config.Get("db.pass"), ShouldBeNil)
+			})
+
+			Convey("Try each decrypter handling a value", func() {
+				config.AddValueDecrypter(AESKey(bytes.Repeat([]byte{8}, 32)))
+				config.AddValueDecrypter(key)
+				So(config.GetString("db.pass"), ShouldEqual, "hunter2")
+			})
+		})
+		Convey("Inline values encrypted with age", func() {
+			identity, recipient := ageIdentity()
+			keys, _ := age.NewKeyring(strings.NewReader(identity))
+			sealed, err := keys.Values().EncryptValue("hunter2")
+			So(err, ShouldBeNil)
+
+			config.Set("db.pass", sealed)
+			config.Set("db.user", "age1 is not ciphertext")
+			config.AddValueDecrypter(keys.Values())
+			So(config.GetString("db.pass"), ShouldEqual, "hunter2")
+			So(config.GetString("db.user"), ShouldEqual, "age1 is not ciphertext")
+			So(config.IsSecret("db.pass"), ShouldBeTrue)
+			So(recipient, ShouldStartWith, "age1")
+
+			other, _ := ageIdentity()
+			wrong, _ := age.NewKeyring(strings.NewReader(other))
+			config := NewConfig()
+			config.Set("db.pass", sealed)
+			config.AddValueDecrypter(wrong.Values())
+			_, err = config.GetStringE("db.pass")
+			So(err, ShouldHaveSameTypeAs, &errors.DecryptionError{})
+		})
+		Convey("Unmarshaling onto populated values", func() {
+			type Database struct {
+				Host    string
+				Port    int
+				MaxIdle int `mapstructure:"max_idle"`
+				Tags    []string
+				Options map[string]string
+			}
+			config.Set("app.database.host", "db.internal")
+			config.Set("app.database.tags", []string{"primary"})
+			config.Set("app.database.options", map[string]interface{}{"sslmode": "require"})
+
+			Convey("Keep fields the configuration doesn't set", func() {
+				db := Database{Host: "localhost", Port: 5432, Tags: []string{"a", "b"}, Options: map[string]string{"timeout": "5s"}}
+				So(config.UnmarshalKey("app.database", &db), ShouldBeNil)
+				So(db, ShouldResemble, Database{
+					Host:    "db.internal",
+					Port:    5432,
+					Tags:    []string{"primary"},
+					Options: map[string]string{"timeout": "5s", "sslmode": "require"},
+				})
+			})
+
+			Convey("Report unknown keys beneath a key", func() {
+				config.Set("app.database.pasword", "typo")
+				err := config.UnmarshalKeyExact("app.database", &Database{})
+				So(err, ShouldResemble, &errors.UnknownKeysError{Keys: []string{"pasword"}})
+			})
+
+			Convey("Report fields the configuration doesn't set", func() {
+				err := config.UnmarshalKeyExactFields("app.database", &Database{})
+				So(err, ShouldResemble, &errors.UnsetFieldsError{Fields: []string{"max_idle", "port"}})
+
+				config.Set("app.database.port", 5432)
+				config.Set("app.database.max_idle", 2)
+				So(config.UnmarshalKeyExactFields("app.database", &Database{}), ShouldBeNil)
+			})
+		})
+		Convey("List separators for environment variables", func() {
+			config.SetEnvironment(source.MapEnvironment{
+				"SERVER_STATIC_ASSETS": "css, js,img",
+				"PLUGINS_PATH":         "/usr/lib:/opt/lib",
+				"DATABASE_DSN":         "host=a,port=5",
+				"SERVER_HOSTS":         "a.internal,b.internal",
+			})
+			config.BindEnv("server.static_assets")
+			config.BindEnv("plugins.path")
+			config.BindEnv("database.dsn")
+			config.BindEnv("server.hosts")
+			config.SetDefault("server.hosts", []string{"localhost"})
+
+			Convey("Split per key", func() {
+				config.SetEnvListSeparator(",", "server.static_assets")
+				config.SetEnvListSeparator(":", "plugins.path")
+				So(config.GetStringSlice("server.static_assets"), ShouldResemble, []string{"css", "js", "img"})
+				So(config.GetStringSlice("plugins.path"), ShouldResemble, []string{"/usr/lib", "/opt/lib"})
+				So(config.GetString("database.dsn"), ShouldEqual, "host=a,port=5")
+			})
+
+			Convey("Split every list globally", func() {
+				config.SetEnvListSeparator(",")
+				config.Define("server.static_assets").As(TypeStringSlice)
+				So(config.GetStringSlice("server.hosts"), ShouldResemble, []string{"a.internal", "b.internal"})
+				So(config.GetStringSlice("server.static_assets"), ShouldResemble, []string{"css", "js", "img"})
+				So(config.GetString("database.dsn"), ShouldEqual, "host=a,port=5")
+				So(config.SettingsFrom(LayerEnv)["server.hosts"], ShouldResemble, []interface{}{"a.internal", "b.internal"})
+			})
+		})
+		Convey("Map valued environment variables", func() {
+			config.SetEnvironment(source.MapEnvironment{
+				"SVC_APP_LABELS_TEAM":        "core",
+				"SVC_APP_LABELS_TIER":        "backend",
+				"SVC_APP_LABELS_COST_CENTER": "eng",
+				"SVC_APP_NAP_TIME":           "1h",
+			})
+			config.Define("app.labels").As(TypeMap)
+			config.SetDefault("app.labels", map[string]interface{}{"tier": "frontend", "owner": "ops"})
+
+			overlay := config.OverlayEnv("SVC_")
+			So(overlay.Bound["SVC_APP_LABELS_TEAM"], ShouldEqual, "app.labels.team")
+			So(overlay.Ignored, ShouldResemble, []string{"SVC_APP_NAP_TIME"})
+
+			So(config.GetStringMapString("app.labels"), ShouldResemble, map[string]string{
+				"team":        "core",
+				"tier":        "backend",
+				"cost_center": "eng",
+				"owner":       "ops",
+			})
+			So(config.GetString("app.labels.team"), ShouldEqual, "core")
+
+			var settings struct {
+				App struct{ Labels map[string]string }
+			}
+			So(config.Unmarshal(&settings), ShouldBeNil)
+			So(settings.App.Labels["tier"], ShouldEqual, "backend")
+		})
+		Convey("Scrubbing secrets", func() {
+			config.SetFileSystem(reader.MapFileSystem{"app.yaml": []byte("db:\n  host: db.internal\n  password: hunter2\n")})
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+			key := []byte("api-key")
+			config.Set("service.api_key", key)
+			config.MarkSecret("service.api_key")
+
+			Convey("Overwrite secrets everywhere they're held", func() {
+				config.ScrubSecrets()
+				So(config.GetString("db.password"), ShouldEqual, Redacted)
+				So(config.GetString("db.host"), ShouldEqual, "db.internal")
+				So(config.Get("service.api_key"), ShouldEqual, Redacted)
+				So(key, ShouldResemble, make([]byte, 7))
+
+				var buf bytes.Buffer
+				So(config.WriteConfigFor(&buf, "app.yaml", ""), ShouldBeNil)
+				So(buf.String(), ShouldNotContainSubstring, "hunter2")
+
+				_, exists := config.TakeSecret("db.password")
+				So(exists, ShouldBeFalse)
+			})
+
+			Convey("Retain secrets for a single read", func() {
+				config.ScrubSecrets(ScrubOptions{Retain: true})
+				So(config.GetString("db.password"), ShouldEqual, Redacted)
+
+				val, exists := config.TakeSecret("db.password")
+				So(exists, ShouldBeTrue)
+				So(string(val), ShouldEqual, "hunter2")
+
+				_, exists = config.TakeSecret("db.password")
+				So(exists, ShouldBeFalse)
+			})
+		})
+		Convey("Health", func() {
+			config.SetFileSystem(reader.MapFileSystem{"app.yaml": []byte("port: 8080\n")})
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+
+			Convey("Report a healthy configuration", func() {
+				health := config.Health()
+				So(health.Healthy, ShouldBeTrue)
+				So(health.Degraded, ShouldBeFalse)
+				So(health.LoadedAt.IsZero(), ShouldBeFalse)
+
+				recorder := httptest.NewRecorder()
+				config.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+				So(recorder.Body.String(), ShouldContainSubstring, `"status":"ok"`)
+			})
+
+			Convey("Report failed reloads and invalid settings", func() {
+				config.AddValidator(func(c *Config) error {
+					if c.GetInt("port") > 9000 {
+						return fmt.Errorf("port too high")
+					}
+					return nil
+				})
+				config.SetFileSystem(reader.MapFileSystem{"app.yaml": []byte("port: 9999\n")})
+				_, err := config.Reload()
+				So(err, ShouldNotBeNil)
+
+				health := config.Health()
+				So(health.Healthy, ShouldBeFalse)
+				So(health.LastReloadErr, ShouldEqual, err)
+
+				recorder := httptest.NewRecorder()
+				config.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+				So(recorder.Code, ShouldEqual, http.StatusServiceUnavailable)
+			})
+
+			Convey("Report stale remote sources as degraded", func() {
+				dir, _ := os.MkdirTemp("", "confer")
+				defer os.RemoveAll(dir)
+				remote := &fakeRemote{doc: "region: us-east\n", changed: make(chan struct{})}
+				RegisterRemoteProvider("health", func(u *url.URL) (RemoteProvider, error) {
+					return remote, nil
+				})
+				config.SetRemoteCacheDir(dir)
+				So(config.ReadRemote("health://control/app"), ShouldBeNil)
+
+				remote.err = fmt.Errorf("connection refused")
+				booted := NewConfig()
+				booted.SetRemoteCacheDir(dir)
+				So(booted.ReadRemote("health://control/app"), ShouldBeNil)
+
+				health := booted.Health()
+				So(health.Healthy, ShouldBeTrue)
+				So(health.Degraded, ShouldBeTrue)
+				So(health.Remote[0].Stale, ShouldBeTrue)
+			})
+		})
+
+		Convey("Reading while watched files reload", func() {
+			dir, _ := os.MkdirTemp("", "confer")
+			defer os.RemoveAll(dir)
+			file := dir + "/application.yaml"
+			os.WriteFile(file, []byte("app:\n  generation: 0\n"), 0644)
+
+			So(config.ReadPaths(file), ShouldBeNil)
+			So(config.WatchConfig(), ShouldBeNil)
+			defer config.StopWatching()
+
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-done:
+							return
+						default:
+							config.GetInt("app.generation")
+							config.AllSettings()
+							config.IsSet("app.name")
+							config.WriteConfigFor(new(bytes.Buffer), file, "")
+							config.SettingsFrom(LayerAttributes)
+							config.Layers()
+							config.DocumentEnv()
+							config.DumpState(new(bytes.Buffer))
+							config.Get("app.tags")
+						}
+					}
+				}()
+			}
+
+			for i := 1; i <= 5; i++ {
+				os.WriteFile(file, []byte(fmt.Sprintf("app:\n  generation: %d\n", i)), 0644)
+				config.Set("app.name", fmt.Sprint("writer-", i))
+				config.SetEnvListSeparator(",", "app.tags")
+				config.SetStrictLifecycle(i%2 == 0)
+				config.Finalize()
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for config.GetInt("app.generation") != 5 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			close(done)
+			wg.Wait()
+
+			So(config.GetInt("app.generation"), ShouldEqual, 5)
+			So(config.GetString("app.name"), ShouldEqual, "writer-5")
+		})
+
+		Convey("Reloading keys removed from files", func() {
+			dir, _ := os.MkdirTemp("", "confer")
+			defer os.RemoveAll(dir)
+			file := dir + "/application.yaml"
+			os.WriteFile(file, []byte("app:\n  name: confer\n  debug: true\n"), 0644)
+
+			So(config.ReadPaths(file), ShouldBeNil)
+			config.MergeAttributes(map[string]interface{}{"extra": "kept"})
+			So(config.IsSet("app.debug"), ShouldBeTrue)
+
+			os.WriteFile(file, []byte("app:\n  name: confer\n"), 0644)
+			report, err := config.Reload()
+			So(err, ShouldBeNil)
+			So(report.Applied, ShouldResemble, []Change{{Key: "app.debug", Old: true, New: nil}})
+			So(config.IsSet("app.debug"), ShouldBeFalse)
+			So(config.GetString("app.name"), ShouldEqual, "confer")
+			So(config.GetString("extra"), ShouldEqual, "kept")
+		})
+
+		Convey("Reloading after merging documents", func() {
+			files := reader.MapFileSystem{
+				"base.yaml":  []byte("xx: 0\nyy: 0\n"),
+				"local.yaml": []byte("yy: 1\n"),
+			}
+			config.SetFileSystem(files)
+			So(config.ReadPaths("base.yaml"), ShouldBeNil)
+			config.MergeAttributes(map[string]interface{}{"xx": 5, "yy": 5})
+			So(config.ReadPaths("local.yaml"), ShouldBeNil)
+			config.Unset("zz")
+
+			report, err := config.Reload()
+			So(err, ShouldBeNil)
+			So(report.Applied, ShouldBeEmpty)
+			So(config.GetInt("xx"), ShouldEqual, 5)
+			So(config.GetInt("yy"), ShouldEqual, 1)
+		})
+		Convey("Flag defaults apart from defaults", func() {
+			flags := pflag.NewFlagSet("tool", pflag.ContinueOnError)
+			flags.Int("workers", 4, "")
+			flags.String("mode", "fast", "")
+			config.BindPFlag("workers", flags.Lookup("workers"))
+			So(config.SetPrecedence(LayerFlags, LayerOverrides, LayerEnv, LayerAttributes, LayerDefaults, LayerFlagDefaults), ShouldBeNil)
+			config.BindPFlag("mode", flags.Lookup("mode"))
+
+			Convey("Leave the defaults tier to SetDefault", func() {
+				So(config.SettingsFrom(LayerDefaults), ShouldBeEmpty)
+				info, _ := config.Provenance("workers")
+				So(info.Layer, ShouldEqual, LayerFlagDefaults)
+				info, _ = config.Provenance("mode")
+				So(info.Layer, ShouldEqual, LayerFlagDefaults)
+				So(config.GetInt("workers"), ShouldEqual, 4)
+			})
+
+			Convey("Let SetDefault beat flag defaults when ranked above them", func() {
+				config.SetDefault("workers", 8)
+				So(config.GetInt("workers"), ShouldEqual, 8)
+				info, _ := config.Provenance("workers")
+				So(info.Layer, ShouldEqual, LayerDefaults)
+				So(config.GetString("mode"), ShouldEqual, "fast")
+			})
+
+			Convey("Copy flag defaults back once the tier is dropped", func() {
+				config.SetDefault("workers", 8)
+				So(config.SetPrecedence(defaultPrecedence...), ShouldBeNil)
+				So(config.SettingsFrom(LayerDefaults), ShouldResemble, map[string]interface{}{"workers": 8, "mode": "fast"})
+			})
+		})
+		Convey("SFTP file systems", func() {
+			dir, _ := os.MkdirTemp("", "sftpfs")
+			defer os.RemoveAll(dir)
+			path := dir + "/device.yaml"
+			os.WriteFile(path, []byte("app:\n  region: us-east\n"), 0644)
+
+			server := newSFTPServer("hunter2")
+			defer server.close()
+			opts := sftpfs.Options{Addr: server.addr(), User: "device", Password: "hunter2", HostKey: server.hostKey}
+			fs := sftpfs.New(opts)
+			defer fs.Close()
+
+			Convey("Read files from the remote host", func() {
+				config.SetFileSystem(fs)
+				So(config.ReadPaths(path), ShouldBeNil)
+				So(config.GetString("app.region"), ShouldEqual, "us-east")
+			})
+
+			Convey("Reuse the connection across reads", func() {
+				_, err := fs.ReadFile(path)
+				So(err, ShouldBeNil)
+				_, err = fs.ReadFile(dir + "/missing.yaml")
+				So(err, ShouldNotBeNil)
+				_, err = fs.ReadFile(path)
+				So(err, ShouldBeNil)
+				So(server.accepted(), ShouldEqual, 1)
+			})
+
+			Convey("Reconnect when the connection drops", func() {
+				config.SetFileSystem(fs)
+				So(config.ReadPaths(path), ShouldBeNil)
+
+				server.drop()
+				os.WriteFile(path, []byte("app:\n  region: eu-west\n"), 0644)
+				_, err := config.Reload()
+				So(err, ShouldBeNil)
+				So(config.GetString("app.region"), ShouldEqual, "eu-west")
+				So(server.accepted(), ShouldEqual, 2)
+			})
+
+			Convey("Reconnect after Close", func() {
+				_, err := fs.ReadFile(path)
+				So(err, ShouldBeNil)
+				So(fs.Close(), ShouldBeNil)
+				So(fs.Close(), ShouldBeNil)
+				data, err := fs.ReadFile(path)
+				So(err, ShouldBeNil)
+				So(string(data), ShouldContainSubstring, "us-east")
+				So(server.accepted(), ShouldEqual, 2)
+			})
+
+			Convey("Reject wrong passwords", func() {
+				opts.Password = "guess"
+				_, err := sftpfs.New(opts).ReadFile(path)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Reject unexpected host keys", func() {
+				other := newSFTPServer("hunter2")
+				defer other.close()
+				opts.HostKey = other.hostKey
+				_, err := sftpfs.New(opts).ReadFile(path)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Require host key verification", func() {
+				opts.HostKey = nil
+				_, err := sftpfs.New(opts).ReadFile(path)
+				So(err, ShouldNotBeNil)
+				So(server.accepted(), ShouldEqual, 0)
+
+				opts.InsecureIgnoreHostKey = true
+				_, err = sftpfs.New(opts).ReadFile(path)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Verify hosts against known_hosts files", func() {
+				opts.HostKey = nil
+				opts.KnownHostsFile = dir + "/known_hosts"
+				os.WriteFile(opts.KnownHostsFile, []byte(knownhosts.Line([]string{server.addr()}, server.hostKey)+"\n"), 0644)
+				_, err := sftpfs.New(opts).ReadFile(path)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Authenticate with private keys", func() {
+				opts.Password = ""
+				opts.PrivateKey = []byte("not a key")
+				_, err := sftpfs.New(opts).ReadFile(path)
+				So(err, ShouldNotBeNil)
+				So(server.accepted(), ShouldEqual, 0)
+			})
+		})
 	})
 }
 
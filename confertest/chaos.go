@@ -0,0 +1,127 @@
+// Package confertest provides utilities for testing code that uses confer.
+package confertest
+
+import (
+	"sync"
+
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/reader"
+	"github.com/jacobstr/confer/source"
+)
+
+// Content that none of the supported formats can parse.
+var corrupted = []byte("\x00{[: corrupted by confertest")
+
+// A scriptable reader.FileSystem for exercising reload and validation
+// handling end to end. Install it with Config.SetFileSystem, then flip
+// values, corrupt files or inject read failures between calls to Reload:
+//
+//	chaos := confertest.NewChaos(reader.OSFileSystem{})
+//	config.SetFileSystem(chaos)
+//	config.ReadPaths("application.yaml")
+//
+//	chaos.Corrupt("application.yaml")
+//	_, err := config.Reload() // a parse error
+//
+// Chaos is safe for concurrent use.
+type Chaos struct {
+	base reader.FileSystem
+
+	mu       sync.Mutex
+	files    map[string][]byte
+	failures map[string]error
+}
+
+// Wraps base, which supplies the contents of any file that hasn't been
+// scripted. A nil base behaves as an empty file system.
+func NewChaos(base reader.FileSystem) *Chaos {
+	if base == nil {
+		base = reader.MapFileSystem{}
+	}
+
+	return &Chaos{
+		base:     base,
+		files:    make(map[string][]byte),
+		failures: make(map[string]error),
+	}
+}
+
+func (c *Chaos) ReadFile(path string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readFile(path)
+}
+
+func (c *Chaos) readFile(path string) ([]byte, error) {
+	if err, exists := c.failures[path]; exists {
+		return nil, err
+	}
+	if data, exists := c.files[path]; exists {
+		return data, nil
+	}
+	return c.base.ReadFile(path)
+}
+
+// Replaces the contents of a file.
+func (c *Chaos) Write(path string, contents []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[path] = contents
+}
+
+// Sets key to val within a file, re-encoding it in the format implied by its
+// extension or, failing that, its contents.
+func (c *Chaos) Flip(path string, key string, val interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	contents, err := c.readFile(path)
+	if err != nil {
+		return err
+	}
+
+	format := reader.FormatOf(path)
+	if format == "" {
+		format = reader.Sniff(contents)
+	}
+
+	loaded, err := reader.ReadBytes(contents, format)
+	if err != nil {
+		return err
+	}
+
+	data := maps.Normalize(loaded)
+	src := source.NewConfigSource()
+	if m, ok := data.(map[string]interface{}); ok {
+		src.FromStringMap(m)
+	}
+	src.Set(key, val)
+
+	encoded, err := reader.Marshal(src.ToStringMap(), format)
+	if err != nil {
+		return err
+	}
+
+	c.files[path] = encoded
+	return nil
+}
+
+// Makes a file unparsable in any format.
+func (c *Chaos) Corrupt(path string) {
+	c.Write(path, corrupted)
+}
+
+// Makes reads of a file fail with err.
+func (c *Chaos) Fail(path string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[path] = err
+}
+
+// Discards any scripted contents or failures for a file.
+func (c *Chaos) Reset(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.files, path)
+	delete(c.failures, path)
+}
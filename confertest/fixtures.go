@@ -0,0 +1,91 @@
+package confertest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jacobstr/confer"
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/reader"
+	"github.com/jacobstr/confer/source"
+)
+
+// The environments of managers built by FromYAML and FromMap, by manager.
+var environments sync.Map
+
+// Builds a manager from a YAML document for a unit test, e.g:
+//
+//	config := confertest.FromYAML(t, `
+//	app:
+//	  database:
+//	    host: localhost
+//	`)
+//
+// The manager reads files from an empty in-memory file system and variables
+// from an empty environment, so the test doesn't depend on the machine it
+// runs on. Use Setenv to provide variables. Fails the test if the document
+// can't be parsed.
+func FromYAML(t testing.TB, doc string) *confer.Config {
+	t.Helper()
+	return fromDocument(t, doc, "yaml")
+}
+
+// Like FromYAML, but builds the manager from a JSON document, e.g. to check
+// that both forms of a fixture produce the same configuration.
+func FromJSON(t testing.TB, doc string) *confer.Config {
+	t.Helper()
+	return fromDocument(t, doc, "json")
+}
+
+func fromDocument(t testing.TB, doc string, format string) *confer.Config {
+	t.Helper()
+
+	config := newConfig(t)
+	if err := config.ReadBytes([]byte(doc), format); err != nil {
+		t.Fatalf("confertest: unable to parse %s: %v", strings.ToUpper(format), err)
+	}
+	return config
+}
+
+// Like FromYAML, but builds the manager from a nested map. The map is copied,
+// so the test may go on to modify it.
+func FromMap(t testing.TB, data map[string]interface{}) *confer.Config {
+	t.Helper()
+
+	config := newConfig(t)
+	config.MergeAttributes(maps.DeepCopy(maps.Normalize(data)))
+	return config
+}
+
+// Sets a variable in the environment of a manager built by FromYAML or
+// FromMap. Bind it as usual, e.g. with BindEnv or AutomaticEnv. The variable
+// only exists for the duration of the test; the process environment is never
+// modified.
+func Setenv(t testing.TB, config *confer.Config, name string, value string) {
+	t.Helper()
+
+	env, exists := environments.Load(config)
+	if !exists {
+		t.Fatalf("confertest: Setenv requires a manager built by FromYAML or FromMap")
+		return
+	}
+
+	env.(source.MapEnvironment)[name] = value
+	config.Publish()
+}
+
+func newConfig(t testing.TB) *confer.Config {
+	env := source.MapEnvironment{}
+
+	config := confer.NewConfig()
+	config.SetFileSystem(reader.MapFileSystem{})
+	config.SetEnvironment(env)
+
+	environments.Store(config, env)
+	t.Cleanup(func() {
+		config.StopWatching()
+		environments.Delete(config)
+	})
+	return config
+}
@@ -0,0 +1,104 @@
+package confertest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jacobstr/confer"
+	"github.com/jacobstr/confer/reader"
+)
+
+// Rewrites golden files rather than comparing against them, e.g:
+//
+//	go test ./... -confertest.update
+//
+// Setting CONFERTEST_UPDATE=1 has the same effect, for test runners that
+// don't pass flags through.
+var update = flag.Bool("confertest.update", false, "rewrite confertest golden files")
+
+// Compares the effective configuration of config with the golden file at
+// path, failing the test if they differ, so an application can lock down its
+// configuration surface:
+//
+//	func TestEffectiveConfig(t *testing.T) {
+//		config := app.LoadConfig("testdata/prod.yaml")
+//		confertest.Golden(t, config, "testdata/effective.golden.yaml")
+//	}
+//
+// Settings are written in the format implied by path, YAML by default, with
+// secrets redacted. Run with -confertest.update to create or rewrite the
+// file after an intended change.
+func Golden(t testing.TB, config *confer.Config, path string) {
+	t.Helper()
+
+	format := reader.FormatOf(path)
+	if format == "" {
+		format = "yaml"
+	}
+
+	got, err := reader.Marshal(config.Export(confer.ExportOptions{Redact: true}), format)
+	if err != nil {
+		t.Fatalf("confertest: unable to encode the effective configuration as %s: %v", format, err)
+		return
+	}
+
+	if *update || os.Getenv("CONFERTEST_UPDATE") == "1" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("confertest: %v", err)
+			return
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("confertest: %v", err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("confertest: golden file %s doesn't exist, run with -confertest.update to create it", path)
+		return
+	} else if err != nil {
+		t.Fatalf("confertest: %v", err)
+		return
+	}
+
+	if !bytes.Equal(bytes.TrimSpace(want), bytes.TrimSpace(got)) {
+		t.Errorf("confertest: effective configuration differs from %s, run with -confertest.update to accept:\n%s", path, diffLines(string(want), string(got)))
+	}
+}
+
+// Lists the lines only in want, prefixed with -, and only in got, prefixed
+// with +.
+func diffLines(want, got string) string {
+	count := func(s string) map[string]int {
+		lines := map[string]int{}
+		for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+			lines[line]++
+		}
+		return lines
+	}
+	wantLines, gotLines := count(want), count(got)
+
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(want), "\n") {
+		if gotLines[line] > 0 {
+			gotLines[line]--
+			continue
+		}
+		fmt.Fprintf(&b, "-%s\n", line)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(got), "\n") {
+		if wantLines[line] > 0 {
+			wantLines[line]--
+			continue
+		}
+		fmt.Fprintf(&b, "+%s\n", line)
+	}
+	return b.String()
+}
@@ -0,0 +1,442 @@
+package confer_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/jacobstr/confer"
+	"github.com/jacobstr/confer/confertest"
+	"github.com/jacobstr/confer/logging"
+	"github.com/jacobstr/confer/mobile"
+	"github.com/jacobstr/confer/presets"
+	"github.com/jacobstr/confer/reader"
+)
+
+// Exercises confertest from outside the package, as it imports confer.
+func TestConfertest(t *testing.T) {
+	Convey("Confertest", t, func() {
+		Convey("Chaos", func() {
+			config := confer.NewConfig()
+			chaos := confertest.NewChaos(reader.OSFileSystem{})
+			config.SetFileSystem(chaos)
+			config.ReadPaths("test/fixtures/application.yaml")
+
+			Convey("Flipped values are picked up on reload", func() {
+				So(chaos.Flip("test/fixtures/application.yaml", "app.logging.level", "warn"), ShouldBeNil)
+				report, err := config.Reload()
+				So(err, ShouldBeNil)
+				So(report.Applied, ShouldResemble, []confer.Change{{Key: "app.logging.level", Old: "info", New: "warn"}})
+			})
+
+			Convey("Parse failures are reported and retain the previous values", func() {
+				chaos.Corrupt("test/fixtures/application.yaml")
+				_, err := config.Reload()
+				So(err, ShouldNotBeNil)
+				So(config.GetString("app.logging.level"), ShouldEqual, "info")
+			})
+		})
+
+		Convey("Fixtures", func() {
+			Convey("From YAML", func() {
+				config := confertest.FromYAML(t, "app:\n  database:\n    host: localhost\n    port: 5432\n")
+				So(config.GetString("app.database.host"), ShouldEqual, "localhost")
+				So(config.GetInt("app.database.port"), ShouldEqual, 5432)
+				So(config.ReadPaths("test/fixtures/application.yaml"), ShouldNotBeNil)
+			})
+
+			Convey("From JSON", func() {
+				yamlConfig := confertest.FromYAML(t, "app:\n  port: 5432\n")
+				jsonConfig := confertest.FromJSON(t, `{"app": {"port": 5432}}`)
+				So(jsonConfig.AllSettings(), ShouldResemble, yamlConfig.AllSettings())
+			})
+
+			Convey("From a map", func() {
+				data := map[string]interface{}{
+					"app": map[string]interface{}{"name": "fixture"},
+				}
+				config := confertest.FromMap(t, data)
+				data["app"].(map[string]interface{})["name"] = "mutated"
+				So(config.GetString("app.name"), ShouldEqual, "fixture")
+			})
+
+			Convey("Environment", func() {
+				t.Setenv("APP_NAME", "process")
+				config := confertest.FromMap(t, map[string]interface{}{"app": map[string]interface{}{"name": "fixture"}})
+				config.BindEnv("app.name")
+				So(config.GetString("app.name"), ShouldEqual, "fixture")
+
+				confertest.Setenv(t, config, "APP_NAME", "test")
+				So(config.GetString("app.name"), ShouldEqual, "test")
+			})
+		})
+
+		Convey("Golden files", func() {
+			dir, _ := os.MkdirTemp("", "confertest")
+			defer os.RemoveAll(dir)
+			golden := filepath.Join(dir, "effective.golden.yaml")
+			config := confertest.FromYAML(t, "app:\n  port: 5432\n  password: hunter2\n")
+			config.MarkSecret("app.password")
+
+			Convey("Match the effective configuration", func() {
+				ioutil.WriteFile(golden, []byte("app:\n  password: '[REDACTED]'\n  port: 5432\n"), 0644)
+				confertest.Golden(t, config, golden)
+				So(t.Failed(), ShouldBeFalse)
+			})
+
+			Convey("Rewrite the file when updating", func() {
+				os.Setenv("CONFERTEST_UPDATE", "1")
+				defer os.Unsetenv("CONFERTEST_UPDATE")
+				confertest.Golden(t, config, golden)
+
+				contents, err := ioutil.ReadFile(golden)
+				So(err, ShouldBeNil)
+				So(string(contents), ShouldContainSubstring, "port: 5432")
+				So(string(contents), ShouldNotContainSubstring, "hunter2")
+			})
+		})
+	})
+}
+
+// Exercises the packages built on confer, which its own tests can't import.
+func TestIntegrations(t *testing.T) {
+	Convey("Integrations", t, func() {
+		Convey("Logging", func() {
+			fs := reader.MapFileSystem{"app.yaml": []byte("logging:\n  level: info\n  format: json\n")}
+			config := confer.NewConfig()
+			config.SetFileSystem(fs)
+			So(config.ReadPaths("app.yaml"), ShouldBeNil)
+
+			Convey("Map level names onto slog levels", func() {
+				for name, want := range map[string]slog.Level{
+					"trace":    slog.LevelDebug - 4,
+					"DEBUG":    slog.LevelDebug,
+					"info":     slog.LevelInfo,
+					"warning":  slog.LevelWarn,
+					"warn":     slog.LevelWarn,
+					"error":    slog.LevelError,
+					"fatal":    slog.LevelError + 4,
+					"critical": slog.LevelError + 4,
+				} {
+					level, err := logging.ParseSlogLevel(name)
+					So(err, ShouldBeNil)
+					So(level, ShouldEqual, want)
+				}
+
+				_, err := logging.ParseSlogLevel("loud")
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Follow the level across reloads", func() {
+				var buf bytes.Buffer
+				logger, _, err := logging.NewSlogTo(config, "logging", &buf)
+				So(err, ShouldBeNil)
+
+				logger.Debug("hidden")
+				logger.Info("shown")
+				So(buf.String(), ShouldNotContainSubstring, "hidden")
+				So(buf.String(), ShouldContainSubstring, `"msg":"shown"`)
+
+				fs["app.yaml"] = []byte("logging:\n  level: debug\n  format: json\n")
+				_, err = config.Reload()
+				So(err, ShouldBeNil)
+				logger.Debug("revealed")
+				So(buf.String(), ShouldContainSubstring, `"msg":"revealed"`)
+			})
+
+			Convey("Stop following the level once closed", func() {
+				var buf bytes.Buffer
+				logger, closer, err := logging.NewSlogTo(config, "logging", &buf)
+				So(err, ShouldBeNil)
+				So(closer.Close(), ShouldBeNil)
+
+				fs["app.yaml"] = []byte("logging:\n  level: debug\n  format: json\n")
+				_, err = config.Reload()
+				So(err, ShouldBeNil)
+				logger.Debug("hidden")
+				So(buf.String(), ShouldNotContainSubstring, "hidden")
+			})
+
+			Convey("Redact attributes named after secrets", func() {
+				config.MarkSecret("session")
+				var buf bytes.Buffer
+				logger, _, err := logging.NewSlogTo(config, "logging", &buf)
+				So(err, ShouldBeNil)
+
+				logger.Info("connect", "password", "hunter2", "session", "s3cr3t", slog.Group("db", "token", "abc123", "host", "db.local"))
+				So(buf.String(), ShouldNotContainSubstring, "hunter2")
+				So(buf.String(), ShouldNotContainSubstring, "s3cr3t")
+				So(buf.String(), ShouldNotContainSubstring, "abc123")
+				So(buf.String(), ShouldContainSubstring, `"password":"[REDACTED]"`)
+				So(buf.String(), ShouldContainSubstring, `"db":{"token":"[REDACTED]","host":"db.local"}`)
+			})
+
+			Convey("Reject unknown formats", func() {
+				config.Set("logging.format", "xml")
+				_, _, err := logging.NewSlogTo(config, "logging", ioutil.Discard)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Close the files opened for outputs", func() {
+				dir, err := ioutil.TempDir("", "logging")
+				So(err, ShouldBeNil)
+				defer os.RemoveAll(dir)
+				path := filepath.Join(dir, "app.log")
+				config.Set("logging.outputs", []string{path})
+
+				logger, closer, err := logging.NewSlog(config, "logging")
+				So(err, ShouldBeNil)
+				logger.Info("written")
+				So(closer.Close(), ShouldBeNil)
+
+				contents, err := ioutil.ReadFile(path)
+				So(err, ShouldBeNil)
+				So(string(contents), ShouldContainSubstring, `"msg":"written"`)
+
+				w, err := logging.Read(config, "logging").Writer()
+				So(err, ShouldBeNil)
+				So(w.Close(), ShouldBeNil)
+				_, err = w.Write([]byte("late\n"))
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Fail when an output can't be opened", func() {
+				config.Set("logging.outputs", []string{"stdout", filepath.Join(os.TempDir(), "missing", "dir", "app.log")})
+				_, _, err := logging.NewSlog(config, "logging")
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("Mobile", func() {
+			config := mobile.NewConfig()
+			So(config.ReadYAML("app:\n  name: demo\n  port: 8080\n  debug: true\n  ratio: 0.5\n"), ShouldBeNil)
+
+			Convey("Read scalars", func() {
+				So(config.GetString("app.name"), ShouldEqual, "demo")
+				So(config.GetInt("app.port"), ShouldEqual, 8080)
+				So(config.GetBool("app.debug"), ShouldBeTrue)
+				So(config.GetFloat64("app.ratio"), ShouldEqual, 0.5)
+				So(config.IsSet("app.name"), ShouldBeTrue)
+				So(config.IsSet("app.missing"), ShouldBeFalse)
+			})
+
+			Convey("Return zero values for absent keys", func() {
+				So(config.GetString("app.missing"), ShouldEqual, "")
+				So(config.GetInt("app.missing"), ShouldEqual, 0)
+				So(config.GetBool("app.missing"), ShouldBeFalse)
+			})
+
+			Convey("Set scalars over files", func() {
+				config.SetString("app.name", "other")
+				config.SetInt("app.port", 9090)
+				config.SetBool("app.debug", false)
+				config.SetFloat64("app.ratio", 0.25)
+				So(config.GetString("app.name"), ShouldEqual, "other")
+				So(config.GetInt("app.port"), ShouldEqual, 9090)
+				So(config.GetBool("app.debug"), ShouldBeFalse)
+				So(config.GetFloat64("app.ratio"), ShouldEqual, 0.25)
+			})
+
+			Convey("Exchange structured values as JSON", func() {
+				So(config.ReadJSON(`{"app": {"tags": ["a", "b"]}}`), ShouldBeNil)
+				doc, err := config.GetJSON("app.tags")
+				So(err, ShouldBeNil)
+				So(doc, ShouldEqual, `["a","b"]`)
+
+				So(config.SetJSON("app.limits", `{"cpu": 2}`), ShouldBeNil)
+				So(config.GetInt("app.limits.cpu"), ShouldEqual, 2)
+
+				doc, err = config.GetJSON("app.missing")
+				So(err, ShouldBeNil)
+				So(doc, ShouldEqual, "null")
+
+				doc, err = config.AllKeysJSON()
+				So(err, ShouldBeNil)
+				So(doc, ShouldContainSubstring, `"app.name"`)
+
+				doc, err = config.AllSettingsJSON()
+				So(err, ShouldBeNil)
+				So(doc, ShouldContainSubstring, `"demo"`)
+			})
+
+			Convey("Report malformed documents", func() {
+				So(config.ReadJSON(`{"app": `), ShouldNotBeNil)
+				So(config.ReadYAML("app: [unclosed\n"), ShouldNotBeNil)
+				So(config.SetJSON("app.name", `{bad`), ShouldNotBeNil)
+				So(config.GetString("app.name"), ShouldEqual, "demo")
+			})
+
+			Convey("Report files that can't be read", func() {
+				config.SetRootPath(os.TempDir())
+				So(config.ReadPath("missing-mobile.yaml"), ShouldNotBeNil)
+			})
+
+			Convey("Read bound environment variables", func() {
+				os.Setenv("APP_NAME", "from-env")
+				defer os.Unsetenv("APP_NAME")
+				So(config.BindEnv("app.name"), ShouldBeNil)
+				So(config.GetString("app.name"), ShouldEqual, "from-env")
+			})
+		})
+
+		Convey("Presets", func() {
+			config := confer.NewConfig()
+
+			Convey("Fall back to the defaults", func() {
+				srv, err := presets.LoadServer(config, "server")
+				So(err, ShouldBeNil)
+				So(srv, ShouldResemble, presets.DefaultServer())
+
+				client, err := presets.LoadClient(config, "client")
+				So(err, ShouldBeNil)
+				So(client, ShouldResemble, presets.DefaultClient())
+
+				pool, err := presets.LoadPool(config, "")
+				So(err, ShouldBeNil)
+				So(pool, ShouldResemble, presets.DefaultPool())
+			})
+
+			Convey("Register the defaults as settings", func() {
+				presets.SetServerDefaults(config, "server")
+				presets.SetClientDefaults(config, "client")
+				presets.SetPoolDefaults(config, "db.pool")
+				So(config.GetString("server.addr"), ShouldEqual, ":8080")
+				So(config.GetDuration("client.timeout"), ShouldEqual, 30*time.Second)
+				So(config.GetString("client.tls.min_version"), ShouldEqual, "1.2")
+				So(config.GetInt("db.pool.max_open"), ShouldEqual, 25)
+			})
+
+			Convey("Apply overrides", func() {
+				So(config.ReadBytes([]byte(`
+server:
+  addr: ":9443"
+  read_timeout: 2s
+  tls:
+    enabled: true
+    cert_file: /etc/app/server.pem
+    key_file: /etc/app/server.key
+    min_version: "1.3"
+client:
+  retries: 5
+  retry_backoff: 1s
+  max_retry_backoff: 3s
+db:
+  pool:
+    max_open: 10
+    max_idle: 2
+`), "yaml"), ShouldBeNil)
+
+				srv, err := presets.LoadServer(config, "server")
+				So(err, ShouldBeNil)
+				So(srv.Addr, ShouldEqual, ":9443")
+				So(srv.ReadTimeout, ShouldEqual, 2*time.Second)
+				So(srv.WriteTimeout, ShouldEqual, presets.DefaultServer().WriteTimeout)
+				So(srv.TLS, ShouldResemble, presets.TLS{Enabled: true, CertFile: "/etc/app/server.pem", KeyFile: "/etc/app/server.key", MinVersion: "1.3"})
+
+				client, err := presets.LoadClient(config, "client")
+				So(err, ShouldBeNil)
+				So(client.Retries, ShouldEqual, 5)
+				So(client.Backoff(1), ShouldEqual, time.Second)
+				So(client.Backoff(2), ShouldEqual, 2*time.Second)
+				So(client.Backoff(3), ShouldEqual, 3*time.Second)
+
+				pool, err := presets.LoadPool(config, "db.pool")
+				So(err, ShouldBeNil)
+				So(pool.MaxOpen, ShouldEqual, 10)
+				So(pool.MaxIdle, ShouldEqual, 2)
+				So(pool.ConnMaxLifetime, ShouldEqual, presets.DefaultPool().ConnMaxLifetime)
+			})
+
+			Convey("Report every validation failure", func() {
+				So(config.ReadBytes([]byte(`
+server:
+  addr: ""
+  max_header_bytes: 0
+  tls:
+    enabled: true
+    min_version: "2.0"
+client:
+  retries: -1
+  retry_backoff: 10s
+  max_retry_backoff: 1s
+pool:
+  max_open: 2
+  max_idle: 5
+`), "yaml"), ShouldBeNil)
+
+				_, err := presets.LoadServer(config, "server")
+				So(err, ShouldHaveSameTypeAs, &presets.ValidationError{})
+				So(err.(*presets.ValidationError).Problems, ShouldResemble, []string{
+					"addr must be set",
+					"max_header_bytes must be positive",
+					"tls.cert_file must be set when tls is enabled",
+					"tls.key_file must be set when tls is enabled",
+					`tls.min_version "2.0" is not one of 1.0, 1.1, 1.2, 1.3`,
+				})
+
+				_, err = presets.LoadClient(config, "client")
+				So(err, ShouldHaveSameTypeAs, &presets.ValidationError{})
+				So(err.(*presets.ValidationError).Problems, ShouldResemble, []string{
+					"retries must not be negative",
+					"max_retry_backoff must be at least retry_backoff",
+				})
+
+				_, err = presets.LoadPool(config, "pool")
+				So(err, ShouldHaveSameTypeAs, &presets.ValidationError{})
+				So(err.Error(), ShouldEqual, "Invalid settings: max_idle must not exceed max_open;")
+			})
+
+			Convey("Report values that can't be parsed", func() {
+				So(config.ReadBytes([]byte(`
+client:
+  timeout: 30 s
+  idle_conn_timeout: 90
+  retries: three
+  tls:
+    enabled: maybe
+pool:
+  conn_max_lifetime: 0
+  conn_max_idle_time: "300"
+`), "yaml"), ShouldBeNil)
+
+				client, err := presets.LoadClient(config, "client")
+				So(err, ShouldHaveSameTypeAs, &presets.ValidationError{})
+				problems := err.(*presets.ValidationError).Problems
+				So(problems, ShouldHaveLength, 4)
+				So(problems[0], ShouldContainSubstring, "client.timeout")
+				So(problems[1], ShouldContainSubstring, "client.retries")
+				So(problems[2], ShouldEqual, "client.idle_conn_timeout needs a unit, e.g. 30s")
+				So(problems[3], ShouldContainSubstring, "client.tls.enabled")
+				So(client.Timeout, ShouldEqual, presets.DefaultClient().Timeout)
+
+				_, err = presets.LoadPool(config, "pool")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "pool.conn_max_idle_time needs a unit")
+				So(err.Error(), ShouldNotContainSubstring, "conn_max_lifetime")
+			})
+
+			Convey("Build servers and clients", func() {
+				srv := presets.DefaultServer()
+				httpServer, err := srv.HTTPServer(http.NotFoundHandler())
+				So(err, ShouldBeNil)
+				So(httpServer.Addr, ShouldEqual, ":8080")
+				So(httpServer.TLSConfig, ShouldBeNil)
+
+				srv.TLS = presets.TLS{Enabled: true, CertFile: "/missing.pem", KeyFile: "/missing.key"}
+				_, err = srv.HTTPServer(http.NotFoundHandler())
+				So(err, ShouldNotBeNil)
+
+				httpClient, err := presets.DefaultClient().HTTPClient()
+				So(err, ShouldBeNil)
+				So(httpClient.Timeout, ShouldEqual, 30*time.Second)
+			})
+		})
+	})
+}
@@ -0,0 +1,125 @@
+package confer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cast"
+
+	errors "github.com/jacobstr/confer/errors"
+)
+
+// Returns the string at key, or an error if it is unset or can't be converted.
+// Conversion errors are ConversionErrors naming the layer that supplied the
+// value, e.g. env APP_PORT='eighty' is not an int.
+func (manager *Config) GetStringE(key string) (string, error) {
+	val, err := manager.getSetE(key)
+	if err != nil {
+		return "", err
+	}
+	s, err := cast.ToStringE(val)
+	return s, manager.conversionError(key, val, "a string", err)
+}
+
+// Returns the int at key, or an error if it is unset or not an int.
+func (manager *Config) GetIntE(key string) (int, error) {
+	val, err := manager.getSetE(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := cast.ToIntE(val)
+	return i, manager.conversionError(key, val, "an int", err)
+}
+
+// Returns the float at key, or an error if it is unset or not a number.
+func (manager *Config) GetFloat64E(key string) (float64, error) {
+	val, err := manager.getSetE(key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := cast.ToFloat64E(val)
+	return f, manager.conversionError(key, val, "a float", err)
+}
+
+// Returns the boolean at key, or an error if it is unset or can't be parsed by
+// the configured BoolParser.
+func (manager *Config) GetBoolE(key string) (bool, error) {
+	val, err := manager.getSetE(key)
+	if err != nil {
+		return false, err
+	}
+	b, err := manager.parseBool(val)
+	return b, manager.conversionError(key, val, "a bool", err)
+}
+
+// Returns the duration at key, or an error if it is unset or invalid.
+func (manager *Config) GetDurationE(key string) (time.Duration, error) {
+	val, err := manager.getSetE(key)
+	if err != nil {
+		return 0, err
+	}
+	d, err := cast.ToDurationE(val)
+	return d, manager.conversionError(key, val, "a duration", err)
+}
+
+// Returns the time at key, or an error if it is unset or invalid.
+func (manager *Config) GetTimeE(key string) (time.Time, error) {
+	val, err := manager.getSetE(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := cast.ToTimeE(val)
+	return t, manager.conversionError(key, val, "a time", err)
+}
+
+// Returns the list at key, or an error if it is unset or not a list.
+func (manager *Config) GetStringSliceE(key string) ([]string, error) {
+	val, err := manager.getSetE(key)
+	if err != nil {
+		return nil, err
+	}
+	s, err := cast.ToStringSliceE(val)
+	return s, manager.conversionError(key, val, "a list of strings", err)
+}
+
+// Like GetE, but unset keys are an error too.
+func (manager *Config) getSetE(key string) (interface{}, error) {
+	val, err := manager.GetE(key)
+	if err == nil && val == nil {
+		err = fmt.Errorf("%q is not set", key)
+	}
+	return val, err
+}
+
+// Wraps a failure to convert the value at key into a ConversionError
+// describing where the value came from. Returns nil if err is nil.
+func (manager *Config) conversionError(key string, val interface{}, want string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	info, _ := manager.Provenance(key)
+	return &errors.ConversionError{
+		Key:    key,
+		Layer:  info.Layer,
+		Origin: describeOrigin(key, info),
+		Value:  fmt.Sprint(val),
+		Type:   want,
+		Err:    err,
+	}
+}
+
+// Describes where a value came from for error messages, e.g. "env APP_PORT".
+func describeOrigin(key string, info SourceInfo) string {
+	switch {
+	case info.Layer == LayerFlags, info.Layer == LayerFlagDefaults:
+		return "flag --" + info.Name
+	case info.Layer == LayerEnv:
+		return "env " + info.Name
+	case info.Path != "":
+		return info.Path + ": " + key
+	case info.Layer != "":
+		return info.Layer + " " + key
+	}
+	return key
+}
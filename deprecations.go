@@ -0,0 +1,140 @@
+package confer
+
+import (
+	"strings"
+	"time"
+
+	jww "github.com/spf13/jwalterweatherman"
+
+	errors "github.com/jacobstr/confer/errors"
+)
+
+// Overridden in tests.
+var timeNow = time.Now
+
+// Describes a key that is being retired.
+type Deprecation struct {
+	// The deprecated key.
+	Key string
+
+	// An optional key that supersedes Key. While Key is still supported,
+	// reading Replacement falls back to Key's value unless Replacement is set
+	// itself.
+	Replacement string
+
+	// Additional guidance included in warnings.
+	Message string
+
+	// After this time use of Key is an error, unless enforcement has been
+	// disabled with SetDeprecationEnforcement. The zero value never expires.
+	EndOfSupport time.Time
+}
+
+// Registers a deprecated key. Deprecations are checked whenever files are
+// loaded by ReadPaths or Reload, and on demand with CheckDeprecations.
+func (manager *Config) Deprecate(d Deprecation) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.deprecations = append(manager.deprecations, d)
+}
+
+// Controls whether using a deprecated key after its end of support is an
+// error (the default) or merely logged.
+func (manager *Config) SetDeprecationEnforcement(enforce bool) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.deprecationsEnforced = enforce
+}
+
+// Checks every registered deprecation against the current configuration,
+// returning an error if any deprecated key is in use past its end of support.
+func (manager *Config) CheckDeprecations() error {
+	errs := manager.checkDeprecations()
+	if len(errs) > 0 {
+		return &errors.LoadError{Msg: "Deprecated keys in use:", Errors: errs}
+	}
+	return nil
+}
+
+func (manager *Config) checkDeprecations() []error {
+	errs := []error{}
+	now := timeNow()
+
+	for _, d := range manager.deprecations {
+		if !manager.IsSet(d.Key) {
+			continue
+		}
+
+		expired := !d.EndOfSupport.IsZero() && now.After(d.EndOfSupport)
+		if expired && manager.deprecationsEnforced {
+			errs = append(errs, &errors.DeprecatedKeyError{
+				Key:          d.Key,
+				Replacement:  d.Replacement,
+				EndOfSupport: d.EndOfSupport,
+			})
+			continue
+		}
+
+		jww.WARN.Println(d.Key, "is deprecated.", deprecationAdvice(d))
+	}
+
+	return errs
+}
+
+// Reports whether reads of d.Replacement fall back to d.Key.
+func (manager *Config) aliased(d Deprecation) bool {
+	if d.Replacement == "" {
+		return false
+	}
+	expired := !d.EndOfSupport.IsZero() && timeNow().After(d.EndOfSupport)
+	return !expired || !manager.deprecationsEnforced
+}
+
+// Returns the deprecated key that key, a replacement or a key beneath one,
+// falls back to. Requires the read lock.
+func (manager *Config) aliasOf(key string) (string, bool) {
+	lowered := strings.ToLower(key)
+	for _, d := range manager.deprecations {
+		if !manager.aliased(d) {
+			continue
+		}
+		replacement := strings.ToLower(d.Replacement)
+		if lowered == replacement {
+			return d.Key, true
+		}
+		if strings.HasPrefix(lowered, replacement+".") {
+			return d.Key + strings.TrimPrefix(lowered, replacement), true
+		}
+	}
+	return "", false
+}
+
+// Returns the replacements aliasing any of keys, and the keys beneath them,
+// so they're listed alongside the deprecated keys. Requires the read lock.
+func (manager *Config) aliasKeys(keys []string) []string {
+	aliases := []string{}
+	for _, d := range manager.deprecations {
+		if !manager.aliased(d) {
+			continue
+		}
+		deprecated := strings.ToLower(d.Key)
+		for _, key := range keys {
+			lowered := strings.ToLower(key)
+			if lowered == deprecated || strings.HasPrefix(lowered, deprecated+".") {
+				aliases = append(aliases, d.Replacement+strings.TrimPrefix(lowered, deprecated))
+			}
+		}
+	}
+	return aliases
+}
+
+func deprecationAdvice(d Deprecation) string {
+	advice := d.Message
+	if d.Replacement != "" {
+		advice += " Use " + d.Replacement + " instead."
+	}
+	if !d.EndOfSupport.IsZero() {
+		advice += " Support ends " + d.EndOfSupport.Format("2006-01-02") + "."
+	}
+	return advice
+}
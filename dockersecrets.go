@@ -0,0 +1,93 @@
+package confer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jww "github.com/spf13/jwalterweatherman"
+
+	"github.com/jacobstr/confer/source"
+)
+
+// Where Docker swarm and compose mount secrets.
+const DockerSecretsDir = "/run/secrets"
+
+// Reads the secrets Docker mounts under /run/secrets, if any. See
+// ReadSecretsDir.
+func (manager *Config) ReadDockerSecrets() error {
+	if _, err := os.Stat(DockerSecretsDir); os.IsNotExist(err) {
+		jww.INFO.Println("No Docker secrets mounted at", DockerSecretsDir)
+		return nil
+	}
+	return manager.ReadSecretsDir(DockerSecretsDir)
+}
+
+// Maps each file in dir to a key, with underscores in its name marking
+// nesting, and sets it to the file's contents less trailing newlines:
+//
+//	/run/secrets/db_password -> db.password
+//
+// A file named after a key that is already known, such as one declared with
+// Define, sets that key as is, so /run/secrets/api_token can set api_token.
+// The keys are marked secret and held in the secrets layer alongside values
+// bound with BindSecret. Hidden files and directories are skipped.
+func (manager *Config) ReadSecretsDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{}
+	for _, key := range manager.AllKeys() {
+		known[key] = true
+	}
+	for key := range manager.schema {
+		known[key] = true
+	}
+
+	layer, err := manager.secretLayer()
+	if err != nil {
+		return err
+	}
+
+	values := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		key := strings.ToLower(entry.Name())
+		if !known[key] {
+			key = strings.Replace(key, "_", ".", -1)
+		}
+
+		values[key] = strings.TrimRight(string(data), "\r\n")
+	}
+
+	manager.write(func() {
+		for key, val := range values {
+			manager.secrets = append(manager.secrets, key)
+			layer.Set(key, val)
+		}
+	})
+	return nil
+}
+
+// Returns the layer holding secrets, adding it on first use.
+func (manager *Config) secretLayer() (*source.ConfigSource, error) {
+	if manager.secretValues == nil {
+		manager.secretValues = source.NewConfigSource()
+		if err := manager.AddSource(LayerSecrets, PrioritySecrets, manager.secretValues); err != nil {
+			manager.secretValues = nil
+			return nil, err
+		}
+	}
+	return manager.secretValues, nil
+}
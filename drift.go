@@ -0,0 +1,129 @@
+package confer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// Compares the effective configuration against a baseline file, e.g. one
+// committed to version control, returning every leaf that differs. Old holds
+// the baseline value and New the runtime value. Keys supplied only by flags
+// or environment variables are reported as additions.
+func (manager *Config) CompareToFile(baseline string) ([]Change, error) {
+	if !filepath.IsAbs(baseline) {
+		baseline = path.Join(manager.rootPath, baseline)
+	}
+
+	loaded, err := manager.readFile(baseline)
+	if err != nil {
+		return nil, err
+	}
+
+	data := cast.ToStringMap(loaded)
+	maps.ToStringMapRecursive(data)
+
+	expected := map[string]interface{}{}
+	for key, val := range maps.Flatten(data) {
+		expected[strings.ToLower(key)] = manager.coerce(val)
+	}
+
+	return diffSettings(expected, manager.AllSettings()), nil
+}
+
+// Returns a SHA-256 checksum of the effective configuration. The checksum is
+// stable across processes given the same settings, so it can be recorded at
+// deploy time and verified later with CompareToChecksum.
+func (manager *Config) Checksum() string {
+	hash := sha256.New()
+	writeCanonical(hash, maps.Normalize(manager.AllSettings()))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Writes val to w as JSON with map keys sorted, so the encoding depends
+// neither on map ordering nor on the process. Values JSON can't represent,
+// such as functions, are written as their type.
+func writeCanonical(w io.Writer, val interface{}) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		io.WriteString(w, "{")
+		for i, key := range keys {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			writeCanonical(w, key)
+			io.WriteString(w, ":")
+			writeCanonical(w, v[key])
+		}
+		io.WriteString(w, "}")
+	case []interface{}:
+		io.WriteString(w, "[")
+		for i, child := range v {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			writeCanonical(w, child)
+		}
+		io.WriteString(w, "]")
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			fmt.Fprintf(w, "%q", fmt.Sprintf("%T", v))
+			return
+		}
+		w.Write(encoded)
+	}
+}
+
+// Reports whether the effective configuration matches a checksum previously
+// produced by Checksum.
+func (manager *Config) CompareToChecksum(sum string) bool {
+	return manager.Checksum() == strings.ToLower(sum)
+}
+
+// Periodically compares the effective configuration against a baseline file,
+// invoking fn whenever drift is detected. Call the returned function to stop
+// watching.
+func (manager *Config) WatchDrift(baseline string, interval time.Duration, fn func([]Change)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				changes, err := manager.CompareToFile(baseline)
+				if err != nil {
+					jww.ERROR.Println("Unable to check for configuration drift:", err)
+				} else if len(changes) > 0 {
+					fn(changes)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,182 @@
+package confer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	errors "github.com/jacobstr/confer/errors"
+)
+
+// Decrypts values stored encrypted inline, so secret and non-secret keys can
+// share a file. See AddValueDecrypter.
+type ValueDecrypter interface {
+	// Reports whether val is ciphertext this decrypter handles.
+	Encrypted(val string) bool
+	// Returns the plaintext of val.
+	Decrypt(val string) (string, error)
+}
+
+// Makes Get return the plaintext of values encrypted for d, in any format
+// and from any layer:
+//
+//	# application.yaml
+//	app:
+//	  database:
+//	    host: db.internal
+//	    password: ENC[AES256_GCM,data:3q2+7w==,iv:...,tag:...,type:str]
+//
+//	config.AddValueDecrypter(confer.AESKey(key))
+//	config.GetString("app.database.password") // the plaintext
+//
+// Encrypted values are secrets, so they're redacted from exports. Values
+// encrypted with age are decrypted by a keyring from the remote/age package,
+// and other ciphertexts are supported by implementing ValueDecrypter. When
+// several decrypters handle a value each is tried in turn. A value none of
+// them can decrypt is never returned as ciphertext: Get logs the failure and
+// returns nil, and GetE and the typed E accessors return a DecryptionError.
+func (manager *Config) AddValueDecrypter(d ValueDecrypter) {
+	manager.valueDecrypters = append(manager.valueDecrypters, d)
+	manager.attributesChanged()
+}
+
+// Reports whether a stored value is ciphertext a registered decrypter
+// handles.
+func (manager *Config) encryptedValue(val interface{}) bool {
+	s, ok := val.(string)
+	if !ok {
+		return false
+	}
+	for _, d := range manager.valueDecrypters {
+		if d.Encrypted(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces encrypted strings within val with their plaintext. Values that
+// can't be decrypted are replaced with nil, and the first failure is
+// returned as a DecryptionError.
+func (manager *Config) decryptValues(key string, val interface{}) (interface{}, error) {
+	if len(manager.valueDecrypters) == 0 {
+		return val, nil
+	}
+
+	var first error
+	keep := func(val interface{}, err error) interface{} {
+		if first == nil {
+			first = err
+		}
+		return val
+	}
+
+	switch v := val.(type) {
+	case string:
+		var err error
+		for _, d := range manager.valueDecrypters {
+			if !d.Encrypted(v) {
+				continue
+			}
+			var plain string
+			if plain, err = d.Decrypt(v); err == nil {
+				return plain, nil
+			}
+		}
+		if err != nil {
+			return nil, &errors.DecryptionError{Key: key, Err: err}
+		}
+	case map[string]interface{}:
+		decrypted := make(map[string]interface{}, len(v))
+		for child, cv := range v {
+			decrypted[child] = keep(manager.decryptValues(key+"."+child, cv))
+		}
+		return decrypted, first
+	case map[interface{}]interface{}:
+		decrypted := make(map[interface{}]interface{}, len(v))
+		for child, cv := range v {
+			decrypted[child] = keep(manager.decryptValues(fmt.Sprint(key, ".", child), cv))
+		}
+		return decrypted, first
+	case []interface{}:
+		decrypted := make([]interface{}, len(v))
+		for i, item := range v {
+			decrypted[i] = keep(manager.decryptValues(key, item))
+		}
+		return decrypted, first
+	}
+	return val, nil
+}
+
+const aesMarkerPrefix = "ENC[AES256_GCM,"
+
+// A 256 bit key decrypting ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]
+// markers, as written by EncryptValue. Fields are base64 encoded.
+type AESKey []byte
+
+func (k AESKey) Encrypted(val string) bool {
+	return strings.HasPrefix(val, aesMarkerPrefix) && strings.HasSuffix(val, "]")
+}
+
+func (k AESKey) Decrypt(val string) (string, error) {
+	fields := map[string]string{}
+	for _, field := range strings.Split(val[len(aesMarkerPrefix):len(val)-1], ",") {
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("Malformed field %q", field)
+		}
+		fields[parts[0]] = parts[1]
+	}
+
+	decoded := map[string][]byte{}
+	for _, name := range []string{"data", "iv", "tag"} {
+		b, err := base64.StdEncoding.DecodeString(fields[name])
+		if err != nil || fields[name] == "" {
+			return "", fmt.Errorf("Missing or malformed %s", name)
+		}
+		decoded[name] = b
+	}
+
+	gcm, err := k.gcm(len(decoded["iv"]))
+	if err != nil {
+		return "", err
+	}
+	plain, err := gcm.Open(nil, decoded["iv"], append(decoded["data"], decoded["tag"]...), nil)
+	if err != nil {
+		return "", fmt.Errorf("Unable to decrypt: %v", err)
+	}
+	return string(plain), nil
+}
+
+// Encrypts plaintext as an ENC[AES256_GCM,...] marker, for tools writing
+// configuration files.
+func (k AESKey) EncryptValue(plaintext string) (string, error) {
+	iv := make([]byte, 32)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	gcm, err := k.gcm(len(iv))
+	if err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, []byte(plaintext), nil)
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("%sdata:%s,iv:%s,tag:%s,type:str]", aesMarkerPrefix, enc(data), enc(iv), enc(tag)), nil
+}
+
+func (k AESKey) gcm(nonceSize int) (cipher.AEAD, error) {
+	if len(k) != 32 {
+		return nil, fmt.Errorf("AES256 keys are 32 bytes, not %d", len(k))
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, nonceSize)
+}
@@ -0,0 +1,104 @@
+package confer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Documents an environment variable the configuration responds to.
+type EnvVarDoc struct {
+	// The variable name, e.g. APP_DATABASE_HOST.
+	Name string
+	// The configuration key it is bound to.
+	Key string
+	// The declared type from the schema, or one inferred from the default.
+	Type string
+	// The value used when the variable is unset. Secrets are redacted.
+	Default string
+	// The description from the schema, if any.
+	Description string
+}
+
+// Lists every environment variable bound with BindEnv or AutomaticEnv, sorted
+// by name. Answers "what environment variables does this service read?".
+func (manager *Config) DocumentEnv() []EnvVarDoc {
+	docs := []EnvVarDoc{}
+
+	manager.mu.RLock()
+	for _, key := range manager.env.AllKeys() {
+		name, _ := manager.env.Variable(key)
+		fallback, exists := manager.attributes.Get(key)
+		if !exists {
+			fallback, _ = manager.defaults.Get(key)
+		}
+
+		doc := EnvVarDoc{
+			Name: name,
+			Key:  key,
+			Type: inferType(fallback),
+		}
+
+		if fallback != nil && manager.isSecret(key) {
+			doc.Default = Redacted
+		} else if fallback != nil {
+			doc.Default = fmt.Sprint(fallback)
+		}
+
+		if spec, exists := manager.Spec(key); exists {
+			if spec.Type != TypeAny {
+				doc.Type = string(spec.Type)
+			}
+			doc.Description = spec.Description
+		}
+
+		docs = append(docs, doc)
+	}
+	manager.mu.RUnlock()
+
+	sort.Sort(envDocsByName(docs))
+	return docs
+}
+
+// Writes DocumentEnv as an aligned, human readable table.
+func (manager *Config) WriteEnvTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tKEY\tTYPE\tDEFAULT\tDESCRIPTION")
+	for _, doc := range manager.DocumentEnv() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", doc.Name, doc.Key, doc.Type, doc.Default, doc.Description)
+	}
+	return tw.Flush()
+}
+
+// Names the type of a value in schema terms.
+func inferType(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return ""
+	case bool:
+		return string(TypeBool)
+	case int, int8, int16, int32, int64:
+		return string(TypeInt)
+	case float32, float64:
+		return string(TypeFloat)
+	case string:
+		return string(TypeString)
+	case time.Duration:
+		return string(TypeDuration)
+	case time.Time:
+		return string(TypeTime)
+	case []string, []interface{}:
+		return string(TypeStringSlice)
+	case map[string]interface{}, map[interface{}]interface{}:
+		return string(TypeMap)
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+type envDocsByName []EnvVarDoc
+
+func (d envDocsByName) Len() int           { return len(d) }
+func (d envDocsByName) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d envDocsByName) Less(i, j int) bool { return d[i].Name < d[j].Name }
@@ -0,0 +1,75 @@
+package confer
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Splits list values read from the environment on sep, so
+// APP_SERVER_STATIC_ASSETS=css,js,img reads as a list and GetStringSlice and
+// Unmarshal see three items:
+//
+//	config.SetEnvListSeparator(",", "server.static_assets")
+//	config.SetEnvListSeparator(":", "plugins.path")
+//
+// Separators given for keys apply to those keys only. Without keys, sep
+// applies to every key that holds a list elsewhere, e.g. in defaults or
+// files, or is declared as TypeStringSlice, leaving scalars containing sep
+// alone. Items are trimmed of surrounding whitespace. A space splits on any
+// run of whitespace, as GetStringSlice does by default.
+func (manager *Config) SetEnvListSeparator(sep string, keys ...string) {
+	manager.write(func() {
+		if len(keys) == 0 {
+			manager.envListSeparator = sep
+		}
+		for _, key := range keys {
+			if manager.envListSeparators == nil {
+				manager.envListSeparators = map[string]string{}
+			}
+			manager.envListSeparators[strings.ToLower(key)] = sep
+		}
+	})
+}
+
+// Splits a value read from the environment for key, if a separator applies.
+func (manager *Config) splitEnvList(key string, val interface{}) interface{} {
+	s, ok := val.(string)
+	if !ok {
+		return val
+	}
+
+	sep, exists := manager.envListSeparators[strings.ToLower(key)]
+	if !exists {
+		if manager.envListSeparator == "" || !manager.holdsList(key) {
+			return val
+		}
+		sep = manager.envListSeparator
+	}
+
+	var fields []string
+	if strings.TrimSpace(sep) == "" {
+		fields = strings.Fields(s)
+	} else if strings.TrimSpace(s) != "" {
+		fields = strings.Split(s, sep)
+	}
+
+	items := make([]interface{}, len(fields))
+	for i, field := range fields {
+		items[i] = strings.TrimSpace(field)
+	}
+	return items
+}
+
+// Reports whether key is declared as a list or holds one in a stored layer.
+func (manager *Config) holdsList(key string) bool {
+	if spec, exists := manager.Spec(key); exists && spec.Type == TypeStringSlice {
+		return true
+	}
+	for _, store := range manager.stores(manager.precedence) {
+		if val, exists := store.Get(key); exists && val != nil {
+			kind := reflect.TypeOf(val).Kind()
+			return kind == reflect.Slice || kind == reflect.Array
+		}
+	}
+	return false
+}
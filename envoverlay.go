@@ -0,0 +1,162 @@
+package confer
+
+import (
+	"sort"
+	"strings"
+
+	jww "github.com/spf13/jwalterweatherman"
+
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/source"
+)
+
+// The outcome of OverlayEnv.
+type EnvOverlay struct {
+	// Environment variables that were bound, by variable name.
+	Bound map[string]string
+	// Variables with the prefix that don't correspond to any existing key,
+	// sorted by name.
+	Ignored []string
+	// Variables that correspond to more than one existing key and were left
+	// unbound, sorted by name.
+	Ambiguous []EnvAmbiguity
+}
+
+// An environment variable name that could refer to several keys, e.g.
+// APP_DATABASE_HOST for both app.database.host and app.database_host.
+type EnvAmbiguity struct {
+	Variable string
+	// The candidate keys, sorted.
+	Keys []string
+}
+
+// Binds every environment variable starting with prefix that corresponds to a
+// key already present in files or defaults. With a prefix of "APP_",
+// APP_DATABASE_HOST overrides database.host. Unlike AutomaticEnv, the
+// environment is scanned, and variables that don't correspond to a known key,
+// such as APP_NAP_TIME, are ignored rather than creating bogus keys. They're
+// logged and returned so typos can be spotted:
+//
+//	overlay := config.OverlayEnv("APP_")
+//	for _, name := range overlay.Ignored {
+//		log.Printf("ignoring unknown setting %s", name)
+//	}
+//
+// Variables beneath a key declared as TypeMap populate that map, since its
+// entries can't be known in advance: APP_LABELS_TEAM=core and
+// APP_LABELS_TIER=backend make labels {team: core, tier: backend}, merged
+// over any entries from files and defaults.
+//
+// Since underscores are common within keys, a name such as APP_DATABASE_HOST
+// may match both database.host and database_host. Such variables are not bound
+// and are reported in Ambiguous instead; a double underscore marks nesting
+// explicitly, so APP_DATABASE__HOST always means database.host.
+func (manager *Config) OverlayEnv(prefix string) *EnvOverlay {
+	known := map[string][]string{}
+	nested := map[string]string{}
+	for key := range maps.Flatten(manager.storedSettings()) {
+		lowered := strings.ToLower(key)
+		name := prefix + source.Envamize(lowered)
+		known[name] = append(known[name], lowered)
+		nested[prefix+source.EnvamizeNested(lowered)] = lowered
+	}
+
+	overlay := &EnvOverlay{
+		Bound:     map[string]string{},
+		Ignored:   []string{},
+		Ambiguous: []EnvAmbiguity{},
+	}
+
+	for _, entry := range manager.env.Environ() {
+		name := strings.SplitN(entry, "=", 2)[0]
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		if key, exists := nested[name]; exists {
+			manager.bindEnvTo(key, name)
+			overlay.Bound[name] = key
+		} else if keys := known[name]; len(keys) == 1 {
+			manager.bindEnvTo(keys[0], name)
+			overlay.Bound[name] = keys[0]
+		} else if len(keys) > 1 {
+			sort.Strings(keys)
+			jww.WARN.Println("Ignoring ambiguous environment variable", name, "matching", keys)
+			overlay.Ambiguous = append(overlay.Ambiguous, EnvAmbiguity{Variable: name, Keys: keys})
+		} else if key, exists := manager.envMapEntry(prefix, name); exists {
+			manager.bindEnvTo(key, name)
+			overlay.Bound[name] = key
+		} else {
+			jww.WARN.Println("Ignoring environment variable without a matching key:", name)
+			overlay.Ignored = append(overlay.Ignored, name)
+		}
+	}
+
+	sort.Strings(overlay.Ignored)
+	sort.Sort(envAmbiguitiesByVariable(overlay.Ambiguous))
+	return overlay
+}
+
+// Returns the key a variable sets within a map declared as TypeMap, e.g.
+// app.labels.team for APP_LABELS_TEAM when app.labels is a map. The rest of
+// the name, lower cased, names the entry.
+func (manager *Config) envMapEntry(prefix string, name string) (string, bool) {
+	for lowered, spec := range manager.schema {
+		if spec.Type != TypeMap {
+			continue
+		}
+		for _, mapPrefix := range []string{prefix + source.EnvamizeNested(lowered) + "__", prefix + source.Envamize(lowered) + "_"} {
+			if entry := strings.TrimPrefix(name, mapPrefix); entry != name && entry != "" {
+				return lowered + "." + strings.ToLower(entry), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Assembles the map at key, declared as TypeMap, from the variables bound to
+// its entries in env.
+func (manager *Config) envMap(env *source.EnvSource, key string) (map[string]interface{}, bool) {
+	lowered := strings.ToLower(key)
+	if spec, exists := manager.schema[lowered]; !exists || spec.Type != TypeMap {
+		return nil, false
+	}
+
+	m := map[string]interface{}{}
+	for _, bound := range env.AllKeys() {
+		entry := strings.TrimPrefix(bound, lowered+".")
+		if entry == bound {
+			continue
+		}
+		if val, exists := env.Get(bound); exists {
+			m[entry] = val
+		}
+	}
+	return m, len(m) > 0
+}
+
+// Lists environment variables bound to more than one key, whether with
+// BindEnv or AutomaticEnv. Only one of the keys can be meant; set the variable
+// using the double underscore form, e.g. DATABASE__HOST rather than
+// DATABASE_HOST for database.host, to address a key unambiguously.
+func (manager *Config) EnvAmbiguities() []EnvAmbiguity {
+	ambiguities := []EnvAmbiguity{}
+	for name, keys := range manager.env.Ambiguities() {
+		ambiguities = append(ambiguities, EnvAmbiguity{Variable: name, Keys: keys})
+	}
+	sort.Sort(envAmbiguitiesByVariable(ambiguities))
+	return ambiguities
+}
+
+type envAmbiguitiesByVariable []EnvAmbiguity
+
+func (a envAmbiguitiesByVariable) Len() int           { return len(a) }
+func (a envAmbiguitiesByVariable) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a envAmbiguitiesByVariable) Less(i, j int) bool { return a[i].Variable < a[j].Variable }
+
+// Binds key to the named variable under the lock.
+func (manager *Config) bindEnvTo(key string, name string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.env.BindTo(key, name)
+}
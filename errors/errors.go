@@ -3,6 +3,7 @@ package err
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 type UnsupportedConfigError string
@@ -26,3 +27,158 @@ func (m *LoadError) Error() string {
 	}
 	return m.Msg + " " + strings.Join(merged, ", ")
 }
+
+type DeprecatedKeyError struct {
+	Key          string
+	Replacement  string
+	EndOfSupport time.Time
+}
+
+// Returned when a deprecated key is used after its end of support date.
+func (e *DeprecatedKeyError) Error() string {
+	msg := fmt.Sprintf(
+		"%q reached end of support on %s",
+		e.Key, e.EndOfSupport.Format("2006-01-02"),
+	)
+	if e.Replacement != "" {
+		msg += fmt.Sprintf(", use %q instead", e.Replacement)
+	}
+	return msg
+}
+
+type ParseError struct {
+	Format string
+	Err    error
+}
+
+// Returned when a configuration document can't be parsed.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Error parsing %s config: %s", e.Format, e.Err)
+}
+
+type InvalidValueError struct {
+	Key    string
+	Reason string
+}
+
+// Returned when a value doesn't satisfy the schema declared for its key.
+func (e *InvalidValueError) Error() string {
+	return fmt.Sprintf("%q is invalid: %s", e.Key, e.Reason)
+}
+
+type WeightError struct {
+	Key   string
+	Sum   float64
+	Total float64
+}
+
+// Returned when the weights within a map don't add up to the expected total.
+func (e *WeightError) Error() string {
+	return fmt.Sprintf("weights in %q sum to %g, expected %g", e.Key, e.Sum, e.Total)
+}
+
+type PolicyError struct {
+	Policy string
+	// Why the policy couldn't be evaluated. Empty when it simply evaluated
+	// to false.
+	Reason string
+}
+
+// Returned when the configuration violates a policy.
+func (e *PolicyError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("policy %q could not be evaluated: %s", e.Policy, e.Reason)
+	}
+	return fmt.Sprintf("policy %q violated", e.Policy)
+}
+
+type UnknownKeysError struct {
+	Keys []string
+}
+
+// Returned by strict decoding when the configuration has keys the target
+// doesn't, usually because of a typo.
+func (e *UnknownKeysError) Error() string {
+	return fmt.Sprintf("Unknown configuration keys: %s", strings.Join(e.Keys, ", "))
+}
+
+type UnsetFieldsError struct {
+	Fields []string
+}
+
+// Returned by strict decoding when the target has fields the configuration
+// doesn't set.
+func (e *UnsetFieldsError) Error() string {
+	return fmt.Sprintf("Fields not set by the configuration: %s", strings.Join(e.Fields, ", "))
+}
+
+type WrongShapeError struct {
+	Key      string
+	Ancestor string
+	Value    interface{}
+}
+
+// Returned when a key can't be read because one of its ancestors isn't a map,
+// typically because an overlay replaced a section with a scalar.
+func (e *WrongShapeError) Error() string {
+	return fmt.Sprintf("%q can't be read, %q is %T %v rather than a map", e.Key, e.Ancestor, e.Value, e.Value)
+}
+
+type ConversionError struct {
+	Key string
+	// The layer that supplied the value.
+	Layer string
+	// Where the value came from, e.g. "env APP_PORT" or "flag --port".
+	Origin string
+	// The raw value, as a string.
+	Value string
+	// The attempted conversion, e.g. "an int".
+	Type string
+	Err  error
+}
+
+// Returned by typed accessors when a value can't be converted, e.g.
+// env APP_PORT='eighty' is not an int.
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("%s='%s' is not %s", e.Origin, e.Value, e.Type)
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+type NotLoadedError struct {
+	Key string
+}
+
+// Returned in strict lifecycle mode when a key is read before configuration
+// has been loaded, typically by a package reading it at import time.
+func (e *NotLoadedError) Error() string {
+	return fmt.Sprintf("%q was read before configuration was loaded; call ReadPaths or Finalize first", e.Key)
+}
+
+type DecryptionError struct {
+	Key string
+	Err error
+}
+
+// Returned when a value stored encrypted can't be decrypted by any
+// registered ValueDecrypter, e.g. because it was encrypted for another key.
+func (e *DecryptionError) Error() string {
+	return fmt.Sprintf("%q can't be decrypted: %v", e.Key, e.Err)
+}
+
+func (e *DecryptionError) Unwrap() error {
+	return e.Err
+}
+
+type QuotaError struct {
+	Source string
+	Key    string
+	Msg    string
+}
+
+// Returned when a value from a remote source exceeds a RemoteQuota.
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%q from %s %s", e.Key, e.Source, e.Msg)
+}
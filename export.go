@@ -0,0 +1,100 @@
+package confer
+
+import (
+	"github.com/jacobstr/confer/maps"
+)
+
+// Classifies keys for filtering exports.
+type KeyTag string
+
+const (
+	// Keys holding sensitive values, see IsSecret.
+	TagSecret KeyTag = "secret"
+	// Keys that can't change at runtime: those pinned or requiring a restart.
+	TagStatic KeyTag = "static"
+	// Keys that may change at runtime, i.e. every key that isn't static.
+	TagRuntime KeyTag = "runtime"
+)
+
+// Selects the settings Export returns.
+type ExportOptions struct {
+	// Key patterns to include, matching as in Pin. Everything when empty.
+	Include []string
+	// Key patterns to leave out, taking precedence over Include.
+	Exclude []string
+	// Only include keys with at least one of these tags. Any tag when empty.
+	Tags []KeyTag
+	// Leave out keys with any of these tags.
+	ExcludeTags []KeyTag
+	// Substitute Redacted for the values of secrets rather than exposing
+	// them.
+	Redact bool
+}
+
+// Returns the effective settings selected by opts as a nested map, so
+// different consumers get appropriate views of the configuration:
+//
+//	// For logs: everything but secrets.
+//	config.Export(confer.ExportOptions{ExcludeTags: []confer.KeyTag{confer.TagSecret}})
+//
+//	// For an admin UI: settings that can be changed live, secrets masked.
+//	config.Export(confer.ExportOptions{Tags: []confer.KeyTag{confer.TagRuntime}, Redact: true})
+//
+//	// For a child process: the database section.
+//	config.Export(confer.ExportOptions{Include: []string{"app.database"}})
+func (manager *Config) Export(opts ExportOptions) map[string]interface{} {
+	selected := map[string]interface{}{}
+
+	for key, val := range manager.AllSettings() {
+		if val == nil {
+			continue
+		}
+		if len(opts.Include) > 0 && !anyKeyMatches(opts.Include, key) {
+			continue
+		}
+		if anyKeyMatches(opts.Exclude, key) {
+			continue
+		}
+
+		tags := manager.Tags(key)
+		if len(opts.Tags) > 0 && !anyTag(tags, opts.Tags) {
+			continue
+		}
+		if anyTag(tags, opts.ExcludeTags) {
+			continue
+		}
+
+		if opts.Redact {
+			val = manager.redact(key, val)
+		}
+		selected[key] = maps.DeepCopy(val)
+	}
+
+	return maps.Expand(selected)
+}
+
+// Returns the tags of key, e.g. [secret static].
+func (manager *Config) Tags(key string) []KeyTag {
+	tags := []KeyTag{}
+	if manager.IsSecret(key) {
+		tags = append(tags, TagSecret)
+	}
+	if anyKeyMatches(manager.pinned, key) || anyKeyMatches(manager.restartRequired, key) {
+		tags = append(tags, TagStatic)
+	} else {
+		tags = append(tags, TagRuntime)
+	}
+	return tags
+}
+
+// Reports whether any of tags is among wanted.
+func anyTag(tags []KeyTag, wanted []KeyTag) bool {
+	for _, tag := range tags {
+		for _, w := range wanted {
+			if tag == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package confer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Prefix marking string values as expressions, e.g:
+//
+//	workers: "expr: server.cpus * 2"
+const exprPrefix = "expr:"
+
+// Bounds the work a single expression may do.
+type ExpressionLimits struct {
+	// The maximum evaluation cost as tracked by CEL, roughly one unit per
+	// operation and per element visited. Zero means unlimited.
+	Cost uint64
+	// The maximum wall clock time for one evaluation. Zero means unlimited.
+	Timeout time.Duration
+}
+
+// Limits applied unless replaced with SetExpressionLimits.
+var DefaultExpressionLimits = ExpressionLimits{Cost: 10000, Timeout: 100 * time.Millisecond}
+
+// Replaces the resource limits used when evaluating expressions.
+func (manager *Config) SetExpressionLimits(limits ExpressionLimits) {
+	manager.exprLimits = limits
+}
+
+// Reports whether the value at key is tagged as an expression.
+func (manager *Config) IsExpression(key string) bool {
+	s, ok := manager.Get(key).(string)
+	return ok && strings.HasPrefix(s, exprPrefix)
+}
+
+// Evaluates the expression at key. Expressions are written in CEL
+// (https://github.com/google/cel-go), which has no side effects, can't touch
+// the file system or network and always terminates:
+//
+//	server:
+//	  cpus: 4
+//	  workers: "expr: server.cpus * 2"
+//	  log_level: "expr: env == 'production' ? 'warn' : 'debug'"
+//
+// Top-level keys are available as variables, and the whole configuration as
+// `config` for keys that aren't valid identifiers, e.g. config["my-key"].
+// Expressions referring to other expressions see their unevaluated strings.
+func (manager *Config) EvalKey(key string) (interface{}, error) {
+	s, ok := manager.Get(key).(string)
+	if !ok || !strings.HasPrefix(s, exprPrefix) {
+		return nil, fmt.Errorf("%q is not an expression", key)
+	}
+
+	val, err := manager.Eval(s[len(exprPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("Unable to evaluate %q: %v", key, err)
+	}
+	return val, nil
+}
+
+// Evaluates a CEL expression against the configuration. See EvalKey.
+func (manager *Config) Eval(expression string) (interface{}, error) {
+	prg, vars, err := manager.compileExpr(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := manager.evalProgram(prg, vars)
+	if err != nil {
+		return nil, err
+	}
+	return celNative(out)
+}
+
+// Matches names CEL accepts as variables.
+var celIdent = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+
+var celReserved = map[string]bool{
+	"as": true, "break": true, "const": true, "continue": true, "else": true,
+	"false": true, "for": true, "function": true, "if": true, "import": true,
+	"in": true, "let": true, "loop": true, "package": true, "namespace": true,
+	"null": true, "return": true, "true": true, "var": true, "void": true,
+	"while": true,
+}
+
+// Compiles expression in an environment exposing the current configuration,
+// returning the program and its variables.
+func (manager *Config) compileExpr(expression string) (cel.Program, map[string]interface{}, error) {
+	settings := manager.effectiveSettings()
+	vars := map[string]interface{}{}
+	opts := []cel.EnvOption{cel.Variable("config", cel.MapType(cel.StringType, cel.DynType))}
+
+	for name, val := range settings {
+		if name == "config" || !celIdent.MatchString(name) || celReserved[name] {
+			continue
+		}
+		vars[name] = val
+		opts = append(opts, cel.Variable(name, cel.DynType))
+	}
+	vars["config"] = settings
+
+	env, err := cel.NewEnv(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ast, issues := env.Compile(strings.TrimSpace(expression))
+	if issues.Err() != nil {
+		return nil, nil, issues.Err()
+	}
+
+	progOpts := []cel.ProgramOption{cel.InterruptCheckFrequency(100)}
+	if manager.exprLimits.Cost > 0 {
+		progOpts = append(progOpts, cel.CostLimit(manager.exprLimits.Cost))
+	}
+
+	prg, err := env.Program(ast, progOpts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return prg, vars, nil
+}
+
+// Runs prg within the configured time limit.
+func (manager *Config) evalProgram(prg cel.Program, vars map[string]interface{}) (ref.Val, error) {
+	ctx := context.Background()
+	if manager.exprLimits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, manager.exprLimits.Timeout)
+		defer cancel()
+	}
+
+	out, _, err := prg.ContextEval(ctx, vars)
+	return out, err
+}
+
+var (
+	nativeList = reflect.TypeOf([]interface{}{})
+	nativeMap  = reflect.TypeOf(map[string]interface{}{})
+)
+
+// Converts a CEL result to the plain Go types used elsewhere in confer.
+func celNative(val ref.Val) (interface{}, error) {
+	switch val.Type() {
+	case types.ListType:
+		return val.ConvertToNative(nativeList)
+	case types.MapType:
+		return val.ConvertToNative(nativeMap)
+	}
+	return val.Value(), nil
+}
@@ -0,0 +1,69 @@
+package confer
+
+import (
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// Returns the string at key, or fallback if it is unset. Saves registering a
+// SetDefault for keys only read in one place.
+func (manager *Config) GetStringDefault(key string, fallback string) string {
+	if val := manager.Get(key); val != nil {
+		if s, err := cast.ToStringE(val); err == nil {
+			return s
+		}
+	}
+	return fallback
+}
+
+// Returns the int at key, or fallback if it is unset or not an int.
+func (manager *Config) GetIntDefault(key string, fallback int) int {
+	if val := manager.Get(key); val != nil {
+		if i, err := cast.ToIntE(val); err == nil {
+			return i
+		}
+	}
+	return fallback
+}
+
+// Returns the float at key, or fallback if it is unset or not a number.
+func (manager *Config) GetFloat64Default(key string, fallback float64) float64 {
+	if val := manager.Get(key); val != nil {
+		if f, err := cast.ToFloat64E(val); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+// Returns the boolean at key, or fallback if it is unset or can't be parsed
+// by the configured BoolParser.
+func (manager *Config) GetBoolDefault(key string, fallback bool) bool {
+	if val := manager.Get(key); val != nil {
+		if b, err := manager.parseBool(val); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+// Returns the duration at key, or fallback if it is unset or invalid.
+func (manager *Config) GetDurationDefault(key string, fallback time.Duration) time.Duration {
+	if val := manager.Get(key); val != nil {
+		if d, err := cast.ToDurationE(val); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+// Returns the list at key, or fallback if it is unset.
+func (manager *Config) GetStringSliceDefault(key string, fallback []string) []string {
+	if val := manager.Get(key); val != nil {
+		if s, err := cast.ToStringSliceE(val); err == nil {
+			return s
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,51 @@
+package confer
+
+import (
+	"github.com/spf13/cast"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/pflag"
+)
+
+// Makes ReadPaths update the defaults of bound flags the user didn't pass to
+// the values files provide, so --help shows the defaults actually in effect:
+//
+//	pflag.Int("port", 8080, "Port to listen on")
+//	config.BindPFlag("server.port", pflag.Lookup("port"))
+//	config.SetFlagDefaultSync(true)
+//	config.ReadPaths("application.yaml") // server.port: 9090
+//	pflag.Parse()                        // --help shows (default 9090)
+//
+// The flag's value is updated along with its default, so code reading the
+// flag directly agrees with Get. Flags given on the command line are left
+// alone.
+func (manager *Config) SetFlagDefaultSync(enabled bool) {
+	manager.flagDefaultSync = enabled
+}
+
+// Updates the defaults of unchanged bound flags to the values files provide,
+// as ReadPaths does when SetFlagDefaultSync is enabled.
+func (manager *Config) SyncFlagDefaults() {
+	for _, key := range manager.pflags.AllKeys() {
+		flag, _ := manager.pflags.Flag(key)
+		if flag.Changed {
+			continue
+		}
+
+		val, exists := manager.attributes.Get(key)
+		if !exists || val == nil {
+			continue
+		}
+
+		var err error
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			err = slice.Replace(cast.ToStringSlice(val))
+		} else {
+			err = flag.Value.Set(cast.ToString(val))
+		}
+		if err != nil {
+			jww.WARN.Println("Unable to set the default of flag", flag.Name, "to", val, err)
+			continue
+		}
+		flag.DefValue = flag.Value.String()
+	}
+}
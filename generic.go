@@ -0,0 +1,91 @@
+//go:build go1.18
+
+package confer
+
+import (
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// Returns the value at key converted to T, or T's zero value if it is unset
+// or can't be converted, e.g:
+//
+//	port := confer.Get[int](config, "server.port")
+//	timeout := confer.Get[time.Duration](config, "server.timeout")
+//	db := confer.Get[Database](config, "app.database")
+//
+// Conversions follow Unmarshal, so casters and decode hooks apply.
+func Get[T any](manager *Config, key string) T {
+	val, _ := Lookup[T](manager, key)
+	return val
+}
+
+// Like Get, but also reports whether the key was set and could be converted.
+func Lookup[T any](manager *Config, key string) (T, bool) {
+	var out T
+
+	val := manager.Get(key)
+	if val == nil {
+		return out, false
+	}
+
+	if typed, ok := val.(T); ok {
+		return typed, true
+	}
+
+	decoder, err := mapstructure.NewDecoder(manager.decoderConfig(&out))
+	if err != nil {
+		return out, false
+	}
+	if err := decoder.Decode(maps.DeepCopy(maps.Normalize(val))); err != nil {
+		var zero T
+		return zero, false
+	}
+	return out, true
+}
+
+// Like Get, but returns fallback if key is unset or can't be converted:
+//
+//	workers := confer.GetOr(config, "queue.workers", 4)
+func GetOr[T any](manager *Config, key string, fallback T) T {
+	if val, ok := Lookup[T](manager, key); ok {
+		return val
+	}
+	return fallback
+}
+
+// Returns a function that parses the value at key once and caches the
+// result until the configuration next changes, in the spirit of
+// sync.OnceValues. Useful where parsing is expensive, such as compiling
+// regular expressions or templates:
+//
+//	allowed := confer.Memo(config, "http.allowed_origins", func(val interface{}) (*regexp.Regexp, error) {
+//		return regexp.Compile(cast.ToString(val))
+//	})
+//	...
+//	re, err := allowed()
+//
+// The cache is invalidated by writes through the API, including ReadPaths
+// and Reload. Call Publish after changing flags or the environment directly.
+func Memo[T any](manager *Config, key string, parse func(interface{}) (T, error)) func() (T, error) {
+	var mu sync.Mutex
+	var generation uint64
+	var val T
+	var err error
+	parsed := false
+
+	return func() (T, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		current := manager.generation.Load()
+		if !parsed || generation != current {
+			val, err = parse(manager.Get(key))
+			generation, parsed = current, true
+		}
+		return val, err
+	}
+}
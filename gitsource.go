@@ -0,0 +1,231 @@
+package confer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/reader"
+)
+
+// Configures a source added with AddGitSource.
+type GitOptions struct {
+	// The branch or tag to track. Defaults to the remote's default branch.
+	Ref string
+	// The files to load, relative to the root of the repository, in merge
+	// order.
+	Paths []string
+	// Where to clone the repository. An existing clone is reused. Defaults
+	// to a temporary directory.
+	Dir string
+	// How often to pull. Pulled once when zero.
+	Interval time.Duration
+}
+
+// Describes a pulled change, as passed to OnGitUpdate handlers.
+type GitUpdate struct {
+	Repo     string
+	Ref      string
+	Previous string
+	Current  string
+}
+
+// A repository added with AddGitSource.
+type gitSource struct {
+	repo   string
+	opts   GitOptions
+	dir    string
+	commit string
+	data   map[string]interface{}
+	stop   chan struct{}
+	sourceHealth
+}
+
+// Loads files from a git repository, for GitOps style configuration
+// management, e.g:
+//
+//	err := config.AddGitSource("https://github.com/acme/config.git", confer.GitOptions{
+//		Ref:      "production",
+//		Paths:    []string{"base.yaml", "billing/production.yaml"},
+//		Interval: time.Minute,
+//	})
+//
+// The repository is shallow cloned with the git command, which must be on
+// the PATH and handles authentication as usual. The files are merged on top
+// of files read with ReadPaths, along with object sources. With a positive
+// interval the ref is fetched periodically; when it moves the files go
+// through the same pipeline as Reload and OnGitUpdate handlers are notified.
+// Stop pulling with StopGitSources.
+func (manager *Config) AddGitSource(repo string, opts GitOptions) error {
+	if len(opts.Paths) == 0 {
+		return fmt.Errorf("No files to load from %s", repo)
+	}
+
+	src := &gitSource{repo: repo, opts: opts, dir: opts.Dir, stop: make(chan struct{})}
+	if src.dir == "" {
+		dir, err := ioutil.TempDir("", "confer-git")
+		if err != nil {
+			return err
+		}
+		src.dir = dir
+	}
+
+	if err := src.clone(); err != nil {
+		return err
+	}
+	if err := src.load(); err != nil {
+		return err
+	}
+	src.record(nil)
+
+	manager.addSource(func() {
+		manager.gitSources = append(manager.gitSources, src)
+	})
+
+	if opts.Interval > 0 {
+		go manager.pollGitSource(src)
+	}
+	return nil
+}
+
+// Registers a handler invoked whenever a git source pulls a new commit, after
+// its files have been reloaded.
+func (manager *Config) OnGitUpdate(fn func(GitUpdate)) {
+	manager.gitUpdateHandlers = append(manager.gitUpdateHandlers, fn)
+}
+
+// Stops pulling every git source. Their last loaded files remain in effect.
+func (manager *Config) StopGitSources() {
+	for _, src := range manager.gitSources {
+		select {
+		case <-src.stop:
+		default:
+			close(src.stop)
+		}
+	}
+}
+
+func (manager *Config) pollGitSource(src *gitSource) {
+	ticker := time.NewTicker(src.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-src.stop:
+			return
+		case <-ticker.C:
+		}
+
+		previous := src.commit
+		manager.reloadMu.Lock()
+		changed, err := src.pull()
+		manager.reloadMu.Unlock()
+		src.record(err)
+		if err != nil {
+			jww.ERROR.Println("Unable to pull", src.repo, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		jww.INFO.Println("Reloading", src.repo, "at", src.commit)
+		if _, err := manager.reload(func() []error {
+			return manager.rebuildAttributes(false)
+		}); err != nil {
+			jww.ERROR.Println(err)
+			continue
+		}
+
+		update := GitUpdate{Repo: src.repo, Ref: src.opts.Ref, Previous: previous, Current: src.commit}
+		for _, fn := range manager.gitUpdateHandlers {
+			fn(update)
+		}
+	}
+}
+
+// Clones the repository, or reuses an existing clone.
+func (src *gitSource) clone() error {
+	if _, err := os.Stat(filepath.Join(src.dir, ".git")); err == nil {
+		_, err := src.pull()
+		return err
+	}
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if src.opts.Ref != "" {
+		args = append(args, "--branch", src.opts.Ref)
+	}
+	if _, err := git("", append(args, src.repo, src.dir)...); err != nil {
+		return err
+	}
+
+	commit, err := git(src.dir, "rev-parse", "HEAD")
+	src.commit = commit
+	return err
+}
+
+// Fetches the ref, checking it out and loading the files if it moved.
+func (src *gitSource) pull() (bool, error) {
+	ref := src.opts.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := git(src.dir, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+		return false, err
+	}
+
+	commit, err := git(src.dir, "rev-parse", "FETCH_HEAD")
+	if err != nil || commit == src.commit {
+		return false, err
+	}
+	if _, err := git(src.dir, "checkout", "--quiet", "--force", commit); err != nil {
+		return false, err
+	}
+	if err := src.load(); err != nil {
+		return false, err
+	}
+
+	src.commit = commit
+	return true, nil
+}
+
+// Reads and merges the files.
+func (src *gitSource) load() error {
+	merged := map[string]interface{}{}
+	for _, p := range src.opts.Paths {
+		loaded, err := reader.ReadFileFrom(reader.OSFileSystem{}, filepath.Join(src.dir, p))
+		if err != nil {
+			return fmt.Errorf("Unable to load %s from %s: %v", p, src.repo, err)
+		}
+
+		parsed := cast.ToStringMap(loaded)
+		maps.ToStringMapRecursive(parsed)
+		merged = maps.Merge(merged, parsed)
+	}
+
+	src.data = merged
+	return nil
+}
+
+// Runs git in dir, returning its trimmed output.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	out, err := cmd.Output()
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exit.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,161 @@
+package confer
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Summarizes the state of the configuration subsystem, as reported by Health.
+type HealthStatus struct {
+	// False if the last reload failed or the configuration is invalid.
+	Healthy bool
+	// True if the configuration is usable but something needs attention: a
+	// remote source is failing or serving cached data, or settings are
+	// quarantined.
+	Degraded bool
+
+	// When files were last read with ReadPaths. Zero if never.
+	LoadedAt time.Time
+	// When the configuration was last reloaded, whether by Reload, a watch or
+	// a remote source, and why that reload failed, if it did.
+	LastReload    time.Time
+	LastReloadErr error
+
+	// Every remote source: object stores, ZooKeeper, git and documents read
+	// with ReadRemote, with their last error and staleness.
+	Remote []RemoteStatus
+	// Why the current configuration fails the schema or validators.
+	Invalid []error
+	// Settings withheld by the last reload, see SetQuarantine.
+	Quarantined []QuarantinedKey
+}
+
+// Reports the state of the configuration subsystem, for readiness probes and
+// health endpoints:
+//
+//	health := config.Health()
+//	if !health.Healthy {
+//		log.Println("configuration problem:", health.LastReloadErr, health.Invalid)
+//	}
+//
+// A stale or unreachable remote source only degrades health, since the last
+// known configuration remains in effect. See HealthHandler for an HTTP
+// endpoint.
+func (manager *Config) Health() HealthStatus {
+	health := HealthStatus{
+		Remote:      []RemoteStatus{},
+		Invalid:     manager.validate(false),
+		Quarantined: manager.Quarantined(),
+	}
+
+	manager.mu.RLock()
+	health.LoadedAt = manager.loadedAt
+	health.LastReload, health.LastReloadErr = manager.reloadedAt, manager.reloadErr
+	for _, src := range manager.objectSources {
+		health.Remote = append(health.Remote, src.status(src.url))
+	}
+	for _, src := range manager.zooKeeperSources {
+		health.Remote = append(health.Remote, src.status(src.path))
+	}
+	for _, src := range manager.gitSources {
+		health.Remote = append(health.Remote, src.status(src.repo))
+	}
+	for _, src := range manager.remoteSources {
+		health.Remote = append(health.Remote, src.status(src.url))
+	}
+	manager.mu.RUnlock()
+
+	health.Healthy = health.LastReloadErr == nil && len(health.Invalid) == 0
+	health.Degraded = len(health.Quarantined) > 0
+	for _, remote := range health.Remote {
+		if remote.Stale || remote.Err != nil {
+			health.Degraded = true
+		}
+	}
+	return health
+}
+
+// Returns an http.Handler serving Health as JSON, responding 503 Service
+// Unavailable when unhealthy so configuration problems fail readiness
+// probes:
+//
+//	http.Handle("/healthz/config", config.HealthHandler())
+func (manager *Config) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := manager.Health()
+
+		status := "ok"
+		if !health.Healthy {
+			status = "unhealthy"
+		} else if health.Degraded {
+			status = "degraded"
+		}
+
+		remote := []map[string]interface{}{}
+		for _, src := range health.Remote {
+			remote = append(remote, map[string]interface{}{
+				"url":        src.URL,
+				"fetched_at": src.FetchedAt,
+				"stale":      src.Stale,
+				"error":      errorString(src.Err),
+			})
+		}
+		invalid := []string{}
+		for _, err := range health.Invalid {
+			invalid = append(invalid, err.Error())
+		}
+		quarantined := []string{}
+		for _, q := range health.Quarantined {
+			quarantined = append(quarantined, q.Key)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !health.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":            status,
+			"loaded_at":         health.LoadedAt,
+			"last_reload":       health.LastReload,
+			"last_reload_error": errorString(health.LastReloadErr),
+			"remote":            remote,
+			"invalid":           invalid,
+			"quarantined":       quarantined,
+		})
+	})
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// When a remote source last fetched successfully, whether it is serving a
+// cached copy and its last error, for Health.
+type sourceHealth struct {
+	mu        sync.Mutex
+	fetchedAt time.Time
+	stale     bool
+	err       error
+}
+
+// Records the outcome of a fetch.
+func (h *sourceHealth) record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.err = err
+	if err == nil {
+		h.fetchedAt, h.stale = time.Now(), false
+	}
+}
+
+func (h *sourceHealth) status(name string) RemoteStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return RemoteStatus{URL: name, FetchedAt: h.fetchedAt, Stale: h.stale, Err: h.err}
+}
@@ -0,0 +1,294 @@
+package confer
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	errors "github.com/jacobstr/confer/errors"
+	"github.com/jacobstr/confer/maps"
+)
+
+// Helm refuses list indices above this to avoid huge allocations.
+const helmMaxIndex = 65536
+
+// Merges Helm values files in order, as `helm install -f a.yaml -f b.yaml`
+// would. Maps merge deeply, everything else is replaced, and an explicit null
+// removes the key, e.g. to drop a default. Paths are resolved as in ReadPaths.
+func (manager *Config) ReadHelmValues(paths ...string) error {
+	errs := []error{}
+
+	for _, base_path := range paths {
+		final_path := base_path
+		if !filepath.IsAbs(base_path) {
+			final_path = path.Join(manager.rootPath, base_path)
+		}
+
+		loaded, err := manager.readFile(final_path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		manager.mergeHelmValues(cast.ToStringMap(maps.Normalize(loaded)))
+	}
+
+	if len(errs) > 0 {
+		return &errors.LoadError{Errors: errs}
+	}
+	return nil
+}
+
+// Applies `helm --set` style overrides, e.g:
+//
+//	config.HelmSet("image.tag=1.4.2,replicas=3", "hosts={a.example.com,b.example.com}")
+//
+// Values are typed as Helm types them: true and false become booleans, whole
+// numbers become int64 and null removes the key. Everything else, including
+// decimals, stays a string.
+func (manager *Config) HelmSet(exprs ...string) error {
+	return manager.helmSet(exprs, false)
+}
+
+// Applies `helm --set-string` style overrides, where every value is a string.
+func (manager *Config) HelmSetString(exprs ...string) error {
+	return manager.helmSet(exprs, true)
+}
+
+func (manager *Config) helmSet(exprs []string, stringsOnly bool) error {
+	for _, expr := range exprs {
+		values, err := parseHelmSet(expr, stringsOnly)
+		if err != nil {
+			return err
+		}
+		manager.mergeHelmValues(values)
+	}
+	return nil
+}
+
+// Parses a `--set` expression into the values it describes.
+func ParseHelmSet(expr string) (map[string]interface{}, error) {
+	return parseHelmSet(expr, false)
+}
+
+func parseHelmSet(expr string, stringsOnly bool) (map[string]interface{}, error) {
+	var values interface{} = map[string]interface{}{}
+
+	for _, assignment := range splitUnescaped(expr, ',', true) {
+		if assignment == "" {
+			continue
+		}
+
+		parts := splitUnescaped(assignment, '=', false)
+		if len(parts) < 2 {
+			return nil, helmSetError(assignment, "missing '='")
+		}
+		// Only the first '=' separates the key from the value.
+		key, raw := parts[0], strings.Join(parts[1:], "=")
+
+		steps, err := parseHelmKey(key)
+		if err != nil {
+			return nil, helmSetError(assignment, err.Error())
+		}
+
+		var val interface{}
+		if strings.HasPrefix(raw, "{") && strings.HasSuffix(raw, "}") {
+			list := []interface{}{}
+			for _, item := range splitUnescaped(raw[1:len(raw)-1], ',', false) {
+				if item != "" {
+					list = append(list, helmValue(item, stringsOnly))
+				}
+			}
+			val = list
+		} else {
+			val = helmValue(raw, stringsOnly)
+		}
+
+		if values, err = helmAssign(values, steps, val); err != nil {
+			return nil, helmSetError(assignment, err.Error())
+		}
+	}
+
+	return values.(map[string]interface{}), nil
+}
+
+func helmSetError(assignment, reason string) error {
+	return &errors.ParseError{Format: "--set", Err: fmt.Errorf("%q: %s", assignment, reason)}
+}
+
+// A single step in a --set key: either a map key or a list index.
+type helmStep struct {
+	key   string
+	index int
+	list  bool
+}
+
+// Parses keys such as `servers[0].hosts` into steps.
+func parseHelmKey(key string) ([]helmStep, error) {
+	steps := []helmStep{}
+
+	for _, segment := range splitUnescaped(key, '.', false) {
+		name := segment
+		indices := ""
+		if i := strings.Index(segment, "["); i >= 0 {
+			name, indices = segment[:i], segment[i:]
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("empty key segment")
+		}
+		steps = append(steps, helmStep{key: unescapeHelm(name)})
+
+		for indices != "" {
+			end := strings.Index(indices, "]")
+			if !strings.HasPrefix(indices, "[") || end < 0 {
+				return nil, fmt.Errorf("malformed index in %q", segment)
+			}
+			index, err := strconv.Atoi(indices[1:end])
+			if err != nil || index < 0 || index > helmMaxIndex {
+				return nil, fmt.Errorf("invalid index in %q", segment)
+			}
+			steps = append(steps, helmStep{index: index, list: true})
+			indices = indices[end+1:]
+		}
+	}
+
+	return steps, nil
+}
+
+// Sets val at steps beneath node, creating maps and lists along the way.
+func helmAssign(node interface{}, steps []helmStep, val interface{}) (interface{}, error) {
+	if len(steps) == 0 {
+		return val, nil
+	}
+
+	step, rest := steps[0], steps[1:]
+
+	if step.list {
+		list, _ := node.([]interface{})
+		for len(list) <= step.index {
+			list = append(list, nil)
+		}
+		child, err := helmAssign(list[step.index], rest, val)
+		list[step.index] = child
+		return list, err
+	}
+
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+	}
+	child, err := helmAssign(m[step.key], rest, val)
+	m[step.key] = child
+	return m, err
+}
+
+// Types a scalar the way Helm's strvals package does.
+func helmValue(raw string, stringsOnly bool) interface{} {
+	raw = unescapeHelm(raw)
+	if stringsOnly {
+		return raw
+	}
+
+	switch strings.ToLower(raw) {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	case "0":
+		return int64(0)
+	}
+
+	// Leading zeros usually mean an identifier such as a zip code.
+	if !strings.HasPrefix(raw, "0") {
+		if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return i
+		}
+	}
+	return raw
+}
+
+// Splits s on sep, ignoring separators escaped with a backslash and, if
+// braces is set, those within {...} lists. Escapes are preserved.
+func splitUnescaped(s string, sep rune, braces bool) []string {
+	parts := []string{}
+	current := []rune{}
+	depth := 0
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case braces && r == '{':
+			depth++
+		case braces && r == '}' && depth > 0:
+			depth--
+		case r == sep && depth == 0:
+			parts = append(parts, string(current))
+			current = current[:0]
+			continue
+		}
+		current = append(current, r)
+	}
+
+	return append(parts, string(current))
+}
+
+func unescapeHelm(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	out := []rune{}
+	escaped := false
+	for _, r := range s {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// Merges values into the attributes tier with Helm semantics.
+func (manager *Config) mergeHelmValues(values map[string]interface{}) {
+	manager.write(func() {
+		manager.recordDocument(attributeDocument{data: maps.DeepCopy(values).(map[string]interface{}), helm: true})
+		merged := map[string]interface{}{}
+		if current := manager.attributes.ToStringMap(); current != nil {
+			merged = maps.DeepCopy(current).(map[string]interface{})
+		}
+
+		manager.attributes.FromStringMap(mergeHelm(merged, values))
+	})
+}
+
+// Like maps.Merge, but a nil in src deletes the key from dst.
+func mergeHelm(dst, src map[string]interface{}) map[string]interface{} {
+	for key, srcVal := range src {
+		if srcVal == nil {
+			delete(dst, key)
+			continue
+		}
+
+		srcMap, srcIsMap := srcVal.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			dst[key] = mergeHelm(dstMap, srcMap)
+		} else {
+			dst[key] = srcVal
+		}
+	}
+	return dst
+}
@@ -0,0 +1,53 @@
+package confer
+
+import (
+	"gopkg.in/yaml.v2"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// The data key the configuration is stored under in exported ConfigMaps.
+// Mount the ConfigMap as a volume and read it back with ReadPaths.
+const ConfigMapKey = "config.yaml"
+
+type configMap struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   configMapMetadata `yaml:"metadata"`
+	Data       map[string]string `yaml:"data"`
+}
+
+type configMapMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// Renders the effective configuration as a Kubernetes ConfigMap manifest,
+// stored as YAML under ConfigMapKey. Pass keys to export only those subtrees,
+// e.g:
+//
+//	manifest, err := config.ExportK8sConfigMap("api", "prod", "app.database")
+//
+// ConfigMaps are not meant for credentials, so secret values are redacted.
+// The namespace is omitted when empty.
+func (manager *Config) ExportK8sConfigMap(name, namespace string, keys ...string) ([]byte, error) {
+	settings := map[string]interface{}{}
+	for key, val := range manager.AllSettings() {
+		if val == nil || (len(keys) > 0 && !anyKeyMatches(keys, key)) {
+			continue
+		}
+		settings[key] = maps.Normalize(manager.redact(key, val))
+	}
+
+	contents, err := yaml.Marshal(maps.Expand(settings))
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(configMap{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   configMapMetadata{Name: name, Namespace: namespace},
+		Data:       map[string]string{ConfigMapKey: string(contents)},
+	})
+}
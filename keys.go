@@ -0,0 +1,36 @@
+package confer
+
+import (
+	"path"
+	"strings"
+)
+
+// Reports whether pattern matches key or one of its ancestors. Patterns are
+// materialized paths whose segments may contain path.Match wildcards, so
+// "app.security.*" matches "app.security.salt" as well as everything nested
+// beneath it. Matching is case-insensitive.
+func keyMatches(pattern, key string) bool {
+	patternParts := strings.Split(strings.ToLower(pattern), ".")
+	keyParts := strings.Split(strings.ToLower(key), ".")
+
+	if len(patternParts) > len(keyParts) {
+		return false
+	}
+
+	for i, part := range patternParts {
+		if matched, err := path.Match(part, keyParts[i]); err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether any of the patterns match key.
+func anyKeyMatches(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if keyMatches(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
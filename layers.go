@@ -0,0 +1,220 @@
+package confer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/source"
+)
+
+// Names of the configuration tiers, in their default order of precedence.
+const (
+	// Command line flags that were explicitly provided.
+	LayerFlags = "flags"
+	// Values provided with Set.
+	LayerOverrides = "overrides"
+	// Bound environment variables that are set.
+	LayerEnv = "env"
+	// Data from configuration files.
+	LayerAttributes = "attributes"
+	// Values provided with SetDefault.
+	LayerDefaults = "defaults"
+	// The defaults of bound command line flags that weren't provided. Unused
+	// unless named in SetPrecedence.
+	LayerFlagDefaults = "flag_defaults"
+)
+
+var defaultPrecedence = []string{LayerFlags, LayerOverrides, LayerEnv, LayerAttributes, LayerDefaults}
+
+// Returns the names of all layers, highest precedence first.
+func (manager *Config) Layers() []string {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return append([]string(nil), manager.precedence...)
+}
+
+// Reorders the layers Get resolves keys through, highest precedence first,
+// e.g. where files mounted by an orchestrator must beat the environment:
+//
+//	config.SetPrecedence(
+//		confer.LayerFlags,
+//		confer.LayerOverrides,
+//		confer.LayerAttributes,
+//		confer.LayerEnv,
+//		confer.LayerDefaults,
+//	)
+//
+// Flag defaults are copied into LayerDefaults unless LayerFlagDefaults is
+// named, in which case they're only found in their own tier, so tools can let
+// files beat the defaults baked into their flags while explicitly passed flags
+// still win:
+//
+//	config.SetPrecedence(
+//		confer.LayerFlags,
+//		confer.LayerOverrides,
+//		confer.LayerEnv,
+//		confer.LayerAttributes,
+//		confer.LayerFlagDefaults,
+//		confer.LayerDefaults,
+//	)
+//
+// Kiosk deployments can likewise put LayerAttributes first, so files beat
+// everything. Every layer, including sources added with AddSource, must be
+// named exactly once; only LayerFlagDefaults may be left out.
+func (manager *Config) SetPrecedence(layers ...string) error {
+	manager.mu.Lock()
+	err := manager.checkPrecedence(layers)
+	if err == nil {
+		manager.precedence = append([]string(nil), layers...)
+		manager.copyFlagDefaults()
+	}
+	manager.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	manager.attributesChanged()
+	return nil
+}
+
+// Validates a new precedence against the known layers. Requires the lock.
+func (manager *Config) checkPrecedence(layers []string) error {
+	seen := map[string]bool{}
+	for _, layer := range layers {
+		if layer != LayerFlags && layer != LayerFlagDefaults && layer != LayerEnv && manager.store(layer) == nil {
+			return fmt.Errorf("Unknown layer %q", layer)
+		}
+		if seen[layer] {
+			return fmt.Errorf("Layer %q is named more than once", layer)
+		}
+		seen[layer] = true
+	}
+	for _, layer := range manager.precedence {
+		if !seen[layer] && layer != LayerFlagDefaults {
+			return fmt.Errorf("Layer %q is missing from the precedence", layer)
+		}
+	}
+	return nil
+}
+
+// Looks key up in a single layer.
+func (manager *Config) lookupLayer(layer string, key string) (interface{}, bool) {
+	return manager.lookupIn(manager.env, layer, key)
+}
+
+// Like lookupLayer, but reads environment variables from env.
+func (manager *Config) lookupIn(env *source.EnvSource, layer string, key string) (interface{}, bool) {
+	switch layer {
+	case LayerFlags:
+		return manager.pflags.Get(key)
+	case LayerFlagDefaults:
+		return manager.pflags.GetDefault(key)
+	case LayerEnv:
+		val, exists := env.Get(key)
+		if exists {
+			return manager.splitEnvList(key, val), true
+		}
+		if m, exists := manager.envMap(env, key); exists {
+			return m, true
+		}
+		return nil, false
+	}
+	if store := manager.store(layer); store != nil {
+		return store.Get(key)
+	}
+	return nil, false
+}
+
+// Returns the source backing a layer holding nested data, or nil for flags,
+// the environment and unknown layers.
+func (manager *Config) store(layer string) source.Configger {
+	switch layer {
+	case LayerOverrides:
+		return manager.overrides
+	case LayerAttributes:
+		return manager.attributes
+	case LayerDefaults:
+		return manager.defaults
+	}
+	if custom, exists := manager.sources[layer]; exists {
+		return custom.src
+	}
+	return nil
+}
+
+// Returns the sources backing the stored layers among layers, in order.
+func (manager *Config) stores(layers []string) []source.Configger {
+	stores := []source.Configger{}
+	for _, layer := range layers {
+		if store := manager.store(layer); store != nil {
+			stores = append(stores, store)
+		}
+	}
+	return stores
+}
+
+// Returns the leaf settings contributed by a single layer, independent of the
+// merged result. Keys are flattened and lower cased as in AllSettings. Returns
+// nil for an unknown layer.
+//
+//	fromEnv := config.SettingsFrom(confer.LayerEnv)
+func (manager *Config) SettingsFrom(layer string) map[string]interface{} {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return manager.settingsFrom(layer)
+}
+
+// SettingsFrom without locking, for callers already holding the lock.
+func (manager *Config) settingsFrom(layer string) map[string]interface{} {
+	m := map[string]interface{}{}
+
+	switch layer {
+	case LayerFlags:
+		for _, key := range manager.pflags.AllKeys() {
+			if val, exists := manager.pflags.Get(key); exists {
+				m[key] = val
+			}
+		}
+	case LayerFlagDefaults:
+		for _, key := range manager.pflags.AllKeys() {
+			if val, exists := manager.pflags.GetDefault(key); exists {
+				m[key] = val
+			}
+		}
+	case LayerOverrides:
+		for key, _ := range maps.Flatten(manager.overrides.ToStringMap()) {
+			if val, exists := manager.overrides.Get(key); exists {
+				m[strings.ToLower(key)] = val
+			}
+		}
+	case LayerEnv:
+		for _, key := range manager.env.AllKeys() {
+			if val, exists := manager.env.Get(key); exists {
+				m[key] = manager.splitEnvList(key, val)
+			}
+		}
+	case LayerAttributes:
+		for key, _ := range maps.Flatten(manager.attributes.ToStringMap()) {
+			if val, exists := manager.attributes.Get(key); exists {
+				m[strings.ToLower(key)] = val
+			}
+		}
+	case LayerDefaults:
+		for key, _ := range maps.Flatten(manager.defaults.ToStringMap()) {
+			if val, exists := manager.defaults.Get(key); exists {
+				m[strings.ToLower(key)] = val
+			}
+		}
+	default:
+		custom, exists := manager.sources[layer]
+		if !exists {
+			return nil
+		}
+		for key, val := range maps.Flatten(maps.Normalize(custom.src.ToStringMap()).(map[string]interface{})) {
+			m[strings.ToLower(key)] = val
+		}
+	}
+
+	return m
+}
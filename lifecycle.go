@@ -0,0 +1,32 @@
+package confer
+
+import (
+	errors "github.com/jacobstr/confer/errors"
+)
+
+// Enables a strict lifecycle, in which reading a key before ReadPaths or
+// Finalize has been called is a bug: Get panics and GetE returns a
+// NotLoadedError. This catches packages that read configuration at import
+// time, before main has wired it up, and would otherwise silently see
+// defaults:
+//
+//	config.SetStrictLifecycle(true)
+//	// ... register defaults, bind flags and environment variables ...
+//	config.ReadPaths("application.yaml")
+func (manager *Config) SetStrictLifecycle(enabled bool) {
+	manager.strictLifecycle.Store(enabled)
+}
+
+// Marks configuration as loaded, for applications that don't read files with
+// ReadPaths, e.g. those configured entirely by flags and the environment.
+func (manager *Config) Finalize() {
+	manager.loaded.Store(true)
+}
+
+// Returns a NotLoadedError if key is read too early in strict lifecycle mode.
+func (manager *Config) checkLifecycle(key string) error {
+	if manager.strictLifecycle.Load() && !manager.loaded.Load() {
+		return &errors.NotLoadedError{Key: key}
+	}
+	return nil
+}
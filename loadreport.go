@@ -0,0 +1,111 @@
+package confer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// Describes the hygiene of a configuration after loading, as returned by
+// ReadPathsWithReport.
+type LoadReport struct {
+	// The files read by this call.
+	Files []string
+	// Keys provided by files that the schema doesn't declare. Only reported
+	// when a schema is defined.
+	Unknown []string
+	// Deprecated keys that are set.
+	Deprecated []string
+	// Declared keys taking their default because nothing else sets them.
+	Defaulted []string
+	// Keys provided by files whose values are superseded by another layer.
+	Overridden []OverriddenKey
+}
+
+// A file provided key superseded by another layer.
+type OverriddenKey struct {
+	Key string
+	// The layer supplying the value in effect, e.g. LayerEnv.
+	Layer string
+}
+
+// Reports whether no unknown or deprecated keys were found.
+func (report *LoadReport) Clean() bool {
+	return len(report.Unknown) == 0 && len(report.Deprecated) == 0
+}
+
+// Like ReadPaths, but also returns a report of unknown, deprecated, defaulted
+// and overridden keys, so CI pipelines can gate on configuration hygiene:
+//
+//	report, err := config.ReadPathsWithReport("application.yaml")
+//	if err != nil || !report.Clean() {
+//		os.Exit(1)
+//	}
+//
+// The report is returned even when loading fails.
+func (manager *Config) ReadPathsWithReport(paths ...string) (*LoadReport, error) {
+	read := len(manager.paths)
+	err := manager.ReadPaths(paths...)
+
+	report := manager.loadReport()
+	report.Files = append(report.Files, manager.paths[read:]...)
+	return report, err
+}
+
+func (manager *Config) loadReport() *LoadReport {
+	report := &LoadReport{}
+
+	for key := range maps.Flatten(manager.attributes.ToStringMap()) {
+		key = strings.ToLower(key)
+		if manager.withinSchedule(key) {
+			continue
+		}
+		if len(manager.schema) > 0 && !manager.declared(key) && !manager.deprecated(key) {
+			report.Unknown = append(report.Unknown, key)
+		}
+		if info, exists := manager.Provenance(key); exists && info.Layer != LayerAttributes {
+			report.Overridden = append(report.Overridden, OverriddenKey{Key: key, Layer: info.Layer})
+		}
+	}
+
+	for _, d := range manager.deprecations {
+		if manager.IsSet(d.Key) {
+			report.Deprecated = append(report.Deprecated, d.Key)
+		}
+	}
+
+	for _, spec := range manager.Schema() {
+		if info, exists := manager.Provenance(spec.Key); exists && info.Layer == LayerDefaults {
+			report.Defaulted = append(report.Defaulted, spec.Key)
+		}
+	}
+
+	sort.Strings(report.Unknown)
+	sort.Strings(report.Deprecated)
+	sort.Slice(report.Overridden, func(i, j int) bool {
+		return report.Overridden[i].Key < report.Overridden[j].Key
+	})
+	return report
+}
+
+// Reports whether key, or a section containing it, is declared in the schema.
+func (manager *Config) declared(key string) bool {
+	parts := strings.Split(strings.ToLower(key), ".")
+	for i := len(parts); i > 0; i-- {
+		if _, exists := manager.schema[strings.Join(parts[:i], ".")]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether key has been deprecated.
+func (manager *Config) deprecated(key string) bool {
+	for _, d := range manager.deprecations {
+		if strings.EqualFold(d.Key, key) {
+			return true
+		}
+	}
+	return false
+}
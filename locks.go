@@ -0,0 +1,69 @@
+package confer
+
+import (
+	"strings"
+	"sync"
+)
+
+// Subtrees locked with LockPrefix.
+type prefixLocks struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	held []string
+}
+
+// Locks the subtree beneath prefix, blocking while an overlapping subtree is
+// locked, and returns the function that unlocks it. Every write is already
+// safe on its own, as the tiers are guarded by a lock of their own; subtree
+// locks group several writes so components touching the same keys take
+// turns, while those updating different subtrees don't wait on each other:
+//
+//	defer config.LockPrefix("cache.")()
+//	config.Set("cache.redis.host", host)
+//	config.Set("cache.redis.port", port)
+//
+// Subtrees overlap when one contains the other, so "cache" blocks
+// "cache.redis" but not "queue". An empty prefix locks everything. Locks
+// aren't reentrant, and nothing is locked implicitly: writers cooperate by
+// taking the lock for the keys they change. Readers don't take them, so they
+// may see a group of writes half applied.
+func (manager *Config) LockPrefix(prefix string) func() {
+	prefix = strings.ToLower(strings.TrimSuffix(prefix, "."))
+	locks := &manager.locks
+
+	locks.mu.Lock()
+	if locks.cond == nil {
+		locks.cond = sync.NewCond(&locks.mu)
+	}
+	for locks.overlaps(prefix) {
+		locks.cond.Wait()
+	}
+	locks.held = append(locks.held, prefix)
+	locks.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			locks.mu.Lock()
+			for i, held := range locks.held {
+				if held == prefix {
+					locks.held = append(locks.held[:i], locks.held[i+1:]...)
+					break
+				}
+			}
+			locks.mu.Unlock()
+			locks.cond.Broadcast()
+		})
+	}
+}
+
+// Reports whether prefix overlaps a held subtree. Requires mu.
+func (locks *prefixLocks) overlaps(prefix string) bool {
+	for _, held := range locks.held {
+		if held == "" || prefix == "" || held == prefix ||
+			strings.HasPrefix(prefix, held+".") || strings.HasPrefix(held, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package confer
+
+import (
+	"sort"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// Receives structured log lines from LogEffectiveConfig. An *slog.Logger
+// satisfies it, as do most structured loggers with a thin adapter.
+type Logger interface {
+	// Logs msg with alternating key and value attributes.
+	Info(msg string, args ...interface{})
+}
+
+// Logs the effective configuration now and again after every reload that
+// changes it, as one line per leaf key with the layer that supplied it:
+//
+//	config.LogEffectiveConfig(slog.Default())
+//	// INFO effective config key=app.database.host value=db.internal layer=env
+//	// INFO effective config key=app.database.password value=[REDACTED] layer=attributes
+//
+// Settings are selected as by Export with opts, secrets redacted unless opts
+// say otherwise.
+func (manager *Config) LogEffectiveConfig(logger Logger, opts ...ExportOptions) {
+	selected := ExportOptions{Redact: true}
+	if len(opts) > 0 {
+		selected = opts[0]
+	}
+
+	manager.logEffectiveConfig(logger, selected)
+	manager.OnChange(func([]Change) {
+		manager.logEffectiveConfig(logger, selected)
+	})
+}
+
+func (manager *Config) logEffectiveConfig(logger Logger, opts ExportOptions) {
+	flat := maps.Flatten(maps.Normalize(manager.Export(opts)).(map[string]interface{}))
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		info, _ := manager.Provenance(key)
+		logger.Info("effective config", "key", key, "value", flat[key], "layer", info.Layer)
+	}
+}
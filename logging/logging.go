@@ -0,0 +1,175 @@
+// Package logging configures loggers from a subtree of confer configuration
+// and keeps them in sync as the configuration is reloaded.
+//
+// A subtree such as:
+//
+//	logging:
+//	  level: info
+//	  format: json
+//	  outputs: [stdout, /var/log/myapp.log]
+//
+// is read into Settings. The standard library's log/slog is the only logger
+// with a built-in adapter, NewSlog, or NewSlogTo for output already opened
+// elsewhere. Either redacts the values of attributes named after secret keys.
+// To keep this package free of third-party dependencies, other loggers are
+// wired up with NewBridge, or BindLevel when only the level can change, e.g.
+// for zap:
+//
+//	atom := zap.NewAtomicLevel()
+//	logging.BindLevel(config, "logging", func(level string) error {
+//		return atom.UnmarshalText([]byte(level))
+//	})
+//
+// or logrus:
+//
+//	logging.BindLevel(config, "logging", func(level string) error {
+//		lvl, err := logrus.ParseLevel(level)
+//		if err == nil {
+//			logrus.SetLevel(lvl)
+//		}
+//		return err
+//	})
+//
+// Close the returned Bridge once the logger is no longer used.
+package logging
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jacobstr/confer"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// Logger options read from a configuration subtree.
+type Settings struct {
+	// The minimum level to emit, e.g. debug, info, warn, error.
+	Level string
+	// The output encoding, e.g. text or json.
+	Format string
+	// Destinations: stdout, stderr or file paths.
+	Outputs []string
+}
+
+// Reads Settings from the subtree rooted at prefix.
+func Read(config *confer.Config, prefix string) Settings {
+	settings := Settings{
+		Level:   config.GetString(prefix + ".level"),
+		Format:  config.GetString(prefix + ".format"),
+		Outputs: config.GetStringSlice(prefix + ".outputs"),
+	}
+
+	if settings.Level == "" {
+		settings.Level = "info"
+	}
+	if settings.Format == "" {
+		settings.Format = "text"
+	}
+	if len(settings.Outputs) == 0 {
+		settings.Outputs = []string{"stderr"}
+	}
+
+	return settings
+}
+
+// Opens every configured output and combines them into a single writer.
+// Closing it closes the files it opened; stdout and stderr are left open.
+func (s Settings) Writer() (io.WriteCloser, error) {
+	out := &outputs{}
+	writers := []io.Writer{}
+
+	for _, output := range s.Outputs {
+		switch output {
+		case "stdout":
+			writers = append(writers, os.Stdout)
+		case "stderr":
+			writers = append(writers, os.Stderr)
+		default:
+			file, err := os.OpenFile(output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				out.Close()
+				return nil, err
+			}
+			out.files = append(out.files, file)
+			writers = append(writers, file)
+		}
+	}
+
+	out.Writer = io.MultiWriter(writers...)
+	return out, nil
+}
+
+// The writer returned by Settings.Writer, along with the files it opened.
+type outputs struct {
+	io.Writer
+	files []*os.File
+}
+
+// Closes the opened files, returning the first error encountered.
+func (o *outputs) Close() error {
+	var first error
+	for _, file := range o.files {
+		if err := file.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	o.files = nil
+	return first
+}
+
+// Applies Settings to a logger.
+type ApplyFunc func(settings Settings) error
+
+// Keeps a logger in sync with a configuration subtree.
+type Bridge struct {
+	config *confer.Config
+	prefix string
+	apply  ApplyFunc
+	stop   func()
+}
+
+// Applies the current settings under prefix and re-applies them whenever a
+// reload changes a key within the subtree. Errors encountered while
+// re-applying are logged as the reload has already taken place. Close the
+// bridge to stop following the configuration.
+func NewBridge(config *confer.Config, prefix string, apply ApplyFunc) (*Bridge, error) {
+	bridge := &Bridge{config: config, prefix: prefix, apply: apply}
+
+	if err := bridge.Apply(); err != nil {
+		return nil, err
+	}
+
+	bridge.stop = config.OnChange(func(changes []confer.Change) {
+		for _, change := range changes {
+			if strings.HasPrefix(change.Key, strings.ToLower(prefix)+".") {
+				if err := bridge.Apply(); err != nil {
+					jww.ERROR.Println("Unable to reconfigure logger:", err)
+				}
+				return
+			}
+		}
+	})
+
+	return bridge, nil
+}
+
+// Reads and applies the current settings.
+func (b *Bridge) Apply() error {
+	return b.apply(Read(b.config, b.prefix))
+}
+
+// Stops re-applying settings on reload. The logger keeps its current
+// settings.
+func (b *Bridge) Close() error {
+	b.stop()
+	return nil
+}
+
+// Keeps a logger's level in sync with the `level` key under prefix. The most
+// portable way to integrate loggers whose output can't be changed once built.
+func BindLevel(config *confer.Config, prefix string, setLevel func(level string) error) (*Bridge, error) {
+	return NewBridge(config, prefix, func(settings Settings) error {
+		return setLevel(settings.Level)
+	})
+}
@@ -0,0 +1,113 @@
+//go:build go1.21
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/jacobstr/confer"
+)
+
+// Parses a level name into an slog.Level. Accepts the names understood by
+// slog along with the common aliases trace, warning and fatal.
+func ParseSlogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "trace":
+		return slog.LevelDebug - 4, nil
+	case "warning":
+		return slog.LevelWarn, nil
+	case "fatal", "critical":
+		return slog.LevelError + 4, nil
+	}
+
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("Unknown log level %q", level)
+	}
+	return l, nil
+}
+
+// Builds an slog.Logger from the subtree at prefix. The format and outputs
+// are fixed when the logger is built, while the level follows the
+// configuration across reloads. Close the returned closer once the logger is
+// no longer used to stop following the configuration and close the files it
+// writes to.
+func NewSlog(config *confer.Config, prefix string) (*slog.Logger, io.Closer, error) {
+	w, err := Read(config, prefix).Writer()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger, bridge, err := NewSlogTo(config, prefix, w)
+	if err != nil {
+		w.Close()
+		return nil, nil, err
+	}
+	return logger, closers{bridge, w}, nil
+}
+
+// Like NewSlog, but writes to w rather than the configured outputs, which are
+// ignored. Closing the returned closer only stops following the
+// configuration; w is left open.
+func NewSlogTo(config *confer.Config, prefix string, w io.Writer) (*slog.Logger, io.Closer, error) {
+	settings := Read(config, prefix)
+
+	level := new(slog.LevelVar)
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactor(config)}
+
+	var handler slog.Handler
+	switch settings.Format {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, nil, fmt.Errorf("Unknown log format %q", settings.Format)
+	}
+
+	bridge, err := BindLevel(config, prefix, func(name string) error {
+		l, err := ParseSlogLevel(name)
+		if err != nil {
+			return err
+		}
+		level.Set(l)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return slog.New(handler), bridge, nil
+}
+
+// Closes each closer in turn, returning the first error encountered.
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var first error
+	for _, closer := range c {
+		if err := closer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Returns a ReplaceAttr function substituting confer.Redacted for the values
+// of attributes whose dotted path, groups included, names a secret key, e.g.
+// "password" or "db.token".
+func redactor(config *confer.Config) func(groups []string, a slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if a.Value.Kind() == slog.KindGroup {
+			return a
+		}
+		key := strings.Join(append(append([]string(nil), groups...), a.Key), ".")
+		if config.IsSecret(key) {
+			return slog.String(a.Key, confer.Redacted)
+		}
+		return a
+	}
+}
@@ -0,0 +1,36 @@
+package confer
+
+// Resolves several keys at once, for request paths that read a handful of
+// settings per call:
+//
+//	settings := config.GetMany("limits.rps", "limits.burst", "features.beta")
+//
+// Checks that apply once per read, such as SetMutationChecks, run once for
+// the whole batch, and the keys are read under a single acquisition of the
+// lock from a single snapshot of the environment, so they're consistent with
+// each other. Values are resolved as by Get and keyed as requested; unset
+// keys are left out.
+func (manager *Config) GetMany(keys ...string) map[string]interface{} {
+	if len(keys) > 0 {
+		if err := manager.checkLifecycle(keys[0]); err != nil {
+			panic("confer: " + err.Error())
+		}
+	}
+
+	manager.mu.RLock()
+	manager.checkMutations()
+	env := manager.env.Snapshot()
+	found := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		found[key] = manager.findIn(env, key)
+	}
+	manager.mu.RUnlock()
+
+	values := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if val := manager.resolve(key, found[key]); val != nil {
+			values[key] = val
+		}
+	}
+	return values
+}
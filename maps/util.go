@@ -2,6 +2,7 @@ package maps
 
 import (
 	"reflect"
+	"strings"
 
 	"github.com/spf13/cast"
 )
@@ -91,3 +92,135 @@ func ToStringMapRecursive(src map[string]interface{}) {
 		}
 	}
 }
+
+// Flattens a nested string map into a map of materialized paths to leaf
+// values. Maps are descended into and never reported as leaves themselves.
+func Flatten(data map[string]interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	Traverse(data, func(key string, val interface{}, depth int) bool {
+		if val != nil && reflect.TypeOf(val).Kind() == reflect.Map {
+			return true
+		}
+		m[key] = val
+		return false
+	})
+	return m
+}
+
+// Expands a map of materialized paths into a nested string map, the inverse
+// of Flatten.
+func Expand(flat map[string]interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	for key, val := range flat {
+		parts := strings.Split(key, ".")
+		current := m
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := current[part].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				current[part] = child
+			}
+			current = child
+		}
+		current[parts[len(parts)-1]] = val
+	}
+	return m
+}
+
+// Returns a copy of val in which every nested map has been converted to a
+// string map, descending into slices as well. The result is safe to hand to
+// encoders such as encoding/json that reject map[interface{}]interface{}.
+func Normalize(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = Normalize(child)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[cast.ToString(key)] = Normalize(child)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, child := range v {
+			s[i] = Normalize(child)
+		}
+		return s
+	}
+	return val
+}
+
+// Returns a deep copy of val, recursively copying maps and slices. Other
+// values, including helper functions, are shared.
+func DeepCopy(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = DeepCopy(child)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for key, child := range v {
+			m[key] = DeepCopy(child)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, child := range v {
+			s[i] = DeepCopy(child)
+		}
+		return s
+	case []string:
+		s := make([]string, len(v))
+		copy(s, v)
+		return s
+	}
+	return val
+}
+
+// Reports whether a and b are deeply equal. Unlike reflect.DeepEqual, helper
+// functions are considered equal when they refer to the same function.
+func Equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Type() != vb.Type() {
+		return false
+	}
+
+	switch va.Kind() {
+	case reflect.Func:
+		return va.Pointer() == vb.Pointer()
+	case reflect.Map:
+		if va.Len() != vb.Len() {
+			return false
+		}
+		for _, key := range va.MapKeys() {
+			child := vb.MapIndex(key)
+			if !child.IsValid() || !Equal(va.MapIndex(key).Interface(), child.Interface()) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if va.Len() != vb.Len() {
+			return false
+		}
+		for i := 0; i < va.Len(); i++ {
+			if !Equal(va.Index(i).Interface(), vb.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
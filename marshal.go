@@ -0,0 +1,25 @@
+package confer
+
+import (
+	"encoding/json"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// Encodes the merged settings as a JSON object, with secrets redacted, so a
+// Config can be handed straight to debug endpoints and structured loggers:
+//
+//	json.NewEncoder(w).Encode(config)
+func (manager *Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(manager.marshaled())
+}
+
+// Encodes the merged settings as YAML, with secrets redacted, as MarshalJSON
+// does.
+func (manager *Config) MarshalYAML() (interface{}, error) {
+	return manager.marshaled(), nil
+}
+
+func (manager *Config) marshaled() interface{} {
+	return maps.Normalize(manager.Export(ExportOptions{Redact: true}))
+}
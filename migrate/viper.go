@@ -0,0 +1,457 @@
+// Package migrate helps projects move from spf13/viper to confer. Scan finds
+// the viper calls in a codebase, and the resulting Report describes an
+// equivalent confer setup along with anything that can't be carried over:
+//
+//	report, err := migrate.Scan(".")
+//	report.WriteGo(os.Stdout, "config")
+//	report.WriteSummary(os.Stderr)
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const viperImport = "github.com/spf13/viper"
+
+// A key bound to an environment variable or flag.
+type Binding struct {
+	Key string
+	// The environment variable or flag name. Empty for environment
+	// variables named after the key.
+	Name string
+	// Where the binding was made, as file:line:column.
+	Pos string
+}
+
+// A default registered with SetDefault.
+type Default struct {
+	Key string
+	// The Go source of the value.
+	Value string
+	Pos   string
+}
+
+// A viper call without a direct confer equivalent.
+type Issue struct {
+	Pos     string
+	Call    string
+	Message string
+}
+
+// The viper setup found by Scan.
+type Report struct {
+	// Every file calling viper.
+	Files []string
+	// Configuration files, in the order viper would consider them.
+	Paths []string
+	// The prefix given to SetEnvPrefix, if any.
+	EnvPrefix string
+	// Whether AutomaticEnv was called.
+	AutomaticEnv bool
+	EnvBindings  []Binding
+	FlagBindings []Binding
+	Defaults     []Default
+	Issues       []Issue
+
+	configFiles []string
+	configNames []string
+	configDirs  []string
+	configType  string
+	replacer    bool
+}
+
+// Calls that behave the same in confer, with the receiver changed to a
+// *confer.Config.
+var compatible = map[string]bool{
+	"New": true, "GetViper": true, "ReadInConfig": true, "MergeInConfig": true,
+	"MergeConfigMap": true, "Get": true, "GetString": true, "GetInt": true,
+	"GetBool": true, "GetFloat64": true, "GetDuration": true, "GetTime": true,
+	"GetStringSlice": true, "GetIntSlice": true, "GetStringMap": true,
+	"GetStringMapString": true, "GetStringMapStringSlice": true, "IsSet": true,
+	"InConfig": true, "AllKeys": true, "AllSettings": true, "Set": true,
+	"Sub": true, "Unmarshal": true, "UnmarshalKey": true,
+	"UnmarshalExact": true, "WatchConfig": true, "Debug": true,
+}
+
+// Guidance for calls confer handles differently or not at all.
+var incompatible = map[string]string{
+	"ReadConfig":                 "use ReadBytes with the format instead of a reader",
+	"MergeConfig":                "use ReadBytes with the format instead of a reader",
+	"BindPFlags":                 "bind each flag with BindPFlag",
+	"BindFlagValue":              "bind each flag with BindPFlag",
+	"BindFlagValues":             "bind each flag with BindPFlag",
+	"AllowEmptyEnv":              "empty environment variables are always treated as set",
+	"OnConfigChange":             "handlers take a confer.Event rather than an fsnotify.Event",
+	"RegisterAlias":              "aliases aren't supported; Deprecate the old key with a Replacement",
+	"SetTypeByDefaultValue":      "values are converted by the typed getters, or declared with Define",
+	"SetFs":                      "use SetFileSystem with a reader.FileSystem",
+	"WriteConfig":                "WriteConfig takes a writer and format; WriteConfigFiles writes back to the files read",
+	"SafeWriteConfig":            "WriteConfig takes a writer and format; WriteConfigFiles writes back to the files read",
+	"WriteConfigAs":              "WriteConfig takes a writer and format",
+	"SafeWriteConfigAs":          "WriteConfig takes a writer and format",
+	"AddRemoteProvider":          "remote key/value stores aren't supported; see AddObjectSource and AddZooKeeperSource",
+	"AddSecureRemoteProvider":    "remote key/value stores aren't supported; see AddObjectSource and AddZooKeeperSource",
+	"ReadRemoteConfig":           "remote key/value stores aren't supported; see AddObjectSource and AddZooKeeperSource",
+	"WatchRemoteConfig":          "remote key/value stores aren't supported; see AddObjectSource and AddZooKeeperSource",
+	"WatchRemoteConfigOnChannel": "remote key/value stores aren't supported; see AddObjectSource and AddZooKeeperSource",
+	"SetEnvKeyReplacer":          "environment variables are named by replacing dots with underscores; BindEnv other names explicitly",
+}
+
+// Scans the Go files beneath root, skipping vendor, testdata and hidden
+// directories.
+func Scan(root string) (*Report, error) {
+	report := &Report{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if p != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") {
+			return nil
+		}
+
+		src, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return report.ScanFile(p, src)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Scans a single Go source file, adding what it finds to the report.
+func (r *Report) ScanFile(filename string, src []byte) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return err
+	}
+
+	pkg := viperName(file)
+	if pkg == "" {
+		return nil
+	}
+	r.Files = append(r.Files, filename)
+
+	// Variables holding a *viper.Viper, e.g. v := viper.New().
+	instances := map[string]bool{}
+	isViper := func(expr ast.Expr) bool {
+		ident, ok := expr.(*ast.Ident)
+		return ok && (ident.Name == pkg || instances[ident.Name])
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.AssignStmt:
+			for i, rhs := range node.Rhs {
+				if i < len(node.Lhs) && isConstructor(rhs, pkg) {
+					if ident, ok := node.Lhs[i].(*ast.Ident); ok {
+						instances[ident.Name] = true
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			for i, val := range node.Values {
+				if i < len(node.Names) && isConstructor(val, pkg) {
+					instances[node.Names[i].Name] = true
+				}
+			}
+		case *ast.CallExpr:
+			sel, ok := node.Fun.(*ast.SelectorExpr)
+			if ok && isViper(sel.X) {
+				r.call(fset, sel.Sel.Name, node)
+			}
+		}
+		return true
+	})
+
+	r.resolvePaths()
+	return nil
+}
+
+// Records a single call to viper.
+func (r *Report) call(fset *token.FileSet, name string, call *ast.CallExpr) {
+	pos := fset.Position(call.Pos()).String()
+	issue := func(message string) {
+		r.Issues = append(r.Issues, Issue{Pos: pos, Call: name, Message: message})
+	}
+	// Returns the string literal argument at i, noting an issue if it isn't one.
+	literal := func(i int) (string, bool) {
+		if i < len(call.Args) {
+			if s, ok := stringLiteral(call.Args[i]); ok {
+				return s, true
+			}
+		}
+		issue("argument isn't a string literal; carry it over by hand")
+		return "", false
+	}
+
+	switch name {
+	case "SetConfigFile":
+		if s, ok := literal(0); ok {
+			r.configFiles = append(r.configFiles, s)
+		}
+	case "SetConfigName":
+		if s, ok := literal(0); ok {
+			r.configNames = append(r.configNames, s)
+		}
+	case "AddConfigPath":
+		if s, ok := literal(0); ok {
+			r.configDirs = append(r.configDirs, s)
+		}
+	case "SetConfigType":
+		if s, ok := literal(0); ok {
+			r.configType = s
+		}
+	case "SetEnvPrefix":
+		if s, ok := literal(0); ok {
+			r.EnvPrefix = s
+		}
+	case "AutomaticEnv":
+		r.AutomaticEnv = true
+	case "SetEnvKeyReplacer":
+		if len(call.Args) == 1 && source(fset, call.Args[0]) == `strings.NewReplacer(".", "_")` {
+			r.replacer = true
+		} else {
+			issue(incompatible[name])
+		}
+	case "BindEnv":
+		key, ok := literal(0)
+		if !ok {
+			return
+		}
+		binding := Binding{Key: key, Pos: pos}
+		if len(call.Args) > 1 {
+			binding.Name, _ = literal(1)
+		}
+		if len(call.Args) > 2 {
+			issue("only the first environment variable is bound; BindEnv the others to the same key")
+		}
+		r.EnvBindings = append(r.EnvBindings, binding)
+	case "BindPFlag":
+		key, ok := literal(0)
+		if !ok {
+			return
+		}
+		if flag, ok := flagLookup(call); ok {
+			r.FlagBindings = append(r.FlagBindings, Binding{Key: key, Name: flag, Pos: pos})
+		} else {
+			issue("the flag isn't looked up by name; bind it by hand")
+		}
+	case "SetDefault":
+		key, ok := literal(0)
+		if !ok || len(call.Args) < 2 {
+			return
+		}
+		r.Defaults = append(r.Defaults, Default{Key: key, Value: source(fset, call.Args[1]), Pos: pos})
+	default:
+		if message, exists := incompatible[name]; exists {
+			issue(message)
+		} else if !compatible[name] {
+			issue("no confer equivalent")
+		}
+	}
+}
+
+// Works out the configuration files viper would consider.
+func (r *Report) resolvePaths() {
+	paths := append([]string(nil), r.configFiles...)
+	ext := r.configType
+	if ext == "" {
+		ext = "yaml"
+	}
+	for _, dir := range r.configDirs {
+		for _, name := range r.configNames {
+			paths = append(paths, path.Join(dir, name+"."+ext))
+		}
+	}
+	r.Paths = paths
+}
+
+// Returns the environment variable viper would read for key.
+func (r *Report) envName(key string) string {
+	name := key
+	if r.EnvPrefix != "" {
+		name = r.EnvPrefix + "_" + name
+	}
+	if r.replacer {
+		name = strings.Replace(name, ".", "_", -1)
+	}
+	return strings.ToUpper(name)
+}
+
+// Writes Go source defining NewConfig, which sets up a confer.Config as the
+// scanned code set up viper. Review it before use: viper reads the first
+// configuration file it finds, whereas every existing file is merged here.
+func (r *Report) WriteGo(w io.Writer, pkg string) error {
+	var buf bytes.Buffer
+	p := func(format string, args ...interface{}) { fmt.Fprintf(&buf, format+"\n", args...) }
+
+	p("// Code generated by confer migrate-viper. Review before use.")
+	p("")
+	p("package %s", pkg)
+	p("")
+	p("import (")
+	p("%q", "github.com/jacobstr/confer")
+	if len(r.FlagBindings) > 0 {
+		p("%q", "github.com/spf13/pflag")
+	}
+	p(")")
+	p("")
+
+	if len(r.FlagBindings) > 0 {
+		p("func NewConfig(flags *pflag.FlagSet) (*confer.Config, error) {")
+	} else {
+		p("func NewConfig() (*confer.Config, error) {")
+	}
+	p("config := confer.NewConfig()")
+
+	for _, d := range r.Defaults {
+		p("config.SetDefault(%q, %s)", d.Key, d.Value)
+	}
+
+	if len(r.Paths) > 0 {
+		p("if err := config.ReadPathsWithOptions(")
+		for _, file := range r.Paths {
+			required := false
+			for _, explicit := range r.configFiles {
+				required = required || explicit == file
+			}
+			if required {
+				p("confer.PathSpec{Path: %q, Required: true},", file)
+			} else {
+				p("confer.PathSpec{Path: %q},", file)
+			}
+		}
+		p("); err != nil {")
+		p("return nil, err")
+		p("}")
+	}
+
+	for _, b := range r.EnvBindings {
+		name := b.Name
+		if name == "" {
+			name = r.envName(b.Key)
+		}
+		p("config.BindEnv(%q, %q)", b.Key, name)
+	}
+	if r.AutomaticEnv && r.EnvPrefix != "" {
+		p("config.OverlayEnv(%q)", strings.ToUpper(r.EnvPrefix)+"_")
+	} else if r.AutomaticEnv {
+		p("config.AutomaticEnv()")
+	}
+
+	for _, b := range r.FlagBindings {
+		p("config.BindPFlag(%q, flags.Lookup(%q))", b.Key, b.Name)
+	}
+
+	p("return config, nil")
+	p("}")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// Writes a human readable account of the report, listing issues by position.
+func (r *Report) WriteSummary(w io.Writer) {
+	fmt.Fprintf(w, "Scanned %d files using viper\n", len(r.Files))
+	fmt.Fprintf(w, "  %d configuration files, %d defaults, %d environment bindings, %d flag bindings\n",
+		len(r.Paths), len(r.Defaults), len(r.EnvBindings), len(r.FlagBindings))
+	if len(r.configDirs) > 1 || len(r.configNames) > 1 {
+		fmt.Fprintln(w, "  viper reads the first configuration file found; confer merges all of them")
+	}
+
+	if len(r.Issues) == 0 {
+		fmt.Fprintln(w, "No incompatibilities found")
+		return
+	}
+	fmt.Fprintf(w, "%d incompatibilities:\n", len(r.Issues))
+	for _, issue := range r.Issues {
+		fmt.Fprintf(w, "  %s: %s: %s\n", issue.Pos, issue.Call, issue.Message)
+	}
+}
+
+// Returns the name viper is imported under in file, or "" if it isn't.
+func viperName(file *ast.File) string {
+	for _, spec := range file.Imports {
+		if p, _ := strconv.Unquote(spec.Path.Value); p != viperImport {
+			continue
+		}
+		if spec.Name != nil {
+			return spec.Name.Name
+		}
+		return "viper"
+	}
+	return ""
+}
+
+// Reports whether expr is viper.New() or viper.GetViper().
+func isConstructor(expr ast.Expr, pkg string) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && ident.Name == pkg && (sel.Sel.Name == "New" || sel.Sel.Name == "GetViper")
+}
+
+// Returns the name of the flag passed to BindPFlag as flags.Lookup("name").
+func flagLookup(call *ast.CallExpr) (string, bool) {
+	if len(call.Args) < 2 {
+		return "", false
+	}
+	lookup, ok := call.Args[1].(*ast.CallExpr)
+	if !ok || len(lookup.Args) != 1 {
+		return "", false
+	}
+	if sel, ok := lookup.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "Lookup" {
+		return "", false
+	}
+	return stringLiteral(lookup.Args[0])
+}
+
+func stringLiteral(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// Returns the Go source of expr.
+func source(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
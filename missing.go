@@ -0,0 +1,66 @@
+package confer
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// The directory holding this package's sources, used to skip our own frames
+// when looking for the caller of an accessor.
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// Enables a debug mode that logs a warning the first time each unset key is
+// read, along with the file and line of the code reading it. Handy for
+// hunting down typos and stale code paths in large applications:
+//
+//	WARN: Read of unset key "app.databse.host" at server/db.go:42
+//
+// Intended for development; each miss walks the call stack.
+func (manager *Config) SetMissingKeyLogging(enabled bool) {
+	if enabled {
+		manager.missingKeys = &sync.Map{}
+	} else {
+		manager.missingKeys = nil
+	}
+}
+
+// Logs a read of an unset key, unless it was already logged.
+func (manager *Config) logMissingKey(key string) {
+	if manager.missingKeys == nil {
+		return
+	}
+
+	lowered := strings.ToLower(key)
+	if _, logged := manager.missingKeys.LoadOrStore(lowered, true); logged {
+		return
+	}
+
+	if file, line, ok := accessorCaller(); ok {
+		jww.WARN.Printf("Read of unset key %q at %s:%d", lowered, file, line)
+	} else {
+		jww.WARN.Printf("Read of unset key %q", lowered)
+	}
+}
+
+// Returns the first caller outside of this package.
+func accessorCaller() (string, int, bool) {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+
+	for {
+		frame, more := frames.Next()
+		if filepath.Dir(frame.File) != packageDir || strings.HasSuffix(frame.File, "_test.go") {
+			return frame.File, frame.Line, frame.File != ""
+		}
+		if !more {
+			return "", 0, false
+		}
+	}
+}
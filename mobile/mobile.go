@@ -0,0 +1,121 @@
+// Package mobile exposes a simplified facade over confer that can be bound
+// with gomobile for use from Android and iOS applications.
+//
+// gomobile can only bind a restricted set of types, so every method here
+// accepts and returns strings, numbers, booleans and errors. Structured values
+// cross the boundary as JSON documents.
+//
+//	gomobile bind -target=android github.com/jacobstr/confer/mobile
+package mobile
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jacobstr/confer"
+	"github.com/jacobstr/confer/maps"
+)
+
+// A binding-friendly wrapper around a confer.Config.
+type Config struct {
+	config *confer.Config
+}
+
+func NewConfig() *Config {
+	return &Config{config: confer.NewConfig()}
+}
+
+// Sets the root path used to resolve relative paths passed to ReadPath.
+func (c *Config) SetRootPath(path string) {
+	c.config.SetRootPath(path)
+}
+
+// Reads and merges a single configuration file.
+func (c *Config) ReadPath(path string) error {
+	return c.config.ReadPaths(path)
+}
+
+// Merges a JSON document into the configuration.
+func (c *Config) ReadJSON(doc string) error {
+	return c.config.ReadBytes([]byte(doc), "json")
+}
+
+// Merges a YAML document into the configuration.
+func (c *Config) ReadYAML(doc string) error {
+	return c.config.ReadBytes([]byte(doc), "yaml")
+}
+
+// Binds key to its corresponding environment variable.
+func (c *Config) BindEnv(key string) error {
+	return c.config.BindEnv(key)
+}
+
+func (c *Config) IsSet(key string) bool {
+	return c.config.IsSet(key)
+}
+
+func (c *Config) GetString(key string) string {
+	return c.config.GetString(key)
+}
+
+func (c *Config) GetInt(key string) int {
+	return c.config.GetInt(key)
+}
+
+func (c *Config) GetBool(key string) bool {
+	return c.config.GetBool(key)
+}
+
+func (c *Config) GetFloat64(key string) float64 {
+	return c.config.GetFloat64(key)
+}
+
+// Returns the value at key encoded as JSON. Absent keys encode as null.
+func (c *Config) GetJSON(key string) (string, error) {
+	return encode(c.config.Get(key))
+}
+
+func (c *Config) SetString(key string, value string) {
+	c.config.Set(key, value)
+}
+
+func (c *Config) SetInt(key string, value int) {
+	c.config.Set(key, value)
+}
+
+func (c *Config) SetBool(key string, value bool) {
+	c.config.Set(key, value)
+}
+
+func (c *Config) SetFloat64(key string, value float64) {
+	c.config.Set(key, value)
+}
+
+// Sets key to the value described by a JSON document, which may be a scalar,
+// array or object.
+func (c *Config) SetJSON(key string, value string) error {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return fmt.Errorf("Invalid JSON for %q: %v", key, err)
+	}
+	c.config.Set(key, decoded)
+	return nil
+}
+
+// Returns every key as a JSON array of strings.
+func (c *Config) AllKeysJSON() (string, error) {
+	return encode(c.config.AllKeys())
+}
+
+// Returns every leaf setting as a flat JSON object of key to value.
+func (c *Config) AllSettingsJSON() (string, error) {
+	return encode(c.config.AllSettings())
+}
+
+func encode(val interface{}) (string, error) {
+	out, err := json.Marshal(maps.Normalize(val))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
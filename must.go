@@ -0,0 +1,111 @@
+package confer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// Returns the string at key, panicking if it is unset. Intended for settings
+// the application can't start without, such as a database URL.
+func (manager *Config) MustGetString(key string) string {
+	val := manager.mustGet(key)
+	s, err := cast.ToStringE(val)
+	manager.mustConvert(key, val, err)
+	return s
+}
+
+// Returns the int at key, panicking if it is unset or not an int.
+func (manager *Config) MustGetInt(key string) int {
+	val := manager.mustGet(key)
+	i, err := cast.ToIntE(val)
+	manager.mustConvert(key, val, err)
+	return i
+}
+
+// Returns the float at key, panicking if it is unset or not a number.
+func (manager *Config) MustGetFloat64(key string) float64 {
+	val := manager.mustGet(key)
+	f, err := cast.ToFloat64E(val)
+	manager.mustConvert(key, val, err)
+	return f
+}
+
+// Returns the boolean at key, panicking if it is unset or can't be parsed by
+// the configured BoolParser.
+func (manager *Config) MustGetBool(key string) bool {
+	val := manager.mustGet(key)
+	b, err := manager.parseBool(val)
+	manager.mustConvert(key, val, err)
+	return b
+}
+
+// Returns the duration at key, panicking if it is unset or invalid.
+func (manager *Config) MustGetDuration(key string) time.Duration {
+	val := manager.mustGet(key)
+	d, err := cast.ToDurationE(val)
+	manager.mustConvert(key, val, err)
+	return d
+}
+
+// Returns the time at key, panicking if it is unset or invalid.
+func (manager *Config) MustGetTime(key string) time.Time {
+	val := manager.mustGet(key)
+	t, err := cast.ToTimeE(val)
+	manager.mustConvert(key, val, err)
+	return t
+}
+
+// Returns the list at key, panicking if it is unset.
+func (manager *Config) MustGetStringSlice(key string) []string {
+	val := manager.mustGet(key)
+	s, err := cast.ToStringSliceE(val)
+	manager.mustConvert(key, val, err)
+	return s
+}
+
+// Returns the map at key, panicking if it is unset or not a map.
+func (manager *Config) MustGetStringMap(key string) map[string]interface{} {
+	val := manager.mustGet(key)
+	if _, err := cast.ToStringMapE(val); err != nil {
+		manager.mustConvert(key, val, err)
+	}
+	return manager.GetStringMap(key)
+}
+
+func (manager *Config) mustGet(key string) interface{} {
+	val := manager.Get(key)
+	if val == nil {
+		panic(fmt.Sprintf("confer: required key %q is not set (searched %s)", key, manager.searchLocations(key)))
+	}
+	return val
+}
+
+func (manager *Config) mustConvert(key string, val interface{}, err error) {
+	if err != nil {
+		info, _ := manager.Provenance(key)
+		panic(fmt.Sprintf("confer: required key %q has invalid value %#v from %s: %v", key, val, describeOrigin(key, info), err))
+	}
+}
+
+// Describes where a value for key could have come from, for error messages.
+func (manager *Config) searchLocations(key string) string {
+	locations := []string{}
+
+	if flag, exists := manager.pflags.Flag(key); exists {
+		locations = append(locations, "flag --"+flag.Name)
+	}
+	if name, exists := manager.env.Variable(key); exists {
+		locations = append(locations, "environment variable "+name)
+	}
+
+	if len(manager.paths) > 0 {
+		locations = append(locations, "files "+strings.Join(manager.paths, ", "))
+	} else {
+		locations = append(locations, "no files")
+	}
+
+	return strings.Join(append(locations, "defaults"), "; ")
+}
@@ -0,0 +1,83 @@
+package confer
+
+import (
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/source"
+)
+
+// Controls whether Get, and the accessors built on it such as GetStringMap,
+// return deep copies of the maps and slices in the underlying data. Enabled
+// by default so that callers mutating the result can't corrupt the
+// configuration. Copies are made on every call rather than cached, as a
+// shared copy could itself be modified. Disable it on hot paths where the
+// result is known to be treated as read-only.
+func (manager *Config) SetCopyOnRead(enabled bool) {
+	manager.copyOnRead = enabled
+}
+
+// Enables a debug mode that panics when the overrides, attributes or defaults
+// are modified without going through the API, e.g. by mutating a map
+// returned from Get or one passed to Set.
+// Every write takes a deep copy of the data and every read compares against
+// it, so this is expensive and intended for tests and development only.
+func (manager *Config) SetMutationChecks(enabled bool) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if enabled {
+		manager.pristine = manager.copyTiers()
+	} else {
+		manager.pristine = nil
+	}
+	manager.mutationChecks = enabled
+}
+
+// Applies fn, a write to the tiers, under the write lock, then publishes the
+// result.
+func (manager *Config) write(fn func()) {
+	manager.mu.Lock()
+	fn()
+	manager.mu.Unlock()
+	manager.attributesChanged()
+}
+
+// Called after every write to the tiers made through the API, without holding
+// the lock.
+func (manager *Config) attributesChanged() {
+	manager.mu.Lock()
+	if manager.mutationChecks {
+		manager.pristine = manager.copyTiers()
+	}
+	manager.mu.Unlock()
+	manager.generation.Add(1)
+	manager.republish()
+}
+
+// Panics if the overrides, attributes or defaults no longer match the last
+// known copies. Requires the read lock.
+func (manager *Config) checkMutations() {
+	if !manager.mutationChecks {
+		return
+	}
+
+	for i, tier := range manager.storedTiers() {
+		if !maps.Equal(manager.pristine[i], tier.ToStringMap()) {
+			panic("confer: configuration data was modified outside of the API")
+		}
+	}
+}
+
+// Returns the tiers checked by SetMutationChecks.
+func (manager *Config) storedTiers() []*source.ConfigSource {
+	return []*source.ConfigSource{manager.overrides, manager.attributes, manager.defaults}
+}
+
+// Deep copies the data of the tiers checked by SetMutationChecks. Requires the
+// lock.
+func (manager *Config) copyTiers() []interface{} {
+	copies := []interface{}{}
+	for _, tier := range manager.storedTiers() {
+		copies = append(copies, maps.DeepCopy(tier.ToStringMap()))
+	}
+	return copies
+}
@@ -0,0 +1,261 @@
+package confer
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/reader"
+	"github.com/jacobstr/confer/remote/azblob"
+	"github.com/jacobstr/confer/remote/gcs"
+	"github.com/jacobstr/confer/remote/s3"
+)
+
+// Fetches configuration objects from a bucket based store such as S3, Cloud
+// Storage or Azure Blob Storage.
+type ObjectStore interface {
+	// Returns the contents and ETag of the object at key. If etag is
+	// non-empty and still current, returns nil data and the same ETag.
+	Fetch(bucket, key, etag string) (data []byte, newETag string, err error)
+}
+
+var (
+	objectStoresMu sync.RWMutex
+	objectStores   = map[string]ObjectStore{
+		"s3":     s3.New(s3.Options{}),
+		"gs":     gcs.New(gcs.Options{}),
+		"azblob": azblob.New(azblob.Options{}),
+	}
+)
+
+// Makes a store available to AddObjectSource under a URL scheme, replacing
+// any existing store for that scheme, e.g. to point s3:// at MinIO:
+//
+//	confer.RegisterObjectStore("s3", s3.New(s3.Options{
+//		Endpoint:  "http://minio:9000",
+//		PathStyle: true,
+//	}))
+//
+// Third party stores can register themselves from an init function, so
+// importing them for their side effects is enough:
+//
+//	import _ "example.com/confer-contrib/sources/consul"
+func RegisterObjectStore(scheme string, store ObjectStore) {
+	objectStoresMu.Lock()
+	defer objectStoresMu.Unlock()
+	objectStores[strings.ToLower(scheme)] = store
+}
+
+// Returns the URL schemes ReadRemote supports, sorted by name. These include
+// every object store AddObjectSource supports.
+func SupportedRemoteProviders() []string {
+	seen := map[string]bool{}
+
+	objectStoresMu.RLock()
+	for scheme := range objectStores {
+		seen[scheme] = true
+	}
+	objectStoresMu.RUnlock()
+
+	remoteProvidersMu.RLock()
+	for scheme := range remoteProviders {
+		seen[scheme] = true
+	}
+	remoteProvidersMu.RUnlock()
+
+	schemes := []string{}
+	for scheme := range seen {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+func objectStore(scheme string) (ObjectStore, bool) {
+	objectStoresMu.RLock()
+	defer objectStoresMu.RUnlock()
+	store, exists := objectStores[strings.ToLower(scheme)]
+	return store, exists
+}
+
+// A configuration object added with AddObjectSource.
+type objectSource struct {
+	url    string
+	store  ObjectStore
+	bucket string
+	key    string
+	etag   string
+	data   map[string]interface{}
+	stop   chan struct{}
+	sourceHealth
+}
+
+// Loads a configuration object from a store, e.g:
+//
+//	err := config.AddObjectSource("s3://my-bucket/app.yaml", time.Minute)
+//
+// s3://, gs:// (Cloud Storage) and azblob:// (Azure Blob Storage, addressing a
+// container) are supported out of the box; see RegisterObjectStore for
+// others. The object is merged on top of files read with ReadPaths, in the format
+// implied by its extension. With a positive interval the object is polled in
+// the background; when its ETag changes it goes through the same pipeline as
+// Reload, so pinned keys, restart-required keys and change handlers behave as
+// they do for files. Stop polling with StopObjectSources.
+func (manager *Config) AddObjectSource(rawurl string, interval time.Duration) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+
+	store, exists := objectStore(u.Scheme)
+	if !exists {
+		return fmt.Errorf("No object store registered for %s://", u.Scheme)
+	}
+
+	return manager.addObjectSource(&objectSource{
+		url:    rawurl,
+		store:  store,
+		bucket: u.Host,
+		key:    strings.TrimPrefix(u.Path, "/"),
+		stop:   make(chan struct{}),
+	}, interval)
+}
+
+// Fetches src, merges it and starts polling it.
+func (manager *Config) addObjectSource(src *objectSource, interval time.Duration) error {
+	if _, err := src.fetch(); err != nil {
+		return err
+	}
+	src.record(nil)
+
+	manager.addSource(func() {
+		manager.objectSources = append(manager.objectSources, src)
+	})
+
+	if interval > 0 {
+		go manager.pollObjectSource(src, interval)
+	}
+	return nil
+}
+
+// Stops polling every object source. Their last fetched contents remain in
+// effect.
+func (manager *Config) StopObjectSources() {
+	for _, src := range manager.objectSources {
+		select {
+		case <-src.stop:
+		default:
+			close(src.stop)
+		}
+	}
+}
+
+func (manager *Config) pollObjectSource(src *objectSource, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-src.stop:
+			return
+		case <-ticker.C:
+		}
+
+		manager.reloadMu.Lock()
+		changed, err := src.fetch()
+		manager.reloadMu.Unlock()
+		src.record(err)
+		if err != nil {
+			jww.ERROR.Println("Unable to refresh", src.url, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		jww.INFO.Println("Reloading changed object", src.url)
+		if _, err := manager.reload(func() []error {
+			return manager.rebuildAttributes(false)
+		}); err != nil {
+			jww.ERROR.Println(err)
+		}
+	}
+}
+
+// Fetches the object, reporting whether it changed since the last fetch.
+func (src *objectSource) fetch() (bool, error) {
+	data, etag, err := src.store.Fetch(src.bucket, src.key, src.etag)
+	if err != nil {
+		return false, err
+	}
+	if data == nil && src.data != nil {
+		return false, nil
+	}
+
+	format := reader.FormatOf(src.key)
+	if format == "" {
+		format = reader.Sniff(data)
+	}
+
+	loaded, err := reader.ReadBytes(data, format)
+	if err != nil {
+		return false, fmt.Errorf("Unable to parse %s: %v", src.url, err)
+	}
+
+	parsed := cast.ToStringMap(loaded)
+	maps.ToStringMapRecursive(parsed)
+
+	src.data, src.etag = parsed, etag
+	return true, nil
+}
+
+// Registers a source with add, which appends it to its list, and merges it
+// along with the others.
+func (manager *Config) addSource(add func()) {
+	manager.reloadMu.Lock()
+	defer manager.reloadMu.Unlock()
+
+	manager.mu.Lock()
+	add()
+	manager.mu.Unlock()
+	manager.mergeObjectSources()
+}
+
+// Merges the last fetched contents of every object source, then every
+// ZooKeeper, git and remote source, in the order they were added, on top of
+// the attributes. Requires reloadMu, which guards their contents.
+func (manager *Config) mergeObjectSources() {
+	if len(manager.objectSources) == 0 && len(manager.zooKeeperSources) == 0 && len(manager.gitSources) == 0 && len(manager.remoteSources) == 0 {
+		return
+	}
+
+	merged := manager.mergeSources(maps.DeepCopy(manager.attributes.ToStringMap()).(map[string]interface{}))
+	manager.write(func() {
+		manager.attributes.FromStringMap(merged)
+	})
+}
+
+// Merges the sources described in mergeObjectSources into merged, returning
+// the result. Requires reloadMu.
+func (manager *Config) mergeSources(merged map[string]interface{}) map[string]interface{} {
+	for _, src := range manager.objectSources {
+		merged = manager.mergeRemote(merged, src.url, src.data)
+	}
+	for _, src := range manager.zooKeeperSources {
+		merged = manager.mergeRemote(merged, src.path, src.data)
+	}
+	for _, src := range manager.gitSources {
+		merged = manager.mergeRemote(merged, src.repo, src.data)
+	}
+	for _, src := range manager.remoteSources {
+		merged = manager.mergeRemote(merged, src.url, src.data)
+	}
+	return merged
+}
@@ -0,0 +1,156 @@
+package confer
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// Builds an OpenAPI 3 schema object describing every key declared with
+// Define, nested by key, so platforms that document services with OpenAPI
+// can include their configuration contract:
+//
+//	schema := config.OpenAPISchema()
+//	// {"type": "object", "properties": {"app": {"type": "object", ...}}}
+//
+// Declared types, descriptions and defaults are carried over and required
+// keys are listed in `required`. Secrets are marked writeOnly and their
+// defaults omitted. Types OpenAPI lacks use a string with a format, e.g.
+// "duration" or "cron".
+func (manager *Config) OpenAPISchema() map[string]interface{} {
+	root := openAPIObject()
+
+	for _, spec := range manager.Schema() {
+		parts := strings.Split(strings.ToLower(spec.Key), ".")
+
+		parent := root
+		for _, part := range parts[:len(parts)-1] {
+			parent = openAPIChild(parent, part)
+		}
+
+		leaf := parts[len(parts)-1]
+		props := parent["properties"].(map[string]interface{})
+		schema := manager.openAPIProperty(spec)
+		if existing, ok := props[leaf].(map[string]interface{}); ok {
+			// Children were declared first; keep them.
+			for k, v := range schema {
+				if _, taken := existing[k]; !taken {
+					existing[k] = v
+				}
+			}
+		} else {
+			props[leaf] = schema
+		}
+
+		if spec.Required {
+			required, _ := parent["required"].([]string)
+			parent["required"] = append(required, leaf)
+		}
+	}
+
+	return root
+}
+
+// Writes OpenAPISchema to w as a components document, in the given format,
+// registered under name:
+//
+//	components:
+//	  schemas:
+//	    AppConfig: ...
+func (manager *Config) WriteOpenAPI(w io.Writer, name string, format string) error {
+	doc := map[string]interface{}{
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				name: manager.OpenAPISchema(),
+			},
+		},
+	}
+	return writeDocument(w, doc, format)
+}
+
+func (manager *Config) openAPIProperty(spec *KeySpec) map[string]interface{} {
+	schema := map[string]interface{}{}
+
+	switch spec.Type {
+	case TypeString:
+		schema["type"] = "string"
+	case TypeInt:
+		schema["type"] = "integer"
+	case TypeFloat:
+		schema["type"] = "number"
+	case TypeBool:
+		schema["type"] = "boolean"
+	case TypeDuration:
+		if spec.Unit != 0 {
+			schema["oneOf"] = []interface{}{
+				map[string]interface{}{"type": "string", "format": "duration"},
+				map[string]interface{}{"type": "number", "description": "A multiple of " + spec.Unit.String()},
+			}
+		} else {
+			schema["type"] = "string"
+			schema["format"] = "duration"
+		}
+	case TypeTime:
+		schema["type"] = "string"
+		schema["format"] = "date-time"
+	case TypeStringSlice:
+		schema["type"] = "array"
+		schema["items"] = map[string]interface{}{"type": "string"}
+	case TypeMap:
+		schema["type"] = "object"
+		schema["additionalProperties"] = true
+	case TypeCron:
+		schema["type"] = "string"
+		schema["format"] = "cron"
+	case TypeClockTime:
+		schema["type"] = "string"
+		schema["pattern"] = `^\d{1,2}:\d{2}$`
+	}
+
+	if spec.Description != "" {
+		schema["description"] = spec.Description
+	}
+
+	if manager.IsSecret(spec.Key) {
+		schema["writeOnly"] = true
+	} else if spec.Default != nil {
+		schema["default"] = openAPIValue(spec.Default)
+	}
+
+	return schema
+}
+
+// Returns the object schema for a nested key, creating it if needed.
+func openAPIChild(parent map[string]interface{}, name string) map[string]interface{} {
+	props := parent["properties"].(map[string]interface{})
+	child, ok := props[name].(map[string]interface{})
+	if !ok {
+		child = openAPIObject()
+		props[name] = child
+	}
+	if _, ok := child["properties"]; !ok {
+		child["type"] = "object"
+		child["properties"] = map[string]interface{}{}
+	}
+	return child
+}
+
+func openAPIObject() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+}
+
+// Converts a default into something every format can encode.
+func openAPIValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return maps.Normalize(val)
+}
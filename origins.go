@@ -0,0 +1,171 @@
+package confer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/reader"
+	"github.com/jacobstr/confer/source"
+)
+
+// Records path as the origin of every leaf in data, keeping a copy of data so
+// the file can be written back without flattening overlays.
+func (state *attributeState) recordOrigins(data map[string]interface{}, path string) {
+	state.fileData[path] = maps.DeepCopy(data).(map[string]interface{})
+	for key, val := range maps.Flatten(data) {
+		if val != nil {
+			state.origins[strings.ToLower(key)] = path
+		}
+	}
+}
+
+// Returns the file that supplied the value at key, as resolved by ReadPaths.
+// Values later changed with Set keep their origin, so an editing tool can
+// write them back where they came from. Keys not set by any file, e.g. those
+// only set with Set or SetDefault, have none.
+func (manager *Config) Origin(key string) (string, bool) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	path, exists := manager.origins[strings.ToLower(key)]
+	return path, exists
+}
+
+// Writes every file, flag and environment variable free setting to w in the
+// given format, merged as one document.
+func (manager *Config) WriteConfig(w io.Writer, format string) error {
+	return writeDocument(w, manager.selectSettings(func(key string) bool { return true }), format)
+}
+
+// Writes the contents of the file at path to w in the given format, or in the
+// format implied by path when format is empty. Settings whose origin is the
+// file are written with their current values, including changes made with
+// Set, and are dropped if they were Unset. Settings the file provides but
+// another file overrides keep the file's own value, so overlays aren't
+// flattened into it.
+func (manager *Config) WriteConfigFor(w io.Writer, path string, format string) error {
+	final_path := manager.resolvePath(path)
+	if format == "" {
+		format = manager.formatOf(final_path)
+	}
+
+	data, err := manager.fileDocument(final_path)
+	if err != nil {
+		return err
+	}
+	return writeDocument(w, data, format)
+}
+
+// Builds the document WriteConfigFor writes for the file at final_path.
+func (manager *Config) fileDocument(final_path string) (interface{}, error) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	contents, exists := manager.fileData[final_path]
+	if !exists {
+		return nil, fmt.Errorf("%s was not loaded", final_path)
+	}
+
+	flat := maps.Flatten(contents)
+	for key := range flat {
+		origin, exists := manager.origins[strings.ToLower(key)]
+		if !exists {
+			delete(flat, key)
+		} else if parent, ok := refParent(key); ok {
+			// References are kept as written unless the key they stand for was
+			// replaced with Set.
+			if val, exists := manager.overrides.Get(parent); exists && origin == final_path {
+				delete(flat, key)
+				flat[parent] = maps.Normalize(val)
+			}
+		} else if origin == final_path {
+			val, exists := manager.overrides.Get(key)
+			if !exists {
+				val, _ = manager.attributes.Get(key)
+			}
+			flat[key] = maps.Normalize(val)
+		}
+	}
+	doc := maps.Expand(flat)
+
+	// Files read with ReadPathsInto are written without their mount point.
+	var data interface{} = doc
+	if mount := manager.pathSpecs[final_path].Key; mount != "" {
+		mounted := source.NewConfigSource()
+		mounted.FromStringMap(doc)
+		data, _ = mounted.Get(mount)
+	}
+	return data, nil
+}
+
+// Returns the key a flattened reference leaf, e.g. app.cache.host.$ref,
+// stands for.
+func refParent(key string) (string, bool) {
+	if !strings.HasSuffix(key, "."+refKey) {
+		return "", false
+	}
+	return strings.TrimSuffix(key, "."+refKey), true
+}
+
+// Writes each file loaded by ReadPaths back to disk, containing only the
+// settings that originated from it, as WriteConfigFor. Files inside archives
+// can't be written.
+func (manager *Config) WriteConfigFiles() error {
+	manager.mu.RLock()
+	paths := append([]string(nil), manager.paths...)
+	manager.mu.RUnlock()
+
+	for _, final_path := range paths {
+		if _, _, ok := reader.SplitArchivePath(final_path); ok {
+			return fmt.Errorf("Unable to write %s, it is inside an archive", final_path)
+		}
+
+		var buf strings.Builder
+		if err := manager.WriteConfigFor(&buf, final_path, ""); err != nil {
+			return fmt.Errorf("Unable to write %s: %v", final_path, err)
+		}
+		if err := ioutil.WriteFile(final_path, []byte(buf.String()), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the overrides, attributes and defaults whose lower cased keys
+// satisfy include, as a nested map with their original casing.
+func (manager *Config) selectSettings(include func(key string) bool) map[string]interface{} {
+	selected := map[string]interface{}{}
+	for key, val := range maps.Flatten(manager.storedSettings()) {
+		if val != nil && include(strings.ToLower(key)) {
+			selected[key] = val
+		}
+	}
+	return maps.Expand(selected)
+}
+
+func writeDocument(w io.Writer, data interface{}, format string) error {
+	out, err := reader.Marshal(data, format)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+// The format of a configuration file, as readFile would determine it.
+func (manager *Config) formatOf(final_path string) string {
+	if spec, exists := manager.pathSpecs[final_path]; exists && spec.Format != "" {
+		return spec.Format
+	}
+	if format := reader.FormatOf(final_path); format != "" {
+		return format
+	}
+	if manager.configType != "" {
+		return manager.configType
+	}
+	return "yaml"
+}
@@ -0,0 +1,69 @@
+package confer
+
+import (
+	"path"
+	"path/filepath"
+)
+
+// Resolves a relative path held by a setting, given where the setting came
+// from. See SetPathResolver.
+type PathResolver func(value string, info SourceInfo) string
+
+// Replaces how GetPath and GetPathSlice resolve relative paths, e.g. to
+// resolve paths from the environment against an install directory:
+//
+//	config.SetPathResolver(func(value string, info confer.SourceInfo) string {
+//		if info.Layer == confer.LayerEnv {
+//			return filepath.Join(installDir, value)
+//		}
+//		return confer.ResolveRelativeToFile(value, info)
+//	})
+func (manager *Config) SetPathResolver(fn PathResolver) {
+	manager.pathResolver = fn
+}
+
+// Returns the path at key. A relative path read from a file is resolved
+// against that file's directory, so a bundle of configuration and assets can
+// be relocated as a whole:
+//
+//	# /etc/myapp/prod.yaml
+//	tls:
+//	  cert_file: certs/server.pem
+//
+//	config.GetPath("tls.cert_file") // "/etc/myapp/certs/server.pem"
+//
+// Paths from other layers, e.g. flags, are returned as is, relative to the
+// working directory. Returns "" if key is unset.
+func (manager *Config) GetPath(key string) string {
+	return manager.resolveSettingPath(key, manager.GetString(key))
+}
+
+// Returns the list of paths at key, each resolved as in GetPath.
+func (manager *Config) GetPathSlice(key string) []string {
+	paths := manager.GetStringSlice(key)
+	for i, p := range paths {
+		paths[i] = manager.resolveSettingPath(key, p)
+	}
+	return paths
+}
+
+func (manager *Config) resolveSettingPath(key string, value string) string {
+	if value == "" {
+		return value
+	}
+
+	info, _ := manager.Provenance(key)
+	if manager.pathResolver != nil {
+		return manager.pathResolver(value, info)
+	}
+	return ResolveRelativeToFile(value, info)
+}
+
+// The default PathResolver: resolves a relative path against the directory of
+// the file that supplied it, and returns any other path as is.
+func ResolveRelativeToFile(value string, info SourceInfo) string {
+	if info.Path == "" || filepath.IsAbs(value) {
+		return value
+	}
+	return path.Join(path.Dir(info.Path), value)
+}
@@ -0,0 +1,66 @@
+package confer
+
+// A configuration file along with how to read it.
+type PathSpec struct {
+	Path string
+	// The format of the file, for when its extension is missing or
+	// misleading, e.g. "yaml" for settings.conf.
+	Format string
+	// Rejects documents with duplicate keys rather than silently keeping the
+	// last occurrence. TOML documents are always strict.
+	Strict bool
+	// Whether a missing file is an error. Missing optional files are skipped.
+	Required bool
+	// Mounts the document beneath this key rather than at the root. Needed
+	// for documents whose root is a list.
+	Key string
+}
+
+// Like ReadPaths, but with options for each file:
+//
+//	err := config.ReadPathsWithOptions(
+//		confer.PathSpec{Path: "application.yaml", Strict: true, Required: true},
+//		confer.PathSpec{Path: "legacy.conf", Format: "toml"},
+//		confer.PathSpec{Path: "local.yaml"},
+//	)
+//
+// Note that, unlike ReadPaths, files are optional unless Required is set. The
+// options are remembered, so they apply again on Reload.
+func (manager *Config) ReadPathsWithOptions(specs ...PathSpec) error {
+	paths := []string{}
+	for _, spec := range specs {
+		manager.pathSpecs[manager.resolvePath(spec.Path)] = spec
+		paths = append(paths, spec.Path)
+	}
+	return manager.ReadPaths(paths...)
+}
+
+// Reports whether a resolved path was read with ReadPathsWithOptions and
+// isn't required.
+func (manager *Config) isOptional(final_path string) bool {
+	spec, exists := manager.pathSpecs[final_path]
+	return exists && !spec.Required
+}
+
+// Reads files whose contents belong beneath key, such as rule lists whose
+// root is an array rather than a map:
+//
+//	// rules.yaml
+//	- match: /admin
+//	  allow: [ops]
+//	- match: /
+//	  allow: ["*"]
+//
+//	err := config.ReadPathsInto("acl.rules", "rules.yaml")
+//	rules := config.Get("acl.rules").([]interface{})
+//
+// Documents whose root is a map are mounted beneath key as well. As with
+// ReadPaths, later files override earlier ones, so a later list replaces an
+// earlier one rather than being appended to it.
+func (manager *Config) ReadPathsInto(key string, paths ...string) error {
+	specs := []PathSpec{}
+	for _, p := range paths {
+		specs = append(specs, PathSpec{Path: p, Required: true, Key: key})
+	}
+	return manager.ReadPathsWithOptions(specs...)
+}
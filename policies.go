@@ -0,0 +1,55 @@
+package confer
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+
+	errors "github.com/jacobstr/confer/errors"
+)
+
+// Attaches a policy: a CEL expression that must evaluate to true. Policies
+// are checked with the other validators during ReadPaths, Reload and Validate,
+// e.g:
+//
+//	config.AddPolicy("production must not log debug output",
+//		"env != 'production' || app.logging.level != 'debug'")
+//	config.AddPolicy("production needs redundancy",
+//		"env != 'production' || replicas >= 2")
+//
+// Variables are exposed as in EvalKey. Use has() to guard optional keys, as a
+// reference to a missing key is reported as a violation. Returns an error if
+// the expression doesn't parse.
+func (manager *Config) AddPolicy(name, expression string) error {
+	env, err := cel.NewEnv()
+	if err != nil {
+		return err
+	}
+	if _, issues := env.Parse(expression); issues.Err() != nil {
+		return fmt.Errorf("Invalid policy %q: %v", name, issues.Err())
+	}
+
+	manager.AddValidator(func(manager *Config) error {
+		return manager.checkPolicy(name, expression)
+	})
+	return nil
+}
+
+func (manager *Config) checkPolicy(name, expression string) error {
+	prg, vars, err := manager.compileExpr(expression)
+	if err != nil {
+		return &errors.PolicyError{Policy: name, Reason: err.Error()}
+	}
+
+	out, err := manager.evalProgram(prg, vars)
+	if err != nil {
+		return &errors.PolicyError{Policy: name, Reason: err.Error()}
+	}
+
+	if ok, isBool := out.Value().(bool); !isBool {
+		return &errors.PolicyError{Policy: name, Reason: fmt.Sprintf("evaluated to %v, not a boolean", out.Value())}
+	} else if !ok {
+		return &errors.PolicyError{Policy: name}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package presets
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/jacobstr/confer"
+)
+
+// HTTP client settings, including retry policy and connection pooling.
+type Client struct {
+	Timeout             time.Duration `mapstructure:"timeout"`
+	Retries             int           `mapstructure:"retries"`
+	RetryBackoff        time.Duration `mapstructure:"retry_backoff"`
+	MaxRetryBackoff     time.Duration `mapstructure:"max_retry_backoff"`
+	MaxIdleConns        int           `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`
+	TLS                 TLS           `mapstructure:"tls"`
+}
+
+func DefaultClient() Client {
+	return Client{
+		Timeout:             30 * time.Second,
+		Retries:             3,
+		RetryBackoff:        100 * time.Millisecond,
+		MaxRetryBackoff:     5 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		TLS:                 DefaultTLS(),
+	}
+}
+
+// Registers the client defaults under prefix.
+func SetClientDefaults(config *confer.Config, prefix string) {
+	d := DefaultClient()
+	config.SetDefault(join(prefix, "timeout"), d.Timeout)
+	config.SetDefault(join(prefix, "retries"), d.Retries)
+	config.SetDefault(join(prefix, "retry_backoff"), d.RetryBackoff)
+	config.SetDefault(join(prefix, "max_retry_backoff"), d.MaxRetryBackoff)
+	config.SetDefault(join(prefix, "max_idle_conns"), d.MaxIdleConns)
+	config.SetDefault(join(prefix, "max_idle_conns_per_host"), d.MaxIdleConnsPerHost)
+	config.SetDefault(join(prefix, "idle_conn_timeout"), d.IdleConnTimeout)
+	config.SetDefault(join(prefix, "tls.enabled"), d.TLS.Enabled)
+	config.SetDefault(join(prefix, "tls.min_version"), d.TLS.MinVersion)
+}
+
+// Reads and validates client settings under prefix. Unset keys take their
+// default value; values that can't be parsed are reported as problems.
+func LoadClient(config *confer.Config, prefix string) (Client, error) {
+	d := DefaultClient()
+	v := &validator{}
+	c := Client{
+		Timeout:             durationAt(config, v, join(prefix, "timeout"), d.Timeout),
+		Retries:             intAt(config, v, join(prefix, "retries"), d.Retries),
+		RetryBackoff:        durationAt(config, v, join(prefix, "retry_backoff"), d.RetryBackoff),
+		MaxRetryBackoff:     durationAt(config, v, join(prefix, "max_retry_backoff"), d.MaxRetryBackoff),
+		MaxIdleConns:        intAt(config, v, join(prefix, "max_idle_conns"), d.MaxIdleConns),
+		MaxIdleConnsPerHost: intAt(config, v, join(prefix, "max_idle_conns_per_host"), d.MaxIdleConnsPerHost),
+		IdleConnTimeout:     durationAt(config, v, join(prefix, "idle_conn_timeout"), d.IdleConnTimeout),
+		TLS:                 loadTLS(config, v, join(prefix, "tls")),
+	}
+	c.validate(v)
+	return c, v.err()
+}
+
+func (c Client) Validate() error {
+	v := &validator{}
+	c.validate(v)
+	return v.err()
+}
+
+func (c Client) validate(v *validator) {
+	v.check(c.Timeout >= 0, "timeout must not be negative")
+	v.check(c.Retries >= 0, "retries must not be negative")
+	v.check(c.RetryBackoff >= 0, "retry_backoff must not be negative")
+	v.check(c.MaxRetryBackoff >= c.RetryBackoff, "max_retry_backoff must be at least retry_backoff")
+	v.check(c.MaxIdleConns >= 0, "max_idle_conns must not be negative")
+	v.check(c.MaxIdleConnsPerHost >= 0, "max_idle_conns_per_host must not be negative")
+	v.check(c.IdleConnTimeout >= 0, "idle_conn_timeout must not be negative")
+	c.TLS.validate(v, false)
+}
+
+// Returns the delay before the given retry attempt (starting at 1), doubling
+// RetryBackoff each attempt up to MaxRetryBackoff.
+func (c Client) Backoff(attempt int) time.Duration {
+	d := c.RetryBackoff
+	for i := 1; i < attempt && d < c.MaxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > c.MaxRetryBackoff {
+		d = c.MaxRetryBackoff
+	}
+	return d
+}
+
+// Builds an *http.Client from the settings. Retries are left to the caller,
+// see Backoff.
+func (c Client) HTTPClient() (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        c.MaxIdleConns,
+		MaxIdleConnsPerHost: c.MaxIdleConnsPerHost,
+		IdleConnTimeout:     c.IdleConnTimeout,
+	}
+
+	if c.TLS.Enabled {
+		version, err := tlsVersion(c.TLS.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{MinVersion: version}
+
+		if c.TLS.CAFile != "" {
+			pem, err := ioutil.ReadFile(c.TLS.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("No certificates found in %s", c.TLS.CAFile)
+			}
+			transport.TLSClientConfig.RootCAs = pool
+		}
+
+		if c.TLS.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	return &http.Client{Timeout: c.Timeout, Transport: transport}, nil
+}
@@ -0,0 +1,71 @@
+package presets
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jacobstr/confer"
+)
+
+// Connection pool settings, e.g. for database/sql.
+type Pool struct {
+	MaxOpen         int           `mapstructure:"max_open"`
+	MaxIdle         int           `mapstructure:"max_idle"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+}
+
+func DefaultPool() Pool {
+	return Pool{
+		MaxOpen:         25,
+		MaxIdle:         5,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+	}
+}
+
+// Registers the pool defaults under prefix.
+func SetPoolDefaults(config *confer.Config, prefix string) {
+	d := DefaultPool()
+	config.SetDefault(join(prefix, "max_open"), d.MaxOpen)
+	config.SetDefault(join(prefix, "max_idle"), d.MaxIdle)
+	config.SetDefault(join(prefix, "conn_max_lifetime"), d.ConnMaxLifetime)
+	config.SetDefault(join(prefix, "conn_max_idle_time"), d.ConnMaxIdleTime)
+}
+
+// Reads and validates pool settings under prefix. Unset keys take their
+// default value; values that can't be parsed are reported as problems.
+func LoadPool(config *confer.Config, prefix string) (Pool, error) {
+	d := DefaultPool()
+	v := &validator{}
+	p := Pool{
+		MaxOpen:         intAt(config, v, join(prefix, "max_open"), d.MaxOpen),
+		MaxIdle:         intAt(config, v, join(prefix, "max_idle"), d.MaxIdle),
+		ConnMaxLifetime: durationAt(config, v, join(prefix, "conn_max_lifetime"), d.ConnMaxLifetime),
+		ConnMaxIdleTime: durationAt(config, v, join(prefix, "conn_max_idle_time"), d.ConnMaxIdleTime),
+	}
+	p.validate(v)
+	return p, v.err()
+}
+
+func (p Pool) Validate() error {
+	v := &validator{}
+	p.validate(v)
+	return v.err()
+}
+
+func (p Pool) validate(v *validator) {
+	v.check(p.MaxOpen >= 0, "max_open must not be negative")
+	v.check(p.MaxIdle >= 0, "max_idle must not be negative")
+	v.check(p.MaxOpen == 0 || p.MaxIdle <= p.MaxOpen, "max_idle must not exceed max_open")
+	v.check(p.ConnMaxLifetime >= 0, "conn_max_lifetime must not be negative")
+	v.check(p.ConnMaxIdleTime >= 0, "conn_max_idle_time must not be negative")
+}
+
+// Applies the settings to a database/sql connection pool.
+func (p Pool) Apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpen)
+	db.SetMaxIdleConns(p.MaxIdle)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
@@ -0,0 +1,140 @@
+// Package presets provides reusable settings structs for common components,
+// along with conventional key names, sane defaults and validation.
+//
+// Each preset reads from a subtree of the configuration, e.g. with a prefix of
+// "server":
+//
+//	server:
+//	  addr: ":8080"
+//	  read_timeout: 5s
+//	  tls:
+//	    enabled: true
+//	    cert_file: /etc/myapp/server.pem
+//	    key_file: /etc/myapp/server.key
+//
+//	srv, err := presets.LoadServer(config, "server")
+package presets
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacobstr/confer"
+	"github.com/spf13/cast"
+)
+
+// Joins a prefix and key into a materialized path.
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// The helpers below return fallback when key is unset, and record a problem
+// with v, returning fallback, when its value can't be parsed, so typos aren't
+// silently read as zero.
+
+func durationAt(config *confer.Config, v *validator, key string, fallback time.Duration) time.Duration {
+	if !config.IsSet(key) {
+		return fallback
+	}
+	if n, ok := bareNumber(config.Get(key)); ok {
+		if n != 0 {
+			v.fail(fmt.Sprintf("%s needs a unit, e.g. 30s", key))
+			return fallback
+		}
+		return 0
+	}
+	d, err := config.GetDurationE(key)
+	if err != nil {
+		v.fail(err.Error())
+		return fallback
+	}
+	return d
+}
+
+// Returns val if it is a number without a unit. Only zero is a meaningful
+// duration without one.
+func bareNumber(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return cast.ToFloat64(v), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func intAt(config *confer.Config, v *validator, key string, fallback int) int {
+	if !config.IsSet(key) {
+		return fallback
+	}
+	i, err := config.GetIntE(key)
+	if err != nil {
+		v.fail(err.Error())
+		return fallback
+	}
+	return i
+}
+
+func stringAt(config *confer.Config, v *validator, key string, fallback string) string {
+	if !config.IsSet(key) {
+		return fallback
+	}
+	s, err := config.GetStringE(key)
+	if err != nil {
+		v.fail(err.Error())
+		return fallback
+	}
+	return s
+}
+
+func boolAt(config *confer.Config, v *validator, key string, fallback bool) bool {
+	if !config.IsSet(key) {
+		return fallback
+	}
+	b, err := config.GetBoolE(key)
+	if err != nil {
+		v.fail(err.Error())
+		return fallback
+	}
+	return b
+}
+
+// Accumulates validation failures so they can be reported together.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	msg := "Invalid settings:"
+	for _, p := range e.Problems {
+		msg += " " + p + ";"
+	}
+	return msg
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, problem string) {
+	if !ok {
+		v.fail(problem)
+	}
+}
+
+func (v *validator) fail(problem string) {
+	v.problems = append(v.problems, problem)
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
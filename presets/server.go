@@ -0,0 +1,192 @@
+package presets
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jacobstr/confer"
+)
+
+// HTTP server settings.
+type Server struct {
+	Addr              string        `mapstructure:"addr"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout"`
+	ShutdownTimeout   time.Duration `mapstructure:"shutdown_timeout"`
+	MaxHeaderBytes    int           `mapstructure:"max_header_bytes"`
+	MaxBodyBytes      int           `mapstructure:"max_body_bytes"`
+	TLS               TLS           `mapstructure:"tls"`
+}
+
+// TLS settings shared by servers and clients.
+type TLS struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	CAFile     string `mapstructure:"ca_file"`
+	MinVersion string `mapstructure:"min_version"`
+}
+
+// Conservative defaults that guard against slow clients.
+func DefaultServer() Server {
+	return Server{
+		Addr:              ":8080",
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		MaxBodyBytes:      10 << 20,
+		TLS:               DefaultTLS(),
+	}
+}
+
+func DefaultTLS() TLS {
+	return TLS{MinVersion: "1.2"}
+}
+
+// Registers the server defaults under prefix.
+func SetServerDefaults(config *confer.Config, prefix string) {
+	d := DefaultServer()
+	config.SetDefault(join(prefix, "addr"), d.Addr)
+	config.SetDefault(join(prefix, "read_timeout"), d.ReadTimeout)
+	config.SetDefault(join(prefix, "read_header_timeout"), d.ReadHeaderTimeout)
+	config.SetDefault(join(prefix, "write_timeout"), d.WriteTimeout)
+	config.SetDefault(join(prefix, "idle_timeout"), d.IdleTimeout)
+	config.SetDefault(join(prefix, "shutdown_timeout"), d.ShutdownTimeout)
+	config.SetDefault(join(prefix, "max_header_bytes"), d.MaxHeaderBytes)
+	config.SetDefault(join(prefix, "max_body_bytes"), d.MaxBodyBytes)
+	config.SetDefault(join(prefix, "tls.enabled"), d.TLS.Enabled)
+	config.SetDefault(join(prefix, "tls.min_version"), d.TLS.MinVersion)
+}
+
+// Reads and validates server settings under prefix. Unset keys take their
+// default value; values that can't be parsed are reported as problems.
+func LoadServer(config *confer.Config, prefix string) (Server, error) {
+	d := DefaultServer()
+	v := &validator{}
+	s := Server{
+		Addr:              stringAt(config, v, join(prefix, "addr"), d.Addr),
+		ReadTimeout:       durationAt(config, v, join(prefix, "read_timeout"), d.ReadTimeout),
+		ReadHeaderTimeout: durationAt(config, v, join(prefix, "read_header_timeout"), d.ReadHeaderTimeout),
+		WriteTimeout:      durationAt(config, v, join(prefix, "write_timeout"), d.WriteTimeout),
+		IdleTimeout:       durationAt(config, v, join(prefix, "idle_timeout"), d.IdleTimeout),
+		ShutdownTimeout:   durationAt(config, v, join(prefix, "shutdown_timeout"), d.ShutdownTimeout),
+		MaxHeaderBytes:    intAt(config, v, join(prefix, "max_header_bytes"), d.MaxHeaderBytes),
+		MaxBodyBytes:      intAt(config, v, join(prefix, "max_body_bytes"), d.MaxBodyBytes),
+		TLS:               loadTLS(config, v, join(prefix, "tls")),
+	}
+	s.validate(v)
+	return s, v.err()
+}
+
+func loadTLS(config *confer.Config, v *validator, prefix string) TLS {
+	d := DefaultTLS()
+	return TLS{
+		Enabled:    boolAt(config, v, join(prefix, "enabled"), d.Enabled),
+		CertFile:   stringAt(config, v, join(prefix, "cert_file"), d.CertFile),
+		KeyFile:    stringAt(config, v, join(prefix, "key_file"), d.KeyFile),
+		CAFile:     stringAt(config, v, join(prefix, "ca_file"), d.CAFile),
+		MinVersion: stringAt(config, v, join(prefix, "min_version"), d.MinVersion),
+	}
+}
+
+func (s Server) Validate() error {
+	v := &validator{}
+	s.validate(v)
+	return v.err()
+}
+
+func (s Server) validate(v *validator) {
+	v.check(s.Addr != "", "addr must be set")
+	v.check(s.ReadTimeout >= 0, "read_timeout must not be negative")
+	v.check(s.ReadHeaderTimeout >= 0, "read_header_timeout must not be negative")
+	v.check(s.WriteTimeout >= 0, "write_timeout must not be negative")
+	v.check(s.IdleTimeout >= 0, "idle_timeout must not be negative")
+	v.check(s.ShutdownTimeout >= 0, "shutdown_timeout must not be negative")
+	v.check(s.MaxHeaderBytes > 0, "max_header_bytes must be positive")
+	v.check(s.MaxBodyBytes >= 0, "max_body_bytes must not be negative")
+	s.TLS.validate(v, true)
+}
+
+func (t TLS) validate(v *validator, server bool) {
+	if !t.Enabled {
+		return
+	}
+	if server {
+		v.check(t.CertFile != "", "tls.cert_file must be set when tls is enabled")
+		v.check(t.KeyFile != "", "tls.key_file must be set when tls is enabled")
+	}
+	_, err := tlsVersion(t.MinVersion)
+	v.check(err == nil, fmt.Sprintf("tls.min_version %q is not one of 1.0, 1.1, 1.2, 1.3", t.MinVersion))
+}
+
+func tlsVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("Unknown TLS version %q", version)
+}
+
+// Builds a *tls.Config for the settings, or nil when TLS is disabled.
+// Certificates are loaded from CertFile and KeyFile.
+func (t TLS) Config() (*tls.Config, error) {
+	if !t.Enabled {
+		return nil, nil
+	}
+
+	version, err := tlsVersion(t.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{MinVersion: version}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Builds an *http.Server from the settings. Request bodies are limited to
+// MaxBodyBytes when it is non-zero.
+func (s Server) HTTPServer(handler http.Handler) (*http.Server, error) {
+	tlsConfig, err := s.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.MaxBodyBytes > 0 {
+		inner, limit := handler, int64(s.MaxBodyBytes)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			inner.ServeHTTP(w, r)
+		})
+	}
+
+	return &http.Server{
+		Addr:              s.Addr,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadTimeout:       s.ReadTimeout,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		MaxHeaderBytes:    s.MaxHeaderBytes,
+	}, nil
+}
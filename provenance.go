@@ -0,0 +1,153 @@
+package confer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Describes where a value came from, as reported by Provenance.
+type SourceInfo struct {
+	// The layer that supplied the value, e.g. LayerEnv, or the name of a
+	// source added with AddSource.
+	Layer string
+
+	// The flag or environment variable that supplied the value, for LayerFlags
+	// and LayerEnv.
+	Name string
+
+	// The file that supplied the value, for LayerAttributes. Empty for values
+	// that didn't come from a file, e.g. those merged with MergeAttributes.
+	Path string
+}
+
+// Reports which source supplied the value Get returns for key, answering
+// "where is this value coming from?":
+//
+//	info, _ := config.Provenance("app.database.host")
+//	// {Layer: "env", Name: "APP_DATABASE_HOST"}
+//
+// Sections are attributed to the highest precedence layer providing part of
+// them. Returns false if key is unset.
+func (manager *Config) Provenance(key string) (SourceInfo, bool) {
+	for _, layer := range manager.precedence {
+		switch layer {
+		case LayerFlags:
+			if _, exists := manager.pflags.Get(key); exists {
+				flag, _ := manager.pflags.Flag(key)
+				return SourceInfo{Layer: layer, Name: flag.Name}, true
+			}
+		case LayerFlagDefaults:
+			if _, exists := manager.pflags.GetDefault(key); exists {
+				flag, _ := manager.pflags.Flag(key)
+				return SourceInfo{Layer: layer, Name: flag.Name}, true
+			}
+		case LayerEnv:
+			if _, name, exists := manager.env.Lookup(key); exists {
+				return SourceInfo{Layer: layer, Name: name}, true
+			}
+		case LayerAttributes:
+			if _, exists := manager.attributes.Get(key); exists {
+				return SourceInfo{Layer: layer, Path: manager.origins[strings.ToLower(key)]}, true
+			}
+		default:
+			if _, exists := manager.lookupLayer(layer, key); exists {
+				return SourceInfo{Layer: layer}, true
+			}
+		}
+	}
+	return SourceInfo{}, false
+}
+
+// The value a single layer holds for a key, as reported by Explain.
+type LayerValue struct {
+	Layer string
+	// The flag, environment variable or file behind the layer, where known.
+	Source SourceInfo
+	// The value the layer would produce, or nil if it has none.
+	Value interface{}
+	// Whether the layer provides a value.
+	Set bool
+}
+
+// How a key was resolved, as reported by Explain.
+type Explanation struct {
+	Key string
+	// The value Get returns.
+	Value interface{}
+	// The layer that supplied Value, or empty if the key is unset.
+	Winner string
+	// Every layer, highest precedence first.
+	Layers []LayerValue
+}
+
+// Reports the value each layer holds for key and which one won, so operators
+// can see that a file sets `workers: 4` but an environment variable overrode
+// it to 16:
+//
+//	fmt.Print(config.Explain("app.workers"))
+//	// app.workers = 16 (from env)
+//	//   flags: unset
+//	//   overrides: unset
+//	// * env (APP_WORKERS): 16
+//	//   attributes (application.yaml): 4
+//	//   defaults: unset
+func (manager *Config) Explain(key string) Explanation {
+	explanation := Explanation{Key: key, Value: manager.Get(key)}
+	if info, exists := manager.Provenance(key); exists {
+		explanation.Winner = info.Layer
+	}
+
+	lowered := strings.ToLower(key)
+	for _, layer := range manager.precedence {
+		lv := LayerValue{Layer: layer, Source: SourceInfo{Layer: layer}}
+
+		switch layer {
+		case LayerFlags, LayerFlagDefaults:
+			if flag, exists := manager.pflags.Flag(key); exists {
+				lv.Source.Name = flag.Name
+			}
+		case LayerEnv:
+			if _, name, exists := manager.env.Lookup(key); exists {
+				lv.Source.Name = name
+			} else if name, exists := manager.env.Variable(key); exists {
+				lv.Source.Name = name
+			}
+		case LayerAttributes:
+			lv.Source.Path = manager.origins[lowered]
+		}
+
+		if val, exists := manager.lookupLayer(layer, key); exists {
+			lv.Value, lv.Set = manager.coerce(val), true
+		}
+		explanation.Layers = append(explanation.Layers, lv)
+	}
+	return explanation
+}
+
+func (e Explanation) String() string {
+	var b strings.Builder
+	if e.Winner == "" {
+		fmt.Fprintf(&b, "%s is unset\n", e.Key)
+	} else {
+		fmt.Fprintf(&b, "%s = %v (from %s)\n", e.Key, e.Value, e.Winner)
+	}
+
+	for _, lv := range e.Layers {
+		marker := "  "
+		if lv.Layer == e.Winner {
+			marker = "* "
+		}
+
+		name := lv.Layer
+		if detail := lv.Source.Name + lv.Source.Path; detail != "" {
+			name += " (" + detail + ")"
+		}
+
+		if lv.Set {
+			fmt.Fprintf(&b, "%s%s: %v\n", marker, name, lv.Value)
+		} else {
+			fmt.Fprintf(&b, "%s%s: unset\n", marker, name)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package confer
+
+import (
+	"sort"
+	"strings"
+
+	jww "github.com/spf13/jwalterweatherman"
+
+	errors "github.com/jacobstr/confer/errors"
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/source"
+)
+
+// A setting withheld from a reload because it failed validation.
+type QuarantinedKey struct {
+	Key string
+	Err error
+}
+
+// Enables a mode where a reload failing validation only withholds the
+// offending settings rather than being rolled back as a whole. Each setting
+// named by an InvalidValueError or WeightError keeps its last known good
+// value, or is removed if it had none so a default applies, while the rest of
+// the new configuration takes effect. Useful for large files shared between
+// teams, where one team's mistake shouldn't block everyone else's changes.
+//
+// Withheld settings are listed in ReloadReport.Quarantined and by
+// Quarantined. Failures that can't be attributed to a key, such as those
+// from policies, still roll back the whole reload.
+func (manager *Config) SetQuarantine(enabled bool) {
+	manager.quarantineEnabled = enabled
+}
+
+// Returns the settings withheld by the last reload, sorted by key.
+func (manager *Config) Quarantined() []QuarantinedKey {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return append([]QuarantinedKey{}, manager.quarantined...)
+}
+
+// Restores the settings named by invalid to their saved values. Reports
+// false, leaving the attributes partially restored, if a failure can't be
+// attributed to a key or the result is still invalid.
+func (manager *Config) quarantine(saved *attributeState, invalid []error) ([]QuarantinedKey, bool) {
+	quarantined := []QuarantinedKey{}
+	for _, err := range invalid {
+		key := invalidKey(err)
+		if key == "" || manager.attributes.Shape(key) != nil {
+			return nil, false
+		}
+		quarantined = append(quarantined, QuarantinedKey{Key: key, Err: err})
+	}
+
+	previous := source.NewConfigSource()
+	previous.FromStringMap(saved.data)
+
+	manager.write(func() {
+		for _, q := range quarantined {
+			jww.WARN.Println("Quarantined invalid setting", q.Key, q.Err)
+
+			if val, exists := previous.Get(q.Key); exists && val != nil {
+				manager.attributes.Set(q.Key, maps.DeepCopy(val))
+			} else {
+				manager.attributes.Unset(q.Key)
+			}
+
+			lowered := strings.ToLower(q.Key)
+			for key := range manager.origins {
+				if key == lowered || strings.HasPrefix(key, lowered+".") {
+					delete(manager.origins, key)
+				}
+			}
+			for key, origin := range saved.origins {
+				if key == lowered || strings.HasPrefix(key, lowered+".") {
+					manager.origins[key] = origin
+				}
+			}
+		}
+	})
+
+	if len(manager.validate(false)) > 0 {
+		return nil, false
+	}
+
+	sort.Sort(quarantinedByKey(quarantined))
+	return quarantined, true
+}
+
+// The key a validation failure refers to, if any.
+func invalidKey(err error) string {
+	switch e := err.(type) {
+	case *errors.InvalidValueError:
+		return e.Key
+	case *errors.WeightError:
+		return e.Key
+	}
+	return ""
+}
+
+type quarantinedByKey []QuarantinedKey
+
+func (q quarantinedByKey) Len() int           { return len(q) }
+func (q quarantinedByKey) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q quarantinedByKey) Less(i, j int) bool { return q[i].Key < q[j].Key }
@@ -0,0 +1,154 @@
+package confer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	jww "github.com/spf13/jwalterweatherman"
+
+	errors "github.com/jacobstr/confer/errors"
+	"github.com/jacobstr/confer/maps"
+)
+
+// Limits on the values remote sources may provide, so a corrupted or
+// malicious entry can't balloon memory or reshape the configuration
+// unnoticed. Zero fields impose no limit.
+type RemoteQuota struct {
+	// The largest value a single key may hold, in bytes as estimated by
+	// Stats. Lists count as one value.
+	MaxValueBytes int
+	// How deeply sections may nest, e.g. 2 allows app.port but not
+	// app.database.port.
+	MaxDepth int
+	// Rejects values that change kind, e.g. a scalar turning into a section
+	// or list, compared with the value in effect and any type declared with
+	// Define.
+	KeepTypes bool
+}
+
+// Guards every remote source, including object, ZooKeeper and git sources,
+// with quota:
+//
+//	config.SetRemoteQuota(confer.RemoteQuota{MaxValueBytes: 64 << 10, MaxDepth: 8, KeepTypes: true})
+//
+// A value violating the quota is withheld, keeping the value in effect, and
+// OnQuarantine handlers are notified with a QuotaError.
+func (manager *Config) SetRemoteQuota(quota RemoteQuota) {
+	manager.remoteQuota = quota
+}
+
+// Registers a handler invoked for each setting withheld, whether by a reload
+// in quarantine mode or by a RemoteQuota.
+func (manager *Config) OnQuarantine(fn func(QuarantinedKey)) {
+	manager.quarantineHandlers = append(manager.quarantineHandlers, fn)
+}
+
+func (manager *Config) notifyQuarantined(quarantined []QuarantinedKey) {
+	for _, q := range quarantined {
+		for _, fn := range manager.quarantineHandlers {
+			fn(q)
+		}
+	}
+}
+
+// Merges a copy of the document fetched from a remote source onto merged,
+// withholding values that violate the quota.
+func (manager *Config) mergeRemote(merged map[string]interface{}, from string, data map[string]interface{}) map[string]interface{} {
+	doc := maps.DeepCopy(data).(map[string]interface{})
+
+	violations := []QuarantinedKey{}
+	manager.enforceQuota(from, "", doc, merged, &violations)
+	for _, q := range violations {
+		jww.WARN.Println("Withheld remote setting", q.Key, q.Err)
+	}
+	manager.notifyQuarantined(violations)
+
+	return maps.Merge(merged, doc)
+}
+
+// Removes the children of doc at prefix violating the quota. existing holds
+// the values currently in effect at the same level.
+func (manager *Config) enforceQuota(from string, prefix string, doc map[string]interface{}, existing map[string]interface{}, violations *[]QuarantinedKey) {
+	quota := manager.remoteQuota
+	depth := strings.Count(prefix, ".") + 1
+	if prefix == "" {
+		depth = 0
+	}
+
+	for name, val := range doc {
+		key := strings.TrimPrefix(prefix+"."+name, ".")
+		current := lookupFold(existing, name)
+
+		msg := ""
+		child, isSection := val.(map[string]interface{})
+		switch {
+		case quota.KeepTypes && current != nil && valueKind(current) != valueKind(val):
+			msg = fmt.Sprintf("changes a %s into a %s", valueKind(current), valueKind(val))
+		case quota.KeepTypes && !manager.kindAllowed(key, val):
+			msg = fmt.Sprintf("is a %s, but declared as %s", valueKind(val), manager.schema[strings.ToLower(key)].Type)
+		case isSection && quota.MaxDepth > 0 && depth+1 >= quota.MaxDepth:
+			msg = fmt.Sprintf("nests deeper than %d levels", quota.MaxDepth)
+		case !isSection && quota.MaxValueBytes > 0 && estimateSize(val) > quota.MaxValueBytes:
+			msg = fmt.Sprintf("exceeds %d bytes", quota.MaxValueBytes)
+		}
+
+		if msg != "" {
+			delete(doc, name)
+			*violations = append(*violations, QuarantinedKey{
+				Key: key,
+				Err: &errors.QuotaError{Source: from, Key: key, Msg: msg},
+			})
+			continue
+		}
+
+		if isSection {
+			section, _ := current.(map[string]interface{})
+			manager.enforceQuota(from, key, child, section, violations)
+		}
+	}
+}
+
+// Reports whether val suits the type key was declared with, if any.
+func (manager *Config) kindAllowed(key string, val interface{}) bool {
+	spec, exists := manager.schema[strings.ToLower(key)]
+	if !exists {
+		return true
+	}
+
+	switch spec.Type {
+	case TypeAny:
+		return true
+	case TypeMap:
+		return valueKind(val) == "section"
+	case TypeStringSlice:
+		return valueKind(val) != "section"
+	}
+	return valueKind(val) == "scalar"
+}
+
+// Describes the shape of a value: a section, a list or a scalar.
+func valueKind(val interface{}) string {
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Map:
+		return "section"
+	case reflect.Slice, reflect.Array:
+		if _, isBytes := val.([]byte); !isBytes {
+			return "list"
+		}
+	}
+	return "scalar"
+}
+
+// Returns the value of a key in m, ignoring case.
+func lookupFold(m map[string]interface{}, name string) interface{} {
+	if val, exists := m[name]; exists {
+		return val
+	}
+	for key, val := range m {
+		if strings.EqualFold(key, name) {
+			return val
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package confer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/spf13/cast"
+
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/reader"
+)
+
+// Parses and merges a configuration document held in memory into the
+// attributes tier. Useful where there is no file system to read from, e.g.
+// a JSON blob handed to a js/wasm module by the page that embeds it.
+func (manager *Config) ReadBytes(data []byte, format string) error {
+	loaded, err := reader.ReadBytes(data, format)
+	if err != nil {
+		return err
+	}
+
+	coerced := cast.ToStringMap(loaded)
+	maps.ToStringMapRecursive(coerced)
+
+	manager.write(func() {
+		manager.recordDocument(attributeDocument{data: maps.DeepCopy(coerced).(map[string]interface{})})
+		manager.attributes.FromStringMap(
+			maps.Merge(maps.DeepCopy(manager.attributes.ToStringMap()).(map[string]interface{}), coerced),
+		)
+	})
+	return nil
+}
+
+// Fetches a configuration document over HTTP(S) and merges it into the
+// attributes tier. Under js/wasm requests are made with the browser's fetch
+// API. The format is taken from the URL's extension, then the response's
+// Content-Type, and finally defaults to json.
+func (manager *Config) ReadURL(rawurl string) error {
+	resp, err := http.Get(rawurl)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to fetch %s: %s", rawurl, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return manager.ReadBytes(data, urlFormat(rawurl, resp.Header.Get("Content-Type")))
+}
+
+// Guesses the format of a remote document.
+func urlFormat(rawurl string, contentType string) string {
+	if u, err := url.Parse(rawurl); err == nil {
+		switch path.Ext(u.Path) {
+		case ".yaml", ".yml":
+			return "yaml"
+		case ".json":
+			return "json"
+		case ".toml":
+			return "toml"
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-yaml", "application/yaml", "text/yaml", "text/x-yaml":
+		return "yaml"
+	case "application/toml", "text/x-toml":
+		return "toml"
+	}
+
+	return "json"
+}
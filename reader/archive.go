@@ -0,0 +1,154 @@
+package reader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// Archive formats, by extension.
+var archiveExts = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
+// Reads files from within zip and tar archives, delegating all other paths to
+// Base. Files inside an archive are addressed by joining the archive path and
+// the entry path with `//`, e.g:
+//
+//	configs.tar.gz//app/application.yaml
+//
+// A single slash works too, as path cleaning collapses the double slash.
+type ArchiveFileSystem struct {
+	Base FileSystem
+}
+
+func (a ArchiveFileSystem) ReadFile(p string) ([]byte, error) {
+	archive, entry, ok := SplitArchivePath(p)
+	if !ok {
+		return a.Base.ReadFile(p)
+	}
+
+	files, err := OpenArchive(a.Base, archive)
+	if err != nil {
+		return nil, err
+	}
+	return files.ReadFile(entry)
+}
+
+// Splits a path into the archive and the entry within it, reporting whether
+// the path refers to an archive entry at all.
+func SplitArchivePath(p string) (archive string, entry string, ok bool) {
+	segments := strings.Split(p, "/")
+
+	for i, segment := range segments[:len(segments)-1] {
+		if archiveExt(segment) == "" {
+			continue
+		}
+
+		archive = strings.Join(segments[:i+1], "/")
+		entry = path.Clean(strings.Join(segments[i+1:], "/"))
+		entry = strings.TrimPrefix(entry, "/")
+		return archive, entry, entry != "" && entry != "."
+	}
+
+	return "", "", false
+}
+
+func archiveExt(name string) string {
+	lowered := strings.ToLower(name)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(lowered, ext) && len(lowered) > len(ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// Reads every regular file in a zip or tar (optionally gzipped) archive into
+// memory, keyed by its cleaned path within the archive.
+func OpenArchive(fs FileSystem, archive string) (MapFileSystem, error) {
+	data, err := fs.ReadFile(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	var files MapFileSystem
+	switch archiveExt(path.Base(archive)) {
+	case ".zip":
+		files, err = readZip(data)
+	case ".tar.gz", ".tgz":
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			files, err = readTar(gz)
+		}
+	case ".tar":
+		files, err = readTar(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("%s is not a supported archive", archive)
+	}
+
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: archive, Err: err}
+	}
+	return files, nil
+}
+
+func readZip(data []byte) (MapFileSystem, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := MapFileSystem{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		contents, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[entryName(f.Name)] = contents
+	}
+	return files, nil
+}
+
+func readTar(r io.Reader) (MapFileSystem, error) {
+	tr := tar.NewReader(r)
+	files := MapFileSystem{}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		contents, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[entryName(header.Name)] = contents
+	}
+}
+
+// Normalizes entry names such as "./app/application.yaml".
+func entryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -0,0 +1,72 @@
+package reader
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Decodes and encodes configuration data in a format beyond the built in
+// YAML, JSON and TOML. Decode should produce maps, slices and scalars as
+// encoding/json would.
+type Codec interface {
+	Decode(data []byte) (interface{}, error)
+	Encode(data interface{}) ([]byte, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+// Makes a codec available for a format, which is also the file extension it
+// applies to. Intended to be called from the init function of a package
+// providing the codec, so importing it for its side effects is enough:
+//
+//	import _ "example.com/confer-contrib/codecs/hcl"
+//
+// Panics if the format is built in or already registered, like
+// database/sql.Register.
+func RegisterCodec(format string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if codec == nil {
+		panic("reader: RegisterCodec codec is nil")
+	}
+	if isBuiltinFormat(format) {
+		panic(fmt.Sprintf("reader: %s is built in and can't be registered", format))
+	}
+	if _, exists := codecs[format]; exists {
+		panic(fmt.Sprintf("reader: RegisterCodec called twice for %s", format))
+	}
+	codecs[format] = codec
+}
+
+// Returns every supported format, built in or registered, sorted by name.
+func Formats() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	formats := []string{string(FormatJSON), string(FormatTOML), string(FormatYAML)}
+	for format := range codecs {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func registeredCodec(format string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, exists := codecs[format]
+	return codec, exists
+}
+
+func isBuiltinFormat(format string) bool {
+	switch ConfigFormat(format) {
+	case FormatYAML, FormatJSON, FormatTOML:
+		return true
+	}
+	return format == "yml"
+}
@@ -3,8 +3,8 @@ package reader
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
-	"io/ioutil"
 	"path/filepath"
 
 	"github.com/BurntSushi/toml"
@@ -23,9 +23,20 @@ const (
 
 type ConfigReader struct {
 	Format string
+	// Rejects documents with duplicate keys. TOML always does.
+	Strict bool
 	reader io.Reader
 }
 
+// Controls how a configuration file is parsed.
+type ReadOptions struct {
+	// The format of the file, overriding its extension. When empty, the
+	// extension is used, and failing that the contents are sniffed.
+	Format string
+	// Rejects documents with duplicate keys rather than keeping the last.
+	Strict bool
+}
+
 // Retuns the configuration data into a generic object for for us.
 func (cr *ConfigReader) Export() (interface{}, error) {
 	var config interface{}
@@ -34,36 +45,93 @@ func (cr *ConfigReader) Export() (interface{}, error) {
 
 	switch cr.Format {
 	case "yaml":
-		if err := yaml.Unmarshal(buf.Bytes(), &config); err != nil {
-			jww.ERROR.Fatalf("Error parsing config: %s", err)
+		unmarshal := yaml.Unmarshal
+		if cr.Strict {
+			unmarshal = yaml.UnmarshalStrict
+		}
+		if e := unmarshal(buf.Bytes(), &config); e != nil {
+			return nil, &err.ParseError{Format: cr.Format, Err: e}
 		}
 
 	case "json":
-		if err := json.Unmarshal(buf.Bytes(), &config); err != nil {
-			jww.ERROR.Fatalf("Error parsing config: %s", err)
+		// Numbers are decoded as json.Number so integers survive intact.
+		dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+		dec.UseNumber()
+		if e := dec.Decode(&config); e != nil {
+			return nil, &err.ParseError{Format: cr.Format, Err: e}
+		}
+		// As json.Unmarshal does, reject anything after the document.
+		var trailing interface{}
+		if e := dec.Decode(&trailing); e != io.EOF {
+			if e == nil {
+				e = fmt.Errorf("invalid character after top-level value")
+			}
+			return nil, &err.ParseError{Format: cr.Format, Err: e}
+		}
+		if cr.Strict {
+			if e := checkDuplicateKeys(buf.Bytes()); e != nil {
+				return nil, &err.ParseError{Format: cr.Format, Err: e}
+			}
 		}
+		config = normalizeNumbers(config)
 
 	case "toml":
-		if _, err := toml.Decode(buf.String(), &config); err != nil {
-			jww.ERROR.Fatalf("Error parsing config: %s", err)
+		if _, e := toml.Decode(buf.String(), &config); e != nil {
+			return nil, &err.ParseError{Format: cr.Format, Err: e}
 		}
+		config = normalizeNumbers(config)
 	default:
-		return nil, err.UnsupportedConfigError(cr.Format)
+		codec, exists := registeredCodec(cr.Format)
+		if !exists {
+			return nil, err.UnsupportedConfigError(cr.Format)
+		}
+		decoded, e := codec.Decode(buf.Bytes())
+		if e != nil {
+			return nil, &err.ParseError{Format: cr.Format, Err: e}
+		}
+		config = normalizeNumbers(decoded)
 	}
 
 	return config, nil
 }
 
 func ReadFile(path string) (interface{}, error) {
-	file, err := ioutil.ReadFile(path)
+	return ReadFileFrom(OSFileSystem{}, path)
+}
+
+// Reads and parses a configuration file from the provided file system. The
+// format is taken from the file's extension, or sniffed from its contents if
+// it has none.
+func ReadFileFrom(fs FileSystem, path string) (interface{}, error) {
+	return ReadFileAs(fs, path, "")
+}
+
+// Reads and parses a configuration file in the given format. An empty format
+// behaves as ReadFileFrom.
+func ReadFileAs(fs FileSystem, path string, format string) (interface{}, error) {
+	return ReadFileWith(fs, path, ReadOptions{Format: format})
+}
+
+// Reads and parses a configuration file as directed by opts.
+func ReadFileWith(fs FileSystem, path string, opts ReadOptions) (interface{}, error) {
+	file, err := fs.ReadFile(path)
 	if err != nil {
 		jww.DEBUG.Println("Error reading config file:", err)
 		return nil, err
 	}
 
+	format := opts.Format
+	if format == "" {
+		format = getConfigType(path)
+	}
+	if format == "" {
+		format = Sniff(file)
+		jww.DEBUG.Printf("Detected %s format for %s", format, path)
+	}
+
 	reader := bytes.NewReader(file)
 
-	cr := &ConfigReader{Format: getConfigType(path), reader: reader}
+	cr := &ConfigReader{Format: format, Strict: opts.Strict, reader: reader}
 	return cr.Export()
 }
 
@@ -76,8 +144,17 @@ func ReadBytes(data []byte, format string) (interface{}, error) {
 	return cr.Export()
 }
 
+// Returns the format of a configuration file based on its extension.
+func FormatOf(path string) string {
+	return getConfigType(path)
+}
+
 func getConfigType(path string) string {
 	ext := filepath.Ext(path)
+	if ext == "" {
+		return ""
+	}
+
 	switch ext[1:] {
 	case "yml":
 		return "yaml"
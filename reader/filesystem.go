@@ -0,0 +1,30 @@
+package reader
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// Abstracts reading configuration files so that platforms without a usable
+// file system (e.g. js/wasm in the browser) or alternate storage can be used.
+type FileSystem interface {
+	ReadFile(path string) ([]byte, error)
+}
+
+// Reads files from the local file system.
+type OSFileSystem struct{}
+
+func (OSFileSystem) ReadFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+// An in-memory file system keyed by path.
+type MapFileSystem map[string][]byte
+
+func (m MapFileSystem) ReadFile(path string) ([]byte, error) {
+	data, exists := m[path]
+	if !exists {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return data, nil
+}
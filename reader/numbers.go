@@ -0,0 +1,48 @@
+package reader
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Brings the output of the JSON and TOML decoders in line with YAML, so a
+// document means the same thing whichever format it's written in. Integers
+// become int where they fit and int64 otherwise, rather than float64 (JSON)
+// or always int64 (TOML). TOML arrays of tables become []interface{}.
+func normalizeNumbers(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = normalizeNumbers(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalizeNumbers(child)
+		}
+		return v
+	case []map[string]interface{}:
+		s := make([]interface{}, len(v))
+		for i, child := range v {
+			s[i] = normalizeNumbers(child)
+		}
+		return s
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return integer(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case int64:
+		return integer(v)
+	}
+	return val
+}
+
+// Returns i as an int if it fits, as yaml.v2 does.
+func integer(i int64) interface{} {
+	if i >= math.MinInt && i <= math.MaxInt {
+		return int(i)
+	}
+	return i
+}
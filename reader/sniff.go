@@ -0,0 +1,50 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"regexp"
+)
+
+var (
+	// `key = value` and `[table]` lines are distinctive to TOML.
+	tomlAssignment = regexp.MustCompile(`^[A-Za-z0-9_.\-"']+\s*=`)
+	tomlTable      = regexp.MustCompile(`^\[{1,2}[A-Za-z0-9_.\-"' ]+\]{1,2}$`)
+)
+
+// Guesses the format of configuration data from its contents, for files
+// without an extension such as mounted secrets:
+//
+//   - a leading `{`, or a `[` that parses as JSON, is JSON
+//   - a `key = value` assignment or `[table]` header is TOML
+//   - anything else, including a leading `---`, is YAML
+//
+// Blank lines and # comments are skipped.
+func Sniff(data []byte) string {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return string(FormatJSON)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(line, []byte("---")):
+			return string(FormatYAML)
+		case line[0] == '{':
+			return string(FormatJSON)
+		case tomlTable.Match(line), tomlAssignment.Match(line):
+			return string(FormatTOML)
+		}
+		break
+	}
+
+	return string(FormatYAML)
+}
@@ -0,0 +1,59 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Reports the first key repeated within a JSON object. encoding/json quietly
+// keeps the last occurrence, which hides copy and paste mistakes.
+func checkDuplicateKeys(data []byte) error {
+	return walkJSON(json.NewDecoder(bytes.NewReader(data)), "")
+}
+
+func walkJSON(dec *json.Decoder, path string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return nil
+	}
+
+	switch delim {
+	case '{':
+		seen := map[string]bool{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+
+			key := tok.(string)
+			if path != "" {
+				key = path + "." + key
+			}
+			if seen[key] {
+				return fmt.Errorf("duplicate key %q", key)
+			}
+			seen[key] = true
+
+			if err := walkJSON(dec, key); err != nil {
+				return err
+			}
+		}
+	case '[':
+		for i := 0; dec.More(); i++ {
+			if err := walkJSON(dec, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Consume the closing delimiter.
+	_, err = dec.Token()
+	return err
+}
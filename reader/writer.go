@@ -0,0 +1,38 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jacobstr/confer/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Serializes configuration data in the given format, the inverse of
+// ReadBytes.
+func Marshal(data interface{}, format string) ([]byte, error) {
+	switch format {
+	case "yaml":
+		return yaml.Marshal(data)
+
+	case "json":
+		out, e := json.MarshalIndent(data, "", "  ")
+		if e != nil {
+			return nil, e
+		}
+		return append(out, '\n'), nil
+
+	case "toml":
+		var buf bytes.Buffer
+		if e := toml.NewEncoder(&buf).Encode(data); e != nil {
+			return nil, e
+		}
+		return buf.Bytes(), nil
+	}
+
+	if codec, exists := registeredCodec(format); exists {
+		return codec.Encode(data)
+	}
+	return nil, err.UnsupportedConfigError(format)
+}
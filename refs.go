@@ -0,0 +1,89 @@
+package confer
+
+import (
+	"fmt"
+	"strings"
+
+	errors "github.com/jacobstr/confer/errors"
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/source"
+)
+
+// The key marking a reference to another value.
+const refKey = "$ref"
+
+// Replaces references in data with the values they point to, once files have
+// been merged, so an overlay can reuse a value another file defines:
+//
+//	# application.yaml
+//	app:
+//	  database:
+//	    host: db.internal
+//
+//	# environments/production.yaml
+//	app:
+//	  cache:
+//	    host:
+//	      $ref: app.database.host
+//
+// References may point at sections and at other references. A reference to
+// a key that isn't set, or a cycle of references, is an error.
+func resolveRefs(data map[string]interface{}) []error {
+	errs := []error{}
+	// Targets are looked up case-insensitively in data itself, so they see
+	// the references resolved so far.
+	lookup := source.NewConfigSource()
+	lookup.FromStringMap(data)
+
+	var resolve func(key string, val interface{}, chain []string) interface{}
+	resolve = func(key string, val interface{}, chain []string) interface{} {
+		if ref, ok := refOf(val); ok {
+			for _, seen := range chain {
+				if strings.EqualFold(seen, ref) {
+					errs = append(errs, &errors.InvalidValueError{
+						Key:    key,
+						Reason: fmt.Sprintf("has circular references: %s", strings.Join(append(chain, ref), " -> ")),
+					})
+					return nil
+				}
+			}
+
+			target, exists := lookup.Get(ref)
+			if !exists || target == nil {
+				errs = append(errs, &errors.InvalidValueError{
+					Key:    key,
+					Reason: fmt.Sprintf("refers to %s, which is not set", ref),
+				})
+				return nil
+			}
+			return resolve(key, maps.DeepCopy(target), append(chain, ref))
+		}
+
+		switch v := val.(type) {
+		case map[string]interface{}:
+			for child, childVal := range v {
+				v[child] = resolve(key+"."+child, childVal, chain)
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = resolve(fmt.Sprintf("%s.%d", key, i), item, chain)
+			}
+		}
+		return val
+	}
+
+	for key, val := range data {
+		data[key] = resolve(key, val, nil)
+	}
+	return errs
+}
+
+// Returns the key a reference points to, if val is one.
+func refOf(val interface{}) (string, bool) {
+	m, ok := val.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", false
+	}
+	ref, ok := m[refKey].(string)
+	return ref, ok
+}
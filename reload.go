@@ -0,0 +1,427 @@
+package confer
+
+import (
+	"sort"
+	"time"
+
+	jww "github.com/spf13/jwalterweatherman"
+
+	errors "github.com/jacobstr/confer/errors"
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/source"
+)
+
+// A change to a single leaf setting. Old is nil for added keys, New is nil
+// for removed ones.
+type Change struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+// Summarizes the outcome of a Reload.
+type ReloadReport struct {
+	// Changes that took effect.
+	Applied []Change
+
+	// Changes to pinned keys that were reverted.
+	Rejected []Change
+
+	// Changes to keys that only take effect after a restart. These are
+	// reflected in the configuration but not passed to change handlers.
+	PendingRestart []Change
+
+	// Settings withheld because they failed validation, see SetQuarantine.
+	Quarantined []QuarantinedKey
+}
+
+// Invoked with the changes that took effect after a reload.
+type ChangeHandler func(changes []Change)
+
+// Registers a handler invoked after every Reload that changed at least one
+// setting. Call the returned function to unregister it again; handlers
+// already running for a reload in progress still complete.
+func (manager *Config) OnChange(fn ChangeHandler) func() {
+	handler := &fn
+	manager.mu.Lock()
+	manager.changeHandlers = append(manager.changeHandlers, handler)
+	manager.mu.Unlock()
+
+	return func() {
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+		for i, h := range manager.changeHandlers {
+			if h == handler {
+				manager.changeHandlers = append(manager.changeHandlers[:i:i], manager.changeHandlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Registers fn to be called for each changed key matching prefix after a
+// reload, e.g. to adjust a logger without diffing settings by hand:
+//
+//	config.Watch("app.logging", func(key string, old, new interface{}) {
+//		logger.SetLevel(config.GetString("app.logging.level"))
+//	})
+//
+// The prefix matches a key or any of its ancestors, as in Pin. Keys requiring
+// a restart aren't reported, as with OnChange, whose unregister function is
+// returned.
+func (manager *Config) Watch(prefix string, fn func(key string, old, new interface{})) func() {
+	return manager.OnChange(func(changes []Change) {
+		for _, change := range changes {
+			if keyMatches(prefix, change.Key) {
+				fn(change.Key, change.Old, change.New)
+			}
+		}
+	})
+}
+
+// Marks keys whose values may not change on reload, e.g. listening ports or
+// crypto parameters that are unsafe to swap at runtime. Patterns match a key
+// or any of its ancestors, see keyMatches:
+//
+//	config.Pin("server.port", "app.security.*")
+//
+// Changes to pinned keys are reverted and reported in ReloadReport.Rejected.
+func (manager *Config) Pin(patterns ...string) {
+	manager.pinned = append(manager.pinned, patterns...)
+}
+
+// Marks keys that can't be hot-reloaded. Changes to them are reported in
+// ReloadReport.PendingRestart rather than Applied, and RestartRequired
+// reports true until they are reverted. Patterns match as in Pin.
+func (manager *Config) RequireRestart(patterns ...string) {
+	manager.restartRequired = append(manager.restartRequired, patterns...)
+}
+
+// Reports whether a reload has changed a key marked with RequireRestart since
+// the process started.
+func (manager *Config) RestartRequired() bool {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return len(manager.pendingRestart) > 0
+}
+
+// Returns the outstanding changes to restart-required keys, sorted by key.
+// Old holds the value the process started with.
+func (manager *Config) PendingRestart() []Change {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	changes := []Change{}
+	for _, change := range manager.pendingRestart {
+		changes = append(changes, change)
+	}
+	sort.Sort(changesByKey(changes))
+	return changes
+}
+
+// Tracks a change to a restart-required key against its original value.
+func (manager *Config) trackRestart(change Change) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if pending, exists := manager.pendingRestart[change.Key]; exists {
+		change.Old = pending.Old
+	}
+
+	if maps.Equal(change.Old, change.New) {
+		delete(manager.pendingRestart, change.Key)
+	} else {
+		manager.pendingRestart[change.Key] = change
+	}
+}
+
+// Re-reads every file previously loaded by ReadPaths, in the original merge
+// order, followed by the last fetched contents of object sources, and
+// notifies change handlers of any settings that changed.
+//
+// The attributes tier is rebuilt from scratch, so keys removed from a file
+// are removed from the configuration. Documents merged with ReadBytes,
+// MergeAttributes or Helm values, and keys removed with Unset, are replayed
+// in their original order among the files, and a file that fails to load
+// keeps its previous contents, or the snapshot's data when the configuration
+// was loaded from one. If the result fails the
+// schema or validators, the previous configuration is kept, see
+// OnReloadError.
+func (manager *Config) Reload() (*ReloadReport, error) {
+	return manager.reload(func() []error {
+		return manager.rebuildAttributes(true)
+	})
+}
+
+// Registers a handler invoked when a reload fails, whether triggered by
+// Reload, WatchConfig or a polled source. Reloads producing configuration
+// that fails the schema or validators are rolled back, so the handler is the
+// place to alert on them:
+//
+//	config.OnReloadError(func(err error) {
+//		log.Printf("keeping previous configuration: %v", err)
+//	})
+func (manager *Config) OnReloadError(fn func(error)) {
+	manager.reloadErrorHandlers = append(manager.reloadErrorHandlers, fn)
+}
+
+// Runs load, then checks, classifies and announces the resulting changes as
+// described in Reload. If the result fails validation, the previous
+// attributes are restored and the reload is rejected as a whole.
+func (manager *Config) reload(load func() []error) (*ReloadReport, error) {
+	report, errs, err := manager.applyReload(load)
+	if err != nil {
+		return report, manager.reloadFailed(err)
+	}
+
+	if len(report.Applied) > 0 {
+		manager.mu.RLock()
+		handlers := manager.changeHandlers
+		manager.mu.RUnlock()
+		for _, fn := range handlers {
+			(*fn)(report.Applied)
+		}
+	}
+
+	if len(errs) > 0 {
+		return report, manager.reloadFailed(&errors.LoadError{Msg: "Reload failed:", Errors: errs})
+	}
+	manager.mu.Lock()
+	manager.reloadedAt, manager.reloadErr = time.Now(), nil
+	manager.mu.Unlock()
+	return report, nil
+}
+
+// Runs load and classifies the resulting changes, holding reloadMu so
+// reloads triggered from several goroutines take turns. Returns the errors
+// load reported, and an error if the reload was rolled back.
+func (manager *Config) applyReload(load func() []error) (*ReloadReport, []error, error) {
+	manager.reloadMu.Lock()
+	defer manager.reloadMu.Unlock()
+
+	release := manager.holdViews()
+	before := manager.AllSettings()
+	previous := manager.saveAttributes()
+
+	errs := load()
+	errs = append(errs, manager.checkDeprecations()...)
+
+	report := &ReloadReport{}
+	manager.mu.Lock()
+	manager.quarantined = nil
+	manager.mu.Unlock()
+
+	if invalid := manager.validate(false); len(invalid) > 0 {
+		quarantined, ok := []QuarantinedKey(nil), false
+		if manager.quarantineEnabled {
+			quarantined, ok = manager.quarantine(previous, invalid)
+		}
+
+		if !ok {
+			jww.ERROR.Println("Rolling back invalid configuration")
+			manager.restoreAttributes(previous)
+			// Readers of View never saw the rejected configuration, so the
+			// previous view stays published rather than releasing the hold.
+			manager.viewsHeld.Add(-1)
+			return report, errs, &errors.LoadError{
+				Msg:    "Reload rejected, keeping previous configuration:",
+				Errors: append(errs, invalid...),
+			}
+		}
+
+		report.Quarantined = quarantined
+		manager.mu.Lock()
+		manager.quarantined = quarantined
+		manager.mu.Unlock()
+		manager.notifyQuarantined(quarantined)
+	}
+
+	// Reloads only change the attributes tier, so pinned keys are reverted
+	// to the tier's own previous values rather than to whatever was in
+	// effect, which may have come from another tier.
+	reverted := source.NewConfigSource()
+	reverted.FromStringMap(previous.data)
+
+	for _, change := range diffSettings(before, manager.AllSettings()) {
+		if anyKeyMatches(manager.pinned, change.Key) {
+			jww.WARN.Println("Rejected change to pinned key", change.Key)
+			manager.write(func() {
+				if val, exists := reverted.Get(change.Key); exists && val != nil {
+					manager.attributes.Set(change.Key, maps.DeepCopy(val))
+				} else {
+					manager.attributes.Unset(change.Key)
+				}
+			})
+			report.Rejected = append(report.Rejected, change)
+		} else if anyKeyMatches(manager.restartRequired, change.Key) {
+			manager.trackRestart(change)
+			report.PendingRestart = append(report.PendingRestart, change)
+		} else {
+			report.Applied = append(report.Applied, change)
+		}
+	}
+	release()
+
+	return report, errs, nil
+}
+
+// Notifies OnReloadError handlers, returning err.
+func (manager *Config) reloadFailed(err error) error {
+	manager.mu.Lock()
+	manager.reloadedAt, manager.reloadErr = time.Now(), err
+	manager.mu.Unlock()
+	for _, fn := range manager.reloadErrorHandlers {
+		fn(err)
+	}
+	return err
+}
+
+// The attributes tier along with where its values came from, as saved
+// before a reload or built by reading files.
+type attributeState struct {
+	data     map[string]interface{}
+	origins  map[string]string
+	fileData map[string]map[string]interface{}
+}
+
+// Returns a copy of the attributes tier that may be freely modified.
+func (manager *Config) saveAttributes() *attributeState {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	saved := &attributeState{
+		data:     maps.DeepCopy(manager.attributes.ToStringMap()).(map[string]interface{}),
+		origins:  map[string]string{},
+		fileData: map[string]map[string]interface{}{},
+	}
+	for key, origin := range manager.origins {
+		saved.origins[key] = origin
+	}
+	for path, data := range manager.fileData {
+		saved.fileData[path] = data
+	}
+	return saved
+}
+
+// Swaps saved in as the attributes tier. The tier takes ownership of its
+// data.
+func (manager *Config) restoreAttributes(saved *attributeState) {
+	manager.write(func() {
+		manager.attributes.FromStringMap(saved.data)
+		manager.origins = saved.origins
+		manager.fileData = saved.fileData
+	})
+}
+
+// A write to the attributes tier, replayed in order when the tier is rebuilt:
+// a file read by ReadPaths, a document merged by other means, or a key
+// removed with Unset.
+type attributeDocument struct {
+	data map[string]interface{}
+	// Merge with Helm semantics, where a nil removes a key.
+	helm bool
+	// The key to remove, rather than merging data.
+	unset string
+	// The resolved path of the file to merge, rather than merging data.
+	path string
+}
+
+// Records doc for replay. Requires the write lock.
+func (manager *Config) recordDocument(doc attributeDocument) {
+	manager.documents = append(manager.documents, doc)
+}
+
+// Records files loaded by ReadPaths, in merge order. Requires the write lock.
+func (manager *Config) recordPaths(loaded []string) {
+	manager.paths = append(manager.paths, loaded...)
+	for _, path := range loaded {
+		manager.recordDocument(attributeDocument{path: path})
+	}
+}
+
+// Applies doc to data, returning the result.
+func (doc attributeDocument) apply(data map[string]interface{}) map[string]interface{} {
+	copied, _ := maps.DeepCopy(doc.data).(map[string]interface{})
+	switch {
+	case doc.unset != "":
+		lookup := source.NewConfigSource()
+		lookup.FromStringMap(data)
+		lookup.Unset(doc.unset)
+		return lookup.ToStringMap()
+	case doc.helm:
+		return mergeHelm(data, copied)
+	default:
+		return maps.Merge(data, copied)
+	}
+}
+
+// Rebuilds the attributes tier from nothing by replaying, in their original
+// order, the files read by ReadPaths and the documents merged or keys unset
+// by other means, then merging the last fetched contents of object sources.
+// Files are read again when reread is set, otherwise the copies kept when
+// they were last read are used where there are any, as they are for files
+// that fail to load.
+// The result is swapped in as a whole. Requires reloadMu.
+func (manager *Config) rebuildAttributes(reread bool) []error {
+	manager.mu.RLock()
+	documents := append([]attributeDocument(nil), manager.documents...)
+	kept := manager.fileData
+	manager.mu.RUnlock()
+
+	state := &attributeState{
+		data:     map[string]interface{}{},
+		origins:  map[string]string{},
+		fileData: map[string]map[string]interface{}{},
+	}
+
+	errs := []error{}
+	for _, doc := range documents {
+		if doc.path == "" {
+			state.data = doc.apply(state.data)
+			continue
+		}
+
+		data, exists := kept[doc.path]
+		if reread || !exists {
+			_, fileErrs := manager.mergeFiles(state, []string{doc.path})
+			errs = append(errs, fileErrs...)
+			if len(fileErrs) == 0 || !exists {
+				continue
+			}
+		}
+
+		state.recordOrigins(data, doc.path)
+		state.data = maps.Merge(state.data, maps.DeepCopy(data).(map[string]interface{}))
+	}
+
+	errs = append(errs, resolveRefs(state.data)...)
+	state.data = manager.mergeSources(state.data)
+	manager.restoreAttributes(state)
+	return errs
+}
+
+// Compares two flattened settings maps, returning changes sorted by key.
+func diffSettings(before, after map[string]interface{}) []Change {
+	changes := []Change{}
+
+	for key, old := range before {
+		if val, exists := after[key]; !exists || !maps.Equal(old, val) {
+			changes = append(changes, Change{Key: key, Old: old, New: after[key]})
+		}
+	}
+
+	for key, val := range after {
+		if _, exists := before[key]; !exists {
+			changes = append(changes, Change{Key: key, New: val})
+		}
+	}
+
+	sort.Sort(changesByKey(changes))
+	return changes
+}
+
+type changesByKey []Change
+
+func (c changesByKey) Len() int           { return len(c) }
+func (c changesByKey) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c changesByKey) Less(i, j int) bool { return c[i].Key < c[j].Key }
@@ -0,0 +1,467 @@
+package confer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/reader"
+)
+
+// A remote configuration backend, as created by a ProviderFactory.
+type RemoteProvider interface {
+	// Returns the current configuration document and its format. An empty
+	// format is inferred from the URL's extension, or sniffed.
+	Fetch() (data []byte, format string, err error)
+}
+
+// Implemented by providers that are notified of changes, e.g. through a
+// subscription, rather than polled.
+type RemoteWatcher interface {
+	RemoteProvider
+	// Blocks until the document may have changed, returning early once stop
+	// is closed.
+	Wait(stop <-chan struct{}) error
+}
+
+// Creates a provider for a URL, e.g. nats://localhost:4222/config.app.
+type ProviderFactory func(u *url.URL) (RemoteProvider, error)
+
+var (
+	remoteProvidersMu sync.RWMutex
+	remoteProviders   = map[string]ProviderFactory{}
+)
+
+// Makes a backend available to ReadRemote and WatchRemote under a URL scheme,
+// replacing any existing provider for that scheme. Third party providers can
+// register themselves from an init function, so importing them for their
+// side effects is enough:
+//
+//	func init() {
+//		confer.RegisterRemoteProvider("nats", func(u *url.URL) (confer.RemoteProvider, error) {
+//			return dial(u.Host, strings.TrimPrefix(u.Path, "/"))
+//		})
+//	}
+//
+// Schemes registered with RegisterObjectStore are available as well.
+func RegisterRemoteProvider(scheme string, factory ProviderFactory) {
+	remoteProvidersMu.Lock()
+	defer remoteProvidersMu.Unlock()
+	remoteProviders[strings.ToLower(scheme)] = factory
+}
+
+// Returns the provider for a URL.
+func remoteProvider(u *url.URL) (RemoteProvider, error) {
+	remoteProvidersMu.RLock()
+	factory, exists := remoteProviders[strings.ToLower(u.Scheme)]
+	remoteProvidersMu.RUnlock()
+	if exists {
+		return factory(u)
+	}
+
+	if store, exists := objectStore(u.Scheme); exists {
+		return &objectProvider{store: store, bucket: u.Host, key: strings.TrimPrefix(u.Path, "/")}, nil
+	}
+	return nil, fmt.Errorf("No remote provider registered for %s://", u.Scheme)
+}
+
+// Decrypts payloads fetched with ReadSecureRemote or WatchSecureRemote, e.g.
+// a keyring from the remote/pgp or remote/age package.
+type Decrypter interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// A document read with ReadRemote or WatchRemote.
+type remoteSource struct {
+	url       string
+	path      string
+	provider  RemoteProvider
+	decrypter Decrypter
+	data      map[string]interface{}
+	stop      chan struct{}
+
+	// Where the last fetched payload is persisted, if anywhere.
+	cacheFile string
+	sourceHealth
+}
+
+// The state of a document read with ReadRemote or WatchRemote, as reported
+// by RemoteStatus, or of any remote source, as reported by Health.
+type RemoteStatus struct {
+	// The source's URL, or the znode path or repository of ZooKeeper and git
+	// sources.
+	URL string
+	// When the document in effect was fetched from its provider.
+	FetchedAt time.Time
+	// Whether the document in effect was loaded from the cache because the
+	// provider was unreachable.
+	Stale bool
+	// The last error fetching the document, if the last attempt failed.
+	Err error
+}
+
+// Reads a configuration document from a registered remote provider once and
+// merges it on top of files read with ReadPaths, along with object sources:
+//
+//	err := config.ReadRemote("nats://localhost:4222/config.billing")
+func (manager *Config) ReadRemote(rawurl string) error {
+	_, err := manager.addRemote(rawurl, nil)
+	return err
+}
+
+// Like ReadRemote, for documents stored encrypted so that secrets don't sit
+// in etcd or Consul as plaintext. Payloads are decrypted with decrypter
+// before being parsed; the cache kept by SetRemoteCacheDir holds them
+// encrypted.
+func (manager *Config) ReadSecureRemote(rawurl string, decrypter Decrypter) error {
+	_, err := manager.addRemote(rawurl, decrypter)
+	return err
+}
+
+// Like ReadRemote, but keeps the document up to date. Providers implementing
+// RemoteWatcher are waited on; others are polled at interval. Changes go
+// through the same pipeline as Reload. Stop with StopRemote.
+func (manager *Config) WatchRemote(rawurl string, interval time.Duration) error {
+	return manager.WatchSecureRemote(rawurl, interval, nil)
+}
+
+// Like WatchRemote, decrypting payloads as ReadSecureRemote does.
+func (manager *Config) WatchSecureRemote(rawurl string, interval time.Duration, decrypter Decrypter) error {
+	src, err := manager.addRemote(rawurl, decrypter)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := src.provider.(RemoteWatcher); ok || interval > 0 {
+		go manager.watchRemote(src, interval)
+	}
+	return nil
+}
+
+// A change to a document being watched with WatchRemote, as sent by
+// WatchRemoteConfigOnChannel.
+type RemoteEvent struct {
+	URL string
+	// The newly fetched document, parsed.
+	Settings map[string]interface{}
+	// The settings that changed as a result. Empty if the reload was
+	// rejected.
+	Changes []Change
+	// Why the document couldn't be fetched, or the reload was rejected.
+	Err error
+}
+
+// Returns a channel receiving an event whenever a document being watched
+// with WatchRemote changes or fails to refresh, after the change has taken
+// effect, so applications can handle configuration changes in their own
+// event loop:
+//
+//	events := config.WatchRemoteConfigOnChannel()
+//	for {
+//		select {
+//		case event := <-events:
+//			if event.Err == nil {
+//				resize(config.GetInt("pool.size"))
+//			}
+//		case job := <-jobs:
+//			...
+//		}
+//	}
+//
+// The channel is buffered; events arriving while it is full are dropped.
+// It is closed by StopRemote.
+func (manager *Config) WatchRemoteConfigOnChannel() <-chan RemoteEvent {
+	manager.remoteEventsMu.Lock()
+	defer manager.remoteEventsMu.Unlock()
+
+	events := make(chan RemoteEvent, remoteEventBuffer)
+	manager.remoteEvents = append(manager.remoteEvents, events)
+	return events
+}
+
+// How many events a WatchRemoteConfigOnChannel channel holds.
+const remoteEventBuffer = 16
+
+func (manager *Config) sendRemoteEvent(event RemoteEvent) {
+	manager.remoteEventsMu.Lock()
+	defer manager.remoteEventsMu.Unlock()
+
+	for _, events := range manager.remoteEvents {
+		select {
+		case events <- event:
+		default:
+			jww.WARN.Println("Dropping remote event for", event.URL, "the channel is full")
+		}
+	}
+}
+
+// Persists every document fetched with ReadRemote or WatchRemote under dir,
+// so that when a provider is unreachable at startup the last payload fetched
+// is used instead of failing, e.g. during a control plane outage:
+//
+//	config.SetRemoteCacheDir("/var/cache/myapp")
+//	err := config.ReadRemote("etcd://config/billing.yaml")
+//
+// Check RemoteStatus to learn whether a document is stale. A stale document
+// being watched is replaced once its provider is reachable again.
+func (manager *Config) SetRemoteCacheDir(dir string) {
+	manager.remoteCacheDir = dir
+}
+
+// Returns the state of the document read from rawurl.
+func (manager *Config) RemoteStatus(rawurl string) (RemoteStatus, bool) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	for _, src := range manager.remoteSources {
+		if src.url == rawurl {
+			return src.status(src.url), true
+		}
+	}
+	return RemoteStatus{}, false
+}
+
+// Stops watching every remote document. Their last fetched contents remain
+// in effect.
+func (manager *Config) StopRemote() {
+	for _, src := range manager.remoteSources {
+		select {
+		case <-src.stop:
+		default:
+			close(src.stop)
+		}
+	}
+
+	manager.remoteEventsMu.Lock()
+	defer manager.remoteEventsMu.Unlock()
+	for _, events := range manager.remoteEvents {
+		close(events)
+	}
+	manager.remoteEvents = nil
+}
+
+func (manager *Config) addRemote(rawurl string, decrypter Decrypter) (*remoteSource, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := remoteProvider(u)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &remoteSource{url: rawurl, path: u.Path, provider: provider, decrypter: decrypter, stop: make(chan struct{})}
+	if manager.remoteCacheDir != "" {
+		sum := sha256.Sum256([]byte(rawurl))
+		src.cacheFile = filepath.Join(manager.remoteCacheDir, hex.EncodeToString(sum[:8])+".json")
+	}
+
+	if _, err := src.fetch(); err != nil {
+		if cacheErr := src.readCache(); cacheErr != nil {
+			return nil, err
+		}
+		jww.WARN.Println("Unable to fetch", rawurl, "using the copy cached at", src.status(rawurl).FetchedAt, err)
+	}
+
+	manager.addSource(func() {
+		manager.remoteSources = append(manager.remoteSources, src)
+	})
+	return src, nil
+}
+
+func (manager *Config) watchRemote(src *remoteSource, interval time.Duration) {
+	watcher, push := src.provider.(RemoteWatcher)
+
+	for {
+		if push {
+			if err := watcher.Wait(src.stop); err != nil {
+				jww.ERROR.Println("Unable to watch", src.url, err)
+				if interval <= 0 {
+					return
+				}
+				// Fall back to polling.
+				push = false
+				continue
+			}
+			select {
+			case <-src.stop:
+				return
+			default:
+			}
+		} else {
+			timer := time.NewTimer(interval)
+			select {
+			case <-src.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		manager.reloadMu.Lock()
+		changed, err := src.fetch()
+		manager.reloadMu.Unlock()
+		if err != nil {
+			jww.ERROR.Println("Unable to refresh", src.url, err)
+			manager.sendRemoteEvent(RemoteEvent{URL: src.url, Err: err})
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		jww.INFO.Println("Reloading changed document", src.url)
+		report, err := manager.reload(func() []error {
+			return manager.rebuildAttributes(false)
+		})
+		if err != nil {
+			jww.ERROR.Println(err)
+		}
+
+		event := RemoteEvent{
+			URL:      src.url,
+			Settings: maps.DeepCopy(src.data).(map[string]interface{}),
+			Err:      err,
+		}
+		if err == nil {
+			event.Changes = report.Applied
+		}
+		manager.sendRemoteEvent(event)
+	}
+}
+
+// Fetches the document, reporting whether it changed since the last fetch.
+func (src *remoteSource) fetch() (bool, error) {
+	data, format, err := src.provider.Fetch()
+	if err == nil {
+		var changed bool
+		if changed, err = src.parse(data, format); err == nil {
+			src.record(nil)
+			if werr := src.writeCache(data, format); werr != nil {
+				jww.WARN.Println("Unable to cache", src.url, werr)
+			}
+			return changed, nil
+		}
+	}
+	src.record(err)
+	return false, err
+}
+
+// A payload persisted by SetRemoteCacheDir.
+type remoteCacheEntry struct {
+	URL       string    `json:"url"`
+	Format    string    `json:"format"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Data      []byte    `json:"data"`
+}
+
+func (src *remoteSource) writeCache(data []byte, format string) error {
+	if src.cacheFile == "" {
+		return nil
+	}
+
+	out, err := json.Marshal(remoteCacheEntry{URL: src.url, Format: format, FetchedAt: src.status(src.url).FetchedAt, Data: data})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(src.cacheFile), 0700); err != nil {
+		return err
+	}
+
+	// Write atomically, so a crash never leaves a truncated cache behind.
+	tmp := src.cacheFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, out, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, src.cacheFile)
+}
+
+// Loads the cached payload, marking the document stale.
+func (src *remoteSource) readCache() error {
+	if src.cacheFile == "" {
+		return fmt.Errorf("No cache configured")
+	}
+
+	raw, err := ioutil.ReadFile(src.cacheFile)
+	if err != nil {
+		return err
+	}
+	var entry remoteCacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return err
+	}
+	if entry.URL != src.url {
+		return fmt.Errorf("%s caches %s", src.cacheFile, entry.URL)
+	}
+	if _, err := src.parse(entry.Data, entry.Format); err != nil {
+		return err
+	}
+
+	src.mu.Lock()
+	src.fetchedAt, src.stale = entry.FetchedAt, true
+	src.mu.Unlock()
+	return nil
+}
+
+// Parses a payload, reporting whether it differs from the current document.
+func (src *remoteSource) parse(data []byte, format string) (bool, error) {
+	if src.decrypter != nil {
+		plain, err := src.decrypter.Decrypt(data)
+		if err != nil {
+			return false, fmt.Errorf("Unable to decrypt %s: %v", src.url, err)
+		}
+		data = plain
+	}
+
+	if format == "" {
+		format = reader.FormatOf(src.path)
+	}
+	if format == "" {
+		format = reader.Sniff(data)
+	}
+
+	loaded, err := reader.ReadBytes(data, format)
+	if err != nil {
+		return false, fmt.Errorf("Unable to parse %s: %v", src.url, err)
+	}
+
+	parsed := cast.ToStringMap(loaded)
+	maps.ToStringMapRecursive(parsed)
+
+	changed := src.data == nil || !maps.Equal(src.data, parsed)
+	src.data = parsed
+	return changed, nil
+}
+
+// Reads an object store through the RemoteProvider interface, downloading
+// the object only when its ETag changes.
+type objectProvider struct {
+	store       ObjectStore
+	bucket, key string
+	etag        string
+	data        []byte
+}
+
+func (p *objectProvider) Fetch() ([]byte, string, error) {
+	data, etag, err := p.store.Fetch(p.bucket, p.key, p.etag)
+	if err != nil {
+		return nil, "", err
+	}
+	if data != nil || p.data == nil {
+		p.data, p.etag = data, etag
+	}
+	return p.data, "", nil
+}
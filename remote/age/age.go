@@ -0,0 +1,129 @@
+// Package age decrypts remote configuration encrypted with age
+// (https://age-encryption.org) for confer's ReadSecureRemote and
+// WatchSecureRemote, and values encrypted inline for AddValueDecrypter:
+//
+//	f, _ := os.Open("/etc/myapp/keys.txt")
+//	keyring, err := age.NewKeyring(f)
+//	...
+//	err = config.ReadSecureRemote("etcd://config/billing.yaml", keyring)
+//	config.AddValueDecrypter(keyring.Values())
+//
+// Payloads may be ASCII armored, base64 encoded or binary.
+package age
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// A set of age identities. Identities decrypt payloads, their recipients
+// encrypt them.
+type Keyring struct {
+	identities []age.Identity
+	recipients []age.Recipient
+}
+
+// Reads identities as written by age-keygen, one AGE-SECRET-KEY-1... per
+// line, ignoring blank lines and comments.
+func NewKeyring(r io.Reader) (*Keyring, error) {
+	identities, err := age.ParseIdentities(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read identities: %v", err)
+	}
+
+	k := &Keyring{identities: identities}
+	for _, identity := range identities {
+		if x, ok := identity.(*age.X25519Identity); ok {
+			k.recipients = append(k.recipients, x.Recipient())
+		}
+	}
+	return k, nil
+}
+
+// Decrypts a payload encrypted for any identity in the keyring.
+func (k *Keyring) Decrypt(ciphertext []byte) ([]byte, error) {
+	var body io.Reader
+	trimmed := bytes.TrimSpace(ciphertext)
+
+	if bytes.HasPrefix(trimmed, []byte(armor.Header)) {
+		body = armor.NewReader(bytes.NewReader(trimmed))
+	} else if decoded, err := base64.StdEncoding.DecodeString(string(trimmed)); err == nil {
+		body = bytes.NewReader(decoded)
+	} else {
+		body = bytes.NewReader(ciphertext)
+	}
+
+	r, err := age.Decrypt(body, k.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt: %v", err)
+	}
+	return ioutil.ReadAll(r)
+}
+
+// Encrypts plaintext for every identity in the keyring, ASCII armored, for
+// tools that write encrypted configuration.
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armored, k.recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := armored.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decrypts ASCII armored values encrypted for the keyring's recipients, the
+// age1... public keys of its identities, as confer's ValueDecrypter:
+//
+//	app:
+//	  database:
+//	    password: |
+//	      -----BEGIN AGE ENCRYPTED FILE-----
+//	      YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOSBu...
+//	      -----END AGE ENCRYPTED FILE-----
+type Values struct {
+	keyring *Keyring
+}
+
+// Returns the keyring as a decrypter of inline values.
+func (k *Keyring) Values() Values {
+	return Values{keyring: k}
+}
+
+func (v Values) Encrypted(val string) bool {
+	return strings.HasPrefix(strings.TrimSpace(val), armor.Header)
+}
+
+func (v Values) Decrypt(val string) (string, error) {
+	plain, err := v.keyring.Decrypt([]byte(val))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// Encrypts plaintext as an armored value, for tools writing configuration
+// files.
+func (v Values) EncryptValue(plaintext string) (string, error) {
+	sealed, err := v.keyring.Encrypt([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return string(sealed), nil
+}
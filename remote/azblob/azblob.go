@@ -0,0 +1,189 @@
+// Package azblob fetches blobs from Azure Blob Storage using only the
+// standard library. It backs the azblob:// scheme of confer's
+// AddObjectSource, addressing a container and blob within the account:
+//
+//	err := config.AddObjectSource("azblob://configs/app.yaml", time.Minute)
+//
+// The account is taken from Options or AZURE_STORAGE_ACCOUNT. Requests are
+// authorized with a SAS token from Options or AZURE_STORAGE_SAS_TOKEN, or
+// else signed with the account key from Options or AZURE_STORAGE_KEY. With
+// neither, only public containers can be read.
+package azblob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The REST API version requests are made with.
+const apiVersion = "2021-08-06"
+
+type Options struct {
+	// The storage account. Defaults to AZURE_STORAGE_ACCOUNT.
+	Account string
+
+	// The base URL of the blob service, e.g. "http://127.0.0.1:10000/devstoreaccount1"
+	// for Azurite. Defaults to https://<account>.blob.core.windows.net.
+	Endpoint string
+
+	// A shared access signature, with or without the leading "?". Defaults
+	// to AZURE_STORAGE_SAS_TOKEN.
+	SASToken string
+
+	// The base64 encoded account key. Defaults to AZURE_STORAGE_KEY.
+	AccountKey string
+
+	// Defaults to a client with a 30 second timeout.
+	Client *http.Client
+}
+
+// Fetches blobs from Azure.
+type Store struct {
+	opts Options
+	now  func() time.Time
+}
+
+func New(opts Options) *Store {
+	if opts.Account == "" {
+		opts.Account = os.Getenv("AZURE_STORAGE_ACCOUNT")
+	}
+	if opts.SASToken == "" {
+		opts.SASToken = os.Getenv("AZURE_STORAGE_SAS_TOKEN")
+	}
+	if opts.AccountKey == "" {
+		opts.AccountKey = os.Getenv("AZURE_STORAGE_KEY")
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Store{opts: opts, now: time.Now}
+}
+
+// Returns the contents and ETag of the blob at key within the container
+// bucket. If etag is non-empty and still current, returns nil data and the
+// same ETag without downloading the blob again.
+func (s *Store) Fetch(bucket, key, etag string) ([]byte, string, error) {
+	endpoint := s.opts.Endpoint
+	if endpoint == "" {
+		if s.opts.Account == "" {
+			return nil, "", fmt.Errorf("Unable to fetch azblob://%s/%s: no storage account configured", bucket, key)
+		}
+		endpoint = "https://" + s.opts.Account + ".blob.core.windows.net"
+	}
+
+	rawurl := strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + escapePath(strings.TrimPrefix(key, "/"))
+	if sas := strings.TrimPrefix(s.opts.SASToken, "?"); sas != "" {
+		rawurl += "?" + sas
+	}
+
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("x-ms-date", s.now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", apiVersion)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if s.opts.SASToken == "" && s.opts.AccountKey != "" {
+		if err := sign(req, s.opts.Account, s.opts.AccountKey); err != nil {
+			return nil, "", err
+		}
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, resp.Header.Get("ETag"), nil
+	case http.StatusNotModified:
+		return nil, etag, nil
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return nil, "", fmt.Errorf("Unable to fetch azblob://%s/%s: %s %s", bucket, key, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// Signs req with Shared Key authorization, covering every header already set
+// on the request.
+func sign(req *http.Request, account, accountKey string) error {
+	key, err := base64.StdEncoding.DecodeString(accountKey)
+	if err != nil {
+		return fmt.Errorf("Invalid Azure storage account key: %v", err)
+	}
+
+	msHeaders := []string{}
+	for name := range req.Header {
+		if lowered := strings.ToLower(name); strings.HasPrefix(lowered, "x-ms-") {
+			msHeaders = append(msHeaders, lowered)
+		}
+	}
+	sort.Strings(msHeaders)
+
+	canonicalHeaders := ""
+	for _, name := range msHeaders {
+		canonicalHeaders += name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n"
+	}
+
+	canonicalResource := "/" + account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	params := []string{}
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := query[name]
+		sort.Strings(values)
+		canonicalResource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		"", // Content-Length, empty for requests without a body.
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, superseded by x-ms-date.
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalHeaders + canonicalResource,
+	}, "\n")
+
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	req.Header.Set("Authorization", "SharedKey "+account+":"+signature)
+	return nil
+}
+
+// Escapes each segment of a blob name, leaving slashes intact.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
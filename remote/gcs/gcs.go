@@ -0,0 +1,169 @@
+// Package gcs fetches objects from Google Cloud Storage using only the
+// standard library. It backs the gs:// scheme of confer's AddObjectSource:
+//
+//	err := config.AddObjectSource("gs://my-bucket/app.yaml", time.Minute)
+//
+// Access tokens are taken from Options, then the GOOGLE_OAUTH_ACCESS_TOKEN
+// environment variable, and finally the GCE metadata server, so service
+// accounts attached to GCE, GKE and Cloud Run work without configuration.
+// Requests to an emulator named by STORAGE_EMULATOR_HOST aren't
+// authenticated.
+package gcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEndpoint = "https://storage.googleapis.com"
+	metadataHost    = "http://metadata.google.internal"
+)
+
+type Options struct {
+	// The base URL of the storage API. Defaults to STORAGE_EMULATOR_HOST or
+	// Google itself.
+	Endpoint string
+
+	// A static OAuth2 access token. Leave empty to discover one.
+	Token string
+
+	// Defaults to a client with a 30 second timeout.
+	Client *http.Client
+}
+
+// Fetches objects from Cloud Storage.
+type Store struct {
+	opts      Options
+	anonymous bool
+
+	// Overridable for tests.
+	metadataHost string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func New(opts Options) *Store {
+	anonymous := false
+	if opts.Endpoint == "" {
+		if emulator := os.Getenv("STORAGE_EMULATOR_HOST"); emulator != "" {
+			opts.Endpoint, anonymous = emulator, true
+			if !strings.Contains(emulator, "://") {
+				opts.Endpoint = "http://" + emulator
+			}
+		} else {
+			opts.Endpoint = defaultEndpoint
+		}
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Store{opts: opts, anonymous: anonymous, metadataHost: metadataHost}
+}
+
+// Returns the contents and ETag of the object at key. If etag is non-empty
+// and still current, returns nil data and the same ETag without downloading
+// the object again.
+func (s *Store) Fetch(bucket, key, etag string) ([]byte, string, error) {
+	endpoint := strings.TrimSuffix(s.opts.Endpoint, "/")
+	req, err := http.NewRequest("GET", endpoint+"/"+bucket+"/"+escapePath(strings.TrimPrefix(key, "/")), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !s.anonymous {
+		token, err := s.accessToken()
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, resp.Header.Get("ETag"), nil
+	case http.StatusNotModified:
+		return nil, etag, nil
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return nil, "", fmt.Errorf("Unable to fetch gs://%s/%s: %s %s", bucket, key, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// Returns an access token, caching tokens from the metadata server until
+// shortly before they expire.
+func (s *Store) accessToken() (string, error) {
+	if s.opts.Token != "" {
+		return s.opts.Token, nil
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Add(time.Minute).Before(s.expires) {
+		return s.token, nil
+	}
+
+	req, err := http.NewRequest("GET", s.metadataHost+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Unable to find Google credentials: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Unable to find Google credentials: metadata server returned %s", resp.Status)
+	}
+
+	var doc struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", err
+	}
+
+	s.token = doc.AccessToken
+	s.expires = time.Now().Add(time.Duration(doc.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+// Escapes each segment of an object name, leaving slashes intact.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,92 @@
+// Package pgp decrypts remote configuration encrypted with OpenPGP, in the
+// style of crypt, for confer's ReadSecureRemote and WatchSecureRemote:
+//
+//	f, _ := os.Open("/etc/myapp/secring.gpg")
+//	keyring, err := pgp.NewKeyring(f)
+//	...
+//	err = config.ReadSecureRemote("etcd://config/billing.yaml", keyring)
+//
+// Payloads may be ASCII armored, base64 encoded as crypt stores them, or
+// binary. OpenPGP is implemented by ProtonMail's maintained fork of the
+// deprecated golang.org/x/crypto/openpgp. See the age package for a simpler
+// alternative.
+package pgp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// A set of OpenPGP keys. Private keys decrypt payloads, public keys encrypt
+// them.
+type Keyring struct {
+	entities openpgp.EntityList
+}
+
+// Reads an ASCII armored or binary keyring, e.g. as exported by
+// `gpg --export-secret-keys`. Encrypted private keys aren't supported.
+func NewKeyring(r io.Reader) (*Keyring, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(raw))
+	if err != nil {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(raw))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read keyring: %v", err)
+	}
+	return &Keyring{entities: entities}, nil
+}
+
+// Decrypts a payload encrypted for any key in the keyring.
+func (k *Keyring) Decrypt(ciphertext []byte) ([]byte, error) {
+	var body io.Reader
+	trimmed := bytes.TrimSpace(ciphertext)
+
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN")) {
+		block, err := armor.Decode(bytes.NewReader(trimmed))
+		if err != nil {
+			return nil, err
+		}
+		body = block.Body
+	} else if decoded, err := base64.StdEncoding.DecodeString(string(trimmed)); err == nil {
+		body = bytes.NewReader(decoded)
+	} else {
+		body = bytes.NewReader(ciphertext)
+	}
+
+	md, err := openpgp.ReadMessage(body, k.entities, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt: %v", err)
+	}
+	return ioutil.ReadAll(md.UnverifiedBody)
+}
+
+// Encrypts plaintext for every key in the keyring, base64 encoded as crypt
+// stores it, for tools that write encrypted configuration.
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := openpgp.Encrypt(&buf, k.entities, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, base64.StdEncoding.EncodedLen(buf.Len()))
+	base64.StdEncoding.Encode(out, buf.Bytes())
+	return out, nil
+}
@@ -0,0 +1,191 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	containerCredentialsHost = "http://169.254.170.2"
+	instanceMetadataHost     = "http://169.254.169.254"
+)
+
+type credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Zero for credentials that don't expire.
+	Expiration time.Time
+}
+
+// Resolves credentials in order of preference, caching temporary credentials
+// until shortly before they expire.
+type credentialChain struct {
+	static credentials
+	client *http.Client
+
+	// Overridable for tests.
+	containerHost string
+	metadataHost  string
+
+	mu     sync.Mutex
+	cached credentials
+}
+
+func newCredentialChain(opts Options, client *http.Client) *credentialChain {
+	return &credentialChain{
+		static: credentials{
+			AccessKeyID:     opts.AccessKeyID,
+			SecretAccessKey: opts.SecretAccessKey,
+			SessionToken:    opts.SessionToken,
+		},
+		client:        client,
+		containerHost: containerCredentialsHost,
+		metadataHost:  instanceMetadataHost,
+	}
+}
+
+func (c *credentialChain) get() (credentials, error) {
+	if c.static.AccessKeyID != "" {
+		return c.static, nil
+	}
+
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return credentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached.AccessKeyID != "" && time.Now().Add(5*time.Minute).Before(c.cached.Expiration) {
+		return c.cached, nil
+	}
+
+	creds, err := c.fetchContainerCredentials()
+	if err == nil && creds.AccessKeyID == "" {
+		creds, err = c.fetchInstanceCredentials()
+	}
+	if err != nil {
+		return credentials{}, fmt.Errorf("Unable to find AWS credentials: %v", err)
+	}
+
+	c.cached = creds
+	return creds, nil
+}
+
+// Reads credentials for the task role on ECS and similar container
+// platforms. Returns empty credentials when not running on one.
+func (c *credentialChain) fetchContainerCredentials() (credentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = c.containerHost + relative
+	}
+	if endpoint == "" {
+		return credentials{}, nil
+	}
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return credentials{}, err
+	}
+
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return credentials{}, err
+		}
+		token = strings.TrimSpace(string(contents))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	return c.decodeCredentials(req)
+}
+
+// Reads credentials for the instance profile from the EC2 instance metadata
+// service, using IMDSv2 session tokens.
+func (c *credentialChain) fetchInstanceCredentials() (credentials, error) {
+	tokenReq, err := http.NewRequest("PUT", c.metadataHost+"/latest/api/token", nil)
+	if err != nil {
+		return credentials{}, err
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+
+	token, err := c.readBody(tokenReq)
+	if err != nil {
+		return credentials{}, err
+	}
+
+	roleReq, err := http.NewRequest("GET", c.metadataHost+"/latest/meta-data/iam/security-credentials/", nil)
+	if err != nil {
+		return credentials{}, err
+	}
+	roleReq.Header.Set("X-aws-ec2-metadata-token", token)
+
+	role, err := c.readBody(roleReq)
+	if err != nil {
+		return credentials{}, err
+	}
+	role = strings.TrimSpace(strings.SplitN(role, "\n", 2)[0])
+
+	credsReq, err := http.NewRequest("GET", c.metadataHost+"/latest/meta-data/iam/security-credentials/"+role, nil)
+	if err != nil {
+		return credentials{}, err
+	}
+	credsReq.Header.Set("X-aws-ec2-metadata-token", token)
+
+	return c.decodeCredentials(credsReq)
+}
+
+func (c *credentialChain) readBody(req *http.Request) (string, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", req.URL, resp.Status)
+	}
+	return string(body), nil
+}
+
+func (c *credentialChain) decodeCredentials(req *http.Request) (credentials, error) {
+	body, err := c.readBody(req)
+	if err != nil {
+		return credentials{}, err
+	}
+
+	var doc struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		return credentials{}, err
+	}
+
+	return credentials{
+		AccessKeyID:     doc.AccessKeyId,
+		SecretAccessKey: doc.SecretAccessKey,
+		SessionToken:    doc.Token,
+		Expiration:      doc.Expiration,
+	}, nil
+}
@@ -0,0 +1,250 @@
+// Package s3 fetches objects from Amazon S3 and S3 compatible stores such as
+// MinIO, using only the standard library. It backs the s3:// scheme of
+// confer's AddObjectSource:
+//
+//	err := config.AddObjectSource("s3://my-bucket/app.yaml", time.Minute)
+//
+// Credentials are taken from Options, then the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, then the
+// ECS container credentials endpoint and finally the EC2 instance metadata
+// service, so IAM roles work without configuration.
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+type Options struct {
+	// Defaults to AWS_REGION, AWS_DEFAULT_REGION or us-east-1.
+	Region string
+
+	// The base URL of an S3 compatible service, e.g. "http://minio:9000".
+	// Defaults to AWS_ENDPOINT_URL_S3, AWS_ENDPOINT_URL or AWS itself.
+	Endpoint string
+
+	// Addresses buckets as a path prefix rather than a subdomain. Usually
+	// required by MinIO.
+	PathStyle bool
+
+	// Static credentials. Leave empty to discover them.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Defaults to a client with a 30 second timeout.
+	Client *http.Client
+}
+
+// Fetches objects from S3.
+type Store struct {
+	opts  Options
+	creds *credentialChain
+	now   func() time.Time
+}
+
+func New(opts Options) *Store {
+	if opts.Region == "" {
+		opts.Region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Store{
+		opts:  opts,
+		creds: newCredentialChain(opts, opts.Client),
+		now:   time.Now,
+	}
+}
+
+// Returns the contents and ETag of the object at key. If etag is non-empty
+// and still current, returns nil data and the same ETag without downloading
+// the object again.
+func (s *Store) Fetch(bucket, key, etag string) ([]byte, string, error) {
+	req, err := http.NewRequest("GET", s.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	creds, err := s.creds.get()
+	if err != nil {
+		return nil, "", err
+	}
+	sign(req, creds, s.opts.Region, s.now())
+
+	// Added after signing as it needn't be covered by the signature.
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, resp.Header.Get("ETag"), nil
+	case http.StatusNotModified:
+		return nil, etag, nil
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return nil, "", fmt.Errorf("Unable to fetch s3://%s/%s: %s %s", bucket, key, resp.Status, strings.TrimSpace(string(body)))
+}
+
+func (s *Store) objectURL(bucket, key string) string {
+	key = strings.TrimPrefix(key, "/")
+
+	if s.opts.Endpoint != "" {
+		endpoint := strings.TrimSuffix(s.opts.Endpoint, "/")
+		if s.opts.PathStyle {
+			return endpoint + "/" + bucket + "/" + escapePath(key)
+		}
+		if u, err := url.Parse(endpoint); err == nil {
+			u.Host = bucket + "." + u.Host
+			return u.String() + "/" + escapePath(key)
+		}
+	}
+
+	if s.opts.PathStyle {
+		return fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", s.opts.Region, bucket, escapePath(key))
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, s.opts.Region, escapePath(key))
+}
+
+// Signs req with AWS Signature Version 4, covering the host and every header
+// already set on the request.
+func sign(req *http.Request, creds credentials, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func canonicalQuery(values url.Values) string {
+	pairs := []string{}
+	for key, vals := range values {
+		for _, val := range vals {
+			pairs = append(pairs, escape(key)+"="+escape(val))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// URI encodes a path as SigV4 expects, leaving slashes intact.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// Percent encodes everything but unreserved characters.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if val := os.Getenv(name); val != "" {
+			return val
+		}
+	}
+	return ""
+}
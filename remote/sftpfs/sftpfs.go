@@ -0,0 +1,210 @@
+// Package sftpfs reads configuration files from a remote host over SFTP, for
+// appliance-style deployments where a management host publishes
+// configuration that devices pull on boot:
+//
+//	fs := sftpfs.New(sftpfs.Options{
+//		Addr:           "config.internal:22",
+//		User:           "device",
+//		PrivateKeyFile: "/etc/device/id_ed25519",
+//		KnownHostsFile: "/etc/device/known_hosts",
+//	})
+//	defer fs.Close()
+//
+//	config.SetFileSystem(fs)
+//	err := config.ReadPaths("/srv/config/device.yaml")
+//
+// The connection is established on the first read and re-established if it
+// drops, so Reload picks up changes pushed to the management host.
+package sftpfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// How to reach and authenticate with the remote host.
+type Options struct {
+	// The host and port, e.g. "config.internal:22". The port defaults to 22.
+	Addr string
+	User string
+
+	// Credentials. Keys are tried before the password.
+	Password       string
+	PrivateKey     []byte
+	PrivateKeyFile string
+	// Decrypts an encrypted private key.
+	Passphrase string
+
+	// Verifies the host's identity, either against a known_hosts file or a
+	// single expected key. One of these is required unless
+	// InsecureIgnoreHostKey is set.
+	KnownHostsFile string
+	HostKey        ssh.PublicKey
+
+	// Skips host key verification. Only suitable for testing.
+	InsecureIgnoreHostKey bool
+
+	// Limits how long connecting may take. Defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// A reader.FileSystem backed by an SFTP server.
+type FileSystem struct {
+	opts Options
+
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+// Returns a file system reading from the host described by opts. No
+// connection is made until the first read.
+func New(opts Options) *FileSystem {
+	if _, _, err := net.SplitHostPort(opts.Addr); err != nil {
+		opts.Addr = net.JoinHostPort(opts.Addr, "22")
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &FileSystem{opts: opts}
+}
+
+// Reads the file at path on the remote host.
+func (fs *FileSystem) ReadFile(path string) ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.connect(); err != nil {
+		return nil, err
+	}
+
+	data, err := fs.readFile(path)
+	if err != nil && fs.disconnected() {
+		// Retry once on a fresh connection.
+		fs.close()
+		if err := fs.connect(); err != nil {
+			return nil, err
+		}
+		data, err = fs.readFile(path)
+	}
+	return data, err
+}
+
+// Closes the connection, if any. The file system may still be used, in
+// which case it reconnects.
+func (fs *FileSystem) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.close()
+}
+
+func (fs *FileSystem) readFile(path string) ([]byte, error) {
+	f, err := fs.client.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func (fs *FileSystem) connect() error {
+	if fs.client != nil {
+		return nil
+	}
+
+	config, err := fs.clientConfig()
+	if err != nil {
+		return err
+	}
+
+	conn, err := ssh.Dial("tcp", fs.opts.Addr, config)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s: %v", fs.opts.Addr, err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Unable to start SFTP on %s: %v", fs.opts.Addr, err)
+	}
+
+	fs.conn, fs.client = conn, client
+	return nil
+}
+
+// Reports whether the connection has been lost, as opposed to a read failing
+// for some other reason such as a missing file.
+func (fs *FileSystem) disconnected() bool {
+	_, err := fs.client.Getwd()
+	return err != nil
+}
+
+func (fs *FileSystem) close() error {
+	if fs.client == nil {
+		return nil
+	}
+
+	fs.client.Close()
+	err := fs.conn.Close()
+	fs.conn, fs.client = nil, nil
+	return err
+}
+
+func (fs *FileSystem) clientConfig() (*ssh.ClientConfig, error) {
+	opts := fs.opts
+	auth := []ssh.AuthMethod{}
+
+	key := opts.PrivateKey
+	if key == nil && opts.PrivateKeyFile != "" {
+		var err error
+		if key, err = ioutil.ReadFile(opts.PrivateKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if key != nil {
+		var signer ssh.Signer
+		var err error
+		if opts.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(opts.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if opts.Password != "" {
+		auth = append(auth, ssh.Password(opts.Password))
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case opts.HostKey != nil:
+		hostKeyCallback = ssh.FixedHostKey(opts.HostKey)
+	case opts.KnownHostsFile != "":
+		var err error
+		if hostKeyCallback, err = knownhosts.New(opts.KnownHostsFile); err != nil {
+			return nil, err
+		}
+	case opts.InsecureIgnoreHostKey:
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("No host key verification configured for %s", opts.Addr)
+	}
+
+	return &ssh.ClientConfig{
+		User:            opts.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         opts.Timeout,
+	}, nil
+}
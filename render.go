@@ -0,0 +1,78 @@
+package confer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// Writes the value at key to w in the given format: yaml, json, toml, plain
+// or a registered codec's. Subtrees are written as documents and scalars as
+// values, so both a single setting and a whole section can be inspected:
+//
+//	config.Render("app.database", "yaml", os.Stdout)
+//
+// TOML has no bare values, so a scalar is written as an assignment to the
+// last segment of key. Plain writes a scalar as is, a list one item per line
+// and a subtree as sorted key=value lines. Secrets are redacted.
+func (manager *Config) Render(key string, format string, w io.Writer) error {
+	val := manager.Get(key)
+	if val == nil {
+		return fmt.Errorf("%s is not set", key)
+	}
+	val = manager.redactTree(key, maps.Normalize(val))
+
+	if format == "plain" {
+		return renderPlain(w, key, val)
+	}
+
+	if _, isMap := val.(map[string]interface{}); !isMap && format == "toml" {
+		parts := strings.Split(key, ".")
+		val = map[string]interface{}{parts[len(parts)-1]: val}
+	}
+	return writeDocument(w, val, format)
+}
+
+// Redacts the secrets within the value at key.
+func (manager *Config) redactTree(key string, val interface{}) interface{} {
+	m, ok := val.(map[string]interface{})
+	if !ok {
+		return manager.redact(key, val)
+	}
+
+	redacted := map[string]interface{}{}
+	for child, v := range m {
+		redacted[child] = manager.redactTree(key+"."+child, v)
+	}
+	return redacted
+}
+
+func renderPlain(w io.Writer, key string, val interface{}) error {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		flat := maps.Flatten(v)
+		keys := make([]string, 0, len(flat))
+		for k := range flat {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, err := fmt.Fprintf(w, "%s.%s=%v\n", key, k, flat[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if _, err := fmt.Fprintln(w, item); err != nil {
+				return err
+			}
+		}
+	default:
+		_, err := fmt.Fprintln(w, v)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package confer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// A time of day with minute precision, written as HH:MM, e.g. "02:30".
+type ClockTime struct {
+	Hour   int
+	Minute int
+}
+
+// Parses a 24 hour HH:MM time of day.
+func ParseClockTime(s string) (ClockTime, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 || len(parts[1]) != 2 {
+		return ClockTime{}, fmt.Errorf("%q is not a time of day in HH:MM form", s)
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return ClockTime{}, fmt.Errorf("%q has an invalid hour", s)
+	}
+
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return ClockTime{}, fmt.Errorf("%q has an invalid minute", s)
+	}
+
+	return ClockTime{Hour: hour, Minute: minute}, nil
+}
+
+func (c ClockTime) String() string {
+	return fmt.Sprintf("%02d:%02d", c.Hour, c.Minute)
+}
+
+// Returns the time on the same day as t, in t's location, at this time of
+// day.
+func (c ClockTime) On(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), c.Hour, c.Minute, 0, 0, t.Location())
+}
+
+// Returns the first occurrence of this time of day strictly after t.
+func (c ClockTime) Next(t time.Time) time.Time {
+	next := c.On(t)
+	if !next.After(t) {
+		next = c.On(t.AddDate(0, 0, 1))
+	}
+	return next
+}
+
+// A parsed five field cron expression: minute, hour, day of month, month and
+// day of week. Supports lists, ranges, steps, month and weekday names and the
+// @yearly, @monthly, @weekly, @daily and @hourly macros.
+type Cron struct {
+	expr string
+
+	minute, hour, dom, month, dow uint64
+
+	// Whether the day fields were restricted, which changes how they combine.
+	domStar, dowStar bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dowNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Parses a cron expression such as "*/15 9-17 * * MON-FRI".
+func ParseCron(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, exists := cronMacros[strings.ToLower(spec)]; exists {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%q must have 5 fields, found %d", expr, len(fields))
+	}
+
+	c := &Cron{expr: expr}
+	var err error
+
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("%q has an invalid minute: %v", expr, err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("%q has an invalid hour: %v", expr, err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("%q has an invalid day of month: %v", expr, err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("%q has an invalid month: %v", expr, err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, dowNames); err != nil {
+		return nil, fmt.Errorf("%q has an invalid day of week: %v", expr, err)
+	}
+
+	// Both 0 and 7 mean Sunday.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.domStar = fields[2] == "*" || fields[2] == "?"
+	c.dowStar = fields[4] == "*" || fields[4] == "?"
+	return c, nil
+}
+
+// Parses a comma separated list of values, ranges and steps into a bitset.
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = s
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = cronValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(bounds[1], names); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := cronValue(part, names)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside of %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func cronValue(s string, names map[string]int) (int, error) {
+	if v, exists := names[strings.ToLower(s)]; exists {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return v, nil
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Returns the first time strictly after t matching the expression, or the
+// zero time if there is none within five years.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// As in cron(8), when both day fields are restricted a day matching either
+// of them matches.
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Returns the cron expression at key, or nil if it is unset or invalid.
+func (manager *Config) GetCron(key string) *Cron {
+	c, _ := manager.GetCronE(key)
+	return c
+}
+
+// Returns the cron expression at key, or an error describing why it could
+// not be parsed.
+func (manager *Config) GetCronE(key string) (*Cron, error) {
+	val := manager.Get(key)
+	if val == nil {
+		return nil, fmt.Errorf("%q is not set", key)
+	}
+	return ParseCron(cast.ToString(val))
+}
+
+// Returns the HH:MM time of day at key, or midnight if it is unset or
+// invalid. See GetClockTimeE to tell the difference.
+func (manager *Config) GetClockTime(key string) ClockTime {
+	c, _ := manager.GetClockTimeE(key)
+	return c
+}
+
+// Returns the HH:MM time of day at key, or an error describing why it could
+// not be parsed.
+func (manager *Config) GetClockTimeE(key string) (ClockTime, error) {
+	val := manager.Get(key)
+	if val == nil {
+		return ClockTime{}, fmt.Errorf("%q is not set", key)
+	}
+	return ParseClockTime(cast.ToString(val))
+}
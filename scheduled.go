@@ -0,0 +1,234 @@
+package confer
+
+import (
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// How often WatchSchedules looks for new scheduled values when none are due.
+var scheduleRescanInterval = time.Minute
+
+// Enables values with activation windows, resolved whenever they're read:
+//
+//	maintenance:
+//	  value: true
+//	  effective_at: 2025-01-01T00:00Z
+//	  expires_at: 2025-01-01T04:00Z
+//
+// Outside its window such a value is skipped, so the layers beneath it apply,
+// e.g. a default. expires_at is optional. A list of scheduled values resolves
+// to the active entry that became effective last, for a sequence of planned
+// changes. Times are RFC 3339, seconds optional.
+func (manager *Config) SetScheduledValues(enabled bool) {
+	manager.schedulesEnabled = enabled
+	manager.attributesChanged()
+}
+
+// Registers a handler invoked with the keys whose value changed because an
+// activation window opened or closed. Requires WatchSchedules.
+func (manager *Config) OnScheduledChange(fn ChangeHandler) {
+	manager.scheduledChangeHandlers = append(manager.scheduledChangeHandlers, fn)
+}
+
+// Starts firing OnScheduledChange handlers as activation windows open and
+// close, publishing the new values. Stop with StopSchedules.
+func (manager *Config) WatchSchedules() {
+	manager.StopSchedules()
+	stop, done := make(chan struct{}), make(chan struct{})
+	manager.schedulesStop, manager.schedulesDone = stop, done
+	go manager.runSchedules(stop, done)
+}
+
+// Stops WatchSchedules, returning once it has stopped.
+func (manager *Config) StopSchedules() {
+	if manager.schedulesStop != nil {
+		close(manager.schedulesStop)
+		<-manager.schedulesDone
+		manager.schedulesStop, manager.schedulesDone = nil, nil
+	}
+}
+
+func (manager *Config) runSchedules(stop, done chan struct{}) {
+	defer close(done)
+	before := manager.scheduledSettings()
+	for {
+		wait := scheduleRescanInterval
+		if next, ok := manager.nextScheduleBoundary(timeNow()); ok {
+			if until := next.Sub(timeNow()); until < wait {
+				wait = until
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		after := manager.scheduledSettings()
+		changes := diffSettings(before, after)
+		before = after
+		if len(changes) == 0 {
+			continue
+		}
+
+		jww.INFO.Println(len(changes), "scheduled values changed")
+		manager.attributesChanged()
+		for _, fn := range manager.scheduledChangeHandlers {
+			fn(changes)
+		}
+	}
+}
+
+// Returns the resolved value of every scheduled key.
+func (manager *Config) scheduledSettings() map[string]interface{} {
+	settings := map[string]interface{}{}
+	for key := range manager.scheduledValues() {
+		settings[key] = manager.Get(key)
+	}
+	return settings
+}
+
+// Returns the next time any activation window opens or closes after now.
+func (manager *Config) nextScheduleBoundary(now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, val := range manager.scheduledValues() {
+		for _, entry := range scheduleEntries(val) {
+			for _, t := range []time.Time{entry.from, entry.until} {
+				if t.After(now) && (next.IsZero() || t.Before(next)) {
+					next = t
+				}
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Returns the raw scheduled values held by the stored layers, by lower cased
+// key.
+func (manager *Config) scheduledValues() map[string]interface{} {
+	found := map[string]interface{}{}
+
+	var walk func(prefix string, val interface{})
+	walk = func(prefix string, val interface{}) {
+		if scheduleEntries(val) != nil {
+			found[prefix] = val
+			return
+		}
+		if m, ok := val.(map[string]interface{}); ok {
+			for key, child := range m {
+				walk(strings.TrimPrefix(prefix+"."+strings.ToLower(key), "."), child)
+			}
+		}
+	}
+
+	if manager.schedulesEnabled {
+		walk("", manager.storedSettings())
+	}
+	return found
+}
+
+// Reports whether key lies within a scheduled value, e.g. maintenance.value.
+func (manager *Config) withinSchedule(key string) bool {
+	parts := strings.Split(key, ".")
+	for i := 1; i < len(parts); i++ {
+		for _, layer := range manager.precedence {
+			if val, exists := manager.lookupLayer(layer, strings.Join(parts[:i], ".")); exists && scheduleEntries(val) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// An activation window.
+type scheduleEntry struct {
+	value       interface{}
+	from, until time.Time
+}
+
+// Resolves a scheduled value as of now. Returns false if val is scheduled but
+// not active, and val itself if it isn't scheduled.
+func resolveSchedule(val interface{}, now time.Time) (interface{}, bool) {
+	entries := scheduleEntries(val)
+	if entries == nil {
+		return val, true
+	}
+
+	var active *scheduleEntry
+	for i, entry := range entries {
+		if now.Before(entry.from) || (!entry.until.IsZero() && !now.Before(entry.until)) {
+			continue
+		}
+		if active == nil || !entry.from.Before(active.from) {
+			active = &entries[i]
+		}
+	}
+	if active == nil {
+		return nil, false
+	}
+	return active.value, true
+}
+
+// Parses a scheduled value, or a list of them. Returns nil for anything else.
+func scheduleEntries(val interface{}) []scheduleEntry {
+	if list, ok := val.([]interface{}); ok && len(list) > 0 {
+		entries := []scheduleEntry{}
+		for _, item := range list {
+			entry, ok := parseScheduleEntry(item)
+			if !ok {
+				return nil
+			}
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+
+	if entry, ok := parseScheduleEntry(val); ok {
+		return []scheduleEntry{entry}
+	}
+	return nil
+}
+
+func parseScheduleEntry(val interface{}) (scheduleEntry, bool) {
+	m, err := cast.ToStringMapE(val)
+	if err != nil {
+		return scheduleEntry{}, false
+	}
+
+	value, hasValue := m["value"]
+	rawFrom, hasFrom := m["effective_at"]
+	rawUntil, hasUntil := m["expires_at"]
+	fields := 2
+	if hasUntil {
+		fields++
+	}
+	if !hasValue || !hasFrom || len(m) != fields {
+		return scheduleEntry{}, false
+	}
+
+	entry := scheduleEntry{value: value}
+	if entry.from, err = parseScheduleTime(rawFrom); err != nil {
+		return scheduleEntry{}, false
+	}
+	if hasUntil {
+		if entry.until, err = parseScheduleTime(rawUntil); err != nil {
+			return scheduleEntry{}, false
+		}
+	}
+	return entry, true
+}
+
+func parseScheduleTime(val interface{}) (time.Time, error) {
+	if s, ok := val.(string); ok {
+		if t, err := time.Parse("2006-01-02T15:04Z07:00", s); err == nil {
+			return t, nil
+		}
+	}
+	return cast.ToTimeE(val)
+}
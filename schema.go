@@ -0,0 +1,231 @@
+package confer
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+
+	errors "github.com/jacobstr/confer/errors"
+)
+
+// The expected type of a configuration value.
+type ValueType string
+
+const (
+	TypeAny         ValueType = ""
+	TypeString      ValueType = "string"
+	TypeInt         ValueType = "int"
+	TypeFloat       ValueType = "float"
+	TypeBool        ValueType = "bool"
+	TypeDuration    ValueType = "duration"
+	TypeTime        ValueType = "time"
+	TypeStringSlice ValueType = "[]string"
+	TypeMap         ValueType = "map"
+	// A five field cron expression, see ParseCron.
+	TypeCron ValueType = "cron"
+	// An HH:MM time of day, see ParseClockTime.
+	TypeClockTime ValueType = "clock"
+)
+
+// Declares the expectations for a single key. Built with Define:
+//
+//	config.Define("jobs.cleanup.schedule").
+//		As(confer.TypeCron).
+//		Describe("When stale sessions are purged").
+//		WithDefault("@daily")
+type KeySpec struct {
+	Key         string
+	Type        ValueType
+	Description string
+	Default     interface{}
+	Required    bool
+	// The unit of bare numbers for durations, see DurationUnit.
+	Unit time.Duration
+	// The Go type values are cast to, see CastTo.
+	GoType reflect.Type
+
+	manager *Config
+}
+
+// Declares a key in the schema, returning its spec for further refinement.
+// Defining a key that already exists returns the existing spec.
+func (manager *Config) Define(key string) *KeySpec {
+	lowered := strings.ToLower(key)
+	if spec, exists := manager.schema[lowered]; exists {
+		return spec
+	}
+
+	spec := &KeySpec{Key: key, manager: manager}
+	manager.schema[lowered] = spec
+	return spec
+}
+
+// Returns every key declared with Define, sorted by key.
+func (manager *Config) Schema() []*KeySpec {
+	specs := []*KeySpec{}
+	for _, spec := range manager.schema {
+		specs = append(specs, spec)
+	}
+	sort.Sort(specsByKey(specs))
+	return specs
+}
+
+// Returns the spec for key, if it was declared.
+func (manager *Config) Spec(key string) (*KeySpec, bool) {
+	spec, exists := manager.schema[strings.ToLower(key)]
+	return spec, exists
+}
+
+// Sets the expected type.
+func (k *KeySpec) As(t ValueType) *KeySpec {
+	k.Type = t
+	return k
+}
+
+// Sets a human readable description.
+func (k *KeySpec) Describe(text string) *KeySpec {
+	k.Description = text
+	return k
+}
+
+// Sets the default value, registering it with SetDefault.
+func (k *KeySpec) WithDefault(val interface{}) *KeySpec {
+	k.Default = val
+	k.manager.SetDefault(k.Key, val)
+	return k
+}
+
+// Declares the key a duration whose bare numbers are in unit, e.g. for legacy
+// configs expressing timeouts in milliseconds:
+//
+//	config.Define("http.timeout").DurationUnit(time.Millisecond)
+//
+// A value of 1500 is then returned by Get as the time.Duration 1.5s. Strings
+// carrying their own unit, such as "2s", are unaffected.
+func (k *KeySpec) DurationUnit(unit time.Duration) *KeySpec {
+	k.Type = TypeDuration
+	k.Unit = unit
+	return k
+}
+
+// Declares the key holds values of type t, converted by the caster registered
+// for t with RegisterCaster, so Get, and Unmarshal, return them ready to use:
+//
+//	config.Define("logging.level").CastTo(reflect.TypeOf(LogLevel(0)))
+//	level := config.Get("logging.level").(LogLevel)
+func (k *KeySpec) CastTo(t reflect.Type) *KeySpec {
+	k.GoType = t
+	return k
+}
+
+// Marks the key as mandatory. Checked by Validate.
+func (k *KeySpec) Require() *KeySpec {
+	k.Required = true
+	return k
+}
+
+// Checks the configuration against the schema and registered validators.
+// Every declared key that is set must match its declared type, and be cast by
+// the caster for its CastTo type, and every required key must be set.
+func (manager *Config) Validate() error {
+	return validationError(manager.validate(true))
+}
+
+// Checks declared types, validators, and optionally required keys. Loading validates
+// without requiring keys as they may still be set programmatically.
+func (manager *Config) validate(requireAll bool) []error {
+	errs := []error{}
+
+	for _, spec := range manager.Schema() {
+		val := manager.Get(spec.Key)
+		if val == nil {
+			if spec.Required && requireAll {
+				errs = append(errs, &errors.InvalidValueError{Key: spec.Key, Reason: "required but not set"})
+			}
+			continue
+		}
+
+		if err := manager.checkType(val, spec.Type); err != nil {
+			errs = append(errs, &errors.InvalidValueError{Key: spec.Key, Reason: err.Error()})
+		}
+		// Get returns values it fails to cast as they are.
+		if _, err := manager.castKey(spec.Key, val); err != nil {
+			errs = append(errs, &errors.InvalidValueError{Key: spec.Key, Reason: err.Error()})
+		}
+	}
+
+	return append(errs, manager.runValidators()...)
+}
+
+func validationError(errs []error) error {
+	if len(errs) > 0 {
+		return &errors.LoadError{Msg: "Invalid configuration:", Errors: errs}
+	}
+	return nil
+}
+
+// Checks that val can be interpreted as t.
+func (manager *Config) checkType(val interface{}, t ValueType) error {
+	var err error
+
+	switch t {
+	case TypeString:
+		_, err = cast.ToStringE(val)
+	case TypeInt:
+		_, err = cast.ToIntE(val)
+	case TypeFloat:
+		_, err = cast.ToFloat64E(val)
+	case TypeBool:
+		_, err = manager.parseBool(val)
+	case TypeDuration:
+		_, err = cast.ToDurationE(val)
+	case TypeTime:
+		_, err = cast.ToTimeE(val)
+	case TypeStringSlice:
+		_, err = cast.ToStringSliceE(val)
+	case TypeMap:
+		_, err = cast.ToStringMapE(val)
+	case TypeCron:
+		_, err = ParseCron(cast.ToString(val))
+	case TypeClockTime:
+		_, err = ParseClockTime(cast.ToString(val))
+	}
+
+	return err
+}
+
+// Converts bare numbers at keys declared with DurationUnit into durations.
+func (manager *Config) convertUnits(key string, val interface{}) interface{} {
+	if len(manager.schema) == 0 {
+		return val
+	}
+	spec, exists := manager.schema[strings.ToLower(key)]
+	if !exists || spec.Unit == 0 {
+		return val
+	}
+
+	var n float64
+	switch v := val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		n = cast.ToFloat64(v)
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return val
+		}
+		n = f
+	default:
+		return val
+	}
+	return time.Duration(n * float64(spec.Unit))
+}
+
+type specsByKey []*KeySpec
+
+func (s specsByKey) Len() int           { return len(s) }
+func (s specsByKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s specsByKey) Less(i, j int) bool { return s[i].Key < s[j].Key }
@@ -0,0 +1,134 @@
+package confer
+
+import (
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// Adjusts ScrubSecrets.
+type ScrubOptions struct {
+	// Keep each scrubbed value so it can be read once with TakeSecret.
+	Retain bool
+}
+
+// Overwrites the values of secret keys, as reported by IsSecret, with
+// Redacted wherever confer holds them: the stored layers, the copies kept of
+// loaded files and the documents fetched from remote sources. For
+// compliance environments requiring that secrets not linger in memory once
+// the application has used them:
+//
+//	pool := db.Connect(config.GetString("db.password"))
+//	config.ScrubSecrets()
+//
+// Byte slices are zeroed in place. Go strings are immutable, so scrubbing
+// drops confer's references to them and leaves reclaiming their memory to
+// the garbage collector. Flags and the process environment aren't scrubbed,
+// and secrets bound with BindSecret are fetched again on rotation unless
+// StopSecretRotation is called first.
+//
+// With Retain, values can be read once more with TakeSecret, e.g. by a
+// component initialized after scrubbing.
+func (manager *Config) ScrubSecrets(opts ...ScrubOptions) {
+	retain := len(opts) > 0 && opts[0].Retain
+
+	// Keep pollers from merging fetched documents while they're scrubbed.
+	manager.reloadMu.Lock()
+	defer manager.reloadMu.Unlock()
+
+	secrets := []string{}
+	retained := map[string][]byte{}
+	for _, key := range manager.AllKeys() {
+		if !manager.IsSecret(key) {
+			continue
+		}
+		secrets = append(secrets, key)
+
+		if retain {
+			if val := manager.Get(key); val != nil && val != Redacted {
+				retained[strings.ToLower(key)] = []byte(cast.ToString(val))
+			}
+		}
+	}
+
+	manager.write(func() {
+		for key, val := range retained {
+			if manager.scrubbed == nil {
+				manager.scrubbed = map[string][]byte{}
+			}
+			manager.scrubbed[key] = val
+		}
+
+		for _, key := range secrets {
+			for _, store := range manager.stores(manager.precedence) {
+				if val, exists := store.Get(key); exists && val != nil {
+					zero(val)
+					store.Set(key, Redacted)
+				}
+			}
+		}
+
+		for _, data := range manager.fileData {
+			manager.scrubTree("", data)
+		}
+		for _, src := range manager.objectSources {
+			manager.scrubTree("", src.data)
+		}
+		for _, src := range manager.zooKeeperSources {
+			manager.scrubTree("", src.data)
+		}
+		for _, src := range manager.gitSources {
+			manager.scrubTree("", src.data)
+		}
+		for _, src := range manager.remoteSources {
+			manager.scrubTree("", src.data)
+		}
+		for _, binding := range manager.secretBindings {
+			binding.value = ""
+		}
+	})
+}
+
+// Returns a value removed by ScrubSecrets with Retain, then forgets it.
+// Callers should zero the slice once done with it.
+func (manager *Config) TakeSecret(key string) ([]byte, bool) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	lowered := strings.ToLower(key)
+	val, exists := manager.scrubbed[lowered]
+	delete(manager.scrubbed, lowered)
+	return val, exists
+}
+
+// Overwrites the secrets within a nested map in place.
+func (manager *Config) scrubTree(prefix string, data map[string]interface{}) {
+	for name, val := range data {
+		key := strings.TrimPrefix(prefix+"."+name, ".")
+		switch v := val.(type) {
+		case map[string]interface{}:
+			manager.scrubTree(key, v)
+		case map[interface{}]interface{}:
+			for child, cv := range v {
+				if manager.isSecret(key + "." + cast.ToString(child)) {
+					zero(cv)
+					v[child] = Redacted
+				}
+			}
+		default:
+			if val != nil && manager.isSecret(key) {
+				zero(val)
+				data[name] = Redacted
+			}
+		}
+	}
+}
+
+// Zeroes val in place if it's mutable.
+func zero(val interface{}) {
+	if b, ok := val.([]byte); ok {
+		for i := range b {
+			b[i] = 0
+		}
+	}
+}
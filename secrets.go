@@ -0,0 +1,55 @@
+package confer
+
+import (
+	"strings"
+)
+
+// Substituted for the values of secret keys wherever configuration is
+// exported or logged.
+const Redacted = "[REDACTED]"
+
+// Key segments that are treated as secret without being marked explicitly.
+var secretWords = []string{"password", "passwd", "secret", "token", "credential", "private_key"}
+
+// Marks keys holding sensitive values such as passwords or API keys, so they
+// are redacted from dumps and exports. Patterns match as in Pin.
+func (manager *Config) MarkSecret(patterns ...string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.secrets = append(manager.secrets, patterns...)
+}
+
+// Reports whether key holds a sensitive value: because it was marked
+// with MarkSecret, because its name suggests it (e.g. "db.password") or
+// because it is stored encrypted.
+func (manager *Config) IsSecret(key string) bool {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return manager.isSecret(key)
+}
+
+// IsSecret without locking, for callers already holding the lock.
+func (manager *Config) isSecret(key string) bool {
+	if anyKeyMatches(manager.secrets, key) {
+		return true
+	}
+	if len(manager.valueDecrypters) > 0 && manager.encryptedValue(manager.find(key)) {
+		return true
+	}
+
+	lowered := strings.ToLower(key)
+	for _, word := range secretWords {
+		if strings.Contains(lowered, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns val, or Redacted if key is a secret.
+func (manager *Config) redact(key string, val interface{}) interface{} {
+	if val != nil && manager.IsSecret(key) {
+		return Redacted
+	}
+	return val
+}
@@ -0,0 +1,182 @@
+package confer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// The layer holding values bound with BindSecret or read with ReadSecretsDir,
+// and its priority: above the environment and files, below flags and
+// overrides.
+const (
+	LayerSecrets    = "secrets"
+	PrioritySecrets = 350
+)
+
+// Rotation metadata for a secret, as reported by a secret manager.
+type SecretVersion struct {
+	// Identifies the current value, e.g. a version id or ETag.
+	Version string
+	// When the current value was created. Zero if unknown.
+	RotatedAt time.Time
+	// When the value is next due to rotate. Zero if unknown.
+	NextRotation time.Time
+}
+
+// Fetches secrets from a secret manager such as Vault or AWS Secrets Manager.
+type SecretStore interface {
+	// Returns the current value of the secret called name and its version.
+	FetchSecret(name string) (value string, version SecretVersion, err error)
+}
+
+// Describes a rotated secret, as passed to OnSecretRotation handlers. The new
+// value is available through Get as usual.
+type SecretRotation struct {
+	Key      string
+	Name     string
+	Previous SecretVersion
+	Current  SecretVersion
+}
+
+// A secret bound with BindSecret.
+type secretBinding struct {
+	key     string
+	name    string
+	store   SecretStore
+	value   string
+	version SecretVersion
+	stop    chan struct{}
+}
+
+// Binds key to a secret held in store, e.g:
+//
+//	err := config.BindSecret("app.database.password", vault, "db/creds", time.Minute)
+//
+// The key is marked secret. With a positive interval the secret is polled in
+// the background, and sooner if its NextRotation falls first. When its
+// version changes the new value takes effect and OnSecretRotation handlers
+// are notified, so applications can re-establish connections before the old
+// credentials lapse. Stop polling with StopSecretRotation.
+func (manager *Config) BindSecret(key string, store SecretStore, name string, interval time.Duration) error {
+	binding := &secretBinding{key: key, name: name, store: store, stop: make(chan struct{})}
+	if err := binding.fetch(); err != nil {
+		return fmt.Errorf("Unable to fetch secret %s: %v", name, err)
+	}
+
+	layer, err := manager.secretLayer()
+	if err != nil {
+		return err
+	}
+
+	manager.MarkSecret(key)
+	manager.write(func() {
+		manager.secretBindings = append(manager.secretBindings, binding)
+		layer.Set(key, binding.value)
+	})
+
+	if interval > 0 {
+		go manager.pollSecret(binding, interval)
+	}
+	return nil
+}
+
+// Returns the rotation metadata of the secret bound to key with BindSecret.
+func (manager *Config) SecretVersion(key string) (SecretVersion, bool) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	for _, binding := range manager.secretBindings {
+		if strings.EqualFold(binding.key, key) {
+			return binding.version, true
+		}
+	}
+	return SecretVersion{}, false
+}
+
+// Registers a handler invoked whenever a secret bound with BindSecret
+// rotates, after the new value has taken effect.
+func (manager *Config) OnSecretRotation(fn func(SecretRotation)) {
+	manager.secretRotationHandlers = append(manager.secretRotationHandlers, fn)
+}
+
+// Stops polling every secret bound with BindSecret. Their last fetched values
+// remain in effect.
+func (manager *Config) StopSecretRotation() {
+	for _, binding := range manager.secretBindings {
+		select {
+		case <-binding.stop:
+		default:
+			close(binding.stop)
+		}
+	}
+}
+
+func (manager *Config) pollSecret(binding *secretBinding, interval time.Duration) {
+	for {
+		wait := interval
+		if next := binding.version.NextRotation; !next.IsZero() {
+			if until := time.Until(next); until > 0 && until < wait {
+				wait = until
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-binding.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		previous := binding.version
+		value, version, err := binding.store.FetchSecret(binding.name)
+		if err != nil {
+			jww.ERROR.Println("Unable to refresh secret", binding.name, err)
+			continue
+		}
+		manager.mu.RLock()
+		rotated := binding.rotated(value, version)
+		manager.mu.RUnlock()
+		if !rotated {
+			continue
+		}
+
+		jww.INFO.Println("Secret", binding.name, "rotated to version", version.Version)
+		manager.write(func() {
+			binding.value, binding.version = value, version
+			manager.secretValues.Set(binding.key, value)
+		})
+
+		rotation := SecretRotation{
+			Key:      binding.key,
+			Name:     binding.name,
+			Previous: previous,
+			Current:  version,
+		}
+		for _, fn := range manager.secretRotationHandlers {
+			fn(rotation)
+		}
+	}
+}
+
+// Fetches the secret for the first time.
+func (binding *secretBinding) fetch() error {
+	value, version, err := binding.store.FetchSecret(binding.name)
+	if err != nil {
+		return err
+	}
+	binding.value, binding.version = value, version
+	return nil
+}
+
+// Reports whether a fetched secret differs from the bound one. Secrets
+// without a version are compared by value.
+func (binding *secretBinding) rotated(value string, version SecretVersion) bool {
+	if version.Version == "" {
+		return value != binding.value
+	}
+	return version.Version != binding.version.Version
+}
@@ -0,0 +1,97 @@
+package confer
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// Returns the list at key as ints. Strings, e.g. from environment variables,
+// are split on whitespace as in GetStringSlice.
+func (manager *Config) GetIntSlice(key string) []int {
+	items := toSlice(manager.Get(key))
+	if items == nil {
+		return nil
+	}
+
+	s := make([]int, len(items))
+	for i, item := range items {
+		s[i] = cast.ToInt(item)
+	}
+	return s
+}
+
+// Returns the list at key as booleans, parsed with the configured
+// BoolParser. Strings are split as in GetIntSlice.
+func (manager *Config) GetBoolSlice(key string) []bool {
+	items := toSlice(manager.Get(key))
+	if items == nil {
+		return nil
+	}
+
+	s := make([]bool, len(items))
+	for i, item := range items {
+		s[i] = manager.toBool(item)
+	}
+	return s
+}
+
+// Returns the list at key as float64s. Strings are split as in GetIntSlice.
+func (manager *Config) GetFloat64Slice(key string) []float64 {
+	items := toSlice(manager.Get(key))
+	if items == nil {
+		return nil
+	}
+
+	s := make([]float64, len(items))
+	for i, item := range items {
+		s[i] = cast.ToFloat64(item)
+	}
+	return s
+}
+
+// Returns the map at key with each value as a list of strings, e.g:
+//
+//	routes:
+//	  api: [api-1, api-2]
+//	  web: web-1
+func (manager *Config) GetStringMapStringSlice(key string) map[string][]string {
+	m := cast.ToStringMap(manager.Get(key))
+	if m == nil {
+		return nil
+	}
+
+	out := make(map[string][]string, len(m))
+	for k, v := range m {
+		out[k] = cast.ToStringSlice(toSlice(v))
+	}
+	return out
+}
+
+// Converts val to a generic slice, splitting strings on whitespace.
+func toSlice(val interface{}) []interface{} {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case string:
+		s := []interface{}{}
+		for _, field := range strings.Fields(v) {
+			s = append(s, field)
+		}
+		return s
+	}
+
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{val}
+	}
+
+	s := make([]interface{}, rv.Len())
+	for i := range s {
+		s[i] = rv.Index(i).Interface()
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+package confer
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	jww "github.com/spf13/jwalterweatherman"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// Bumped whenever the snapshot layout changes in an incompatible way.
+const snapshotVersion = 1
+
+// A precompiled, serialized copy of the attributes tier. Produced at build or
+// deploy time so that processes with expensive cold starts (e.g. serverless
+// functions) can skip parsing and merging configuration files at runtime.
+type snapshot struct {
+	Version int
+
+	// The paths that were merged to produce this snapshot, in order.
+	Paths []string
+
+	Data map[string]interface{}
+}
+
+func init() {
+	// Gob needs to know about every concrete type we may find behind an
+	// interface{} inside of the configuration data.
+	gob.Register(map[string]interface{}{})
+	gob.Register(map[interface{}]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register([]string{})
+	gob.Register(time.Time{})
+}
+
+// Enables snapshot mode. When set, ReadPaths will load the snapshot at the
+// provided path instead of reading and parsing the requested files. If the
+// snapshot can't be loaded we fall back to reading the files normally.
+func (manager *Config) UseSnapshot(path string) {
+	manager.snapshotPath = path
+}
+
+// Serializes the merged attributes tier to the provided writer. Flags and
+// environment variables are deliberately excluded as they are resolved at
+// runtime.
+func (manager *Config) WriteSnapshot(w io.Writer) error {
+	manager.mu.RLock()
+	snap := snapshot{
+		Version: snapshotVersion,
+		Paths:   manager.paths,
+		Data:    manager.attributes.ToStringMap(),
+	}
+	manager.mu.RUnlock()
+
+	if err := gob.NewEncoder(w).Encode(&snap); err != nil {
+		return fmt.Errorf("Unable to encode snapshot: %v", err)
+	}
+	return nil
+}
+
+// Writes a snapshot to the file at path.
+func (manager *Config) WriteSnapshotFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err = manager.WriteSnapshot(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Replaces the attributes tier with the contents of a snapshot produced by
+// WriteSnapshot.
+func (manager *Config) ReadSnapshot(r io.Reader) error {
+	var snap snapshot
+
+	if err := gob.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("Unable to decode snapshot: %v", err)
+	}
+
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("Unsupported snapshot version %d", snap.Version)
+	}
+
+	if snap.Data == nil {
+		snap.Data = make(map[string]interface{})
+	}
+
+	manager.write(func() {
+		// The snapshot stands in for its files, which a rebuild reads again.
+		// Each keeps the snapshot's data as its contents, so files that are
+		// absent, as they usually are where snapshots are used, rebuild to the
+		// snapshot. Without any files, its data is all there is to rebuild from.
+		manager.documents = nil
+		manager.paths = nil
+		manager.fileData = make(map[string]map[string]interface{})
+		if len(snap.Paths) == 0 {
+			manager.recordDocument(attributeDocument{data: maps.DeepCopy(snap.Data).(map[string]interface{})})
+		}
+		for _, path := range snap.Paths {
+			manager.fileData[path] = maps.DeepCopy(snap.Data).(map[string]interface{})
+		}
+		manager.recordPaths(snap.Paths)
+		manager.attributes.FromStringMap(snap.Data)
+	})
+	return nil
+}
+
+// Reads a snapshot from the file at path.
+func (manager *Config) ReadSnapshotFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return manager.ReadSnapshot(file)
+}
+
+// Attempts to satisfy a ReadPaths call from the configured snapshot.
+func (manager *Config) readPathsFromSnapshot() bool {
+	if manager.snapshotPath == "" {
+		return false
+	}
+
+	if err := manager.ReadSnapshotFile(manager.snapshotPath); err != nil {
+		jww.WARN.Println("Unable to load snapshot, reading paths instead:", err)
+		return false
+	}
+
+	jww.DEBUG.Println("Loaded configuration snapshot", manager.snapshotPath)
+	return true
+}
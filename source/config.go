@@ -3,7 +3,9 @@ package source
 import (
 	"reflect"
 	"strings"
+	"sync"
 
+	errors "github.com/jacobstr/confer/errors"
 	"github.com/jacobstr/confer/maps"
 	"github.com/spf13/cast"
 
@@ -13,7 +15,13 @@ import (
 // Manages key/value access for a specific configuration source. Delegated to by
 // the over-arching config management functions that are aware of multiple config
 // sources and their precedence.
+//
+// A ConfigSource is safe for concurrent use. Writes copy the maps they change
+// rather than modifying them, so values returned by Get and ToStringMap never
+// change underneath their readers.
 type ConfigSource struct {
+	mu sync.RWMutex
+
 	// The raw configuration data.
 	data map[string]interface{}
 
@@ -32,6 +40,12 @@ func NewConfigSource() *ConfigSource {
 
 // Get the value at a key. Case-insensitive, but preserving.
 func (self *ConfigSource) Get(key string) (val interface{}, exists bool) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.get(key)
+}
+
+func (self *ConfigSource) get(key string) (val interface{}, exists bool) {
 	index_key, index_exists := self.index[strings.ToLower(key)]
 
 	// Exit if the index doesn't exist. We shouldn't have false negatives
@@ -44,17 +58,15 @@ func (self *ConfigSource) Get(key string) (val interface{}, exists bool) {
 	path := strings.Split(index_key, ".")
 	current := self.data
 	for _, part := range path[:len(path)-1] {
-		if reflect.TypeOf(current).Kind() != reflect.Map {
+		var next interface{}
+		next, exists := current[part]
+		if exists == false {
+			return nil, false
+		} else if next == nil || reflect.TypeOf(next).Kind() != reflect.Map {
 			jww.TRACE.Println("Attempting deep access of a non-map.")
 			return nil, false
 		} else {
-			var next interface{}
-			next, exists := current[part]
-			if exists == false {
-				return nil, false
-			} else {
-				current = cast.ToStringMap(next)
-			}
+			current = cast.ToStringMap(next)
 		}
 	}
 
@@ -69,8 +81,32 @@ func (self *ConfigSource) Get(key string) (val interface{}, exists bool) {
 	}
 }
 
+// Reports whether reading key would have to pass through a value that isn't a
+// map, e.g. app.logging.level when app.logging is the string "debug". Returns
+// a WrongShapeError naming the offending ancestor, or nil.
+func (self *ConfigSource) Shape(key string) error {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	parts := strings.Split(key, ".")
+	for i := 1; i < len(parts); i++ {
+		ancestor := strings.Join(parts[:i], ".")
+		val, exists := self.get(ancestor)
+		if exists == false || val == nil {
+			return nil
+		}
+		if reflect.TypeOf(val).Kind() != reflect.Map {
+			return &errors.WrongShapeError{Key: key, Ancestor: ancestor, Value: val}
+		}
+	}
+	return nil
+}
+
 // Set a key in a case insensitive manner.
 func (self *ConfigSource) Set(key string, val interface{}) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
 	index_key, index_exists := self.index[strings.ToLower(key)]
 	if index_exists == false {
 		index_key = key
@@ -79,43 +115,133 @@ func (self *ConfigSource) Set(key string, val interface{}) {
 	path := strings.Split(index_key, ".")
 	original_path := strings.Split(key, ".")
 
-	current := self.data
+	root := copyMap(self.data)
+	current := root
 	for depth, part := range path[:len(path)-1] {
-		if reflect.TypeOf(current).Kind() != reflect.Map {
-			panic("Attempting deep access of a non-map.")
-		} else {
-			var next interface{}
-			next, exists := current[part]
-
-			// Generate the index of our ancestors as we progress.
-			ancestor_key := strings.Join(original_path[0:depth+1], ".")
-
-			// Stub out ancestors if we're setting a deep child.
-			if exists == false {
-				current[part] = make(map[string]interface{})
-				current = current[part].(map[string]interface{})
-				self.index[strings.ToLower(ancestor_key)] = ancestor_key
-			} else {
-				current = next.(map[string]interface{})
-			}
+		next, exists := current[part]
+
+		// Generate the index of our ancestors as we progress.
+		ancestor_key := strings.Join(original_path[0:depth+1], ".")
+
+		// Stub out ancestors if we're setting a deep child.
+		if exists == false {
+			self.index[strings.ToLower(ancestor_key)] = ancestor_key
 		}
+
+		// Parsers such as YAML produce maps keyed by interface{}.
+		child := copyMap(cast.ToStringMap(next))
+		current[part] = child
+		current = child
 	}
 
 	current[path[len(path)-1]] = val
-	self.updateIndex(key, current)
+	self.data = root
+	self.updateIndex(key, val)
+}
+
+// Remove a key, including any nested children, in a case insensitive manner.
+// Parent maps are left in place even if they end up empty.
+func (self *ConfigSource) Unset(key string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	lowered := strings.ToLower(key)
+	index_key, index_exists := self.index[lowered]
+	if index_exists == false {
+		return
+	}
+
+	// A stale index entry beneath a scalar leaves nothing to delete.
+	path := strings.Split(index_key, ".")
+	if root, parent := self.copyPath(path[:len(path)-1]); parent != nil {
+		delete(parent, path[len(path)-1])
+		self.data = root
+	}
+
+	for indexed := range self.index {
+		if indexed == lowered || strings.HasPrefix(indexed, lowered+".") {
+			delete(self.index, indexed)
+		}
+	}
+}
+
+// Removes the ancestors of key that hold empty maps, deepest first, along with
+// their index entries. Stops at the first ancestor that still has children.
+func (self *ConfigSource) PruneEmptyParents(key string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	path := strings.Split(strings.ToLower(key), ".")
+	for i := len(path) - 1; i > 0; i-- {
+		parent_key := strings.Join(path[:i], ".")
+		index_key, index_exists := self.index[parent_key]
+		if index_exists == false {
+			continue
+		}
+
+		real_path := strings.Split(index_key, ".")
+		root, current := self.copyPath(real_path[:len(real_path)-1])
+		if current == nil {
+			return
+		}
+
+		parent, ok := current[real_path[len(real_path)-1]].(map[string]interface{})
+		if ok == false || len(parent) > 0 {
+			return
+		}
+		delete(current, real_path[len(real_path)-1])
+		delete(self.index, parent_key)
+		self.data = root
+	}
 }
 
 // Replaces our configuration data with the provided stringmap, without merging.
+// The source takes ownership of data, which must not be modified afterwards.
 func (self *ConfigSource) FromStringMap(data map[string]interface{}) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
 	self.data = data
-	self.UpdateIndices()
+	self.index = make(map[string]string)
+	self.updateIndices()
 }
 
-// Returns data as a string map.
+// Returns data as a string map. The map is shared with other readers and must
+// not be modified; take a copy with maps.DeepCopy to change it.
 func (self *ConfigSource) ToStringMap() map[string]interface{} {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
 	return self.data
 }
 
+// Copies the maps along path, starting from the root, and returns the copied
+// root along with the copy of the map at the end of path. The copies are
+// swapped in by assigning the root to data. Returns a nil map if part of path
+// is missing or isn't a map.
+func (self *ConfigSource) copyPath(path []string) (root, current map[string]interface{}) {
+	root = copyMap(self.data)
+	current = root
+	for _, part := range path {
+		next, ok := current[part].(map[string]interface{})
+		if ok == false {
+			return nil, nil
+		}
+		next = copyMap(next)
+		current[part] = next
+		current = next
+	}
+	return root, current
+}
+
+// Returns a shallow copy of m.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(m)+1)
+	for key, val := range m {
+		copied[key] = val
+	}
+	return copied
+}
+
 // Updates our lookup table of insensitive materialized paths to their
 // corresponding 'real' keys. E.g.
 //
@@ -153,6 +279,12 @@ func (self *ConfigSource) updateIndex(key string, data interface{}) {
 
 // Index every key/value pair inside of this config sources's data.
 func (self *ConfigSource) UpdateIndices() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.updateIndices()
+}
+
+func (self *ConfigSource) updateIndices() {
 	for key, val := range self.data {
 		jww.TRACE.Println("update index", key)
 		self.updateIndex(key, val)
@@ -161,5 +293,7 @@ func (self *ConfigSource) UpdateIndices() {
 
 // Returns all the keys for this specific configuration source.
 func (self *ConfigSource) AllKeys() []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
 	return maps.CollectKeys(self.data, "", -1)
 }
@@ -7,6 +7,8 @@ type Configger interface {
 	Get(key string) (val interface{}, exists bool)
 	// Set a value.
 	Set(key string, val interface{})
+	// Remove a value, along with anything nested beneath it.
+	Unset(key string)
 	// Set data from a map[string]interface{}.
 	FromStringMap(data map[string]interface{})
 	// Merge a map[string]interface{} into existing data.
@@ -2,7 +2,7 @@ package source
 
 import (
 	"fmt"
-	"os"
+	"sort"
 	"strings"
 
 	jww "github.com/spf13/jwalterweatherman"
@@ -11,22 +11,46 @@ import (
 // A configuration data source that that reads environment variables.
 type EnvSource struct {
 	index map[string]string
+
+	// Where variables are read from. Defaults to the process environment.
+	environment Environment
 }
 
 // Converts our materialized path format to a corresponding ENV_VAR friendly
 // format. Periods are replaced with single underscores. Note that reversing
-// this would generally be ambiguous as underscores are common in variable keys.
+// this would generally be ambiguous as underscores are common in variable keys,
+// see EnvamizeNested.
 func envamize(key string) string {
 	return strings.Replace(strings.ToUpper(key), ".", "_", -1)
 }
 
+// Returns the variable name for key using the default single underscore
+// delimiter, e.g. APP_DATABASE_HOST for app.database.host.
+func Envamize(key string) string {
+	return envamize(key)
+}
+
+// Returns the variable name for key using a double underscore as an explicit
+// nesting delimiter, e.g. APP__DATABASE_HOST for app.database_host. Unlike
+// Envamize this can be reversed unambiguously.
+func EnvamizeNested(key string) string {
+	return strings.Replace(strings.ToUpper(key), ".", "__", -1)
+}
+
 func NewEnvSource() *EnvSource {
 	return &EnvSource{
-		index: make(map[string]string),
+		index:       make(map[string]string),
+		environment: OSEnvironment{},
 	}
 }
 
-// Essentially an environment variable specific alias.
+// Replaces the environment that variables are read from.
+func (self *EnvSource) SetEnvironment(env Environment) {
+	self.environment = env
+}
+
+// Essentially an environment variable specific alias. Binds input[0] to
+// input[1] if given, otherwise to the variable named after the key.
 func (self *EnvSource) Bind(input ...string) (err error) {
 	var key, envkey string
 
@@ -34,20 +58,60 @@ func (self *EnvSource) Bind(input ...string) (err error) {
 		return fmt.Errorf("BindEnv missing key to bind to")
 	}
 
+	key = input[0]
 	if len(input) == 1 {
-		key = input[0]
+		envkey = envamize(key)
 	} else {
-		key = input[1]
+		envkey = input[1]
 	}
 
-	envkey = envamize(key)
-
 	jww.TRACE.Println(key, "Bound to", envkey)
 	self.index[strings.ToLower(key)] = envkey
 
 	return nil
 }
 
+// Binds key to a specific environment variable.
+func (self *EnvSource) BindTo(key string, envkey string) {
+	jww.TRACE.Println(key, "Bound to", envkey)
+	self.index[strings.ToLower(key)] = envkey
+}
+
+// Returns a source sharing the bindings, reading from a copy of the
+// environment taken now, so a batch of lookups sees the same variables and
+// reads the environment once. The bindings must not change while it's used.
+func (self *EnvSource) Snapshot() *EnvSource {
+	env := MapEnvironment{}
+	for _, entry := range self.environment.Environ() {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return &EnvSource{index: self.index, environment: env}
+}
+
+// Returns a source holding the bindings of keys beneath prefix, relative to
+// it, reading from the same environment. Scoping "app.database" maps
+// app.database.host to host, still bound to APP_DATABASE_HOST.
+func (self *EnvSource) Scope(prefix string) *EnvSource {
+	scoped := NewEnvSource()
+	scoped.environment = self.environment
+
+	prefix = strings.ToLower(prefix) + "."
+	for key, envkey := range self.index {
+		if strings.HasPrefix(key, prefix) {
+			scoped.index[strings.TrimPrefix(key, prefix)] = envkey
+		}
+	}
+	return scoped
+}
+
+// Returns the environment as "NAME=value" strings.
+func (self *EnvSource) Environ() []string {
+	return self.environment.Environ()
+}
+
 func (self *EnvSource) AllKeys() []string {
 	a := []string{}
 	for x, _ := range self.index {
@@ -56,19 +120,59 @@ func (self *EnvSource) AllKeys() []string {
 	return a
 }
 
-// Gets an environment variable.
+// Gets an environment variable. Keys bound with Bind may also be set using
+// the unambiguous double underscore form, which takes precedence.
 func (self *EnvSource) Get(key string) (val interface{}, exists bool) {
+	val, _, exists = self.Lookup(key)
+	return val, exists
+}
+
+// Like Get, but also returns the name of the variable that supplied the value.
+func (self *EnvSource) Lookup(key string) (val interface{}, name string, exists bool) {
+	key = strings.ToLower(key)
 	envkey, exists := self.index[key]
 
 	if exists {
 		jww.TRACE.Println(key, "registered as env var", envkey)
+
+		if nested := EnvamizeNested(key); envkey == envamize(key) && nested != envkey {
+			if val := self.environment.Getenv(nested); val != "" {
+				jww.TRACE.Println(nested, "found in environment with val:", val)
+				return val, nested, true
+			}
+		}
 	}
 
-	if val = os.Getenv(envkey); val != "" {
+	if val := self.environment.Getenv(envkey); val != "" {
 		jww.TRACE.Println(envkey, "found in environment with val:", val)
-		return val, true
+		return val, envkey, true
 	} else {
 		jww.TRACE.Println(envkey, "env value unset:")
-		return nil, false
+		return nil, "", false
 	}
 }
+
+// Returns variables bound to more than one key, e.g. APP_DATABASE_HOST when
+// both app.database.host and app.database_host are bound, mapped to the keys
+// in sorted order.
+func (self *EnvSource) Ambiguities() map[string][]string {
+	keys := map[string][]string{}
+	for key, envkey := range self.index {
+		keys[envkey] = append(keys[envkey], key)
+	}
+
+	ambiguous := map[string][]string{}
+	for envkey, bound := range keys {
+		if len(bound) > 1 {
+			sort.Strings(bound)
+			ambiguous[envkey] = bound
+		}
+	}
+	return ambiguous
+}
+
+// Returns the environment variable bound to key, if any.
+func (self *EnvSource) Variable(key string) (string, bool) {
+	envkey, exists := self.index[strings.ToLower(key)]
+	return envkey, exists
+}
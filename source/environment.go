@@ -0,0 +1,40 @@
+package source
+
+import (
+	"os"
+)
+
+// Abstracts access to environment variables so that platforms without a
+// process environment (e.g. js/wasm in the browser) can provide their own.
+type Environment interface {
+	// Returns the value of the variable, or an empty string if it is unset.
+	Getenv(key string) string
+	// Returns every variable in KEY=value form.
+	Environ() []string
+}
+
+// The environment of the current process.
+type OSEnvironment struct{}
+
+func (OSEnvironment) Getenv(key string) string {
+	return os.Getenv(key)
+}
+
+func (OSEnvironment) Environ() []string {
+	return os.Environ()
+}
+
+// A fixed, in-memory environment.
+type MapEnvironment map[string]string
+
+func (self MapEnvironment) Getenv(key string) string {
+	return self[key]
+}
+
+func (self MapEnvironment) Environ() []string {
+	a := []string{}
+	for k, v := range self {
+		a = append(a, k+"="+v)
+	}
+	return a
+}
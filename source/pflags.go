@@ -30,6 +30,44 @@ func (self *PFlagSource) Get(key string) (interface{}, bool) {
 	}
 }
 
+// Returns the default value of a bound flag that wasn't explicitly provided.
+func (self *PFlagSource) GetDefault(key string) (interface{}, bool) {
+	val, exists := self.data[strings.ToLower(key)]
+	if !exists || val.Changed {
+		return nil, false
+	}
+	return val.Value.String(), true
+}
+
 func (self *PFlagSource) Set(key string, val interface{}) {
-	self.data[key] = val.(*pflag.Flag)
+	self.data[strings.ToLower(key)] = val.(*pflag.Flag)
+}
+
+// Returns the keys of every bound flag.
+func (self *PFlagSource) AllKeys() []string {
+	a := []string{}
+	for x, _ := range self.data {
+		a = append(a, strings.ToLower(x))
+	}
+	return a
+}
+
+// Returns the flag bound to key, if any.
+func (self *PFlagSource) Flag(key string) (*pflag.Flag, bool) {
+	flag, exists := self.data[strings.ToLower(key)]
+	return flag, exists
+}
+
+// Returns a source holding the flags bound to keys beneath prefix, relative
+// to it.
+func (self *PFlagSource) Scope(prefix string) *PFlagSource {
+	scoped := NewPFlagSource()
+
+	prefix = strings.ToLower(prefix) + "."
+	for key, flag := range self.data {
+		if strings.HasPrefix(key, prefix) {
+			scoped.data[strings.TrimPrefix(key, prefix)] = flag
+		}
+	}
+	return scoped
 }
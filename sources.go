@@ -0,0 +1,110 @@
+package confer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/source"
+)
+
+// The priorities of the built in layers, for placing sources added with
+// AddSource. Higher priorities take precedence.
+const (
+	PriorityFlags        = 500
+	PriorityOverrides    = 400
+	PriorityEnv          = 300
+	PriorityAttributes   = 200
+	PriorityFlagDefaults = 150
+	PriorityDefaults     = 100
+)
+
+// A source added with AddSource.
+type customSource struct {
+	priority int
+	src      source.Configger
+}
+
+// Adds a source to the resolution chain as a layer of its own, e.g. a feature
+// flag service, a database or a test double. The source takes precedence over
+// layers of lower priority; to sit between the environment and files:
+//
+//	config.AddSource("flags-service", confer.PriorityAttributes+50, flagsService)
+//
+// A source takes precedence over built in layers of the same priority, and
+// over sources of the same priority added before it. Sections it provides are
+// filled in by the layers beneath, as with files and defaults. Sources are
+// read on every Get; call Publish after their data changes if Views are in
+// use. The name appears in Layers and may be passed to SettingsFrom and
+// SetPrecedence. Sub doesn't carry sources over.
+func (manager *Config) AddSource(name string, priority int, src source.Configger) error {
+	manager.mu.Lock()
+	err := manager.addLayer(name, priority, src)
+	manager.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	manager.attributesChanged()
+	return nil
+}
+
+// Inserts a custom layer by priority. Requires the write lock.
+func (manager *Config) addLayer(name string, priority int, src source.Configger) error {
+	if src == nil {
+		return fmt.Errorf("Source %q is nil", name)
+	}
+	if name == "" {
+		return fmt.Errorf("Sources must be named")
+	}
+	for _, layer := range manager.precedence {
+		if layer == name {
+			return fmt.Errorf("Layer %q already exists", name)
+		}
+	}
+
+	position := len(manager.precedence)
+	for i, layer := range manager.precedence {
+		if manager.layerPriority(layer) <= priority {
+			position = i
+			break
+		}
+	}
+
+	precedence := append([]string(nil), manager.precedence[:position]...)
+	precedence = append(precedence, name)
+	manager.precedence = append(precedence, manager.precedence[position:]...)
+
+	manager.sources[name] = &customSource{priority: priority, src: src}
+	return nil
+}
+
+// Returns the priority of a layer.
+func (manager *Config) layerPriority(layer string) int {
+	switch layer {
+	case LayerFlags:
+		return PriorityFlags
+	case LayerOverrides:
+		return PriorityOverrides
+	case LayerEnv:
+		return PriorityEnv
+	case LayerAttributes:
+		return PriorityAttributes
+	case LayerFlagDefaults:
+		return PriorityFlagDefaults
+	case LayerDefaults:
+		return PriorityDefaults
+	}
+	return manager.sources[layer].priority
+}
+
+// Returns the leaf keys provided by sources added with AddSource.
+func (manager *Config) customKeys() []string {
+	keys := []string{}
+	for _, custom := range manager.sources {
+		for key := range maps.Flatten(maps.Normalize(custom.src.ToStringMap()).(map[string]interface{})) {
+			keys = append(keys, strings.ToLower(key))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,214 @@
+package confer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+
+	"github.com/jacobstr/confer/reader"
+	"github.com/jacobstr/confer/source"
+)
+
+// A portable record of everything that went into a configuration, produced by
+// DumpState and replayed by LoadState. Attach it to bug reports to reproduce
+// the exact configuration a process was running with.
+type State struct {
+	// Files loaded by ReadPaths, in merge order, with the contents they were
+	// loaded with.
+	Files []StateFile `yaml:"files"`
+
+	// Bound environment variables that were set. Secret values are redacted.
+	Env []StateVar `yaml:"env"`
+
+	// Command line flags that were explicitly provided. Secret values are
+	// redacted.
+	Flags []StateVar `yaml:"flags"`
+
+	// Values provided with Set, along with attributes that didn't come from
+	// files, e.g. MergeAttributes. Secret values are redacted.
+	Overrides map[string]interface{} `yaml:"overrides"`
+
+	// Values provided with SetDefault. Secret values are redacted.
+	Defaults map[string]interface{} `yaml:"defaults,omitempty"`
+}
+
+type StateFile struct {
+	Path     string `yaml:"path"`
+	Contents string `yaml:"contents"`
+}
+
+type StateVar struct {
+	Key string `yaml:"key"`
+	// The environment variable or flag name.
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// Captures the current configuration state. File contents are included as
+// they were loaded, re-encoded in each file's format, so review dumps of files
+// containing secrets before sharing them.
+func (manager *Config) DumpState(w io.Writer) error {
+	state, err := manager.captureState()
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+// Captures the state under the read lock. Files are taken from the contents
+// the configuration last loaded, not read again, so the state describes what
+// was applied.
+func (manager *Config) captureState() (*State, error) {
+	state := &State{
+		Overrides: map[string]interface{}{},
+		Defaults:  map[string]interface{}{},
+	}
+
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	redact := func(key string, val interface{}) interface{} {
+		if val != nil && manager.isSecret(key) {
+			return Redacted
+		}
+		return val
+	}
+
+	// Replay the files alone so we can tell which attributes came from
+	// elsewhere.
+	replay := NewConfig()
+	files := reader.MapFileSystem{}
+	replay.SetFileSystem(files)
+
+	for _, path := range manager.paths {
+		data, exists := manager.fileData[path]
+		if !exists {
+			return nil, fmt.Errorf("Unable to capture %s, its contents weren't kept", path)
+		}
+		contents, err := reader.Marshal(data, manager.formatOf(path))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to capture %s: %v", path, err)
+		}
+		files[path] = contents
+		state.Files = append(state.Files, StateFile{Path: path, Contents: string(contents)})
+	}
+	replay.readFiles(manager.paths)
+
+	for _, change := range diffSettings(
+		replay.SettingsFrom(LayerAttributes),
+		manager.settingsFrom(LayerAttributes),
+	) {
+		if change.New != nil {
+			state.Overrides[change.Key] = redact(change.Key, change.New)
+		}
+	}
+	for key, val := range manager.settingsFrom(LayerOverrides) {
+		state.Overrides[key] = redact(key, val)
+	}
+	for key, val := range manager.settingsFrom(LayerDefaults) {
+		state.Defaults[key] = redact(key, val)
+	}
+
+	for key, val := range manager.settingsFrom(LayerEnv) {
+		name, _ := manager.env.Variable(key)
+		state.Env = append(state.Env, StateVar{
+			Key:   key,
+			Name:  name,
+			Value: fmt.Sprint(redact(key, val)),
+		})
+	}
+
+	for key, val := range manager.settingsFrom(LayerFlags) {
+		flag, _ := manager.pflags.Flag(key)
+		state.Flags = append(state.Flags, StateVar{
+			Key:   key,
+			Name:  flag.Name,
+			Value: fmt.Sprint(redact(key, val)),
+		})
+	}
+
+	sort.Sort(stateVarsByKey(state.Env))
+	sort.Sort(stateVarsByKey(state.Flags))
+	return state, nil
+}
+
+// Reconstructs a configuration from a dump produced by DumpState. Files are
+// served from memory and environment variables from a fixed environment, so
+// the result doesn't depend on the machine it is loaded on.
+func LoadState(r io.Reader) (*Config, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var state State
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("Unable to parse state: %v", err)
+	}
+
+	manager := NewConfig()
+
+	files := reader.MapFileSystem{}
+	paths := []string{}
+	for _, file := range state.Files {
+		files[file.Path] = []byte(file.Contents)
+		paths = append(paths, file.Path)
+	}
+	manager.SetFileSystem(files)
+
+	loaded, errs := manager.readFiles(paths)
+	manager.recordPaths(loaded)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	for key, val := range state.Defaults {
+		manager.SetDefault(key, val)
+	}
+	for key, val := range state.Overrides {
+		manager.Set(key, val)
+	}
+
+	env := source.MapEnvironment{}
+	for _, v := range state.Env {
+		env[v.Name] = v.Value
+		manager.env.BindTo(v.Key, v.Name)
+	}
+	manager.SetEnvironment(env)
+
+	for _, v := range state.Flags {
+		flag := &pflag.Flag{Name: v.Name, Value: newStateValue(v.Value), Changed: true}
+		manager.pflags.Set(v.Key, flag)
+	}
+
+	return manager, nil
+}
+
+// A fixed pflag.Value for replayed flags.
+type stateValue string
+
+func newStateValue(val string) *stateValue {
+	v := stateValue(val)
+	return &v
+}
+
+func (s *stateValue) String() string     { return string(*s) }
+func (s *stateValue) Set(v string) error { *s = stateValue(v); return nil }
+func (s *stateValue) Type() string       { return "string" }
+
+type stateVarsByKey []StateVar
+
+func (s stateVarsByKey) Len() int           { return len(s) }
+func (s stateVarsByKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s stateVarsByKey) Less(i, j int) bool { return s[i].Key < s[j].Key }
@@ -0,0 +1,165 @@
+package confer
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacobstr/confer/reader"
+)
+
+// How many of the largest subtrees Stats reports.
+const statsLargestSubtrees = 10
+
+// Describes the size of a configuration and how long it took to load, as
+// returned by Stats.
+type Stats struct {
+	// The number of leaf keys in the merged configuration.
+	Keys int
+	// The number of leaf keys each layer provides, by layer name.
+	KeysByLayer map[string]int
+	// The number of segments in the longest key, e.g. 3 for app.database.host.
+	Depth int
+	// A rough estimate, in bytes, of the memory held by every layer.
+	MemoryBytes int
+	// The sections holding the most leaf keys, largest first.
+	LargestSubtrees []SubtreeStats
+	// Every file read, in the order they were first read.
+	Files []FileStats
+}
+
+// The number of leaf keys beneath a section.
+type SubtreeStats struct {
+	Key  string
+	Keys int
+}
+
+// Describes the last read of a configuration file.
+type FileStats struct {
+	Path string
+	// The size of the file.
+	Bytes int
+	// The number of leaf keys the file provides.
+	Keys int
+	// Time spent reading the file and parsing it.
+	LoadDuration  time.Duration
+	ParseDuration time.Duration
+}
+
+// Reports the size of the configuration and how long its files took to load,
+// so teams managing very large configurations can monitor their growth:
+//
+//	stats := config.Stats()
+//	metrics.Gauge("config.keys", stats.Keys)
+//	for _, file := range stats.Files {
+//		metrics.Timing("config.parse", file.ParseDuration, "file:"+file.Path)
+//	}
+func (manager *Config) Stats() Stats {
+	stats := Stats{KeysByLayer: map[string]int{}}
+
+	for _, layer := range manager.Layers() {
+		settings := manager.SettingsFrom(layer)
+		stats.KeysByLayer[layer] = len(settings)
+		for key, val := range settings {
+			stats.MemoryBytes += estimateSize(key) + estimateSize(val)
+		}
+	}
+
+	subtrees := map[string]int{}
+	for _, key := range manager.AllKeys() {
+		stats.Keys++
+		parts := strings.Split(key, ".")
+		if len(parts) > stats.Depth {
+			stats.Depth = len(parts)
+		}
+		for i := 1; i < len(parts); i++ {
+			subtrees[strings.Join(parts[:i], ".")]++
+		}
+	}
+
+	for key, count := range subtrees {
+		stats.LargestSubtrees = append(stats.LargestSubtrees, SubtreeStats{Key: key, Keys: count})
+	}
+	sort.Slice(stats.LargestSubtrees, func(i, j int) bool {
+		a, b := stats.LargestSubtrees[i], stats.LargestSubtrees[j]
+		if a.Keys != b.Keys {
+			return a.Keys > b.Keys
+		}
+		return a.Key < b.Key
+	})
+	if len(stats.LargestSubtrees) > statsLargestSubtrees {
+		stats.LargestSubtrees = stats.LargestSubtrees[:statsLargestSubtrees]
+	}
+
+	manager.mu.RLock()
+	for _, path := range manager.statsOrder {
+		stats.Files = append(stats.Files, *manager.fileStats[path])
+	}
+	manager.mu.RUnlock()
+	return stats
+}
+
+// Records how long reading and parsing a file took, and how many keys it
+// provides.
+func (manager *Config) recordFileStats(path string, size int, load, parse time.Duration, keys int) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	file, exists := manager.fileStats[path]
+	if !exists {
+		file = &FileStats{Path: path}
+		manager.fileStats[path] = file
+		manager.statsOrder = append(manager.statsOrder, path)
+	}
+	file.Bytes, file.LoadDuration, file.ParseDuration, file.Keys = size, load, parse, keys
+}
+
+// A file system measuring the reads made through it.
+type timedFileSystem struct {
+	fs      reader.FileSystem
+	size    int
+	elapsed time.Duration
+}
+
+func (t *timedFileSystem) ReadFile(path string) ([]byte, error) {
+	start := time.Now()
+	data, err := t.fs.ReadFile(path)
+	t.elapsed += time.Since(start)
+	t.size += len(data)
+	return data, err
+}
+
+// Roughly estimates the memory held by a value, counting Go's headers.
+func estimateSize(val interface{}) int {
+	switch v := val.(type) {
+	case string:
+		return 16 + len(v)
+	case []byte:
+		return 24 + len(v)
+	case map[string]interface{}:
+		size := 48
+		for key, child := range v {
+			size += estimateSize(key) + estimateSize(child)
+		}
+		return size
+	case map[interface{}]interface{}:
+		size := 48
+		for key, child := range v {
+			size += estimateSize(key) + estimateSize(child)
+		}
+		return size
+	case []interface{}:
+		size := 24
+		for _, child := range v {
+			size += estimateSize(child)
+		}
+		return size
+	case []string:
+		size := 24
+		for _, child := range v {
+			size += estimateSize(child)
+		}
+		return size
+	}
+	return 16
+}
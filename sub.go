@@ -0,0 +1,98 @@
+package confer
+
+import (
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// Returns a manager rooted at key, so a module can be handed only its own
+// slice of configuration:
+//
+//	db := config.Sub("app.database")
+//	db.GetString("host") // app.database.host
+//
+// Flags and environment variables bound beneath key keep overriding their
+// values relative to it, so APP_DATABASE_HOST still sets host. Casters, decode
+// hooks, the BoolParser, the Coercer and secret patterns carry over as well.
+// The values are a copy; later changes to either manager don't affect the
+// other. Returns nil if key holds something other than a map.
+func (manager *Config) Sub(key string) *Config {
+	sub := NewConfig()
+
+	// Each tier is scoped separately so precedence carries over. The highest
+	// tier holding key decides whether it is a section.
+	decided := false
+	for _, layer := range manager.precedence {
+		from, to := manager.store(layer), sub.store(layer)
+		if from == nil || to == nil {
+			continue
+		}
+		val, exists := from.Get(key)
+		if !exists || val == nil {
+			continue
+		}
+		if reflect.TypeOf(val).Kind() != reflect.Map {
+			if !decided {
+				return nil
+			}
+			continue
+		}
+		decided = true
+		to.FromStringMap(maps.DeepCopy(maps.Normalize(val)).(map[string]interface{}))
+	}
+
+	sub.pflags = manager.pflags.Scope(key)
+	sub.env = manager.env.Scope(key)
+	sub.rootPath = manager.rootPath
+	sub.fs = manager.fs
+	sub.configType = manager.configType
+	sub.boolParser = manager.boolParser
+	sub.coercer = manager.coercer
+	sub.precedence = []string{}
+	for _, layer := range manager.precedence {
+		if _, custom := manager.sources[layer]; !custom {
+			sub.precedence = append(sub.precedence, layer)
+		}
+	}
+	sub.copyOnRead = manager.copyOnRead
+	sub.exprLimits = manager.exprLimits
+	sub.decodeHooks = append(sub.decodeHooks, manager.decodeHooks...)
+	for t, caster := range manager.casters {
+		sub.casters[t] = caster
+	}
+	sub.secrets = scopePatterns(manager.secrets, key)
+
+	return sub
+}
+
+// Rewrites patterns relative to prefix, dropping those that can't match keys
+// beneath it. A pattern covering prefix itself covers every key.
+func scopePatterns(patterns []string, prefix string) []string {
+	prefixParts := strings.Split(strings.ToLower(prefix), ".")
+	scoped := []string{}
+
+	for _, pattern := range patterns {
+		patternParts := strings.Split(strings.ToLower(pattern), ".")
+
+		matched := true
+		for i := 0; i < len(patternParts) && i < len(prefixParts); i++ {
+			if ok, err := path.Match(patternParts[i], prefixParts[i]); err != nil || !ok {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		if len(patternParts) <= len(prefixParts) {
+			scoped = append(scoped, "*")
+		} else {
+			scoped = append(scoped, strings.Join(patternParts[len(prefixParts):], "."))
+		}
+	}
+	return scoped
+}
@@ -0,0 +1,246 @@
+package confer
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	errors "github.com/jacobstr/confer/errors"
+	"github.com/jacobstr/confer/maps"
+)
+
+// Decodes the effective configuration into rawVal, which must be a pointer to
+// a struct or map. Values are resolved exactly as Get resolves them, so flags
+// take precedence over the environment, which takes precedence over files and
+// defaults. Fields are matched case-insensitively and may be renamed with
+// `mapstructure` tags:
+//
+//	type Database struct {
+//		Host    string
+//		Timeout time.Duration
+//		MaxIdle int `mapstructure:"max_idle"`
+//	}
+//
+//	var db struct{ Database Database }
+//	err := config.Unmarshal(&db)
+//
+// The configuration is overlaid onto rawVal rather than replacing it: fields
+// the configuration doesn't set keep their current values, nested structs
+// and maps are merged, and only lists are replaced. So an application can
+// populate a struct with its own defaults first:
+//
+//	db := Database{Host: "localhost", MaxIdle: 2}
+//	err := config.UnmarshalKey("app.database", &db)
+//
+// Strings are weakly converted to the target type. Booleans use the
+// configured BoolParser, types with a registered caster are converted with it
+// and other types may be handled with RegisterDecodeHook.
+func (manager *Config) Unmarshal(rawVal interface{}) error {
+	decoder, err := mapstructure.NewDecoder(manager.decoderConfig(rawVal))
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(manager.effectiveSettings())
+}
+
+// Like Unmarshal, but returns an UnknownKeysError listing every key that
+// doesn't correspond to a field in rawVal, catching typos such as
+// `databse.host` that would otherwise silently do nothing.
+func (manager *Config) UnmarshalExact(rawVal interface{}) error {
+	return manager.decodeExact(manager.effectiveSettings(), rawVal, false)
+}
+
+// Like UnmarshalExact, but also returns an UnsetFieldsError listing every
+// field of rawVal the configuration doesn't set, for applications that
+// expect their configuration to be complete.
+func (manager *Config) UnmarshalExactFields(rawVal interface{}) error {
+	return manager.decodeExact(manager.effectiveSettings(), rawVal, true)
+}
+
+// Decodes the effective configuration beneath key into rawVal, as Unmarshal
+// does for the whole configuration, e.g:
+//
+//	var db Database
+//	err := config.UnmarshalKey("app.database", &db)
+//
+// Leaf values may be decoded too, e.g. a list into a slice of structs.
+func (manager *Config) UnmarshalKey(key string, rawVal interface{}) error {
+	subtree, err := manager.effectiveSubtree(key)
+	if err != nil {
+		return err
+	}
+
+	decoder, err := mapstructure.NewDecoder(manager.decoderConfig(rawVal))
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(subtree)
+}
+
+// Like UnmarshalKey, but checks for unknown keys as UnmarshalExact does.
+// Unknown keys are reported relative to key.
+func (manager *Config) UnmarshalKeyExact(key string, rawVal interface{}) error {
+	subtree, err := manager.effectiveSubtree(key)
+	if err != nil {
+		return err
+	}
+	return manager.decodeExact(subtree, rawVal, false)
+}
+
+// Like UnmarshalKeyExact, but checks for unset fields as
+// UnmarshalExactFields does.
+func (manager *Config) UnmarshalKeyExactFields(key string, rawVal interface{}) error {
+	subtree, err := manager.effectiveSubtree(key)
+	if err != nil {
+		return err
+	}
+	return manager.decodeExact(subtree, rawVal, true)
+}
+
+// Decodes data into rawVal, failing on keys rawVal lacks and, if fields is
+// set, on fields data lacks.
+func (manager *Config) decodeExact(data interface{}, rawVal interface{}, fields bool) error {
+	config := manager.decoderConfig(rawVal)
+	metadata := &mapstructure.Metadata{}
+	config.Metadata = metadata
+
+	decoder, err := mapstructure.NewDecoder(config)
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(data); err != nil {
+		return err
+	}
+
+	if len(metadata.Unused) > 0 {
+		// Unused keys are prefixed with struct field names.
+		return &errors.UnknownKeysError{Keys: sortedLower(metadata.Unused)}
+	}
+	if fields && len(metadata.Unset) > 0 {
+		return &errors.UnsetFieldsError{Fields: sortedLower(metadata.Unset)}
+	}
+	return nil
+}
+
+func sortedLower(keys []string) []string {
+	lowered := []string{}
+	for _, key := range keys {
+		lowered = append(lowered, strings.ToLower(key))
+	}
+	sort.Strings(lowered)
+	return lowered
+}
+
+// Returns the effective configuration beneath key.
+func (manager *Config) effectiveSubtree(key string) (interface{}, error) {
+	var subtree interface{} = manager.effectiveSettings()
+
+	for _, part := range strings.Split(strings.ToLower(key), ".") {
+		m, ok := subtree.(map[string]interface{})
+		if !ok {
+			subtree = nil
+			break
+		}
+		subtree = m[part]
+	}
+
+	if subtree == nil {
+		return nil, fmt.Errorf("%q is not set", key)
+	}
+	return subtree, nil
+}
+
+// Returns the effective configuration as a nested string map.
+func (manager *Config) effectiveSettings() map[string]interface{} {
+	settings := manager.AllSettings()
+	for _, key := range manager.pflags.AllKeys() {
+		settings[key] = manager.Get(key)
+	}
+
+	flat := map[string]interface{}{}
+	for key, val := range settings {
+		if val != nil {
+			flat[key] = maps.Normalize(val)
+		}
+	}
+	return maps.Expand(flat)
+}
+
+// Converts data on its way to a value of type to, e.g. a string into a
+// net.IP. Hooks return data unchanged for types they don't handle.
+type DecodeHook func(from, to reflect.Type, data interface{}) (interface{}, error)
+
+// Registers a conversion used by Unmarshal and UnmarshalKey. Hooks run in
+// registration order, before the built in conversions, so they may override
+// them:
+//
+//	config.RegisterDecodeHook(func(from, to reflect.Type, data interface{}) (interface{}, error) {
+//		if to != reflect.TypeOf(Level(0)) || from.Kind() != reflect.String {
+//			return data, nil
+//		}
+//		return ParseLevel(data.(string))
+//	})
+//
+// Durations, RFC 3339 times, net.IP, net.IPNet and url.URL are converted from
+// strings without any registration.
+func (manager *Config) RegisterDecodeHook(hook DecodeHook) {
+	manager.decodeHooks = append(manager.decodeHooks, hook)
+}
+
+func (manager *Config) decoderConfig(rawVal interface{}) *mapstructure.DecoderConfig {
+	hooks := []mapstructure.DecodeHookFunc{manager.casterHook, manager.boolHook}
+	for _, hook := range manager.decodeHooks {
+		hooks = append(hooks, mapstructure.DecodeHookFuncType(hook))
+	}
+	hooks = append(hooks,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToTimeHookFunc(time.RFC3339),
+		mapstructure.StringToIPHookFunc(),
+		mapstructure.StringToIPNetHookFunc(),
+		stringToURLHook,
+		mapstructure.StringToSliceHookFunc(","),
+	)
+
+	return &mapstructure.DecoderConfig{
+		Result:           rawVal,
+		WeaklyTypedInput: true,
+		DecodeHook:       mapstructure.ComposeDecodeHookFunc(hooks...),
+	}
+}
+
+var urlType = reflect.TypeOf(url.URL{})
+
+// Parses strings into url.URL values.
+func stringToURLHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String || to != urlType {
+		return data, nil
+	}
+
+	u, err := url.Parse(data.(string))
+	if err != nil {
+		return nil, err
+	}
+	return *u, nil
+}
+
+// Converts values with casters registered through RegisterCaster.
+func (manager *Config) casterHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if fn, exists := manager.casters[to]; exists && from != to {
+		return fn(data)
+	}
+	return data, nil
+}
+
+// Parses booleans with the configured BoolParser so Unmarshal agrees with
+// GetBool.
+func (manager *Config) boolHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to.Kind() == reflect.Bool && from.Kind() != reflect.Bool {
+		return manager.parseBool(data)
+	}
+	return data, nil
+}
@@ -0,0 +1,84 @@
+package confer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/spf13/cast"
+
+	errors "github.com/jacobstr/confer/errors"
+	"github.com/jacobstr/confer/maps"
+)
+
+// A custom check against the configuration. Validators run alongside the
+// schema during ReadPaths, Reload and Validate.
+type Validator func(manager *Config) error
+
+// Registers a validator.
+func (manager *Config) AddValidator(v Validator) {
+	manager.validators = append(manager.validators, v)
+}
+
+// Runs every registered validator.
+func (manager *Config) runValidators() []error {
+	errs := []error{}
+	for _, v := range manager.validators {
+		if err := v(manager); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Returns a validator requiring the numeric leaves of the map at key to be
+// non-negative and add up to total, e.g. for traffic splits:
+//
+//	traffic:
+//	  split:
+//	    stable: 90
+//	    canary: 10
+//
+//	config.AddValidator(confer.WeightsSumTo("traffic.split", 100))
+//
+// The validator passes when key is unset.
+func WeightsSumTo(key string, total float64) Validator {
+	return func(manager *Config) error {
+		val := manager.Get(key)
+		if val == nil {
+			return nil
+		}
+
+		weights, err := cast.ToStringMapE(val)
+		if err != nil {
+			return &errors.InvalidValueError{Key: key, Reason: "expected a map of weights"}
+		}
+
+		sum := 0.0
+		for name, weight := range maps.Flatten(weights) {
+			w, err := cast.ToFloat64E(weight)
+			if err != nil {
+				return &errors.InvalidValueError{
+					Key:    key + "." + name,
+					Reason: fmt.Sprintf("weight %v is not a number", weight),
+				}
+			}
+			if w < 0 {
+				return &errors.InvalidValueError{
+					Key:    key + "." + name,
+					Reason: fmt.Sprintf("weight %v is negative", weight),
+				}
+			}
+			sum += w
+		}
+
+		if math.Abs(sum-total) > 1e-9 {
+			return &errors.WeightError{Key: key, Sum: sum, Total: total}
+		}
+		return nil
+	}
+}
+
+// Requires the map at key to hold percentages adding up to 100.
+func (manager *Config) RequirePercentages(key string) {
+	manager.AddValidator(WeightsSumTo(key, 100))
+}
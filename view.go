@@ -0,0 +1,166 @@
+package confer
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+
+	"github.com/jacobstr/confer/maps"
+)
+
+// An immutable snapshot of the effective configuration, for hot paths that
+// read settings on every request. Reads are lock-free and, for values of the
+// requested type, allocation-free:
+//
+//	func handler(w http.ResponseWriter, r *http.Request) {
+//		view := config.View()
+//		if view.GetBool("features.beta") {
+//			...
+//		}
+//	}
+//
+// Once View has been called, every write made through the API, including
+// ReadPaths and Reload, builds a new snapshot and swaps it in atomically, so
+// readers never observe a partially applied reload. Flags and environment
+// variables are resolved when a snapshot is built; call Publish after
+// changing them directly. Helper functions set with Set are evaluated once,
+// at build time.
+type View struct {
+	values     map[string]interface{}
+	boolParser BoolParser
+}
+
+// Returns the current snapshot, building the first one on demand.
+func (manager *Config) View() *View {
+	if view := manager.view.Load(); view != nil {
+		return view
+	}
+
+	view := manager.buildView()
+	if manager.view.CompareAndSwap(nil, view) {
+		return view
+	}
+	return manager.view.Load()
+}
+
+// Builds a snapshot of the current settings and swaps it in. Also
+// invalidates values cached by Memo.
+func (manager *Config) Publish() {
+	manager.publishMu.Lock()
+	defer manager.publishMu.Unlock()
+
+	manager.generation.Add(1)
+	manager.view.Store(manager.buildView())
+}
+
+// Publishes a new snapshot after a write, provided snapshots are in use and
+// no batch of writes is underway.
+func (manager *Config) republish() {
+	if manager.viewsHeld.Load() > 0 || manager.view.Load() == nil {
+		return
+	}
+	manager.Publish()
+}
+
+// Defers publishing until the returned function is called, so a batch of
+// writes such as a reload is published as a whole.
+func (manager *Config) holdViews() func() {
+	manager.viewsHeld.Add(1)
+	return func() {
+		manager.viewsHeld.Add(-1)
+		manager.republish()
+	}
+}
+
+func (manager *Config) buildView() *View {
+	manager.mu.RLock()
+	keys := manager.attributes.AllKeys()
+	keys = append(keys, manager.overrides.AllKeys()...)
+	keys = append(keys, manager.defaults.AllKeys()...)
+	keys = append(keys, manager.customKeys()...)
+	keys = append(keys, manager.env.AllKeys()...)
+	keys = append(keys, manager.pflags.AllKeys()...)
+	keys = append(keys, manager.aliasKeys(keys)...)
+
+	found := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		found[key] = manager.find(key)
+	}
+	manager.mu.RUnlock()
+
+	values := make(map[string]interface{}, len(keys))
+	for key, val := range found {
+		if err := manager.checkLifecycle(key); err != nil {
+			panic("confer: " + err.Error())
+		}
+		if val := manager.resolve(key, val); val != nil {
+			values[strings.ToLower(key)] = maps.DeepCopy(val)
+		}
+	}
+
+	return &View{values: values, boolParser: manager.boolParser}
+}
+
+// Returns the value at key, or nil if it is unset. Maps and slices are shared
+// between readers and must not be modified.
+func (view *View) Get(key string) interface{} {
+	return view.values[strings.ToLower(key)]
+}
+
+func (view *View) IsSet(key string) bool {
+	return view.Get(key) != nil
+}
+
+func (view *View) GetString(key string) string {
+	if s, ok := view.Get(key).(string); ok {
+		return s
+	}
+	return cast.ToString(view.Get(key))
+}
+
+func (view *View) GetInt(key string) int {
+	if i, ok := view.Get(key).(int); ok {
+		return i
+	}
+	return cast.ToInt(view.Get(key))
+}
+
+func (view *View) GetFloat64(key string) float64 {
+	if f, ok := view.Get(key).(float64); ok {
+		return f
+	}
+	return cast.ToFloat64(view.Get(key))
+}
+
+// Parses booleans with the BoolParser configured when the snapshot was built.
+func (view *View) GetBool(key string) bool {
+	val := view.Get(key)
+	if b, ok := val.(bool); ok {
+		return b
+	}
+	if view.boolParser == nil {
+		return cast.ToBool(val)
+	}
+	b, _ := view.boolParser(val)
+	return b
+}
+
+func (view *View) GetDuration(key string) time.Duration {
+	return cast.ToDuration(view.Get(key))
+}
+
+func (view *View) GetStringSlice(key string) []string {
+	return cast.ToStringSlice(view.Get(key))
+}
+
+// Returns the map at key. The map is shared between readers and must not be
+// modified.
+func (view *View) GetStringMap(key string) map[string]interface{} {
+	val := view.Get(key)
+	if val == nil || reflect.TypeOf(val).Kind() != reflect.Map {
+		return nil
+	}
+	return cast.ToStringMap(val)
+}
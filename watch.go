@@ -0,0 +1,159 @@
+package confer
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"github.com/jacobstr/confer/reader"
+)
+
+// How long to wait for a burst of file system events to settle before
+// reloading. Editors often write a file in several steps.
+var watchDebounce = 100 * time.Millisecond
+
+// Describes a reload triggered by a change to a watched file.
+type Event struct {
+	// The file that changed.
+	Path string
+	// The outcome of the reload.
+	Report *ReloadReport
+	// Set when the reload failed.
+	Err error
+}
+
+// Registers a handler invoked after every reload triggered by WatchConfig,
+// whether or not any settings changed.
+func (manager *Config) OnConfigChange(fn func(Event)) {
+	manager.configChangeHandlers = append(manager.configChangeHandlers, fn)
+}
+
+// Watches the files loaded by ReadPaths and reloads them, in the original
+// merge order, whenever one changes. Handlers registered with OnConfigChange
+// are invoked afterwards, as are OnChange handlers if settings changed:
+//
+//	config.OnConfigChange(func(e confer.Event) {
+//		if e.Err != nil {
+//			log.Printf("reloading %s: %v", e.Path, e.Err)
+//		}
+//	})
+//	config.WatchConfig()
+//
+// Directories are watched rather than files, so editors that replace files
+// and Kubernetes ConfigMap volumes, which swap a symlink, are handled. Files
+// read after WatchConfig is called aren't watched. Only files on the local
+// file system can be watched. Stop with StopWatching.
+func (manager *Config) WatchConfig() error {
+	if manager.watcher != nil {
+		return nil
+	}
+
+	base := manager.fs
+	if archives, ok := base.(reader.ArchiveFileSystem); ok {
+		base = archives.Base
+	}
+	if _, ok := base.(reader.OSFileSystem); !ok {
+		return fmt.Errorf("WatchConfig requires files on the local file system")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// Watched files mapped to the file they resolve to through symlinks.
+	files := map[string]string{}
+	dirs := map[string]bool{}
+
+	for _, p := range manager.paths {
+		if archive, _, ok := reader.SplitArchivePath(p); ok {
+			p = archive
+		}
+		p = filepath.Clean(p)
+		files[p], _ = filepath.EvalSymlinks(p)
+
+		if dir := filepath.Dir(p); !dirs[dir] {
+			if err := watcher.Add(dir); err != nil {
+				watcher.Close()
+				return err
+			}
+			dirs[dir] = true
+		}
+	}
+
+	manager.watcher = watcher
+	go manager.watch(watcher, files)
+	return nil
+}
+
+// Stops watching configuration files.
+func (manager *Config) StopWatching() {
+	if manager.watcher != nil {
+		manager.watcher.Close()
+		manager.watcher = nil
+	}
+}
+
+func (manager *Config) watch(watcher *fsnotify.Watcher, files map[string]string) {
+	var changed string
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if path, ok := watchedChange(files, event); ok {
+				jww.DEBUG.Println("Config file changed:", event)
+				changed = path
+				settled = time.After(watchDebounce)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			jww.ERROR.Println("Error watching config files:", err)
+
+		case <-settled:
+			settled = nil
+
+			jww.INFO.Println("Reloading changed config file", changed)
+			report, err := manager.Reload()
+			if err != nil {
+				jww.ERROR.Println(err)
+			}
+
+			for _, fn := range manager.configChangeHandlers {
+				fn(Event{Path: changed, Report: report, Err: err})
+			}
+		}
+	}
+}
+
+// Reports which watched file, if any, an event in one of the watched
+// directories affects.
+func watchedChange(files map[string]string, event fsnotify.Event) (string, bool) {
+	name := filepath.Clean(event.Name)
+
+	if _, watched := files[name]; watched && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+		files[name], _ = filepath.EvalSymlinks(name)
+		return name, true
+	}
+
+	// A symlink further up may have been swapped, as with ConfigMap volumes.
+	for path, resolved := range files {
+		if filepath.Dir(path) != filepath.Dir(name) {
+			continue
+		}
+		if now, err := filepath.EvalSymlinks(path); err == nil && now != resolved {
+			files[path] = now
+			return path, true
+		}
+	}
+	return "", false
+}
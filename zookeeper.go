@@ -0,0 +1,205 @@
+package confer
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+
+	"github.com/spf13/cast"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"github.com/jacobstr/confer/maps"
+	"github.com/jacobstr/confer/reader"
+)
+
+// The ZooKeeper operations AddZooKeeperSource needs. Each returns a channel
+// that receives, or is closed, when the znode next changes, as ZooKeeper's
+// one-shot watches do. A github.com/go-zookeeper/zk connection is adapted
+// with a few lines:
+//
+//	func (c zkAdapter) GetW(path string) ([]byte, <-chan struct{}, error) {
+//		data, _, events, err := c.conn.GetW(path)
+//		return data, notify(events), err
+//	}
+type ZooKeeperClient interface {
+	// Returns the data held by the znode at path.
+	GetW(path string) ([]byte, <-chan struct{}, error)
+	// Returns the names of the children of the znode at path.
+	ChildrenW(path string) ([]string, <-chan struct{}, error)
+}
+
+// A znode added with AddZooKeeperSource.
+type zooKeeperSource struct {
+	client  ZooKeeperClient
+	path    string
+	data    map[string]interface{}
+	watches []<-chan struct{}
+	stop    chan struct{}
+	sourceHealth
+}
+
+// Loads configuration from the znode at path, for teams already running
+// ZooKeeper for service coordination, e.g:
+//
+//	err := config.AddZooKeeperSource(zk, "/services/billing")
+//
+// The znode's data is read as a YAML or JSON document. Its children are read
+// as a subtree: each becomes a key named after it, holding a section if it
+// has children or a document of its own, and its data as a string otherwise.
+// The result is merged on top of files along with object sources. Every
+// znode read is watched; when one changes the subtree is read again and goes
+// through the same pipeline as Reload. Stop watching with
+// StopZooKeeperSources.
+func (manager *Config) AddZooKeeperSource(client ZooKeeperClient, path string) error {
+	src := &zooKeeperSource{client: client, path: path, stop: make(chan struct{})}
+	if err := src.fetch(); err != nil {
+		return err
+	}
+	src.record(nil)
+
+	manager.addSource(func() {
+		manager.zooKeeperSources = append(manager.zooKeeperSources, src)
+	})
+
+	go manager.watchZooKeeperSource(src)
+	return nil
+}
+
+// Stops watching every ZooKeeper source. Their last read contents remain in
+// effect.
+func (manager *Config) StopZooKeeperSources() {
+	for _, src := range manager.zooKeeperSources {
+		select {
+		case <-src.stop:
+		default:
+			close(src.stop)
+		}
+	}
+}
+
+func (manager *Config) watchZooKeeperSource(src *zooKeeperSource) {
+	for {
+		if !src.wait() {
+			return
+		}
+
+		manager.reloadMu.Lock()
+		err := src.fetch()
+		manager.reloadMu.Unlock()
+		src.record(err)
+		if err != nil {
+			jww.ERROR.Println("Unable to refresh znode", src.path, err)
+			continue
+		}
+
+		jww.INFO.Println("Reloading changed znode", src.path)
+		if _, err := manager.reload(func() []error {
+			return manager.rebuildAttributes(false)
+		}); err != nil {
+			jww.ERROR.Println(err)
+		}
+	}
+}
+
+// Blocks until any watched znode changes. Returns false once stopped.
+func (src *zooKeeperSource) wait() bool {
+	changed := make(chan struct{}, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	for _, watch := range src.watches {
+		go func(watch <-chan struct{}) {
+			select {
+			case <-watch:
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			case <-done:
+			}
+		}(watch)
+	}
+
+	select {
+	case <-src.stop:
+		return false
+	case <-changed:
+		return true
+	}
+}
+
+// Reads the subtree, replacing the watches set by the previous read.
+func (src *zooKeeperSource) fetch() error {
+	src.watches = nil
+
+	data, err := src.read(src.path, true)
+	if err != nil {
+		return fmt.Errorf("Unable to read znode %s: %v", src.path, err)
+	}
+
+	parsed, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("Znode %s doesn't hold a document", src.path)
+	}
+	src.data = parsed
+	return nil
+}
+
+func (src *zooKeeperSource) read(znode string, root bool) (interface{}, error) {
+	data, watch, err := src.client.GetW(znode)
+	if err != nil {
+		return nil, err
+	}
+	src.watches = append(src.watches, watch)
+
+	children, watch, err := src.client.ChildrenW(znode)
+	if err != nil {
+		return nil, err
+	}
+	src.watches = append(src.watches, watch)
+
+	section := map[string]interface{}{}
+	if doc, ok := parseZnode(data); ok {
+		section = doc
+	} else if len(children) == 0 && !root {
+		return string(data), nil
+	} else if len(bytes.TrimSpace(data)) > 0 {
+		return nil, fmt.Errorf("%s holds neither YAML nor JSON", znode)
+	}
+
+	for _, child := range children {
+		val, err := src.read(path.Join(znode, child), false)
+		if err != nil {
+			return nil, err
+		}
+		existing, isMap := section[child].(map[string]interface{})
+		if m, ok := val.(map[string]interface{}); ok && isMap {
+			val = maps.Merge(maps.DeepCopy(existing).(map[string]interface{}), m)
+		}
+		section[child] = val
+	}
+	return section, nil
+}
+
+// Parses znode data as a YAML or JSON document.
+func parseZnode(data []byte) (map[string]interface{}, bool) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, false
+	}
+
+	format := reader.Sniff(data)
+	if format == string(reader.FormatTOML) {
+		format = string(reader.FormatYAML)
+	}
+
+	loaded, err := reader.ReadBytes(data, format)
+	if err != nil {
+		return nil, false
+	}
+	doc, err := cast.ToStringMapE(loaded)
+	if err != nil {
+		return nil, false
+	}
+	maps.ToStringMapRecursive(doc)
+	return doc, true
+}